@@ -2,30 +2,97 @@ package main
 
 import (
 	"log/slog"
-	"os"
+	"time"
+
+	"app/datasources/database"
+	"app/server"
+
+	"library/config"
+	"library/events"
+	"library/middleware"
+	"library/tracing"
 )
 
-// Configuration is used to store values from environment variables
+// Configuration is used to store the settings of the service, see config.Loader for
+// where they are read from
 type Configuration struct {
 	Port        string
 	DatabaseURL string
+	Pool        database.PoolConfig
+	// Server holds the HTTP timeouts, the origins allowed by CORS, the JWT key and the response cache
+	Server server.Config
+	// BookServiceURL is the base URL of book-service, e.g. http://book_app:3000
+	BookServiceURL string
+	// PhotoDir is the directory uploaded author photos are stored in
+	PhotoDir string
+	// PurgeRetention is how long deleted authors are kept, zero disables purging
+	PurgeRetention time.Duration
+	PurgeInterval  time.Duration
+	// Events selects where the outbox relay publishes domain events, an empty sink disables it
+	Events        events.Config
+	RelayInterval time.Duration
+	// LogLevel is the lowest level logged, debug also logs every database query
+	LogLevel slog.Level
+	// Tracing selects where spans are exported, an empty exporter disables tracing
+	Tracing tracing.Config
+	// HealthTimeout bounds every readiness check
+	HealthTimeout time.Duration
+	// DrainDelay is how long the service keeps serving once it reports draining on shutdown
+	DrainDelay time.Duration
+	// ShutdownTimeout is how long requests in flight are given to finish on shutdown
+	ShutdownTimeout time.Duration
 }
 
-// NewConfiguration reads environment variables and returns a new Configuration
-func NewConfiguration() *Configuration {
-	dbURL := getEnvOrDefault("DATABASE_URL", "")
+// NewConfiguration reads the settings of the service from loader and returns them,
+// along with every invalid one
+func NewConfiguration(loader *config.Loader) (*Configuration, error) {
+	dbURL := loader.String("database.url", "DATABASE_URL", "", config.SecretURL())
 	if dbURL == "" {
 		slog.Warn("DATABASE_URL is not set")
 	}
-	return &Configuration{
-		Port:        getEnvOrDefault("PORT", "3000"),
-		DatabaseURL: dbURL,
+	bookServiceURL := loader.String("book_service.url", "BOOK_SERVICE_URL", "")
+	if bookServiceURL == "" {
+		slog.Warn("BOOK_SERVICE_URL is not set, author bibliographies are unavailable and deleted authors are not purged")
 	}
-}
-
-func getEnvOrDefault(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+	conf := &Configuration{
+		Port:        loader.String("port", "PORT", "3000"),
+		DatabaseURL: dbURL,
+		Pool: database.PoolConfig{
+			MaxConns: loader.Int("database.max_conns", "DATABASE_MAX_CONNS", 0, config.Min(0)),
+			MinConns: loader.Int("database.min_conns", "DATABASE_MIN_CONNS", 0, config.Min(0)),
+		},
+		Server: server.Config{
+			ReadTimeout:  loader.Duration("server.read_timeout", "SERVER_READ_TIMEOUT_SECONDS", 0, time.Second, config.Min(time.Duration(0))),
+			WriteTimeout: loader.Duration("server.write_timeout", "SERVER_WRITE_TIMEOUT_SECONDS", 0, time.Second, config.Min(time.Duration(0))),
+			IdleTimeout:  loader.Duration("server.idle_timeout", "SERVER_IDLE_TIMEOUT_SECONDS", 0, time.Second, config.Min(time.Duration(0))),
+			CORSOrigins:  loader.Strings("cors.origins", "CORS_ALLOWED_ORIGINS", nil),
+			JWTKey:       loader.String("auth.jwt_key", "JWT_SIGNING_KEY", "", config.Secret()),
+			Cache: middleware.CacheConfig{
+				Expiration: loader.Duration("cache.expiration", "CACHE_EXPIRATION_SECONDS", 0, time.Second, config.Min(time.Duration(0))),
+				MaxBytes:   loader.Int("cache.max_bytes", "CACHE_MAX_BYTES", 16<<20, config.Min(0)),
+			},
+		},
+		BookServiceURL: bookServiceURL,
+		PhotoDir:       loader.String("photos.dir", "PHOTO_DIR", "photos"),
+		PurgeRetention: max(loader.Duration("purge.retention", "PURGE_RETENTION_DAYS", 30*24*time.Hour, 24*time.Hour), 0),
+		PurgeInterval:  loader.Duration("purge.interval", "PURGE_INTERVAL_MINUTES", time.Hour, time.Minute),
+		Events: events.Config{
+			Sink: loader.String("events.sink", "EVENT_SINK", "",
+				config.OneOf("", events.SinkWebhook, events.SinkNATS, events.SinkMemory)),
+			URL:           loader.String("events.url", "EVENT_SINK_URL", "", config.Secret()),
+			SubjectPrefix: loader.String("events.subject_prefix", "EVENT_SUBJECT_PREFIX", "library"),
+		},
+		RelayInterval:   loader.Duration("events.relay_interval", "EVENT_RELAY_INTERVAL_SECONDS", 5*time.Second, time.Second),
+		LogLevel:        loader.Level("log.level", "LOG_LEVEL", slog.LevelInfo),
+		HealthTimeout:   loader.Duration("health.timeout", "HEALTH_CHECK_TIMEOUT_SECONDS", 2*time.Second, time.Second, config.Min(time.Millisecond)),
+		DrainDelay:      loader.Duration("shutdown.drain_delay", "SHUTDOWN_DRAIN_DELAY_SECONDS", 5*time.Second, time.Second, config.Min(time.Duration(0))),
+		ShutdownTimeout: loader.Duration("shutdown.timeout", "SHUTDOWN_TIMEOUT_SECONDS", 20*time.Second, time.Second, config.Min(time.Millisecond)),
+		Tracing: tracing.Config{
+			Exporter: loader.String("tracing.exporter", "TRACE_EXPORTER", "",
+				config.OneOf("", tracing.ExporterOTLP, tracing.ExporterStdout, tracing.ExporterMemory)),
+			Endpoint: loader.String("tracing.endpoint", "OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			Service:  loader.String("tracing.service", "OTEL_SERVICE_NAME", "author-service"),
+		},
 	}
-	return defaultValue
+	return conf, loader.Err()
 }
@@ -0,0 +1,220 @@
+package books
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"library/tracing"
+)
+
+// defaultTimeout bounds a single call to book-service
+const defaultTimeout = 5 * time.Second
+
+// Headers book-service reads the caller of a request from
+const (
+	headerUserRole  = "X-User-Role"
+	headerUserID    = "X-User-ID"
+	headerRequestID = "X-Request-ID"
+)
+
+// Caller is the user a call to book-service is made for. Its headers are forwarded,
+// so book-service authorizes and audits the call as that user. Token is the bearer
+// token the caller authenticated with, for a book-service that checks tokens.
+type Caller struct {
+	UserID    string
+	Role      string
+	RequestID string
+	Token     string
+}
+
+type callerKey struct{}
+
+// WithCaller returns a copy of ctx whose calls to book-service are made for caller
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the caller carried by ctx, the zero Caller if there is none
+func CallerFromContext(ctx context.Context) Caller {
+	caller, _ := ctx.Value(callerKey{}).(Caller)
+	return caller
+}
+
+// Book is a book as listed by book-service
+type Book struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	ISBN        string    `json:"isbn"`
+	ISBN10      string    `json:"isbn10,omitempty"`
+	AuthorID    int       `json:"author_id"`
+	CategoryID  int       `json:"category_id"`
+	PublishDate time.Time `json:"publish_date"`
+	Description string    `json:"description"`
+}
+
+// BooksPage is one page of a book listing, NextCursor is empty on the last page
+type BooksPage struct {
+	Books      []Book `json:"books"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// PageQuery selects a page, the fields are passed through to book-service as is
+type PageQuery struct {
+	Sort  string
+	After string
+	Limit int
+}
+
+// AuthorStats sums up the books of an author
+type AuthorStats struct {
+	Titles          int `json:"titles"`
+	TotalCopies     int `json:"total_copies"`
+	AvailableCopies int `json:"available_copies"`
+	ActiveLoans     int `json:"active_loans"`
+}
+
+// StatusError is a response of book-service other than 200 OK
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("book-service responded %d: %s", e.StatusCode, e.Message)
+}
+
+// Client reads the books of authors from book-service
+type Client interface {
+	ListAuthorBooks(ctx context.Context, authorID int, query PageQuery) (BooksPage, error)
+	GetAuthorStats(ctx context.Context, authorID int) (AuthorStats, error)
+	// ReassignAuthorBooks moves every book of an author to another author
+	// and returns how many were moved
+	ReassignAuthorBooks(ctx context.Context, fromAuthorID, toAuthorID int) (int, error)
+}
+
+type httpClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewClient creates a Client for the book-service API at baseURL, e.g. http://book_app:3000
+func NewClient(baseURL string) Client {
+	return &httpClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: defaultTimeout, Transport: tracing.NewTransport(nil)},
+	}
+}
+
+func (c *httpClient) ListAuthorBooks(ctx context.Context, authorID int, query PageQuery) (BooksPage, error) {
+	params := url.Values{}
+	if query.Sort != "" {
+		params.Set("sort", query.Sort)
+	}
+	if query.After != "" {
+		params.Set("after", query.After)
+	}
+	if query.Limit > 0 {
+		params.Set("limit", strconv.Itoa(query.Limit))
+	}
+
+	var page BooksPage
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/authors/%d/books", authorID), params, nil, &page); err != nil {
+		return BooksPage{}, err
+	}
+	return page, nil
+}
+
+func (c *httpClient) GetAuthorStats(ctx context.Context, authorID int) (AuthorStats, error) {
+	var stats AuthorStats
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/authors/%d/stats", authorID), nil, nil, &stats); err != nil {
+		return AuthorStats{}, err
+	}
+	return stats, nil
+}
+
+func (c *httpClient) ReassignAuthorBooks(ctx context.Context, fromAuthorID, toAuthorID int) (int, error) {
+	body := struct {
+		ToAuthorID int `json:"to_author_id"`
+	}{toAuthorID}
+	var result struct {
+		Reassigned int `json:"reassigned"`
+	}
+	path := fmt.Sprintf("/api/v1/authors/%d/books/reassign", fromAuthorID)
+	if err := c.do(ctx, http.MethodPost, path, nil, body, &result); err != nil {
+		return 0, err
+	}
+	return result.Reassigned, nil
+}
+
+// do sends body as JSON, if set, and decodes the JSON response into out
+func (c *httpClient) do(ctx context.Context, method, path string, params url.Values, body, out any) error {
+	target := c.baseURL + path
+	if len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode book-service request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build book-service request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	caller := CallerFromContext(ctx)
+	for header, value := range map[string]string{
+		headerUserRole:  caller.Role,
+		headerUserID:    caller.UserID,
+		headerRequestID: caller.RequestID,
+	} {
+		if value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+	if caller.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+caller.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call book-service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+			body.Error = http.StatusText(resp.StatusCode)
+		}
+		return &StatusError{StatusCode: resp.StatusCode, Message: body.Error}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode book-service response: %w", err)
+	}
+	return nil
+}
+
+// IsClientError reports whether book-service rejected the request itself,
+// e.g. because of an invalid cursor or sort
+func IsClientError(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500
+}
@@ -0,0 +1,26 @@
+package books
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type ClientMock struct {
+	mock.Mock
+}
+
+func (m *ClientMock) ListAuthorBooks(ctx context.Context, authorID int, query PageQuery) (BooksPage, error) {
+	args := m.Called(ctx, authorID, query)
+	return args.Get(0).(BooksPage), args.Error(1)
+}
+
+func (m *ClientMock) GetAuthorStats(ctx context.Context, authorID int) (AuthorStats, error) {
+	args := m.Called(ctx, authorID)
+	return args.Get(0).(AuthorStats), args.Error(1)
+}
+
+func (m *ClientMock) ReassignAuthorBooks(ctx context.Context, fromAuthorID, toAuthorID int) (int, error) {
+	args := m.Called(ctx, fromAuthorID, toAuthorID)
+	return args.Int(0), args.Error(1)
+}
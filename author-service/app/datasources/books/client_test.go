@@ -0,0 +1,87 @@
+package books
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_ListAuthorBooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/authors/7/books", r.URL.Path)
+		assert.Equal(t, "-published_date", r.URL.Query().Get("sort"))
+		assert.Equal(t, "abc", r.URL.Query().Get("after"))
+		assert.Equal(t, "5", r.URL.Query().Get("limit"))
+		_, _ = w.Write([]byte(`{"books":[{"id":1,"title":"Frankenstein","author_id":7}],"next_cursor":"def"}`))
+	}))
+	defer server.Close()
+
+	page, err := NewClient(server.URL+"/").ListAuthorBooks(context.Background(), 7, PageQuery{Sort: "-published_date", After: "abc", Limit: 5})
+	require.NoError(t, err)
+	require.Len(t, page.Books, 1)
+	assert.Equal(t, "Frankenstein", page.Books[0].Title)
+	assert.Equal(t, "def", page.NextCursor)
+}
+
+func TestClient_GetAuthorStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/authors/7/stats", r.URL.Path)
+		assert.Empty(t, r.Header.Get("X-User-Role"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"author_id":7,"titles":3,"total_copies":12,"available_copies":10,"active_loans":2}`))
+	}))
+	defer server.Close()
+
+	stats, err := NewClient(server.URL).GetAuthorStats(context.Background(), 7)
+	require.NoError(t, err)
+	assert.Equal(t, AuthorStats{Titles: 3, TotalCopies: 12, AvailableCopies: 10, ActiveLoans: 2}, stats)
+}
+
+func TestClient_ReassignAuthorBooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/v1/authors/7/books/reassign", r.URL.Path)
+		assert.Equal(t, "admin", r.Header.Get("X-User-Role"))
+		assert.Equal(t, "42", r.Header.Get("X-User-ID"))
+		assert.Equal(t, "req-1", r.Header.Get("X-Request-ID"))
+		assert.Equal(t, "Bearer tok", r.Header.Get("Authorization"))
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"to_author_id":9}`, string(body))
+		_, _ = w.Write([]byte(`{"from_author_id":7,"to_author_id":9,"reassigned":3}`))
+	}))
+	defer server.Close()
+
+	ctx := WithCaller(context.Background(), Caller{UserID: "42", Role: "admin", RequestID: "req-1", Token: "tok"})
+	moved, err := NewClient(server.URL).ReassignAuthorBooks(ctx, 7, 9)
+	require.NoError(t, err)
+	assert.Equal(t, 3, moved)
+}
+
+func TestClient_StatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid cursor"}`))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL).ListAuthorBooks(context.Background(), 7, PageQuery{After: "broken"})
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, "invalid cursor", statusErr.Message)
+	assert.True(t, IsClientError(err))
+}
+
+func TestClient_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	_, err := NewClient(server.URL).GetAuthorStats(context.Background(), 7)
+	assert.ErrorContains(t, err, "failed to call book-service")
+	assert.False(t, IsClientError(err))
+}
@@ -1,9 +1,17 @@
 package datasources
 
-import "app/datasources/database"
+import (
+	"app/datasources/books"
+	"app/datasources/database"
+	"app/datasources/photos"
+)
 
 // DataSources is a struct that contains all the data sources
 // It is used to pass different data sources to the server and services
 type DataSources struct {
 	DB database.Database
+	// Books is nil when no book-service is configured
+	Books books.Client
+	// Photos keeps the uploaded author photos
+	Photos photos.Store
 }
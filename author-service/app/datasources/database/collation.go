@@ -0,0 +1,29 @@
+package database
+
+import (
+	"strings"
+	"sync"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// textCollator orders strings like "en-US-x-icu", the collation of the text
+// columns listings sort by, so the in-memory backend pages in the same order
+var textCollator = struct {
+	// a Collator reuses internal buffers, so comparisons are serialized
+	sync.Mutex
+	*collate.Collator
+}{Collator: collate.New(language.AmericanEnglish)}
+
+// compareText compares strings like the "en-US-x-icu" collation. Strings the collation
+// considers equal are ordered byte-wise, as PostgreSQL does for deterministic collations.
+func compareText(a, b string) int {
+	textCollator.Lock()
+	c := textCollator.CompareString(a, b)
+	textCollator.Unlock()
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
@@ -2,6 +2,8 @@ package database
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"regexp"
@@ -9,42 +11,240 @@ import (
 	"time"
 )
 
+var ErrAuthorNotFound = errors.New("author not found")
+
 type Author struct {
-	ID          int        `db:"id"`
-	FirstName   string     `db:"first_name"`
-	LastName    string     `db:"last_name"`
-	BirthDate   *time.Time `db:"birth_date"`
-	Nationality string     `db:"nationality"`
-	CreatedAt   time.Time  `db:"created_at"`
-	UpdatedAt   time.Time  `db:"updated_at"`
+	ID            int        `db:"id"`
+	FirstName     string     `db:"first_name"`
+	LastName      string     `db:"last_name"`
+	BirthDate     *time.Time `db:"birth_date"`
+	DeathDate     *time.Time `db:"death_date"`
+	Nationality   string     `db:"nationality"`
+	Bio           string     `db:"bio"`
+	Website       string     `db:"website"`
+	PhotoURL      string     `db:"photo_url"`
+	ORCID         string     `db:"orcid"`
+	VIAF          string     `db:"viaf"`
+	OpenLibraryID string     `db:"open_library_id"`
+	CreatedAt     time.Time  `db:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at"`
+	// DeletedAt is set once the author is soft deleted
+	DeletedAt *time.Time `db:"deleted_at"`
 }
 
 type NewAuthor struct {
-	FirstName   string     `db:"first_name"`
-	LastName    string     `db:"last_name"`
-	BirthDate   *time.Time `db:"birth_date"`
-	Nationality string     `db:"nationality"`
+	FirstName     string     `db:"first_name"`
+	LastName      string     `db:"last_name"`
+	BirthDate     *time.Time `db:"birth_date"`
+	DeathDate     *time.Time `db:"death_date"`
+	Nationality   string     `db:"nationality"`
+	Bio           string     `db:"bio"`
+	Website       string     `db:"website"`
+	PhotoURL      string     `db:"photo_url"`
+	ORCID         string     `db:"orcid"`
+	VIAF          string     `db:"viaf"`
+	OpenLibraryID string     `db:"open_library_id"`
+}
+
+// AuthorFilter narrows an author listing, every set field must match
+type AuthorFilter struct {
+	// FirstName and LastName match names containing the text, ignoring case
+	FirstName string
+	LastName  string
+	// Name matches "first_name last_name" containing the text, ignoring case
+	Name string
+	// Nationality matches exactly
+	Nationality string
+	// BornFrom and BornTo bound the birth year, inclusive. Authors without
+	// a birth date never match a bound.
+	BornFrom int
+	BornTo   int
+	// IncludeDeleted lists soft deleted authors as well
+	IncludeDeleted bool
+}
+
+func (f AuthorFilter) matches(author Author) bool {
+	contains := func(value, part string) bool {
+		return part == "" || strings.Contains(strings.ToLower(value), strings.ToLower(part))
+	}
+	if !contains(author.FirstName, f.FirstName) ||
+		!contains(author.LastName, f.LastName) ||
+		!contains(author.FirstName+" "+author.LastName, f.Name) {
+		return false
+	}
+	if f.Nationality != "" && author.Nationality != f.Nationality {
+		return false
+	}
+	if f.BornFrom != 0 && (author.BirthDate == nil || author.BirthDate.Year() < f.BornFrom) {
+		return false
+	}
+	if f.BornTo != 0 && (author.BirthDate == nil || author.BirthDate.Year() > f.BornTo) {
+		return false
+	}
+	return f.IncludeDeleted || author.DeletedAt == nil
+}
+
+// AuditEntry is a write recorded in the audit log. Changes is a JSON object
+// holding the before and after value of every field the write changed.
+type AuditEntry struct {
+	ID        int64           `db:"id"`
+	Actor     string          `db:"actor"`
+	ActorRole string          `db:"actor_role"`
+	Action    string          `db:"action"`
+	Entity    string          `db:"entity"`
+	EntityID  int             `db:"entity_id"`
+	Changes   json.RawMessage `db:"changes"`
+	RequestID string          `db:"request_id"`
+	CreatedAt time.Time       `db:"created_at"`
+}
+
+type NewAuditEntry struct {
+	Actor     string
+	ActorRole string
+	Action    string
+	Entity    string
+	EntityID  int
+	Changes   json.RawMessage
+	RequestID string
+}
+
+// AuditFilter narrows the audit log, every set field must match
+type AuditFilter struct {
+	Entity   string
+	EntityID int
+	Actor    string
+}
+
+func (f AuditFilter) matches(entry AuditEntry) bool {
+	return (f.Entity == "" || entry.Entity == f.Entity) &&
+		(f.EntityID == 0 || entry.EntityID == f.EntityID) &&
+		(f.Actor == "" || entry.Actor == f.Actor)
 }
 
+// Event types written to the outbox
+const (
+	EventAuthorCreated  = "author.created"
+	EventAuthorUpdated  = "author.updated"
+	EventAuthorDeleted  = "author.deleted"
+	EventAuthorRestored = "author.restored"
+	// EventAuthorRemoved follows a permanent delete, the author is gone for good
+	EventAuthorRemoved = "author.removed"
+)
+
+// OutboxEvent is a domain event written in the same transaction as the change it
+// describes. PublishedAt is set once the relay delivered it.
+type OutboxEvent struct {
+	ID          int64           `db:"id"`
+	Type        string          `db:"event_type"`
+	AggregateID int             `db:"aggregate_id"`
+	Payload     json.RawMessage `db:"payload"`
+	CreatedAt   time.Time       `db:"created_at"`
+	PublishedAt *time.Time      `db:"published_at"`
+}
+
+// authorEvent is the payload of the author.created, author.updated and author.restored events
+type authorEvent struct {
+	ID            int        `json:"id"`
+	FirstName     string     `json:"first_name"`
+	LastName      string     `json:"last_name"`
+	BirthDate     *time.Time `json:"birth_date,omitempty"`
+	DeathDate     *time.Time `json:"death_date,omitempty"`
+	Nationality   string     `json:"nationality"`
+	Bio           string     `json:"bio"`
+	Website       string     `json:"website"`
+	PhotoURL      string     `json:"photo_url"`
+	ORCID         string     `json:"orcid"`
+	VIAF          string     `json:"viaf"`
+	OpenLibraryID string     `json:"open_library_id"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func newAuthorEvent(author Author) authorEvent {
+	return authorEvent{
+		ID:            author.ID,
+		FirstName:     author.FirstName,
+		LastName:      author.LastName,
+		BirthDate:     author.BirthDate,
+		DeathDate:     author.DeathDate,
+		Nationality:   author.Nationality,
+		Bio:           author.Bio,
+		Website:       author.Website,
+		PhotoURL:      author.PhotoURL,
+		ORCID:         author.ORCID,
+		VIAF:          author.VIAF,
+		OpenLibraryID: author.OpenLibraryID,
+		UpdatedAt:     author.UpdatedAt,
+	}
+}
+
+// authorRef is the payload of the author.deleted and author.removed events
+type authorRef struct {
+	ID int `json:"id"`
+}
+
+// newEvent encodes the payload of an event about the given author
+func newEvent(eventType string, authorID int, payload any) (OutboxEvent, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return OutboxEvent{}, fmt.Errorf("unable to encode %s event: %v", eventType, err)
+	}
+	return OutboxEvent{Type: eventType, AggregateID: authorID, Payload: encoded}, nil
+}
+
+// Database keeps the authors. Soft deleted authors are left out of every method
+// except DeleteAuthor, RestoreAuthor, DeletedAuthorIDs and listings with
+// AuthorFilter.IncludeDeleted, as if they did not exist.
 type Database interface {
-	AddAuthor(ctx context.Context, author NewAuthor) error
+	AddAuthor(ctx context.Context, author NewAuthor) (Author, error)
 	UpdateAuthor(ctx context.Context, author Author) error
+	// SetAuthorPhoto only replaces the photo URL of an author
+	SetAuthorPhoto(ctx context.Context, id int, photoURL string) error
+	// DeleteAuthor removes an author for good
 	DeleteAuthor(ctx context.Context, id int) error
+	// SoftDeleteAuthor hides an author but keeps the row, so references to it stay valid
+	SoftDeleteAuthor(ctx context.Context, id int) error
+	// RestoreAuthor clears the deletion mark, ErrAuthorNotFound is returned if the author is not soft deleted
+	RestoreAuthor(ctx context.Context, id int) error
+	// DeletedAuthorIDs returns the authors soft deleted before the given time
+	DeletedAuthorIDs(ctx context.Context, before time.Time) ([]int, error)
 	GetAuthor(ctx context.Context, id int) (Author, error)
-	ListAuthor(ctx context.Context, filter Author, limit, offset int) ([]Author, error)
+	// ListAuthor returns up to limit authors in sort order, starting after the cursor if set.
+	// Sort fields must be whitelisted, ErrInvalidSort is returned otherwise.
+	ListAuthor(ctx context.Context, filter AuthorFilter, sort []SortField, after *Cursor, limit int) ([]Author, error)
+	// WithinTx runs fn in a single transaction, the changes made through the context
+	// given to fn are committed together when it returns nil and rolled back otherwise
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+	// AddAuditEntry appends an entry to the audit log, entries are never changed or removed
+	AddAuditEntry(ctx context.Context, entry NewAuditEntry) error
+	// ListAuditEntries returns the audit log newest first
+	ListAuditEntries(ctx context.Context, filter AuditFilter, limit, offset int) ([]AuditEntry, error)
+	// PendingEvents returns up to limit outbox events not published yet, oldest first.
+	// Every author write adds one in the same transaction.
+	PendingEvents(ctx context.Context, limit int) ([]OutboxEvent, error)
+	// MarkEventPublished records that the outbox event was delivered
+	MarkEventPublished(ctx context.Context, id int64) error
+
+	// Ping checks that the database can be reached
+	Ping(ctx context.Context) error
 
 	CloseConnections()
 }
 
 // NewDatabase creates a new Database instance
-func NewDatabase(ctx context.Context, databaseURL string) (Database, error) {
+// PoolConfig sizes the PostgreSQL connection pool, zero values keep the pgx defaults
+type PoolConfig struct {
+	MaxConns int
+	MinConns int
+}
+
+func NewDatabase(ctx context.Context, databaseURL string, pool PoolConfig) (Database, error) {
 	if databaseURL == "" {
 		slog.Info("Using in-memory database implementation")
 		return newMemoryDB(), nil
 	}
 
 	if strings.HasPrefix(databaseURL, "postgres://") {
-		db, err := newPostgresDB(ctx, databaseURL)
+		db, err := newPostgresDB(ctx, databaseURL, pool)
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize PostgreSQL database connection: %w", err)
 		}
@@ -2,6 +2,8 @@ package database
 
 import (
 	"context"
+	"time"
+
 	"github.com/stretchr/testify/mock"
 )
 
@@ -9,28 +11,77 @@ type DatabaseMock struct {
 	mock.Mock
 }
 
-func (m *DatabaseMock) AddAuthor(ctx context.Context, author NewAuthor) error {
-	return m.Called(ctx, author).Error(0)
+func (m *DatabaseMock) AddAuthor(ctx context.Context, author NewAuthor) (Author, error) {
+	args := m.Called(ctx, author)
+	return args.Get(0).(Author), args.Error(1)
 }
 
 func (m *DatabaseMock) UpdateAuthor(ctx context.Context, author Author) error {
 	return m.Called(ctx, author).Error(0)
 }
 
+func (m *DatabaseMock) SetAuthorPhoto(ctx context.Context, id int, photoURL string) error {
+	return m.Called(ctx, id, photoURL).Error(0)
+}
+
 func (m *DatabaseMock) DeleteAuthor(ctx context.Context, id int) error {
 	return m.Called(ctx, id).Error(0)
 }
 
+func (m *DatabaseMock) SoftDeleteAuthor(ctx context.Context, id int) error {
+	return m.Called(ctx, id).Error(0)
+}
+
+func (m *DatabaseMock) RestoreAuthor(ctx context.Context, id int) error {
+	return m.Called(ctx, id).Error(0)
+}
+
+func (m *DatabaseMock) PendingEvents(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	args := m.Called(ctx, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]OutboxEvent), args.Error(1)
+}
+
+func (m *DatabaseMock) MarkEventPublished(ctx context.Context, id int64) error {
+	return m.Called(ctx, id).Error(0)
+}
+
+func (m *DatabaseMock) DeletedAuthorIDs(ctx context.Context, before time.Time) ([]int, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).([]int), args.Error(1)
+}
+
 func (m *DatabaseMock) GetAuthor(ctx context.Context, id int) (Author, error) {
 	args := m.Called(ctx, id)
 	return args.Get(0).(Author), args.Error(1)
 }
 
-func (m *DatabaseMock) ListAuthor(ctx context.Context, filter Author, limit, offset int) ([]Author, error) {
-	args := m.Called(ctx, filter, limit, offset)
+func (m *DatabaseMock) ListAuthor(ctx context.Context, filter AuthorFilter, sort []SortField, after *Cursor, limit int) ([]Author, error) {
+	args := m.Called(ctx, filter, sort, after, limit)
 	return args.Get(0).([]Author), args.Error(1)
 }
 
+func (m *DatabaseMock) Ping(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
 func (m *DatabaseMock) CloseConnections() {
 	m.Called()
 }
+
+// WithinTx runs fn directly, the calls it makes are matched like any other
+func (m *DatabaseMock) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (m *DatabaseMock) AddAuditEntry(ctx context.Context, entry NewAuditEntry) error {
+	return m.Called(ctx, entry).Error(0)
+}
+
+func (m *DatabaseMock) ListAuditEntries(ctx context.Context, filter AuditFilter, limit, offset int) ([]AuditEntry, error) {
+	args := m.Called(ctx, filter, limit, offset)
+	return args.Get(0).([]AuditEntry), args.Error(1)
+}
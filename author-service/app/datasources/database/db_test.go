@@ -1,29 +1,97 @@
 package database
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
 	"reflect"
 	"testing"
+	"time"
 
+	"library/logging"
+	"library/tracing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 func TestNewDatabase_MemoryDB(t *testing.T) {
 	ctx := context.Background()
-	db, err := NewDatabase(ctx, "")
+	db, err := NewDatabase(ctx, "", PoolConfig{})
 	assert.Nil(t, err)
 	assert.Equal(t, "*database.memoryDB", reflect.TypeOf(db).String())
 }
 
 func TestNewDatabase_PostgresDB(t *testing.T) {
 	ctx := context.Background()
-	db, err := NewDatabase(ctx, "postgres://localhost:5432")
+	db, err := NewDatabase(ctx, "postgres://localhost:5432", PoolConfig{})
 	assert.Nil(t, err)
 	assert.Equal(t, "*database.postgresDB", reflect.TypeOf(db).String())
 }
 
+func TestNewDatabase_PoolConfig(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewDatabase(ctx, "postgres://localhost:5432", PoolConfig{MaxConns: 7, MinConns: 2})
+	assert.Nil(t, err)
+	defer db.CloseConnections()
+
+	config := db.(*postgresDB).pool.(*pgxpool.Pool).Config()
+	assert.Equal(t, int32(7), config.MaxConns)
+	assert.Equal(t, int32(2), config.MinConns)
+}
+
 func TestNewDatabase_InvalidDatabaseConfiguration(t *testing.T) {
 	ctx := context.Background()
-	_, err := NewDatabase(ctx, "invalid")
+	_, err := NewDatabase(ctx, "invalid", PoolConfig{})
 	assert.ErrorContains(t, err, "unsupported database")
 }
+
+func TestQueryTracer(t *testing.T) {
+	var logs bytes.Buffer
+	ctx := logging.WithLogger(context.Background(), logging.New(&logs, slog.LevelDebug).With("request_id", "req-1"))
+
+	tracer := queryTracer{slow: time.Hour}
+	queryCtx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{})
+
+	var entry map[string]any
+	assert.Nil(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, "DEBUG", entry["level"])
+	assert.Equal(t, "query", entry["msg"])
+	assert.Equal(t, "SELECT 1", entry["sql"])
+	assert.Equal(t, "req-1", entry["request_id"])
+
+	logs.Reset()
+	tracer = queryTracer{slow: 0}
+	queryCtx = tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+
+	assert.Nil(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, "boom", entry["error"])
+}
+
+func TestQueryTracer_Span(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracing.SetDefault(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer tracing.SetDefault(noop.NewTracerProvider())
+
+	ctx, parent := tracing.Start(context.Background(), "GET /api/v1/authors/:id")
+	queryCtx := queryTracer{slow: time.Hour}.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "\n\t\tselect id FROM authors"})
+	queryTracer{slow: time.Hour}.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "SELECT", spans[0].Name())
+	assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, sdktrace.Status{Code: codes.Error, Description: "boom"}, spans[0].Status())
+}
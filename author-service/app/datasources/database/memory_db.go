@@ -1,6 +1,11 @@
 package database
 
-import "context"
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
 
 func newMemoryDB() Database {
 	return &memoryDB{
@@ -10,34 +15,268 @@ func newMemoryDB() Database {
 }
 
 type memoryDB struct {
+	mu        sync.Mutex
 	records   []Author
+	audit     []AuditEntry
+	outbox    []OutboxEvent
 	idCounter int
 }
 
-func (db *memoryDB) AddAuthor(ctx context.Context, author NewAuthor) error {
-	//TODO implement me
-	panic("implement me")
+func (db *memoryDB) AddAuthor(ctx context.Context, author NewAuthor) (Author, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.idCounter++
+	now := time.Now()
+	created := Author{
+		ID:            db.idCounter,
+		FirstName:     author.FirstName,
+		LastName:      author.LastName,
+		BirthDate:     author.BirthDate,
+		DeathDate:     author.DeathDate,
+		Nationality:   author.Nationality,
+		Bio:           author.Bio,
+		Website:       author.Website,
+		PhotoURL:      author.PhotoURL,
+		ORCID:         author.ORCID,
+		VIAF:          author.VIAF,
+		OpenLibraryID: author.OpenLibraryID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := db.addEvent(EventAuthorCreated, created.ID, newAuthorEvent(created)); err != nil {
+		return Author{}, err
+	}
+	db.records = append(db.records, created)
+	return created, nil
 }
 
 func (db *memoryDB) UpdateAuthor(ctx context.Context, author Author) error {
-	//TODO implement me
-	panic("implement me")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.find(author.ID)
+	if i < 0 {
+		return ErrAuthorNotFound
+	}
+	stored := &db.records[i]
+	stored.FirstName = author.FirstName
+	stored.LastName = author.LastName
+	stored.BirthDate = author.BirthDate
+	stored.DeathDate = author.DeathDate
+	stored.Nationality = author.Nationality
+	stored.Bio = author.Bio
+	stored.Website = author.Website
+	stored.PhotoURL = author.PhotoURL
+	stored.ORCID = author.ORCID
+	stored.VIAF = author.VIAF
+	stored.OpenLibraryID = author.OpenLibraryID
+	stored.UpdatedAt = time.Now()
+	return db.addEvent(EventAuthorUpdated, stored.ID, newAuthorEvent(*stored))
+}
+
+func (db *memoryDB) SetAuthorPhoto(ctx context.Context, id int, photoURL string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.find(id)
+	if i < 0 {
+		return ErrAuthorNotFound
+	}
+	db.records[i].PhotoURL = photoURL
+	db.records[i].UpdatedAt = time.Now()
+	return db.addEvent(EventAuthorUpdated, id, newAuthorEvent(db.records[i]))
 }
 
 func (db *memoryDB) DeleteAuthor(ctx context.Context, id int) error {
-	//TODO implement me
-	panic("implement me")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := slices.IndexFunc(db.records, func(a Author) bool { return a.ID == id })
+	if i < 0 {
+		return ErrAuthorNotFound
+	}
+	db.records = slices.Delete(db.records, i, i+1)
+	return db.addEvent(EventAuthorRemoved, id, authorRef{ID: id})
+}
+
+func (db *memoryDB) SoftDeleteAuthor(ctx context.Context, id int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.find(id)
+	if i < 0 {
+		return ErrAuthorNotFound
+	}
+	now := time.Now()
+	db.records[i].DeletedAt = &now
+	return db.addEvent(EventAuthorDeleted, id, authorRef{ID: id})
+}
+
+func (db *memoryDB) RestoreAuthor(ctx context.Context, id int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := slices.IndexFunc(db.records, func(a Author) bool { return a.ID == id && a.DeletedAt != nil })
+	if i < 0 {
+		return ErrAuthorNotFound
+	}
+	db.records[i].DeletedAt = nil
+	db.records[i].UpdatedAt = time.Now()
+	return db.addEvent(EventAuthorRestored, id, newAuthorEvent(db.records[i]))
+}
+
+func (db *memoryDB) DeletedAuthorIDs(ctx context.Context, before time.Time) ([]int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	ids := []int{}
+	for _, author := range db.records {
+		if author.DeletedAt != nil && author.DeletedAt.Before(before) {
+			ids = append(ids, author.ID)
+		}
+	}
+	return ids, nil
 }
 
 func (db *memoryDB) GetAuthor(ctx context.Context, id int) (Author, error) {
-	//TODO implement me
-	panic("implement me")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.find(id)
+	if i < 0 {
+		return Author{}, ErrAuthorNotFound
+	}
+	return db.records[i], nil
+}
+
+// ListAuthor mirrors the PostgreSQL listing, strings compare like the text columns of the database
+func (db *memoryDB) ListAuthor(ctx context.Context, filter AuthorFilter, sort []SortField, after *Cursor, limit int) ([]Author, error) {
+	keys, err := resolveSort(authorSortColumns, sort)
+	if err != nil {
+		return nil, err
+	}
+	var values []any
+	if after != nil {
+		if values, err = cursorValues(keys, *after); err != nil {
+			return nil, err
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	authors := make([]Author, 0, len(db.records))
+	for _, author := range db.records {
+		if !filter.matches(author) {
+			continue
+		}
+		if after != nil && compareKeyset(keys, author, author.ID, values, after.ID) <= 0 {
+			continue
+		}
+		authors = append(authors, author)
+	}
+
+	slices.SortFunc(authors, func(a, b Author) int {
+		return compareKeyset(keys, a, a.ID, rowValues(keys, b), b.ID)
+	})
+	if limit > 0 && limit < len(authors) {
+		authors = authors[:limit]
+	}
+	return authors, nil
 }
 
-func (db *memoryDB) ListAuthor(ctx context.Context, filter Author, limit, offset int) ([]Author, error) {
-	//TODO implement me
-	panic("implement me")
+func (db *memoryDB) Ping(context.Context) error {
+	return nil
 }
 
 func (db *memoryDB) CloseConnections() {
 }
+
+// find returns the index of the author in records or -1, soft deleted authors are not found
+func (db *memoryDB) find(id int) int {
+	return slices.IndexFunc(db.records, func(a Author) bool { return a.ID == id && a.DeletedAt == nil })
+}
+
+// WithinTx runs fn directly, the memory database applies every change on its own
+// and has nothing to roll back
+func (db *memoryDB) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (db *memoryDB) AddAuditEntry(ctx context.Context, entry NewAuditEntry) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.audit = append(db.audit, AuditEntry{
+		ID:        int64(len(db.audit) + 1),
+		Actor:     entry.Actor,
+		ActorRole: entry.ActorRole,
+		Action:    entry.Action,
+		Entity:    entry.Entity,
+		EntityID:  entry.EntityID,
+		Changes:   slices.Clone(entry.Changes),
+		RequestID: entry.RequestID,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (db *memoryDB) ListAuditEntries(ctx context.Context, filter AuditFilter, limit, offset int) ([]AuditEntry, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	entries := []AuditEntry{}
+	for i := len(db.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		if !filter.matches(db.audit[i]) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		entries = append(entries, db.audit[i])
+	}
+	return entries, nil
+}
+
+// addEvent appends an event to the outbox, the caller holds db.mu
+func (db *memoryDB) addEvent(eventType string, authorID int, payload any) error {
+	event, err := newEvent(eventType, authorID, payload)
+	if err != nil {
+		return err
+	}
+	event.ID = int64(len(db.outbox) + 1)
+	event.CreatedAt = time.Now()
+	db.outbox = append(db.outbox, event)
+	return nil
+}
+
+func (db *memoryDB) PendingEvents(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	events := []OutboxEvent{}
+	for _, event := range db.outbox {
+		if len(events) == limit {
+			break
+		}
+		if event.PublishedAt == nil {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (db *memoryDB) MarkEventPublished(ctx context.Context, id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i := range db.outbox {
+		if db.outbox[i].ID == id {
+			now := time.Now()
+			db.outbox[i].PublishedAt = &now
+		}
+	}
+	return nil
+}
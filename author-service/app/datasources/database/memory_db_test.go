@@ -1 +1,277 @@
 package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryDB_AddAndGetAuthor(t *testing.T) {
+	db := newMemoryDB()
+	created, err := db.AddAuthor(context.Background(), NewAuthor{FirstName: "Jane", LastName: "Austen"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, created.ID)
+
+	author, err := db.GetAuthor(context.Background(), created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Austen", author.LastName)
+
+	_, err = db.GetAuthor(context.Background(), 99)
+	assert.ErrorIs(t, err, ErrAuthorNotFound)
+}
+
+func TestMemoryDB_UpdateAndDeleteAuthor(t *testing.T) {
+	db := newMemoryDB()
+	created, err := db.AddAuthor(context.Background(), NewAuthor{FirstName: "Jane", LastName: "Austen"})
+	require.NoError(t, err)
+
+	created.LastName = "Eyre"
+	require.NoError(t, db.UpdateAuthor(context.Background(), created))
+	author, err := db.GetAuthor(context.Background(), created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Eyre", author.LastName)
+
+	require.NoError(t, db.DeleteAuthor(context.Background(), created.ID))
+	assert.ErrorIs(t, db.DeleteAuthor(context.Background(), created.ID), ErrAuthorNotFound)
+	assert.ErrorIs(t, db.UpdateAuthor(context.Background(), created), ErrAuthorNotFound)
+}
+
+func TestMemoryDB_ListAuthor_Keyset(t *testing.T) {
+	db := newMemoryDB()
+	for _, name := range []string{"Mary", "Anne", "Mary", "Charlotte"} {
+		_, err := db.AddAuthor(context.Background(), NewAuthor{FirstName: name, LastName: "Doe"})
+		require.NoError(t, err)
+	}
+
+	byFirstName := []SortField{{Field: "first_name"}}
+	page, err := db.ListAuthor(context.Background(), AuthorFilter{}, byFirstName, nil, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 4, 1}, authorIDs(page))
+
+	page, err = db.ListAuthor(context.Background(), AuthorFilter{}, byFirstName, &Cursor{Keys: []string{"Mary"}, ID: 1}, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3}, authorIDs(page))
+
+	page, err = db.ListAuthor(context.Background(), AuthorFilter{FirstName: "mar"}, byFirstName, nil, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 3}, authorIDs(page))
+}
+
+func TestMemoryDB_ListAuthor_Collation(t *testing.T) {
+	db := newMemoryDB()
+	for _, name := range []string{"Zoe", "emma", "Émile"} {
+		_, err := db.AddAuthor(context.Background(), NewAuthor{FirstName: name, LastName: "Doe"})
+		require.NoError(t, err)
+	}
+
+	// names sort like the en-US collation rather than byte-wise
+	page, err := db.ListAuthor(context.Background(), AuthorFilter{}, []SortField{{Field: "first_name"}}, nil, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 2, 1}, authorIDs(page))
+}
+
+func TestMemoryDB_ListAuthor_Sort(t *testing.T) {
+	db := newMemoryDB()
+	born := func(year int) *time.Time {
+		t := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	for _, a := range []NewAuthor{
+		{FirstName: "Mary", LastName: "Shelley", BirthDate: born(1797)},
+		{FirstName: "Anne", LastName: "Bronte", BirthDate: born(1820)},
+		{FirstName: "Homer", LastName: "Unknown"},
+		{FirstName: "Emily", LastName: "Bronte", BirthDate: born(1818)},
+	} {
+		_, err := db.AddAuthor(context.Background(), a)
+		require.NoError(t, err)
+	}
+
+	// authors without a birth date sort as the oldest
+	sort := []SortField{{Field: "birth_date", Desc: true}, {Field: "last_name"}}
+	var ids []int
+	var after *Cursor
+	for {
+		page, err := db.ListAuthor(context.Background(), AuthorFilter{}, sort, after, 1)
+		require.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+		ids = append(ids, page[0].ID)
+		cursor := AuthorCursor(page[0], sort)
+		after = &cursor
+	}
+	assert.Equal(t, []int{2, 4, 1, 3}, ids)
+
+	_, err := db.ListAuthor(context.Background(), AuthorFilter{}, []SortField{{Field: "id"}}, nil, 10)
+	assert.ErrorIs(t, err, ErrInvalidSort)
+}
+
+func TestMemoryDB_ListAuthor_Filter(t *testing.T) {
+	db := newMemoryDB()
+	born := func(year int) *time.Time {
+		t := time.Date(year, 6, 1, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	for _, a := range []NewAuthor{
+		{FirstName: "Mary", LastName: "Shelley", BirthDate: born(1797), Nationality: "British"},
+		{FirstName: "Mary", LastName: "Oliver", BirthDate: born(1935), Nationality: "American"},
+		{FirstName: "Percy", LastName: "Shelley", BirthDate: born(1792), Nationality: "British"},
+		{FirstName: "Homer", Nationality: "Greek"},
+		{FirstName: "Émile", LastName: "Zola", Nationality: "French"},
+	} {
+		_, err := db.AddAuthor(context.Background(), a)
+		require.NoError(t, err)
+	}
+	byID := []SortField{{Field: "created_at"}}
+	list := func(filter AuthorFilter) []int {
+		page, err := db.ListAuthor(context.Background(), filter, byID, nil, 10)
+		require.NoError(t, err)
+		return authorIDs(page)
+	}
+
+	// every set field has to match
+	assert.Equal(t, []int{1}, list(AuthorFilter{FirstName: "mary", LastName: "shel"}))
+	assert.Equal(t, []int{1}, list(AuthorFilter{Name: "mary shelley"}))
+	// case folds beyond ASCII like ILIKE under the ICU collation
+	assert.Equal(t, []int{5}, list(AuthorFilter{FirstName: "émile"}))
+	assert.Equal(t, []int{1, 3}, list(AuthorFilter{Nationality: "British"}))
+	assert.Empty(t, list(AuthorFilter{Nationality: "british"}))
+	assert.Equal(t, []int{1}, list(AuthorFilter{BornFrom: 1795, BornTo: 1800}))
+	assert.Equal(t, []int{1, 3}, list(AuthorFilter{BornTo: 1797}))
+}
+
+func TestMemoryDB_AuthorProfile(t *testing.T) {
+	db := newMemoryDB()
+	ctx := context.Background()
+
+	created, err := db.AddAuthor(ctx, NewAuthor{FirstName: "Mary", LastName: "Shelley", Bio: "Novelist", ORCID: "0000-0002-1825-0097"})
+	require.NoError(t, err)
+	assert.Equal(t, "Novelist", created.Bio)
+
+	created.Website = "https://maryshelley.example"
+	require.NoError(t, db.UpdateAuthor(ctx, created))
+	require.NoError(t, db.SetAuthorPhoto(ctx, created.ID, "/api/v1/authors/1/photo"))
+	assert.ErrorIs(t, db.SetAuthorPhoto(ctx, 99, "/api/v1/authors/99/photo"), ErrAuthorNotFound)
+
+	stored, err := db.GetAuthor(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "https://maryshelley.example", stored.Website)
+	assert.Equal(t, "/api/v1/authors/1/photo", stored.PhotoURL)
+	assert.Equal(t, "0000-0002-1825-0097", stored.ORCID)
+}
+
+func TestMemoryDB_SoftDeleteAuthor(t *testing.T) {
+	db := newMemoryDB()
+	ctx := context.Background()
+	for _, name := range []string{"Mary", "Percy"} {
+		_, err := db.AddAuthor(ctx, NewAuthor{FirstName: name, LastName: "Shelley"})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, db.SoftDeleteAuthor(ctx, 1))
+	assert.ErrorIs(t, db.SoftDeleteAuthor(ctx, 1), ErrAuthorNotFound)
+
+	// a soft deleted author is hidden but can still be deleted for good
+	_, err := db.GetAuthor(ctx, 1)
+	assert.ErrorIs(t, err, ErrAuthorNotFound)
+	assert.ErrorIs(t, db.UpdateAuthor(ctx, Author{ID: 1, FirstName: "Mary"}), ErrAuthorNotFound)
+	page, err := db.ListAuthor(ctx, AuthorFilter{}, []SortField{{Field: "first_name"}}, nil, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2}, authorIDs(page))
+	require.NoError(t, db.DeleteAuthor(ctx, 1))
+}
+
+func TestMemoryDB_RestoreAuthor(t *testing.T) {
+	db := newMemoryDB()
+	ctx := context.Background()
+	for _, name := range []string{"Mary", "Percy"} {
+		_, err := db.AddAuthor(ctx, NewAuthor{FirstName: name, LastName: "Shelley"})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.SoftDeleteAuthor(ctx, 1))
+
+	page, err := db.ListAuthor(ctx, AuthorFilter{IncludeDeleted: true}, []SortField{{Field: "first_name"}}, nil, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, authorIDs(page))
+	ids, err := db.DeletedAuthorIDs(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, ids)
+	ids, err = db.DeletedAuthorIDs(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	require.NoError(t, db.RestoreAuthor(ctx, 1))
+	assert.ErrorIs(t, db.RestoreAuthor(ctx, 1), ErrAuthorNotFound)
+	assert.ErrorIs(t, db.RestoreAuthor(ctx, 2), ErrAuthorNotFound)
+	_, err = db.GetAuthor(ctx, 1)
+	assert.NoError(t, err)
+}
+
+func TestMemoryDB_AuditLog(t *testing.T) {
+	db := newMemoryDB()
+	ctx := context.Background()
+	for _, entry := range []NewAuditEntry{
+		{Actor: "1", Action: "create", Entity: "author", EntityID: 1},
+		{Actor: "2", Action: "update", Entity: "author", EntityID: 1},
+		{Actor: "1", Action: "create", Entity: "author", EntityID: 2},
+	} {
+		require.NoError(t, db.AddAuditEntry(ctx, entry))
+	}
+
+	// newest first
+	entries, err := db.ListAuditEntries(ctx, AuditFilter{EntityID: 1}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "update", entries[0].Action)
+	assert.Equal(t, "create", entries[1].Action)
+
+	entries, err = db.ListAuditEntries(ctx, AuditFilter{Actor: "1"}, 1, 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 1, entries[0].EntityID)
+}
+
+func authorIDs(authors []Author) []int {
+	ids := make([]int, 0, len(authors))
+	for _, a := range authors {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
+
+func TestMemoryDB_Outbox(t *testing.T) {
+	db := newMemoryDB()
+	ctx := context.Background()
+	author, err := db.AddAuthor(ctx, NewAuthor{FirstName: "Mary", LastName: "Godwin"})
+	require.NoError(t, err)
+	author.LastName = "Shelley"
+	require.NoError(t, db.UpdateAuthor(ctx, author))
+	require.NoError(t, db.SetAuthorPhoto(ctx, author.ID, "/photo"))
+	require.NoError(t, db.SoftDeleteAuthor(ctx, author.ID))
+	require.NoError(t, db.RestoreAuthor(ctx, author.ID))
+	require.NoError(t, db.DeleteAuthor(ctx, author.ID))
+	assert.ErrorIs(t, db.UpdateAuthor(ctx, author), ErrAuthorNotFound)
+
+	events, err := db.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+		assert.Equal(t, author.ID, event.AggregateID)
+	}
+	assert.Equal(t, []string{
+		EventAuthorCreated, EventAuthorUpdated, EventAuthorUpdated,
+		EventAuthorDeleted, EventAuthorRestored, EventAuthorRemoved,
+	}, types)
+	assert.Contains(t, string(events[1].Payload), `"last_name":"Shelley"`)
+	assert.JSONEq(t, `{"id":1}`, string(events[5].Payload))
+
+	require.NoError(t, db.MarkEventPublished(ctx, events[0].ID))
+	events, err = db.PendingEvents(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, int64(2), events[0].ID)
+}
@@ -2,11 +2,17 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"library/metrics"
+
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"strings"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type PostgresPool interface {
@@ -14,14 +20,30 @@ type PostgresPool interface {
 	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
 	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
 	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Ping(ctx context.Context) error
 	Close()
 }
 
-func newPostgresDB(ctx context.Context, databaseURL string) (Database, error) {
-	dbpool, err := pgxpool.New(ctx, databaseURL)
+func newPostgresDB(ctx context.Context, databaseURL string, pool PoolConfig) (Database, error) {
+	config, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse database URL: %v", err)
+	}
+	if pool.MaxConns > 0 {
+		config.MaxConns = int32(pool.MaxConns)
+	}
+	if pool.MinConns > 0 {
+		config.MinConns = int32(pool.MinConns)
+	}
+	config.ConnConfig.Tracer = queryTracer{slow: slowQuery}
+	dbpool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create connection pool: %v", err)
 	}
+	if err := metrics.RegisterPool(prometheus.DefaultRegisterer, dbpool); err != nil {
+		dbpool.Close()
+		return nil, fmt.Errorf("unable to register pool metrics: %v", err)
+	}
 	return &postgresDB{
 		pool: dbpool,
 	}, nil
@@ -31,93 +53,271 @@ type postgresDB struct {
 	pool PostgresPool
 }
 
-func (db *postgresDB) AddAuthor(ctx context.Context, author NewAuthor) error {
-	_, err := db.pool.Exec(ctx,
-		`INSERT INTO authors (first_name, last_name, birth_date, nationality)`,
-		author.FirstName, author.LastName, author.BirthDate, author.Nationality)
-	if err != nil {
-		return fmt.Errorf("unable to add author: %v", err)
-	}
-
-	return nil
+// querier runs statements either on the pool or on the transaction of WithinTx
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
 }
 
-func (db *postgresDB) UpdateAuthor(ctx context.Context, author Author) error {
-	_, err := db.pool.Exec(ctx,
-		`UPDATE authors 
-		 SET first_name = $1,
-		     last_name = $2,
-		     birth_date = $3,
-		     nationality = $4
-		 WHERE id = $5`,
-		author.FirstName, author.LastName, author.BirthDate, author.Nationality, author.ID)
+type txKey struct{}
+
+func (db *postgresDB) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := db.begin(ctx)
 	if err != nil {
-		return fmt.Errorf("unable to update author: %v", err)
+		return fmt.Errorf("unable to start transaction: %v", err)
 	}
+	defer tx.Rollback(ctx)
 
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("unable to commit transaction: %v", err)
+	}
 	return nil
 }
 
-func (db *postgresDB) DeleteAuthor(ctx context.Context, id int) error {
-	_, err := db.pool.Exec(ctx,
-		`DELETE FROM authors WHERE id = $1`, id)
-	if err != nil {
-		return fmt.Errorf("unable to delete author: %v", err)
+// conn returns the transaction of WithinTx if ctx carries one, the pool otherwise
+func (db *postgresDB) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
 	}
+	return db.pool
+}
 
-	return nil
+// begin starts a transaction, or a savepoint inside the transaction of WithinTx
+func (db *postgresDB) begin(ctx context.Context) (pgx.Tx, error) {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx.Begin(ctx)
+	}
+	return db.pool.BeginTx(ctx, pgx.TxOptions{})
 }
 
-func (db *postgresDB) GetAuthor(ctx context.Context, id int) (Author, error) {
-	query := `
-		SELECT author_id, first_name, last_name, birth_date,
-		       nationality, created_at, updated_at 
-		FROM authors WHERE author_id = $1`
+// authorColumns lists the columns scanAuthor reads, in order
+const authorColumns = `id, first_name, last_name, birth_date, death_date, nationality, bio,
+       website, photo_url, orcid, viaf, open_library_id, created_at, updated_at, deleted_at`
 
-	var author Author
-	err := db.pool.QueryRow(ctx, query, id).Scan(
+// scanAuthor reads a row selected with authorColumns
+func scanAuthor(row pgx.Row, author *Author) error {
+	return row.Scan(
 		&author.ID,
 		&author.FirstName,
 		&author.LastName,
 		&author.BirthDate,
+		&author.DeathDate,
 		&author.Nationality,
+		&author.Bio,
+		&author.Website,
+		&author.PhotoURL,
+		&author.ORCID,
+		&author.VIAF,
+		&author.OpenLibraryID,
 		&author.CreatedAt,
 		&author.UpdatedAt,
+		&author.DeletedAt,
 	)
+}
+
+// withEvent runs write in a transaction and adds the event it returns to the outbox,
+// so the event is only published if the write is committed
+func (db *postgresDB) withEvent(ctx context.Context, write func(tx pgx.Tx) (OutboxEvent, error)) error {
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	event, err := write(tx)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO outbox (event_type, aggregate_id, payload) VALUES ($1, $2, $3)`,
+		event.Type, event.AggregateID, event.Payload)
+	if err != nil {
+		return fmt.Errorf("unable to add %s event: %v", event.Type, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("unable to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// scanChangedAuthor reads the author returned by a write, ErrAuthorNotFound if none matched
+func scanChangedAuthor(row pgx.Row, author *Author, action string) error {
+	if err := scanAuthor(row, author); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrAuthorNotFound
+		}
+		return fmt.Errorf("unable to %s author: %v", action, err)
+	}
+	return nil
+}
+
+func (db *postgresDB) AddAuthor(ctx context.Context, author NewAuthor) (Author, error) {
+	var created Author
+	err := db.withEvent(ctx, func(tx pgx.Tx) (OutboxEvent, error) {
+		row := tx.QueryRow(ctx,
+			`INSERT INTO authors (first_name, last_name, birth_date, death_date, nationality, bio,
+			                      website, photo_url, orcid, viaf, open_library_id)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			 RETURNING `+authorColumns,
+			author.FirstName, author.LastName, author.BirthDate, author.DeathDate, author.Nationality, author.Bio,
+			author.Website, author.PhotoURL, author.ORCID, author.VIAF, author.OpenLibraryID)
+		if err := scanAuthor(row, &created); err != nil {
+			return OutboxEvent{}, fmt.Errorf("unable to add author: %v", err)
+		}
+		return newEvent(EventAuthorCreated, created.ID, newAuthorEvent(created))
+	})
+	if err != nil {
+		return Author{}, err
+	}
+
+	return created, nil
+}
+
+func (db *postgresDB) UpdateAuthor(ctx context.Context, author Author) error {
+	return db.withEvent(ctx, func(tx pgx.Tx) (OutboxEvent, error) {
+		var updated Author
+		row := tx.QueryRow(ctx,
+			`UPDATE authors 
+			 SET first_name = $1,
+			     last_name = $2,
+			     birth_date = $3,
+			     death_date = $4,
+			     nationality = $5,
+			     bio = $6,
+			     website = $7,
+			     photo_url = $8,
+			     orcid = $9,
+			     viaf = $10,
+			     open_library_id = $11,
+			     updated_at = CURRENT_TIMESTAMP
+			 WHERE id = $12 AND deleted_at IS NULL
+			 RETURNING `+authorColumns,
+			author.FirstName, author.LastName, author.BirthDate, author.DeathDate, author.Nationality, author.Bio,
+			author.Website, author.PhotoURL, author.ORCID, author.VIAF, author.OpenLibraryID, author.ID)
+		if err := scanChangedAuthor(row, &updated, "update"); err != nil {
+			return OutboxEvent{}, err
+		}
+		return newEvent(EventAuthorUpdated, updated.ID, newAuthorEvent(updated))
+	})
+}
+
+func (db *postgresDB) SetAuthorPhoto(ctx context.Context, id int, photoURL string) error {
+	return db.withEvent(ctx, func(tx pgx.Tx) (OutboxEvent, error) {
+		var updated Author
+		row := tx.QueryRow(ctx,
+			`UPDATE authors SET photo_url = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND deleted_at IS NULL
+			 RETURNING `+authorColumns, photoURL, id)
+		if err := scanChangedAuthor(row, &updated, "set photo of"); err != nil {
+			return OutboxEvent{}, err
+		}
+		return newEvent(EventAuthorUpdated, updated.ID, newAuthorEvent(updated))
+	})
+}
+
+func (db *postgresDB) DeleteAuthor(ctx context.Context, id int) error {
+	return db.withEvent(ctx, func(tx pgx.Tx) (OutboxEvent, error) {
+		tag, err := tx.Exec(ctx,
+			`DELETE FROM authors WHERE id = $1`, id)
+		if err != nil {
+			return OutboxEvent{}, fmt.Errorf("unable to delete author: %v", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return OutboxEvent{}, ErrAuthorNotFound
+		}
+		return newEvent(EventAuthorRemoved, id, authorRef{ID: id})
+	})
+}
+
+func (db *postgresDB) SoftDeleteAuthor(ctx context.Context, id int) error {
+	return db.withEvent(ctx, func(tx pgx.Tx) (OutboxEvent, error) {
+		tag, err := tx.Exec(ctx,
+			`UPDATE authors SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL`, id)
+		if err != nil {
+			return OutboxEvent{}, fmt.Errorf("unable to soft delete author: %v", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return OutboxEvent{}, ErrAuthorNotFound
+		}
+		return newEvent(EventAuthorDeleted, id, authorRef{ID: id})
+	})
+}
+
+func (db *postgresDB) RestoreAuthor(ctx context.Context, id int) error {
+	return db.withEvent(ctx, func(tx pgx.Tx) (OutboxEvent, error) {
+		var restored Author
+		row := tx.QueryRow(ctx,
+			`UPDATE authors SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NOT NULL
+			 RETURNING `+authorColumns, id)
+		if err := scanChangedAuthor(row, &restored, "restore"); err != nil {
+			return OutboxEvent{}, err
+		}
+		return newEvent(EventAuthorRestored, restored.ID, newAuthorEvent(restored))
+	})
+}
+
+func (db *postgresDB) DeletedAuthorIDs(ctx context.Context, before time.Time) ([]int, error) {
+	rows, err := db.conn(ctx).Query(ctx,
+		`SELECT id FROM authors WHERE deleted_at < $1 ORDER BY id`, before)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list deleted authors: %v", err)
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("unable to read deleted authors: %v", err)
+	}
+	return ids, nil
+}
+
+func (db *postgresDB) GetAuthor(ctx context.Context, id int) (Author, error) {
+	query := `SELECT ` + authorColumns + ` FROM authors WHERE id = $1 AND deleted_at IS NULL`
+
+	var author Author
+	err := scanAuthor(db.conn(ctx).QueryRow(ctx, query, id), &author)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Author{}, ErrAuthorNotFound
+	}
 	if err != nil {
-		return Author{}, fmt.Errorf("unable to get author: %v", err)
+		return Author{}, fmt.Errorf("unable to get author: %w", err)
 	}
 
 	return author, nil
 }
 
-func (db *postgresDB) ListAuthor(ctx context.Context, filter Author, limit, offset int) ([]Author, error) {
-	var (
-		args  []interface{}
-		where []string
-	)
+func (db *postgresDB) ListAuthor(ctx context.Context, filter AuthorFilter, sort []SortField, after *Cursor, limit int) ([]Author, error) {
+	keys, err := resolveSort(authorSortColumns, sort)
+	if err != nil {
+		return nil, err
+	}
 
-	if filter.FirstName != "" {
-		args = append(args, "%"+strings.ToLower(filter.FirstName)+"%")
-		where = append(where, fmt.Sprintf("LOWER(first_name) LIKE $%d", len(args)))
+	where, args := authorFilterClause(filter)
+	if !filter.IncludeDeleted {
+		where = append([]string{"deleted_at IS NULL"}, where...)
 	}
-	if filter.LastName != "" {
-		args = append(args, "%"+strings.ToLower(filter.LastName)+"%")
-		where = append(where, fmt.Sprintf("LOWER(last_name) LIKE $%d", len(args)))
+	if after != nil {
+		values, err := cursorValues(keys, *after)
+		if err != nil {
+			return nil, err
+		}
+		var keyset string
+		keyset, args = keysetClause(keys, values, after.ID, args)
+		where = append(where, keyset)
 	}
 
-	query := `
-        SELECT author_id, first_name, last_name, birth_date, nationality, created_at, updated_at
-        FROM authors
-    `
+	query := `SELECT ` + authorColumns + ` FROM authors`
 	if len(where) > 0 {
-		query += " WHERE " + strings.Join(where, " OR ")
+		query += ` WHERE ` + strings.Join(where, " AND ")
 	}
 
-	args = append(args, limit, offset)
-	query += fmt.Sprintf(" ORDER BY first_name LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d", orderByClause(keys), len(args))
 
-	rows, err := db.pool.Query(ctx, query, args...)
+	rows, err := db.conn(ctx).Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to list authors: %w", err)
 	}
@@ -126,15 +326,7 @@ func (db *postgresDB) ListAuthor(ctx context.Context, filter Author, limit, offs
 	var authors []Author
 	for rows.Next() {
 		var a Author
-		if err := rows.Scan(
-			&a.ID,
-			&a.FirstName,
-			&a.LastName,
-			&a.BirthDate,
-			&a.Nationality,
-			&a.CreatedAt,
-			&a.UpdatedAt,
-		); err != nil {
+		if err := scanAuthor(rows, &a); err != nil {
 			return nil, fmt.Errorf("error scanning author row: %w", err)
 		}
 		authors = append(authors, a)
@@ -147,6 +339,123 @@ func (db *postgresDB) ListAuthor(ctx context.Context, filter Author, limit, offs
 	return authors, nil
 }
 
+func (db *postgresDB) PendingEvents(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	rows, err := db.conn(ctx).Query(ctx,
+		`SELECT id, event_type, aggregate_id, payload, created_at, published_at
+		 FROM outbox
+		 WHERE published_at IS NULL
+		 ORDER BY id
+		 LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query outbox: %v", err)
+	}
+	events, err := pgx.CollectRows(rows, pgx.RowToStructByName[OutboxEvent])
+	if err != nil {
+		return nil, fmt.Errorf("unable to read outbox: %v", err)
+	}
+	return events, nil
+}
+
+func (db *postgresDB) MarkEventPublished(ctx context.Context, id int64) error {
+	_, err := db.conn(ctx).Exec(ctx, `UPDATE outbox SET published_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("unable to mark event %d published: %v", id, err)
+	}
+	return nil
+}
+
+func (db *postgresDB) AddAuditEntry(ctx context.Context, entry NewAuditEntry) error {
+	_, err := db.conn(ctx).Exec(ctx,
+		`INSERT INTO audit_log (actor, actor_role, action, entity, entity_id, changes, request_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		entry.Actor, entry.ActorRole, entry.Action, entry.Entity, entry.EntityID, entry.Changes, entry.RequestID)
+	if err != nil {
+		return fmt.Errorf("unable to add audit entry: %v", err)
+	}
+	return nil
+}
+
+func (db *postgresDB) ListAuditEntries(ctx context.Context, filter AuditFilter, limit, offset int) ([]AuditEntry, error) {
+	var (
+		args  []any
+		where []string
+	)
+	if filter.Entity != "" {
+		args = append(args, filter.Entity)
+		where = append(where, fmt.Sprintf("entity = $%d", len(args)))
+	}
+	if filter.EntityID != 0 {
+		args = append(args, filter.EntityID)
+		where = append(where, fmt.Sprintf("entity_id = $%d", len(args)))
+	}
+	if filter.Actor != "" {
+		args = append(args, filter.Actor)
+		where = append(where, fmt.Sprintf("actor = $%d", len(args)))
+	}
+
+	query := `SELECT id, actor, actor_role, action, entity, entity_id, changes, request_id, created_at FROM audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, limit, offset)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := db.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query audit log: %v", err)
+	}
+
+	entries, err := pgx.CollectRows(rows, pgx.RowToStructByName[AuditEntry])
+	if err != nil {
+		return nil, fmt.Errorf("unable to read audit log: %v", err)
+	}
+	return entries, nil
+}
+
+func (db *postgresDB) Ping(ctx context.Context) error {
+	if err := db.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("unable to ping database: %w", err)
+	}
+	return nil
+}
+
 func (db *postgresDB) CloseConnections() {
 	db.pool.Close()
 }
+
+// authorFilterClause returns the conditions and arguments selecting the authors matching filter
+func authorFilterClause(filter AuthorFilter) ([]string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+	// ILIKE folds case with the ICU collation of the name columns, so it covers
+	// letters beyond ASCII like strings.ToLower does for the in-memory backend
+	contains := func(column, part string) {
+		if part != "" {
+			args = append(args, "%"+escapeLike(part)+"%")
+			conditions = append(conditions, fmt.Sprintf("%s ILIKE $%d", column, len(args)))
+		}
+	}
+	contains("first_name", filter.FirstName)
+	contains("last_name", filter.LastName)
+	contains("(first_name || ' ' || last_name)", filter.Name)
+	if filter.Nationality != "" {
+		args = append(args, filter.Nationality)
+		conditions = append(conditions, fmt.Sprintf("nationality = $%d", len(args)))
+	}
+	if filter.BornFrom != 0 {
+		args = append(args, time.Date(filter.BornFrom, time.January, 1, 0, 0, 0, 0, time.UTC))
+		conditions = append(conditions, fmt.Sprintf("birth_date >= $%d", len(args)))
+	}
+	if filter.BornTo != 0 {
+		args = append(args, time.Date(filter.BornTo+1, time.January, 1, 0, 0, 0, 0, time.UTC))
+		conditions = append(conditions, fmt.Sprintf("birth_date < $%d", len(args)))
+	}
+	return conditions, args
+}
+
+// escapeLike makes the LIKE wildcards in s match literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
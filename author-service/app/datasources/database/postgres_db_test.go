@@ -2,29 +2,75 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"testing"
-	"time"
 )
 
+// authorRows returns the rows of authors as scanned by scanAuthor
+func authorRows(authors ...Author) *pgxmock.Rows {
+	rows := pgxmock.NewRows([]string{
+		"id", "first_name", "last_name", "birth_date", "death_date", "nationality", "bio",
+		"website", "photo_url", "orcid", "viaf", "open_library_id", "created_at", "updated_at", "deleted_at",
+	})
+	for _, a := range authors {
+		rows.AddRow(a.ID, a.FirstName, a.LastName, a.BirthDate, a.DeathDate, a.Nationality, a.Bio,
+			a.Website, a.PhotoURL, a.ORCID, a.VIAF, a.OpenLibraryID, a.CreatedAt, a.UpdatedAt, a.DeletedAt)
+	}
+	return rows
+}
+
+// expectEvent expects the outbox insert of a write and the commit of its transaction
+func expectEvent(mock pgxmock.PgxPoolIface, eventType string, authorID int) {
+	mock.ExpectExec(EscapeQuery(`INSERT INTO outbox (event_type, aggregate_id, payload) VALUES ($1, $2, $3)`)).
+		WithArgs(eventType, authorID, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+}
+
 func TestPostgresDB_AddAuthor_Success(t *testing.T) {
 	mock, _ := pgxmock.NewPool()
 	defer mock.Close()
 
 	db := &postgresDB{pool: mock}
 	timeNow := time.Now()
-	author := NewAuthor{"Jane", "Doe", &timeNow, "USA"}
-
-	query := `INSERT INTO authors (first_name, last_name, birth_date, nationality)`
-	mock.ExpectExec(EscapeQuery(query)).
-		WithArgs(author.FirstName, author.LastName, author.BirthDate, author.Nationality).
-		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	author := NewAuthor{
+		FirstName:     "Jane",
+		LastName:      "Doe",
+		BirthDate:     &timeNow,
+		Nationality:   "USA",
+		Bio:           "Novelist",
+		Website:       "https://janedoe.example",
+		ORCID:         "0000-0002-1825-0097",
+		VIAF:          "102333412",
+		OpenLibraryID: "OL23919A",
+	}
 
-	err := db.AddAuthor(context.Background(), author)
+	query := `INSERT INTO authors (first_name, last_name, birth_date, death_date, nationality, bio,
+			                      website, photo_url, orcid, viaf, open_library_id)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectQuery(EscapeQuery(query)).
+		WithArgs(author.FirstName, author.LastName, author.BirthDate, author.DeathDate, author.Nationality, author.Bio,
+			author.Website, author.PhotoURL, author.ORCID, author.VIAF, author.OpenLibraryID).
+		WillReturnRows(authorRows(Author{
+			ID: 7, FirstName: author.FirstName, LastName: author.LastName, BirthDate: author.BirthDate,
+			Nationality: author.Nationality, Bio: author.Bio, Website: author.Website, ORCID: author.ORCID,
+			VIAF: author.VIAF, OpenLibraryID: author.OpenLibraryID, CreatedAt: timeNow, UpdatedAt: timeNow,
+		}))
+	expectEvent(mock, EventAuthorCreated, 7)
+
+	created, err := db.AddAuthor(context.Background(), author)
 	assert.NoError(t, err)
+	assert.Equal(t, 7, created.ID)
+	assert.Equal(t, "Novelist", created.Bio)
+	assert.Equal(t, "0000-0002-1825-0097", created.ORCID)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -35,14 +81,17 @@ func TestPostgresDB_AddAuthor_Fail(t *testing.T) {
 
 	db := &postgresDB{pool: mockPool}
 	timeNow := time.Now()
-	author := NewAuthor{"Jane", "Doe", &timeNow, "USA"}
+	author := NewAuthor{FirstName: "Jane", LastName: "Doe", BirthDate: &timeNow, Nationality: "USA"}
 
-	query := `INSERT INTO authors (first_name, last_name, birth_date, nationality)`
-	mockPool.ExpectExec(EscapeQuery(query)).
-		WithArgs(author.FirstName, author.LastName, author.BirthDate, author.Nationality).
+	query := `INSERT INTO authors (first_name, last_name, birth_date, death_date, nationality, bio,`
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectQuery(EscapeQuery(query)).
+		WithArgs(author.FirstName, author.LastName, author.BirthDate, author.DeathDate, author.Nationality, author.Bio,
+			author.Website, author.PhotoURL, author.ORCID, author.VIAF, author.OpenLibraryID).
 		WillReturnError(fmt.Errorf("insert failed"))
+	mockPool.ExpectRollback()
 
-	err = db.AddAuthor(context.Background(), author)
+	_, err = db.AddAuthor(context.Background(), author)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "unable to add author")
 
@@ -68,17 +117,11 @@ func TestPostgresDB_GetAuthor_Success(t *testing.T) {
 		UpdatedAt:   timeNow,
 	}
 
-	query := `
-		SELECT author_id, first_name, last_name, birth_date,
-		       nationality, created_at, updated_at 
-		FROM authors WHERE author_id = $1`
+	query := `SELECT ` + authorColumns + ` FROM authors WHERE id = $1 AND deleted_at IS NULL`
 
 	mock.ExpectQuery(EscapeQuery(query)).
 		WithArgs(authorID).
-		WillReturnRows(pgxmock.NewRows([]string{
-			"author_id", "first_name", "last_name", "birth_date",
-			"nationality", "created_at", "updated_at",
-		}).AddRow(expected.ID, expected.FirstName, expected.LastName, expected.BirthDate, expected.Nationality, expected.CreatedAt, expected.UpdatedAt))
+		WillReturnRows(authorRows(expected))
 
 	result, err := db.GetAuthor(context.Background(), authorID)
 	assert.NoError(t, err)
@@ -97,10 +140,7 @@ func TestPostgresDB_GetAuthor_Fail(t *testing.T) {
 	db := &postgresDB{pool: mock}
 	authorID := 999
 
-	query := `
-		SELECT author_id, first_name, last_name, birth_date,
-		       nationality, created_at, updated_at 
-		FROM authors WHERE author_id = $1`
+	query := `SELECT ` + authorColumns + ` FROM authors WHERE id = $1 AND deleted_at IS NULL`
 
 	mock.ExpectQuery(EscapeQuery(query)).
 		WithArgs(authorID).
@@ -132,30 +172,16 @@ func TestPostgresDB_ListAuthor_Success(t *testing.T) {
 		UpdatedAt:   timeNow,
 	}
 
-	filter := Author{FirstName: "Jane"}
+	filter := AuthorFilter{FirstName: "Jane"}
 	limit := 10
-	offset := 0
 
-	query := `
-        SELECT author_id, first_name, last_name, birth_date, nationality, created_at, updated_at
-        FROM authors WHERE LOWER(first_name) LIKE $1 ORDER BY first_name LIMIT $2 OFFSET $3`
+	query := `SELECT ` + authorColumns + ` FROM authors WHERE deleted_at IS NULL AND first_name ILIKE $1 ORDER BY first_name, id LIMIT $2`
 
 	mock.ExpectQuery(EscapeQuery(query)).
-		WithArgs("%jane%", limit, offset).
-		WillReturnRows(pgxmock.NewRows([]string{
-			"author_id", "first_name", "last_name", "birth_date",
-			"nationality", "created_at", "updated_at",
-		}).AddRow(
-			expected.ID,
-			expected.FirstName,
-			expected.LastName,
-			expected.BirthDate,
-			expected.Nationality,
-			expected.CreatedAt,
-			expected.UpdatedAt,
-		))
-
-	result, err := db.ListAuthor(context.Background(), filter, limit, offset)
+		WithArgs("%Jane%", limit).
+		WillReturnRows(authorRows(expected))
+
+	result, err := db.ListAuthor(context.Background(), filter, []SortField{{Field: "first_name"}}, nil, limit)
 	require.NoError(t, err)
 	require.Len(t, result, 1)
 	assert.Equal(t, expected, result[0])
@@ -168,19 +194,16 @@ func TestPostgresDB_ListAuthor_Fail(t *testing.T) {
 	defer mock.Close()
 
 	db := &postgresDB{pool: mock}
-	filter := Author{FirstName: "Jane"}
+	filter := AuthorFilter{FirstName: "Jane"}
 	limit := 10
-	offset := 0
 
-	query := `
-        SELECT author_id, first_name, last_name, birth_date, nationality, created_at, updated_at
-        FROM authors WHERE LOWER(first_name) LIKE $1 ORDER BY first_name LIMIT $2 OFFSET $3`
+	query := `SELECT ` + authorColumns + ` FROM authors WHERE deleted_at IS NULL AND first_name ILIKE $1 ORDER BY first_name, id LIMIT $2`
 
 	mock.ExpectQuery(EscapeQuery(query)).
-		WithArgs("%jane%", limit, offset).
+		WithArgs("%Jane%", limit).
 		WillReturnError(fmt.Errorf("query failed"))
 
-	authors, err := db.ListAuthor(context.Background(), filter, limit, offset)
+	authors, err := db.ListAuthor(context.Background(), filter, []SortField{{Field: "first_name"}}, nil, limit)
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "unable to list authors")
@@ -188,6 +211,83 @@ func TestPostgresDB_ListAuthor_Fail(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestPostgresDB_ListAuthor_AfterCursor(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	db := &postgresDB{pool: mock}
+
+	query := `SELECT ` + authorColumns + ` FROM authors WHERE deleted_at IS NULL AND first_name ILIKE $1 AND last_name ILIKE $2 AND ` +
+		`((last_name < $3) OR (last_name = $3 AND id > $4)) ORDER BY last_name DESC, id LIMIT $5`
+
+	mock.ExpectQuery(EscapeQuery(query)).
+		WithArgs("%Ja%", "%Do%", "Doe", 4, 3).
+		WillReturnRows(authorRows())
+
+	sort := []SortField{{Field: "last_name", Desc: true}}
+	authors, err := db.ListAuthor(context.Background(), AuthorFilter{FirstName: "Ja", LastName: "Do"}, sort, &Cursor{Keys: []string{"Doe"}, ID: 4}, 3)
+	require.NoError(t, err)
+	assert.Empty(t, authors)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_ListAuthor_Filter(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	db := &postgresDB{pool: mock}
+
+	query := `FROM authors WHERE deleted_at IS NULL AND (first_name || ' ' || last_name) ILIKE $1 AND nationality = $2 ` +
+		`AND birth_date >= $3 AND birth_date < $4 ORDER BY first_name, id LIMIT $5`
+
+	mock.ExpectQuery(EscapeQuery(query)).
+		WithArgs(`%Mary\_S%`, "British",
+			time.Date(1790, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(1801, 1, 1, 0, 0, 0, 0, time.UTC), 10).
+		WillReturnRows(authorRows())
+
+	filter := AuthorFilter{Name: "Mary_S", Nationality: "British", BornFrom: 1790, BornTo: 1800}
+	authors, err := db.ListAuthor(context.Background(), filter, []SortField{{Field: "first_name"}}, nil, 10)
+	require.NoError(t, err)
+	assert.Empty(t, authors)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_GetAuthor_NotFound(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	db := &postgresDB{pool: mock}
+
+	mock.ExpectQuery(EscapeQuery(`FROM authors WHERE id = $1`)).
+		WithArgs(5).
+		WillReturnError(pgx.ErrNoRows)
+
+	_, err = db.GetAuthor(context.Background(), 5)
+	assert.ErrorIs(t, err, ErrAuthorNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_DeleteAuthor_NotFound(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	db := &postgresDB{pool: mock}
+
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectExec(EscapeQuery(`DELETE FROM authors WHERE id = $1`)).
+		WithArgs(5).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectRollback()
+
+	err = db.DeleteAuthor(context.Background(), 5)
+	assert.ErrorIs(t, err, ErrAuthorNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestPostgresDB_DeleteAuthor_Success(t *testing.T) {
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
@@ -197,9 +297,11 @@ func TestPostgresDB_DeleteAuthor_Success(t *testing.T) {
 	authorID := 1
 
 	query := `DELETE FROM authors WHERE id = $1`
+	mock.ExpectBeginTx(pgx.TxOptions{})
 	mock.ExpectExec(EscapeQuery(query)).
 		WithArgs(authorID).
 		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	expectEvent(mock, EventAuthorRemoved, authorID)
 
 	err = db.DeleteAuthor(context.Background(), authorID)
 	require.NoError(t, err)
@@ -215,9 +317,11 @@ func TestPostgresDB_DeleteAuthor_Fail(t *testing.T) {
 	authorID := 99
 
 	query := `DELETE FROM authors WHERE id = $1`
+	mock.ExpectBeginTx(pgx.TxOptions{})
 	mock.ExpectExec(EscapeQuery(query)).
 		WithArgs(authorID).
 		WillReturnError(fmt.Errorf("some db error"))
+	mock.ExpectRollback()
 
 	err = db.DeleteAuthor(context.Background(), authorID)
 	require.Error(t, err)
@@ -242,16 +346,30 @@ func TestPostgresDB_UpdateAuthor_Success(t *testing.T) {
 	}
 
 	query := `
-		UPDATE authors 
-		 SET first_name = $1,
-		     last_name = $2,
-		     birth_date = $3,
-		     nationality = $4
-		 WHERE id = $5`
-
-	mock.ExpectExec(EscapeQuery(query)).
-		WithArgs(author.FirstName, author.LastName, author.BirthDate, author.Nationality, author.ID).
-		WillReturnResult(pgxmock.NewResult("UPDATE", 1)) // simulate 1 row updated
+			UPDATE authors 
+			 SET first_name = $1,
+			     last_name = $2,
+			     birth_date = $3,
+			     death_date = $4,
+			     nationality = $5,
+			     bio = $6,
+			     website = $7,
+			     photo_url = $8,
+			     orcid = $9,
+			     viaf = $10,
+			     open_library_id = $11,
+			     updated_at = CURRENT_TIMESTAMP
+			 WHERE id = $12 AND deleted_at IS NULL
+			 RETURNING ` + authorColumns
+
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectQuery(EscapeQuery(query)).
+		WithArgs(
+			author.FirstName, author.LastName, author.BirthDate, author.DeathDate, author.Nationality, author.Bio,
+			author.Website, author.PhotoURL, author.ORCID, author.VIAF, author.OpenLibraryID, author.ID,
+		).
+		WillReturnRows(authorRows(author))
+	expectEvent(mock, EventAuthorUpdated, author.ID)
 
 	err = db.UpdateAuthor(context.Background(), author)
 	require.NoError(t, err)
@@ -275,19 +393,284 @@ func TestPostgresDB_UpdateAuthor_Fail(t *testing.T) {
 	}
 
 	query := `
-		UPDATE authors 
-		 SET first_name = $1,
-		     last_name = $2,
-		     birth_date = $3,
-		     nationality = $4
-		 WHERE id = $5`
-
-	mock.ExpectExec(EscapeQuery(query)).
-		WithArgs(author.FirstName, author.LastName, author.BirthDate, author.Nationality, author.ID).
+			UPDATE authors 
+			 SET first_name = $1,
+			     last_name = $2,
+			     birth_date = $3,
+			     death_date = $4,
+			     nationality = $5,
+			     bio = $6,
+			     website = $7,
+			     photo_url = $8,
+			     orcid = $9,
+			     viaf = $10,
+			     open_library_id = $11,
+			     updated_at = CURRENT_TIMESTAMP
+			 WHERE id = $12 AND deleted_at IS NULL
+			 RETURNING ` + authorColumns
+
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectQuery(EscapeQuery(query)).
+		WithArgs(author.FirstName, author.LastName, author.BirthDate, author.DeathDate, author.Nationality, author.Bio,
+			author.Website, author.PhotoURL, author.ORCID, author.VIAF, author.OpenLibraryID, author.ID).
 		WillReturnError(fmt.Errorf("update failed"))
+	mock.ExpectRollback()
 
 	err = db.UpdateAuthor(context.Background(), author)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "unable to update author")
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestPostgresDB_SetAuthorPhoto(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	db := &postgresDB{pool: mock}
+	query := `UPDATE authors SET photo_url = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND deleted_at IS NULL`
+
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectQuery(EscapeQuery(query)).
+		WithArgs("/api/v1/authors/1/photo", 1).
+		WillReturnRows(authorRows(Author{ID: 1, PhotoURL: "/api/v1/authors/1/photo"}))
+	expectEvent(mock, EventAuthorUpdated, 1)
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectQuery(EscapeQuery(query)).
+		WithArgs("/api/v1/authors/2/photo", 2).
+		WillReturnRows(authorRows())
+	mock.ExpectRollback()
+
+	require.NoError(t, db.SetAuthorPhoto(context.Background(), 1, "/api/v1/authors/1/photo"))
+	assert.ErrorIs(t, db.SetAuthorPhoto(context.Background(), 2, "/api/v1/authors/2/photo"), ErrAuthorNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_SoftDeleteAuthor(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	db := &postgresDB{pool: mock}
+	query := `UPDATE authors SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL`
+
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectExec(EscapeQuery(query)).
+		WithArgs(1).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	expectEvent(mock, EventAuthorDeleted, 1)
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectExec(EscapeQuery(query)).
+		WithArgs(2).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mock.ExpectRollback()
+
+	require.NoError(t, db.SoftDeleteAuthor(context.Background(), 1))
+	assert.ErrorIs(t, db.SoftDeleteAuthor(context.Background(), 2), ErrAuthorNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_ListAuthor_IncludeDeleted(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	db := &postgresDB{pool: mock}
+	query := `SELECT ` + authorColumns + ` FROM authors ORDER BY first_name, id LIMIT $1`
+
+	mock.ExpectQuery(EscapeQuery(query)).
+		WithArgs(10).
+		WillReturnRows(authorRows(Author{ID: 1, FirstName: "Jane"}))
+
+	result, err := db.ListAuthor(context.Background(), AuthorFilter{IncludeDeleted: true}, []SortField{{Field: "first_name"}}, nil, 10)
+	require.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_RestoreAuthor(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	db := &postgresDB{pool: mock}
+	query := `UPDATE authors SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectQuery(EscapeQuery(query)).
+		WithArgs(1).
+		WillReturnRows(authorRows(Author{ID: 1, FirstName: "Jane"}))
+	expectEvent(mock, EventAuthorRestored, 1)
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectQuery(EscapeQuery(query)).
+		WithArgs(2).
+		WillReturnRows(authorRows())
+	mock.ExpectRollback()
+
+	require.NoError(t, db.RestoreAuthor(context.Background(), 1))
+	assert.ErrorIs(t, db.RestoreAuthor(context.Background(), 2), ErrAuthorNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_DeletedAuthorIDs(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	db := &postgresDB{pool: mock}
+	before := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(EscapeQuery(`SELECT id FROM authors WHERE deleted_at < $1 ORDER BY id`)).
+		WithArgs(before).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(2).AddRow(5))
+
+	ids, err := db.DeletedAuthorIDs(context.Background(), before)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 5}, ids)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_UpdateAuthor_EventFails(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	db := &postgresDB{pool: mock}
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectQuery(EscapeQuery(`UPDATE authors`)).
+		WithArgs("Jane", "", (*time.Time)(nil), (*time.Time)(nil), "", "", "", "", "", "", "", 1).
+		WillReturnRows(authorRows(Author{ID: 1, FirstName: "Jane"}))
+	mock.ExpectExec(EscapeQuery(`INSERT INTO outbox`)).
+		WithArgs(EventAuthorUpdated, 1, pgxmock.AnyArg()).
+		WillReturnError(fmt.Errorf("outbox full"))
+	mock.ExpectRollback()
+
+	err = db.UpdateAuthor(context.Background(), Author{ID: 1, FirstName: "Jane"})
+	assert.ErrorContains(t, err, "unable to add author.updated event")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_PendingEvents(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	db := &postgresDB{pool: mock}
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(EscapeQuery(`SELECT id, event_type, aggregate_id, payload, created_at, published_at
+		 FROM outbox
+		 WHERE published_at IS NULL
+		 ORDER BY id
+		 LIMIT $1`)).
+		WithArgs(100).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "event_type", "aggregate_id", "payload", "created_at", "published_at"}).
+			AddRow(int64(2), EventAuthorDeleted, 5, json.RawMessage(`{"id":5}`), createdAt, nil))
+	mock.ExpectExec(EscapeQuery(`UPDATE outbox SET published_at = CURRENT_TIMESTAMP WHERE id = $1`)).
+		WithArgs(int64(2)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	events, err := db.PendingEvents(context.Background(), 100)
+	require.NoError(t, err)
+	assert.Equal(t, []OutboxEvent{{
+		ID: 2, Type: EventAuthorDeleted, AggregateID: 5, Payload: json.RawMessage(`{"id":5}`), CreatedAt: createdAt,
+	}}, events)
+	require.NoError(t, db.MarkEventPublished(context.Background(), 2))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_AddAuditEntry(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	db := &postgresDB{pool: mock}
+	changes := json.RawMessage(`{"last_name":{"before":"Austen","after":"Eyre"}}`)
+	mock.ExpectExec(EscapeQuery(`INSERT INTO audit_log (actor, actor_role, action, entity, entity_id, changes, request_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`)).
+		WithArgs("42", "admin", "update", "author", 1, changes, "req-1").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	err = db.AddAuditEntry(context.Background(), NewAuditEntry{
+		Actor: "42", ActorRole: "admin", Action: "update", Entity: "author", EntityID: 1, Changes: changes, RequestID: "req-1",
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_WithinTx(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	db := &postgresDB{pool: mock}
+	query := `UPDATE authors SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL`
+	audit := `INSERT INTO audit_log (actor, actor_role, action, entity, entity_id, changes, request_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	softDelete := func(ctx context.Context) error {
+		if err := db.SoftDeleteAuthor(ctx, 1); err != nil {
+			return err
+		}
+		return db.AddAuditEntry(ctx, NewAuditEntry{Action: "delete", Entity: "author", EntityID: 1})
+	}
+
+	// the write opens a savepoint inside the transaction, its audit entry goes to the same transaction
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectExec(EscapeQuery(query)).
+		WithArgs(1).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	expectEvent(mock, EventAuthorDeleted, 1)
+	mock.ExpectExec(EscapeQuery(audit)).
+		WithArgs("", "", "delete", "author", 1, json.RawMessage(nil), "").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+	require.NoError(t, db.WithinTx(context.Background(), softDelete))
+
+	// a failing audit entry rolls the write back
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectBeginTx(pgx.TxOptions{})
+	mock.ExpectExec(EscapeQuery(query)).
+		WithArgs(1).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	expectEvent(mock, EventAuthorDeleted, 1)
+	mock.ExpectExec(EscapeQuery(audit)).
+		WithArgs("", "", "delete", "author", 1, json.RawMessage(nil), "").
+		WillReturnError(fmt.Errorf("disk full"))
+	mock.ExpectRollback()
+	assert.ErrorContains(t, db.WithinTx(context.Background(), softDelete), "unable to add audit entry")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_ListAuditEntries(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	db := &postgresDB{pool: mock}
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(EscapeQuery(`SELECT id, actor, actor_role, action, entity, entity_id, changes, request_id, created_at FROM audit_log WHERE entity_id = $1 AND actor = $2 ORDER BY id DESC LIMIT $3 OFFSET $4`)).
+		WithArgs(1, "42", 20, 0).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "actor", "actor_role", "action", "entity", "entity_id", "changes", "request_id", "created_at"}).
+			AddRow(int64(3), "42", "admin", "delete", "author", 1, json.RawMessage(`{}`), "", createdAt))
+
+	entries, err := db.ListAuditEntries(context.Background(), AuditFilter{EntityID: 1, Actor: "42"}, 20, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []AuditEntry{{ID: 3, Actor: "42", ActorRole: "admin", Action: "delete", Entity: "author", EntityID: 1,
+		Changes: json.RawMessage(`{}`), CreatedAt: createdAt}}, entries)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_Ping(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	mock.ExpectPing()
+	mock.ExpectPing().WillReturnError(assert.AnError)
+
+	db := &postgresDB{pool: mock}
+	assert.NoError(t, db.Ping(context.Background()))
+	assert.ErrorIs(t, db.Ping(context.Background()), assert.AnError)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,122 @@
+package photos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+var ErrPhotoNotFound = errors.New("photo not found")
+
+// extensions maps the stored image types onto file extensions
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// Photo is an image file with its MIME type
+type Photo struct {
+	ContentType string
+	Data        []byte
+}
+
+// Store keeps one photo per author
+type Store interface {
+	// SavePhoto stores photo as the photo of an author, replacing any previous one.
+	// Only the types in extensions can be stored.
+	SavePhoto(ctx context.Context, authorID int, photo Photo) error
+	GetPhoto(ctx context.Context, authorID int) (Photo, error)
+	// DeletePhoto removes the photo of an author, authors without one are left alone
+	DeletePhoto(ctx context.Context, authorID int) error
+}
+
+// NewLocalStore creates a Store that keeps the photos as files in dir,
+// the directory is created if it does not exist
+func NewLocalStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create photo directory: %w", err)
+	}
+	return &localStore{dir: dir}, nil
+}
+
+type localStore struct {
+	// mu keeps a photo from being read while it is replaced
+	mu  sync.RWMutex
+	dir string
+}
+
+func (s *localStore) SavePhoto(ctx context.Context, authorID int, photo Photo) error {
+	ext, ok := extensions[photo.ContentType]
+	if !ok {
+		return fmt.Errorf("unsupported photo type %q", photo.ContentType)
+	}
+
+	// write to a temporary file first so a failed write keeps the previous photo
+	tmp, err := os.CreateTemp(s.dir, "upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create photo file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(photo.Data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write photo: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write photo: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Rename(tmp.Name(), s.path(authorID, ext)); err != nil {
+		return fmt.Errorf("failed to store photo: %w", err)
+	}
+	// a photo of another type would shadow the new one
+	for _, other := range extensions {
+		if other == ext {
+			continue
+		}
+		if err := os.Remove(s.path(authorID, other)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove previous photo: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *localStore) GetPhoto(ctx context.Context, authorID int) (Photo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for contentType, ext := range extensions {
+		data, err := os.ReadFile(s.path(authorID, ext))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Photo{}, fmt.Errorf("failed to read photo: %w", err)
+		}
+		return Photo{ContentType: contentType, Data: data}, nil
+	}
+	return Photo{}, ErrPhotoNotFound
+}
+
+func (s *localStore) DeletePhoto(ctx context.Context, authorID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ext := range extensions {
+		if err := os.Remove(s.path(authorID, ext)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete photo: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *localStore) path(authorID int, ext string) string {
+	return filepath.Join(s.dir, "author-"+strconv.Itoa(authorID)+ext)
+}
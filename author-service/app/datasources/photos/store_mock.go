@@ -0,0 +1,24 @@
+package photos
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type StoreMock struct {
+	mock.Mock
+}
+
+func (m *StoreMock) SavePhoto(ctx context.Context, authorID int, photo Photo) error {
+	return m.Called(ctx, authorID, photo).Error(0)
+}
+
+func (m *StoreMock) DeletePhoto(ctx context.Context, authorID int) error {
+	return m.Called(ctx, authorID).Error(0)
+}
+
+func (m *StoreMock) GetPhoto(ctx context.Context, authorID int) (Photo, error) {
+	args := m.Called(ctx, authorID)
+	return args.Get(0).(Photo), args.Error(1)
+}
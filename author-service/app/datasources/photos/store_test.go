@@ -0,0 +1,50 @@
+package photos
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStore_SaveAndGet(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(filepath.Join(dir, "photos"))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = store.GetPhoto(ctx, 1)
+	assert.ErrorIs(t, err, ErrPhotoNotFound)
+
+	require.NoError(t, store.SavePhoto(ctx, 1, Photo{ContentType: "image/png", Data: []byte("png")}))
+	photo, err := store.GetPhoto(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, Photo{ContentType: "image/png", Data: []byte("png")}, photo)
+
+	// a photo of another type replaces the previous one
+	require.NoError(t, store.SavePhoto(ctx, 1, Photo{ContentType: "image/jpeg", Data: []byte("jpeg")}))
+	photo, err = store.GetPhoto(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, Photo{ContentType: "image/jpeg", Data: []byte("jpeg")}, photo)
+
+	files, err := os.ReadDir(filepath.Join(dir, "photos"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "author-1.jpg", files[0].Name())
+
+	require.NoError(t, store.DeletePhoto(ctx, 1))
+	_, err = store.GetPhoto(ctx, 1)
+	assert.ErrorIs(t, err, ErrPhotoNotFound)
+	assert.NoError(t, store.DeletePhoto(ctx, 1))
+}
+
+func TestLocalStore_UnsupportedType(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	err = store.SavePhoto(context.Background(), 1, Photo{ContentType: "image/gif", Data: []byte("gif")})
+	assert.ErrorContains(t, err, "unsupported photo type")
+}
@@ -1,13 +1,137 @@
 package domain
 
+import (
+	"fmt"
+	"time"
+)
+
+// BirthDateLayout is the format of Author.BirthDate and Author.DeathDate
+const BirthDateLayout = time.DateOnly
+
 type Author struct {
 	ID          int    `json:"id"`
 	FirstName   string `json:"first_name"`
 	LastName    string `json:"last_name"`
 	BirthDate   string `json:"birth_date"`
+	DeathDate   string `json:"death_date"`
 	Nationality string `json:"nationality"`
+	Bio         string `json:"bio"`
+	Website     string `json:"website"`
+	// PhotoURL links to a photo elsewhere or, once uploaded, to PhotoPath
+	PhotoURL    string      `json:"photo_url"`
+	ExternalIDs ExternalIDs `json:"external_ids"`
+	// DeletedAt is only set on soft deleted authors, which are listed for admins alone
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ExternalIDs identify an author in other catalogs
+type ExternalIDs struct {
+	// ORCID is formatted as 0000-0002-1825-0097
+	ORCID string `json:"orcid"`
+	// VIAF is the numeric id of a VIAF cluster
+	VIAF string `json:"viaf"`
+	// OpenLibrary is an Open Library author key, e.g. OL23919A
+	OpenLibrary string `json:"open_library"`
 }
 
+// MaxPhotoSize bounds the size of an uploaded author photo in bytes
+const MaxPhotoSize = 2 << 20
+
+// Photo is an uploaded author photo
+type Photo struct {
+	ContentType string
+	Data        []byte
+}
+
+// PhotoPath is the path an uploaded photo of an author is served at
+func PhotoPath(authorID int) string {
+	return fmt.Sprintf("/api/v1/authors/%d/photo", authorID)
+}
+
+// AuthorFilter narrows the authors listed, every set field must match.
+// Name searches the full name, BornFrom and BornTo are inclusive birth years.
+type AuthorFilter struct {
+	FirstName   string
+	LastName    string
+	Name        string
+	Nationality string
+	BornFrom    int
+	BornTo      int
+	// IncludeDeleted lists soft deleted authors as well, it is only honoured for admins
+	IncludeDeleted bool
+}
+
+// AuthorQuery selects a page of authors. Sort is a ParseSort list, After is the
+// next_cursor of the previous page listed with the same sort.
+type AuthorQuery struct {
+	Filter AuthorFilter
+	Sort   string
+	After  string
+	Limit  int
+}
+
+// AuthorResponse represents a page of authors, NextCursor is empty on the last page
 type AuthorResponse struct {
-	Authors []Author `json:"authors"`
+	Authors    []Author `json:"authors"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// DeleteOptions choose how an author is deleted. By default an author is only
+// soft deleted: they are hidden but their books keep pointing at them, so they
+// are not checked for books. A permanent delete is refused while books are left.
+type DeleteOptions struct {
+	Permanent bool
+}
+
+// ReassignRequest names the author that takes over the books of a deleted author
+type ReassignRequest struct {
+	ToAuthorID int `json:"to_author_id"`
+}
+
+// ReassignResponse is the deleted author and how many of their books moved
+type ReassignResponse struct {
+	Author     Author `json:"author"`
+	ToAuthorID int    `json:"to_author_id"`
+	Reassigned int    `json:"reassigned"`
+}
+
+// AuthorStats sums up the books of an author as counted by book-service
+type AuthorStats struct {
+	Titles          int `json:"titles"`
+	TotalCopies     int `json:"total_copies"`
+	AvailableCopies int `json:"available_copies"`
+	ActiveLoans     int `json:"active_loans"`
+}
+
+// AuthorDetail is an author with the counts of their books,
+// Stats is left out when book-service cannot be reached
+type AuthorDetail struct {
+	Author
+	Stats *AuthorStats `json:"stats,omitempty"`
+}
+
+// Book is a book of an author's bibliography
+type Book struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	ISBN        string    `json:"isbn"`
+	ISBN10      string    `json:"isbn10,omitempty"`
+	CategoryID  int       `json:"category_id"`
+	PublishDate time.Time `json:"publish_date"`
+	Description string    `json:"description"`
+}
+
+// BibliographyQuery selects a page of the books of an author, the fields are
+// passed to book-service which validates them
+type BibliographyQuery struct {
+	Sort  string
+	After string
+	Limit int
+}
+
+// BibliographyResponse represents a page of the books of an author
+type BibliographyResponse struct {
+	AuthorID   int    `json:"author_id"`
+	Books      []Book `json:"books"`
+	NextCursor string `json:"next_cursor,omitempty"`
 }
@@ -1,5 +1,44 @@
 package domain
 
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrAuthorNotFound = errors.New("author not found")
+	ErrInvalidCursor  = errors.New("invalid cursor")
+	ErrInvalidAuthor  = errors.New("invalid author")
+	ErrInvalidPhoto   = errors.New("invalid photo")
+	ErrPhotoNotFound  = errors.New("photo not found")
+
+	ErrBookServiceDisabled    = errors.New("book service is not configured")
+	ErrBookServiceUnavailable = errors.New("book service unavailable")
+	ErrInvalidBibliography    = errors.New("invalid bibliography query")
+
+	ErrAuthorHasBooks  = errors.New("author still has books")
+	ErrInvalidReassign = errors.New("invalid reassignment")
+)
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
+
+// AuthorHasBooksError blocks deleting an author whose books are still in book-service
+type AuthorHasBooksError struct {
+	BookIDs []int
+}
+
+func (e *AuthorHasBooksError) Error() string {
+	return fmt.Sprintf("%s: %d books", ErrAuthorHasBooks, len(e.BookIDs))
+}
+
+func (e *AuthorHasBooksError) Is(target error) bool {
+	return target == ErrAuthorHasBooks
+}
+
+// AuthorHasBooksResponse lists the books blocking the deletion of an author
+type AuthorHasBooksResponse struct {
+	Error   string `json:"error"`
+	BookIDs []int  `json:"book_ids"`
+}
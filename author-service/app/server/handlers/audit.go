@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"strconv"
+
+	"app/server/domain"
+	"app/server/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetAuditLog returns a handler function that lists the audit log newest first,
+// narrowed by the entity, entity_id and actor parameters and paged by limit and offset
+func GetAuditLog(service services.AuthorsService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", defaultPageLimit)
+		if limit < 1 || limit > maxPageLimit {
+			return sendError(c, fiber.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxPageLimit))
+		}
+		offset := c.QueryInt("offset")
+		entityID := c.QueryInt("entity_id")
+		if offset < 0 || entityID < 0 {
+			return sendError(c, fiber.StatusBadRequest, "offset and entity_id must not be negative")
+		}
+
+		entries, err := service.GetAuditLog(c.UserContext(), domain.AuditQuery{
+			Entity:   c.Query("entity"),
+			EntityID: entityID,
+			Actor:    c.Query("actor"),
+			Limit:    limit,
+			Offset:   offset,
+		})
+		if err != nil {
+			return authorError(c, "GetAuditLog", err)
+		}
+		return c.JSON(domain.AuditResponse{Entries: entries, Limit: limit, Offset: offset})
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"app/server/domain"
+	"app/server/services"
+
+	"library/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetAuditLog(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("GetAuditLog", mock.Anything, domain.AuditQuery{Entity: "author", EntityID: 3, Limit: 20}).
+		Return([]domain.AuditEntry{{ID: 1, Actor: "42", Action: "update", Entity: "author", EntityID: 3}}, nil)
+
+	app := fiber.New()
+	app.Get("/api/v1/audit", middleware.RequireRole("admin"), GetAuditLog(mockService))
+
+	req := httptest.NewRequest("GET", "/api/v1/audit?entity=author&entity_id=3", nil)
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	req.Header.Set(middleware.HeaderUserRole, "admin")
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	body := bodyFromResponse[domain.AuditResponse](t, resp)
+	assert.Len(t, body.Entries, 1)
+	assert.Equal(t, "42", body.Entries[0].Actor)
+}
+
+func TestGetAuditLog_InvalidQuery(t *testing.T) {
+	app := fiber.New()
+	app.Get("/api/v1/audit", GetAuditLog(new(services.AuthorsServiceMock)))
+
+	for _, url := range []string{"/api/v1/audit?limit=0", "/api/v1/audit?offset=-1", "/api/v1/audit?entity_id=-3"} {
+		resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+		assert.Nil(t, err)
+		assert.Equal(t, 400, resp.StatusCode, url)
+	}
+}
+
+func TestWithActor(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("RestoreAuthor", mock.MatchedBy(func(ctx context.Context) bool {
+		return domain.ActorFromContext(ctx) == domain.Actor{ID: "42", Role: "admin"} &&
+			domain.RequestIDFromContext(ctx) == "req-1"
+	}), 3).Return(domain.Author{ID: 3}, nil)
+
+	app := fiber.New()
+	app.Post("/api/v1/authors/:id/restore", WithActor(), RestoreAuthor(mockService))
+
+	req := httptest.NewRequest("POST", "/api/v1/authors/3/restore", nil)
+	req.Header.Set(middleware.HeaderUserID, "42")
+	req.Header.Set(middleware.HeaderUserRole, "admin")
+	req.Header.Set(middleware.HeaderRequestID, "req-1")
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	mockService.AssertExpectations(t)
+}
@@ -1,41 +1,340 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
 	"app/server/domain"
 	"app/server/services"
+
+	"library/logging"
+	"library/middleware"
+
 	"github.com/gofiber/fiber/v2"
-	"log/slog"
-	"strconv"
 )
 
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// GetAuthors returns a handler function that lists a page of authors,
+// the after parameter takes the next_cursor of the previous page
 func GetAuthors(service services.AuthorsService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		authors, err := service.GetAuthors(c.UserContext())
+		filter, err := parseAuthorFilter(c)
+		if errors.Is(err, errAdminOnly) {
+			return sendError(c, fiber.StatusForbidden, err.Error())
+		}
 		if err != nil {
-			slog.Error("Error getting authors: ", err)
-			return c.SendStatus(fiber.StatusInternalServerError)
+			return sendError(c, fiber.StatusBadRequest, err.Error())
+		}
+		limit := c.QueryInt("limit", defaultPageLimit)
+		if limit < 1 || limit > maxPageLimit {
+			return sendError(c, fiber.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxPageLimit))
 		}
 
-		return c.JSON(domain.AuthorResponse{
-			Authors: authors,
+		response, err := service.GetAuthors(c.UserContext(), domain.AuthorQuery{
+			Filter: filter,
+			Sort:   c.Query("sort"),
+			After:  c.Query("after"),
+			Limit:  limit,
 		})
+		if errors.Is(err, domain.ErrInvalidCursor) {
+			return sendError(c, fiber.StatusBadRequest, domain.ErrInvalidCursor.Error())
+		}
+		if errors.Is(err, domain.ErrInvalidSort) {
+			return sendError(c, fiber.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("GetAuthors failed", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+
+		return c.JSON(response)
 	}
 }
 
+// errAdminOnly rejects the include_deleted parameter for callers that are not admins
+var errAdminOnly = errors.New("include_deleted is only allowed for admins")
+
+// parseAuthorFilter reads the author list filters from the query parameters
+func parseAuthorFilter(c *fiber.Ctx) (domain.AuthorFilter, error) {
+	filter := domain.AuthorFilter{
+		FirstName:      strings.TrimSpace(c.Query("first_name")),
+		LastName:       strings.TrimSpace(c.Query("last_name")),
+		Name:           strings.TrimSpace(c.Query("name")),
+		Nationality:    strings.TrimSpace(c.Query("nationality")),
+		IncludeDeleted: c.QueryBool("include_deleted"),
+	}
+	if filter.IncludeDeleted && c.Get(middleware.HeaderUserRole) != "admin" {
+		return domain.AuthorFilter{}, errAdminOnly
+	}
+	var err error
+	if filter.BornFrom, err = parseYear(c, "born_from"); err != nil {
+		return domain.AuthorFilter{}, err
+	}
+	if filter.BornTo, err = parseYear(c, "born_to"); err != nil {
+		return domain.AuthorFilter{}, err
+	}
+	if filter.BornFrom != 0 && filter.BornTo != 0 && filter.BornFrom > filter.BornTo {
+		return domain.AuthorFilter{}, errors.New("born_from must not be after born_to")
+	}
+	return filter, nil
+}
+
+// parseYear reads an optional year query parameter, 0 when it is missing
+func parseYear(c *fiber.Ctx, key string) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+	year, err := strconv.Atoi(value)
+	if err != nil || year < 1 || year > 9999 {
+		return 0, fmt.Errorf("%s must be a year between 1 and 9999", key)
+	}
+	return year, nil
+}
+
+// GetAuthorByID returns a handler function that retrieves one author
 func GetAuthorByID(service services.AuthorsService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		paramID := c.Params("id")
-		id, err := strconv.Atoi(paramID)
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid author id")
+		}
 
 		author, err := service.GetAuthor(c.UserContext(), id)
 		if err != nil {
+			return authorError(c, "GetAuthorByID", err)
+		}
+
+		// the author is still served when their books cannot be counted
+		detail := domain.AuthorDetail{Author: author}
+		stats, err := service.GetAuthorStats(c.UserContext(), id)
+		switch {
+		case err == nil:
+			detail.Stats = &stats
+		case !errors.Is(err, domain.ErrBookServiceDisabled):
+			logging.FromContext(c.UserContext()).Warn("GetAuthorByID stats failed", "error", err)
+		}
+
+		return c.JSON(detail)
+	}
+}
+
+// GetAuthorBooks returns a handler function that lists a page of the books of an author
+// from book-service, it takes the sort, after and limit parameters of the book list
+func GetAuthorBooks(service services.AuthorsService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid author id")
+		}
+		limit := c.QueryInt("limit", defaultPageLimit)
+		if limit < 1 || limit > maxPageLimit {
+			return sendError(c, fiber.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxPageLimit))
+		}
+
+		response, err := service.GetAuthorBooks(c.UserContext(), id, domain.BibliographyQuery{
+			Sort:  c.Query("sort"),
+			After: c.Query("after"),
+			Limit: limit,
+		})
+		if err != nil {
+			return authorError(c, "GetAuthorBooks", err)
+		}
+
+		return c.JSON(response)
+	}
+}
+
+// CreateAuthor returns a handler function that adds an author
+func CreateAuthor(service services.AuthorsService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var author domain.Author
+		if err := c.BodyParser(&author); err != nil {
+			logging.FromContext(c.UserContext()).Warn("CreateAuthor request parsing failed", "error", err)
+			return sendError(c, fiber.StatusBadRequest, "invalid request")
+		}
+
+		created, err := service.CreateAuthor(c.UserContext(), author)
+		if err != nil {
+			return authorError(c, "CreateAuthor", err)
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(created)
+	}
+}
+
+// UpdateAuthor returns a handler function that replaces the fields of an author
+func UpdateAuthor(service services.AuthorsService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid author id")
+		}
+		var author domain.Author
+		if err := c.BodyParser(&author); err != nil {
+			logging.FromContext(c.UserContext()).Warn("UpdateAuthor request parsing failed", "error", err)
+			return sendError(c, fiber.StatusBadRequest, "invalid request")
+		}
+		author.ID = id
+
+		updated, err := service.UpdateAuthor(c.UserContext(), author)
+		if err != nil {
+			return authorError(c, "UpdateAuthor", err)
+		}
+
+		return c.JSON(updated)
+	}
+}
+
+// DeleteAuthor returns a handler function that soft deletes an author and returns it.
+// Admins remove an author for good with permanent=true, which is refused while
+// the author has books.
+func DeleteAuthor(service services.AuthorsService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid author id")
+		}
+
+		options := domain.DeleteOptions{Permanent: c.QueryBool("permanent")}
+		if options.Permanent && c.Get(middleware.HeaderUserRole) != "admin" {
+			return sendError(c, fiber.StatusForbidden, "permanent deletes are only allowed for admins")
+		}
+		deleted, err := service.DeleteAuthor(c.UserContext(), id, options)
+		if err != nil {
+			return authorError(c, "DeleteAuthor", err)
+		}
+
+		return c.JSON(deleted)
+	}
+}
+
+// RestoreAuthor returns a handler function that brings back a soft deleted author
+func RestoreAuthor(service services.AuthorsService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid author id")
+		}
+
+		restored, err := service.RestoreAuthor(c.UserContext(), id)
+		if err != nil {
+			return authorError(c, "RestoreAuthor", err)
+		}
+
+		return c.JSON(restored)
+	}
+}
+
+// ReassignAuthor returns a handler function that moves the books of an author to the
+// author named by to_author_id in the body, then permanently deletes the author
+func ReassignAuthor(service services.AuthorsService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid author id")
+		}
+		var request domain.ReassignRequest
+		if err := c.BodyParser(&request); err != nil || request.ToAuthorID < 1 {
+			return sendError(c, fiber.StatusBadRequest, "to_author_id is required")
+		}
+
+		response, err := service.ReassignAndDeleteAuthor(c.UserContext(), id, request.ToAuthorID)
+		if err != nil {
+			return authorError(c, "ReassignAuthor", err)
+		}
+
+		return c.JSON(response)
+	}
+}
 
+// UploadAuthorPhoto returns a handler function that stores the photo sent
+// as the multipart form file "photo" and returns the updated author
+func UploadAuthorPhoto(service services.AuthorsService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid author id")
+		}
+		header, err := c.FormFile("photo")
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "the photo must be sent as the multipart file photo")
+		}
+		if header.Size > domain.MaxPhotoSize {
+			return sendError(c, fiber.StatusRequestEntityTooLarge, "the photo must not be larger than "+strconv.Itoa(domain.MaxPhotoSize)+" bytes")
+		}
+		file, err := header.Open()
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("UploadAuthorPhoto failed to open the upload", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("UploadAuthorPhoto failed to read the upload", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+
+		author, err := service.UploadAuthorPhoto(c.UserContext(), id, data)
+		if err != nil {
+			return authorError(c, "UploadAuthorPhoto", err)
 		}
 
 		return c.JSON(author)
 	}
 }
 
+// GetAuthorPhoto returns a handler function that serves the uploaded photo of an author
+func GetAuthorPhoto(service services.AuthorsService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid author id")
+		}
+
+		photo, err := service.GetAuthorPhoto(c.UserContext(), id)
+		if err != nil {
+			return authorError(c, "GetAuthorPhoto", err)
+		}
+
+		c.Set(fiber.HeaderContentType, photo.ContentType)
+		return c.Send(photo.Data)
+	}
+}
+
+// authorError maps service errors onto responses, unexpected ones are logged
+func authorError(c *fiber.Ctx, operation string, err error) error {
+	var hasBooks *domain.AuthorHasBooksError
+	switch {
+	case errors.Is(err, domain.ErrInvalidAuthor), errors.Is(err, domain.ErrInvalidPhoto),
+		errors.Is(err, domain.ErrInvalidBibliography), errors.Is(err, domain.ErrInvalidReassign):
+		return sendError(c, fiber.StatusBadRequest, err.Error())
+	case errors.As(err, &hasBooks):
+		return c.Status(fiber.StatusConflict).JSON(domain.AuthorHasBooksResponse{
+			Error:   domain.ErrAuthorHasBooks.Error(),
+			BookIDs: hasBooks.BookIDs,
+		})
+	case errors.Is(err, domain.ErrBookServiceDisabled):
+		return sendError(c, fiber.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, domain.ErrBookServiceUnavailable):
+		logging.FromContext(c.UserContext()).Error(operation+" failed", "error", err)
+		return sendError(c, fiber.StatusBadGateway, domain.ErrBookServiceUnavailable.Error())
+	case errors.Is(err, domain.ErrAuthorNotFound):
+		return sendError(c, fiber.StatusNotFound, domain.ErrAuthorNotFound.Error())
+	case errors.Is(err, domain.ErrPhotoNotFound):
+		return sendError(c, fiber.StatusNotFound, domain.ErrPhotoNotFound.Error())
+	}
+	logging.FromContext(c.UserContext()).Error(operation+" failed", "error", err)
+	return sendError(c, fiber.StatusInternalServerError, "internal error")
+}
+
 func sendError(c *fiber.Ctx, code int, message string) error {
 	return c.Status(code).JSON(domain.ErrorResponse{
 		Error: message,
@@ -3,6 +3,9 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,36 +13,103 @@ import (
 	"app/server/domain"
 	"app/server/services"
 
+	"library/middleware"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
-var booksRoute = "/api/v1/books"
+var authorsRoute = "/api/v1/authors"
 
-func TestGetBooks(t *testing.T) {
-	mockService := new(services.BooksServiceMock)
-	mockService.On("GetBooks", mock.Anything).Return([]domain.Book{{Title: "Title"}}, nil)
+func TestGetAuthors(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("GetAuthors", mock.Anything, domain.AuthorQuery{Sort: "-birth_date", After: "abc", Limit: 2}).
+		Return(domain.AuthorResponse{Authors: []domain.Author{{FirstName: "Jane"}}, NextCursor: "def"}, nil)
 
 	app := fiber.New()
-	app.Get(booksRoute, GetBooks(mockService))
+	app.Get(authorsRoute, GetAuthors(mockService))
 
-	resp, err := app.Test(httptest.NewRequest("GET", booksRoute, nil))
+	resp, err := app.Test(httptest.NewRequest("GET", authorsRoute+"?sort=-birth_date&after=abc&limit=2", nil))
 	assert.Nil(t, err)
 	assert.Equal(t, 200, resp.StatusCode)
 
-	body := bodyFromResponse[domain.BooksResponse](t, resp)
-	assert.Len(t, body.Books, 1)
+	body := bodyFromResponse[domain.AuthorResponse](t, resp)
+	assert.Len(t, body.Authors, 1)
+	assert.Equal(t, "def", body.NextCursor)
 }
 
-func TestGetBooks_ServiceFails(t *testing.T) {
-	mockService := new(services.BooksServiceMock)
-	mockService.On("GetBooks", mock.Anything).Return(nil, assert.AnError)
+func TestGetAuthors_Filter(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("GetAuthors", mock.Anything, domain.AuthorQuery{
+		Filter: domain.AuthorFilter{Name: "mary shelley", Nationality: "British", BornFrom: 1790, BornTo: 1800},
+		Limit:  defaultPageLimit,
+	}).Return(domain.AuthorResponse{Authors: []domain.Author{}}, nil)
 
 	app := fiber.New()
-	app.Get(booksRoute, GetBooks(mockService))
+	app.Get(authorsRoute, GetAuthors(mockService))
 
-	resp, err := app.Test(httptest.NewRequest("GET", booksRoute, nil))
+	resp, err := app.Test(httptest.NewRequest("GET", authorsRoute+"?name=mary+shelley&nationality=British&born_from=1790&born_to=1800", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	mockService.AssertExpectations(t)
+}
+
+func TestGetAuthors_InvalidBirthYears(t *testing.T) {
+	app := fiber.New()
+	app.Get(authorsRoute, GetAuthors(new(services.AuthorsServiceMock)))
+
+	for _, query := range []string{"?born_from=abc", "?born_to=0", "?born_from=1900&born_to=1800"} {
+		resp, err := app.Test(httptest.NewRequest("GET", authorsRoute+query, nil))
+		assert.Nil(t, err)
+		assert.Equal(t, 400, resp.StatusCode, query)
+	}
+}
+
+func TestGetAuthors_InvalidLimit(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+
+	app := fiber.New()
+	app.Get(authorsRoute, GetAuthors(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", authorsRoute+"?limit=500", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestGetAuthors_InvalidCursor(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("GetAuthors", mock.Anything, mock.Anything).Return(domain.AuthorResponse{}, domain.ErrInvalidCursor)
+
+	app := fiber.New()
+	app.Get(authorsRoute, GetAuthors(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", authorsRoute+"?after=broken", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestGetAuthors_InvalidSort(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("GetAuthors", mock.Anything, mock.Anything).Return(domain.AuthorResponse{}, domain.ErrInvalidSort)
+
+	app := fiber.New()
+	app.Get(authorsRoute, GetAuthors(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", authorsRoute+"?sort=age", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestGetAuthors_ServiceFails(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("GetAuthors", mock.Anything, mock.Anything).Return(domain.AuthorResponse{}, assert.AnError)
+
+	app := fiber.New()
+	app.Get(authorsRoute, GetAuthors(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", authorsRoute, nil))
 	assert.Nil(t, err)
 	assert.Equal(t, 500, resp.StatusCode)
 
@@ -47,45 +117,319 @@ func TestGetBooks_ServiceFails(t *testing.T) {
 	assert.Equal(t, "internal error", body.Error)
 }
 
-func TestAddBook(t *testing.T) {
-	mockService := new(services.BooksServiceMock)
-	mockService.On("SaveBook", mock.Anything, domain.Book{Title: "Title"}).Return(nil)
+func TestGetAuthorByID_NotFound(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("GetAuthor", mock.Anything, 4).Return(domain.Author{}, domain.ErrAuthorNotFound)
+
+	app := fiber.New()
+	app.Get(authorsRoute+"/:id", GetAuthorByID(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", authorsRoute+"/4", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+func TestGetAuthorByID_Stats(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("GetAuthor", mock.Anything, 4).Return(domain.Author{ID: 4, FirstName: "Mary"}, nil)
+	mockService.On("GetAuthorStats", mock.Anything, 4).Return(domain.AuthorStats{Titles: 2, TotalCopies: 5, ActiveLoans: 1}, nil)
 
 	app := fiber.New()
-	app.Post(booksRoute, AddBook(mockService))
+	app.Get(authorsRoute+"/:id", GetAuthorByID(mockService))
 
-	resp, err := app.Test(postRequest(booksRoute, `{"title":"Title"}`))
+	resp, err := app.Test(httptest.NewRequest("GET", authorsRoute+"/4", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body := bodyFromResponse[domain.AuthorDetail](t, resp)
+	assert.Equal(t, "Mary", body.FirstName)
+	assert.Equal(t, &domain.AuthorStats{Titles: 2, TotalCopies: 5, ActiveLoans: 1}, body.Stats)
+}
+
+func TestGetAuthorByID_StatsUnavailable(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("GetAuthor", mock.Anything, 4).Return(domain.Author{ID: 4, FirstName: "Mary"}, nil)
+	mockService.On("GetAuthorStats", mock.Anything, 4).Return(domain.AuthorStats{}, domain.ErrBookServiceUnavailable)
+
+	app := fiber.New()
+	app.Get(authorsRoute+"/:id", GetAuthorByID(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", authorsRoute+"/4", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body := bodyFromResponse[domain.AuthorDetail](t, resp)
+	assert.Equal(t, "Mary", body.FirstName)
+	assert.Nil(t, body.Stats)
+}
+
+func TestGetAuthorBooks(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("GetAuthorBooks", mock.Anything, 4, domain.BibliographyQuery{Sort: "title", Limit: 5}).
+		Return(domain.BibliographyResponse{AuthorID: 4, Books: []domain.Book{{ID: 1, Title: "Frankenstein"}}}, nil)
+
+	app := fiber.New()
+	app.Get(authorsRoute+"/:id/books", GetAuthorBooks(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", authorsRoute+"/4/books?sort=title&limit=5", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body := bodyFromResponse[domain.BibliographyResponse](t, resp)
+	assert.Len(t, body.Books, 1)
+}
+
+func TestGetAuthorBooks_Errors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{domain.ErrAuthorNotFound, 404},
+		{domain.ErrInvalidBibliography, 400},
+		{domain.ErrBookServiceDisabled, 503},
+		{domain.ErrBookServiceUnavailable, 502},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			mockService := new(services.AuthorsServiceMock)
+			mockService.On("GetAuthorBooks", mock.Anything, 4, mock.Anything).Return(domain.BibliographyResponse{}, tt.err)
+
+			app := fiber.New()
+			app.Get(authorsRoute+"/:id/books", GetAuthorBooks(mockService))
+
+			resp, err := app.Test(httptest.NewRequest("GET", authorsRoute+"/4/books", nil))
+			assert.Nil(t, err)
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+}
+
+func TestCreateAuthor(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("CreateAuthor", mock.Anything, domain.Author{FirstName: "Jane", LastName: "Austen"}).
+		Return(domain.Author{ID: 1, FirstName: "Jane", LastName: "Austen"}, nil)
+
+	app := fiber.New()
+	app.Post(authorsRoute, CreateAuthor(mockService))
+
+	resp, err := app.Test(postRequest(authorsRoute, `{"first_name":"Jane","last_name":"Austen"}`))
 	assert.Nil(t, err)
 	assert.Equal(t, 201, resp.StatusCode)
+
+	body := bodyFromResponse[domain.Author](t, resp)
+	assert.Equal(t, 1, body.ID)
 }
 
-func TestAddBook_InvalidRequest(t *testing.T) {
-	mockService := new(services.BooksServiceMock)
+func TestCreateAuthor_Invalid(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("CreateAuthor", mock.Anything, mock.Anything).Return(domain.Author{}, domain.ErrInvalidAuthor)
 
 	app := fiber.New()
-	app.Post(booksRoute, AddBook(mockService))
+	app.Post(authorsRoute, CreateAuthor(mockService))
 
-	resp, err := app.Test(httptest.NewRequest("POST", booksRoute, nil))
+	resp, err := app.Test(postRequest(authorsRoute, `{"first_name":"Jane"}`))
 	assert.Nil(t, err)
 	assert.Equal(t, 400, resp.StatusCode)
+}
 
-	body := bodyFromResponse[domain.ErrorResponse](t, resp)
-	assert.Equal(t, "invalid request", body.Error)
+func TestUpdateAuthor(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("UpdateAuthor", mock.Anything, domain.Author{ID: 2, FirstName: "Jane", LastName: "Austen"}).
+		Return(domain.Author{ID: 2, FirstName: "Jane", LastName: "Austen"}, nil)
+
+	app := fiber.New()
+	app.Put(authorsRoute+"/:id", UpdateAuthor(mockService))
+
+	req := httptest.NewRequest("PUT", authorsRoute+"/2", bytes.NewBufferString(`{"first_name":"Jane","last_name":"Austen"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
 }
 
-func TestAddBook_ServiceFails(t *testing.T) {
-	mockService := new(services.BooksServiceMock)
-	mockService.On("SaveBook", mock.Anything, domain.Book{Title: "Title"}).Return(assert.AnError)
+func TestDeleteAuthor(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("DeleteAuthor", mock.Anything, 2, domain.DeleteOptions{}).Return(domain.Author{ID: 2}, nil)
+	mockService.On("DeleteAuthor", mock.Anything, 3, domain.DeleteOptions{Permanent: true}).Return(domain.Author{ID: 3}, nil)
 
 	app := fiber.New()
-	app.Post(booksRoute, AddBook(mockService))
+	app.Delete(authorsRoute+"/:id", DeleteAuthor(mockService))
 
-	resp, err := app.Test(postRequest(booksRoute, `{"title":"Title"}`))
+	resp, err := app.Test(httptest.NewRequest("DELETE", authorsRoute+"/2", nil))
 	assert.Nil(t, err)
-	assert.Equal(t, 500, resp.StatusCode)
+	assert.Equal(t, 200, resp.StatusCode)
 
-	body := bodyFromResponse[domain.ErrorResponse](t, resp)
-	assert.Equal(t, "internal error", body.Error)
+	// permanent deletes are reserved to admins
+	resp, err = app.Test(httptest.NewRequest("DELETE", authorsRoute+"/3?permanent=true", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	req := httptest.NewRequest("DELETE", authorsRoute+"/3?permanent=true", nil)
+	req.Header.Set(middleware.HeaderUserRole, "admin")
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	mockService.AssertExpectations(t)
+}
+
+func TestDeleteAuthor_HasBooks(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("DeleteAuthor", mock.Anything, 2, domain.DeleteOptions{Permanent: true}).
+		Return(domain.Author{}, fmt.Errorf("failed: %w", &domain.AuthorHasBooksError{BookIDs: []int{4, 9}}))
+
+	app := fiber.New()
+	app.Delete(authorsRoute+"/:id", DeleteAuthor(mockService))
+
+	req := httptest.NewRequest("DELETE", authorsRoute+"/2?permanent=true", nil)
+	req.Header.Set(middleware.HeaderUserRole, "admin")
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 409, resp.StatusCode)
+	body := bodyFromResponse[domain.AuthorHasBooksResponse](t, resp)
+	assert.Equal(t, []int{4, 9}, body.BookIDs)
+}
+
+func TestRestoreAuthor(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("RestoreAuthor", mock.Anything, 2).Return(domain.Author{ID: 2, FirstName: "Mary"}, nil)
+	mockService.On("RestoreAuthor", mock.Anything, 3).Return(domain.Author{}, domain.ErrAuthorNotFound)
+
+	app := fiber.New()
+	app.Post(authorsRoute+"/:id/restore", RestoreAuthor(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("POST", authorsRoute+"/2/restore", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "Mary", bodyFromResponse[domain.Author](t, resp).FirstName)
+
+	resp, err = app.Test(httptest.NewRequest("POST", authorsRoute+"/3/restore", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+func TestGetAuthors_IncludeDeleted(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("GetAuthors", mock.Anything, domain.AuthorQuery{
+		Filter: domain.AuthorFilter{IncludeDeleted: true},
+		Limit:  defaultPageLimit,
+	}).Return(domain.AuthorResponse{Authors: []domain.Author{}}, nil)
+
+	app := fiber.New()
+	app.Get(authorsRoute, GetAuthors(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", authorsRoute+"?include_deleted=true", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	req := httptest.NewRequest("GET", authorsRoute+"?include_deleted=true", nil)
+	req.Header.Set(middleware.HeaderUserRole, "admin")
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	mockService.AssertExpectations(t)
+}
+
+func TestReassignAuthor(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("ReassignAndDeleteAuthor", mock.Anything, 2, 5).
+		Return(domain.ReassignResponse{Author: domain.Author{ID: 2}, ToAuthorID: 5, Reassigned: 3}, nil)
+
+	app := fiber.New()
+	app.Post(authorsRoute+"/:id/reassign", middleware.RequireRole("admin"), ReassignAuthor(mockService))
+
+	req := postRequest(authorsRoute+"/2/reassign", `{"to_author_id":5}`)
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	req = postRequest(authorsRoute+"/2/reassign", `{"to_author_id":5}`)
+	req.Header.Set(middleware.HeaderUserRole, "admin")
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 3, bodyFromResponse[domain.ReassignResponse](t, resp).Reassigned)
+
+	req = postRequest(authorsRoute+"/2/reassign", `{}`)
+	req.Header.Set(middleware.HeaderUserRole, "admin")
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestCreateAuthor_Profile(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("CreateAuthor", mock.Anything, domain.Author{
+		FirstName:   "Mary",
+		LastName:    "Shelley",
+		DeathDate:   "1851-02-01",
+		Bio:         "Novelist",
+		ExternalIDs: domain.ExternalIDs{ORCID: "0000-0002-1825-0097", OpenLibrary: "OL23919A"},
+	}).Return(domain.Author{ID: 1, FirstName: "Mary", LastName: "Shelley"}, nil)
+
+	app := fiber.New()
+	app.Post(authorsRoute, CreateAuthor(mockService))
+
+	resp, err := app.Test(postRequest(authorsRoute, `{"first_name":"Mary","last_name":"Shelley","death_date":"1851-02-01",`+
+		`"bio":"Novelist","external_ids":{"orcid":"0000-0002-1825-0097","open_library":"OL23919A"}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 201, resp.StatusCode)
+	mockService.AssertExpectations(t)
+}
+
+func TestUploadAuthorPhoto(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("UploadAuthorPhoto", mock.Anything, 2, []byte("image")).
+		Return(domain.Author{ID: 2, PhotoURL: "/api/v1/authors/2/photo"}, nil)
+
+	app := fiber.New()
+	app.Put(authorsRoute+"/:id/photo", UploadAuthorPhoto(mockService))
+
+	resp, err := app.Test(photoRequest(t, authorsRoute+"/2/photo", "photo", []byte("image")))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "/api/v1/authors/2/photo", bodyFromResponse[domain.Author](t, resp).PhotoURL)
+}
+
+func TestUploadAuthorPhoto_Invalid(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("UploadAuthorPhoto", mock.Anything, 2, mock.Anything).Return(domain.Author{}, domain.ErrInvalidPhoto)
+
+	app := fiber.New()
+	app.Put(authorsRoute+"/:id/photo", UploadAuthorPhoto(mockService))
+
+	// the file has to be sent as photo
+	resp, err := app.Test(photoRequest(t, authorsRoute+"/2/photo", "image", []byte("image")))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	resp, err = app.Test(photoRequest(t, authorsRoute+"/2/photo", "photo", []byte("GIF89a")))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	resp, err = app.Test(photoRequest(t, authorsRoute+"/2/photo", "photo", make([]byte, domain.MaxPhotoSize+1)))
+	assert.Nil(t, err)
+	assert.Equal(t, 413, resp.StatusCode)
+}
+
+func TestGetAuthorPhoto(t *testing.T) {
+	mockService := new(services.AuthorsServiceMock)
+	mockService.On("GetAuthorPhoto", mock.Anything, 2).Return(domain.Photo{ContentType: "image/png", Data: []byte("png")}, nil)
+	mockService.On("GetAuthorPhoto", mock.Anything, 3).Return(domain.Photo{}, domain.ErrPhotoNotFound)
+
+	app := fiber.New()
+	app.Get(authorsRoute+"/:id/photo", GetAuthorPhoto(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", authorsRoute+"/2/photo", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "image/png", resp.Header.Get(fiber.HeaderContentType))
+	data, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "png", string(data))
+
+	resp, err = app.Test(httptest.NewRequest("GET", authorsRoute+"/3/photo", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
 }
 
 func postRequest(url string, body string) *http.Request {
@@ -94,6 +438,20 @@ func postRequest(url string, body string) *http.Request {
 	return req
 }
 
+func photoRequest(t *testing.T, url, field string, data []byte) *http.Request {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile(field, "photo")
+	require.NoError(t, err)
+	_, err = part.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+
+	req := httptest.NewRequest("PUT", url, &body)
+	req.Header.Set(fiber.HeaderContentType, form.FormDataContentType())
+	return req
+}
+
 func bodyFromResponse[T any](t *testing.T, resp *http.Response) T {
 	defer resp.Body.Close()
 	var body T
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"strings"
+
+	"app/server/domain"
+
+	"library/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WithActor returns a middleware that passes the caller and the request id
+// on to the services, which attribute their writes to them in the audit log
+func WithActor() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, _ := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		ctx := domain.WithActor(c.UserContext(), domain.Actor{ID: c.Get(middleware.HeaderUserID), Role: c.Get(middleware.HeaderUserRole), Token: token})
+		c.SetUserContext(domain.WithRequestID(ctx, c.Get(middleware.HeaderRequestID)))
+		return c.Next()
+	}
+}
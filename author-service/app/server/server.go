@@ -2,27 +2,67 @@ package server
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"app/datasources"
 	"app/server/handlers"
 	"app/server/services"
 
+	"library/health"
+	"library/middleware"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-// NewServer creates a new Fiber app and sets up the routes
-func NewServer(ctx context.Context, dataSources *datasources.DataSources) *fiber.App {
-	app := fiber.New()
-	apiRoutes := app.Group("/api")
+// Config tunes the HTTP server, zero timeouts never expire
+type Config struct {
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// CORSOrigins are the origins browsers may call the API from, none disables CORS
+	CORSOrigins []string
+	// JWTKey verifies the bearer tokens callers authenticate with, without it the
+	// caller is taken from the headers set by the API gateway
+	JWTKey string
+	// Cache keeps the responses of the read routes
+	Cache middleware.CacheConfig
+}
+
+// NewServer creates a new Fiber app and sets up the routes, checker decides whether
+// the service is ready for traffic
+func NewServer(ctx context.Context, dataSources *datasources.DataSources, checker *health.Checker, config Config) *fiber.App {
+	app := fiber.New(fiber.Config{
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		IdleTimeout:  config.IdleTimeout,
+	})
+	app.Use(middleware.Trace(), middleware.Authenticate(config.JWTKey), middleware.RequestLogger(), middleware.RecordMetrics())
+	if len(config.CORSOrigins) > 0 {
+		app.Use(cors.New(cors.Config{AllowOrigins: strings.Join(config.CORSOrigins, ",")}))
+	}
+	app.Get("/metrics", middleware.Metrics(prometheus.DefaultGatherer))
+	app.Get("/health/live", health.Live())
+	app.Get("/health/ready", health.Ready(checker))
+	apiRoutes := app.Group("/api", handlers.WithActor())
 
 	apiRoutes.Get("/status", func(c *fiber.Ctx) error {
 		return c.SendString("ok")
 	})
-	apiRoutes.Get("/v1/author", handlers.GetAuthors)
-	apiRoutes.Get("/v1/books", handlers.GetBooks(services.NewBooksService(dataSources.DB)))
-	apiRoutes.Post("/v1/books", handlers.AddBook(services.NewBooksService(dataSources.DB)))
-	apiRoutes.Delete("/v1/books/:id", handlers.DeleteBook(services.NewBooksService(dataSources.DB)))
-	apiRoutes.Put("/v1/books", handlers.AddBook(services.NewBooksService(dataSources.DB)))
+	cached := middleware.Cache(config.Cache)
+	apiRoutes.Get("/v1/authors", cached, handlers.GetAuthors(services.NewAuthorsService(dataSources.DB, dataSources.Books, dataSources.Photos)))
+	apiRoutes.Get("/v1/authors/:id", cached, handlers.GetAuthorByID(services.NewAuthorsService(dataSources.DB, dataSources.Books, dataSources.Photos)))
+	apiRoutes.Get("/v1/authors/:id/books", cached, handlers.GetAuthorBooks(services.NewAuthorsService(dataSources.DB, dataSources.Books, dataSources.Photos)))
+	apiRoutes.Get("/v1/authors/:id/photo", handlers.GetAuthorPhoto(services.NewAuthorsService(dataSources.DB, dataSources.Books, dataSources.Photos)))
+	apiRoutes.Put("/v1/authors/:id/photo", handlers.UploadAuthorPhoto(services.NewAuthorsService(dataSources.DB, dataSources.Books, dataSources.Photos)))
+	apiRoutes.Post("/v1/authors", handlers.CreateAuthor(services.NewAuthorsService(dataSources.DB, dataSources.Books, dataSources.Photos)))
+	apiRoutes.Put("/v1/authors/:id", handlers.UpdateAuthor(services.NewAuthorsService(dataSources.DB, dataSources.Books, dataSources.Photos)))
+	apiRoutes.Post("/v1/authors/:id/restore", middleware.RequireRole("admin"), handlers.RestoreAuthor(services.NewAuthorsService(dataSources.DB, dataSources.Books, dataSources.Photos)))
+	apiRoutes.Post("/v1/authors/:id/reassign", middleware.RequireRole("admin"), handlers.ReassignAuthor(services.NewAuthorsService(dataSources.DB, dataSources.Books, dataSources.Photos)))
+	apiRoutes.Delete("/v1/authors/:id", handlers.DeleteAuthor(services.NewAuthorsService(dataSources.DB, dataSources.Books, dataSources.Photos)))
+	apiRoutes.Get("/v1/audit", middleware.RequireRole("admin"), handlers.GetAuditLog(services.NewAuthorsService(dataSources.DB, dataSources.Books, dataSources.Photos)))
 
 	return app
 }
@@ -5,14 +5,17 @@ import (
 	"io"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"app/datasources"
 
+	"library/health"
+
 	"github.com/stretchr/testify/assert"
 )
 
 func TestGetStatus(t *testing.T) {
-	app := NewServer(context.Background(), &datasources.DataSources{})
+	app := NewServer(context.Background(), &datasources.DataSources{}, health.NewChecker(time.Second), Config{})
 
 	resp, err := app.Test(httptest.NewRequest("GET", "/api/status", nil))
 	assert.Nil(t, err)
@@ -22,3 +25,57 @@ func TestGetStatus(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "ok", string(body))
 }
+
+func TestMetrics(t *testing.T) {
+	app := NewServer(context.Background(), &datasources.DataSources{}, health.NewChecker(time.Second), Config{})
+
+	_, err := app.Test(httptest.NewRequest("GET", "/api/status", nil))
+	assert.Nil(t, err)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain; version=0.0.4")
+
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), `http_requests_total{method="GET",route="/api/status",status="200"}`)
+	assert.Contains(t, string(body), `http_request_duration_seconds_count{method="GET",route="/api/status"}`)
+}
+
+func TestHealth(t *testing.T) {
+	checker := health.NewChecker(time.Second)
+	checker.Add("database", func(context.Context) error { return nil })
+	app := NewServer(context.Background(), &datasources.DataSources{}, checker, Config{})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/health/live", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/health/ready", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), `"database":{"status":"up"`)
+}
+
+func TestCORS(t *testing.T) {
+	app := NewServer(context.Background(), &datasources.DataSources{}, health.NewChecker(time.Second),
+		Config{CORSOrigins: []string{"https://library.example"}})
+
+	req := httptest.NewRequest("OPTIONS", "/api/status", nil)
+	req.Header.Set("Origin", "https://library.example")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 204, resp.StatusCode)
+	assert.Equal(t, "https://library.example", resp.Header.Get("Access-Control-Allow-Origin"))
+
+	req = httptest.NewRequest("GET", "/api/status", nil)
+	req.Header.Set("Origin", "https://elsewhere.example")
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+}
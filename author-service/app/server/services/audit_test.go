@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"app/datasources/database"
+	"app/server/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	db, err := database.NewDatabase(context.Background(), "", database.PoolConfig{})
+	require.NoError(t, err)
+	service := NewAuthorsService(db, nil, nil)
+
+	ctx := domain.WithActor(context.Background(), domain.Actor{ID: "42", Role: "admin"})
+	ctx = domain.WithRequestID(ctx, "req-1")
+	created, err := service.CreateAuthor(ctx, domain.Author{FirstName: "Mary", LastName: "Godwin"})
+	require.NoError(t, err)
+	created.LastName, created.Nationality = "Shelley", "British"
+	_, err = service.UpdateAuthor(ctx, created)
+	require.NoError(t, err)
+	_, err = service.DeleteAuthor(domain.WithActor(context.Background(), domain.Actor{ID: "7"}), created.ID, domain.DeleteOptions{})
+	require.NoError(t, err)
+
+	entries, err := service.GetAuditLog(context.Background(), domain.AuditQuery{EntityID: created.ID, Actor: "42", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// newest first, an update only keeps the fields it changed
+	update := entries[0]
+	assert.Equal(t, domain.AuditActionUpdate, update.Action)
+	assert.Equal(t, domain.AuditEntityAuthor, update.Entity)
+	assert.Equal(t, "admin", update.ActorRole)
+	assert.Equal(t, "req-1", update.RequestID)
+	assert.Equal(t, map[string]domain.FieldChange{
+		"last_name":   {Before: "Godwin", After: "Shelley"},
+		"nationality": {Before: "", After: "British"},
+	}, update.Changes)
+	assert.Equal(t, domain.AuditActionCreate, entries[1].Action)
+	assert.Equal(t, domain.FieldChange{After: "Godwin"}, entries[1].Changes["last_name"])
+
+	entries, err = service.GetAuditLog(context.Background(), domain.AuditQuery{Actor: "7", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, domain.AuditActionDelete, entries[0].Action)
+	assert.Equal(t, domain.FieldChange{Before: "Shelley"}, entries[0].Changes["last_name"])
+}
+
+func TestAuditLog_RecordFails(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("AddAuthor", mock.Anything, mock.Anything).Return(database.Author{ID: 3, FirstName: "Jane", LastName: "Austen"}, nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(assert.AnError)
+
+	service := NewAuthorsService(mockDB, nil, nil)
+	_, err := service.CreateAuthor(context.Background(), domain.Author{FirstName: "Jane", LastName: "Austen"})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.ErrorContains(t, err, "failed to record audit entry")
+}
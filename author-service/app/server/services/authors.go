@@ -1,48 +1,376 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"app/datasources/books"
 	"app/datasources/database"
+	"app/datasources/photos"
 	"app/server/domain"
-	"context"
 )
 
 type AuthorsService interface {
-	GetAuthors(ctx context.Context) ([]domain.Author, error)
+	GetAuthors(ctx context.Context, query domain.AuthorQuery) (domain.AuthorResponse, error)
 	GetAuthor(ctx context.Context, id int) (domain.Author, error)
 	UpdateAuthor(ctx context.Context, author domain.Author) (domain.Author, error)
-	DeleteAuthor(ctx context.Context, id int) (domain.Author, error)
+	// DeleteAuthor soft deletes an author, a permanent delete is refused
+	// while the author still has books
+	DeleteAuthor(ctx context.Context, id int, options domain.DeleteOptions) (domain.Author, error)
+	RestoreAuthor(ctx context.Context, id int) (domain.Author, error)
+	// PurgeAuthors permanently deletes the authors soft deleted before the given time
+	// who no longer have books
+	PurgeAuthors(ctx context.Context, before time.Time) (int, error)
+	// ReassignAndDeleteAuthor moves the books of an author to another author, then deletes them
+	ReassignAndDeleteAuthor(ctx context.Context, id, toAuthorID int) (domain.ReassignResponse, error)
 	CreateAuthor(ctx context.Context, author domain.Author) (domain.Author, error)
+	GetAuthorStats(ctx context.Context, id int) (domain.AuthorStats, error)
+	GetAuthorBooks(ctx context.Context, id int, query domain.BibliographyQuery) (domain.BibliographyResponse, error)
+	UploadAuthorPhoto(ctx context.Context, id int, data []byte) (domain.Author, error)
+	GetAuthorPhoto(ctx context.Context, id int) (domain.Photo, error)
+	GetAuditLog(ctx context.Context, query domain.AuditQuery) ([]domain.AuditEntry, error)
 }
 
+// defaultPageLimit is the page size used when a query sets none
+const defaultPageLimit = 20
+
 type authorsService struct {
 	db database.Database
+	// books is nil when no book-service is configured
+	books  books.Client
+	photos photos.Store
 }
 
-func (a authorsService) GetAuthors(ctx context.Context) ([]domain.Author, error) {
-	//TODO implement me
-	panic("implement me")
+// defaultAuthorSort lists authors by first name when a query sets no sort
+var defaultAuthorSort = []domain.SortField{{Field: "first_name"}}
+
+// GetAuthors returns a page of authors in the requested sort order, ties are broken
+// by id. One extra row is read to tell whether another page follows.
+func (a authorsService) GetAuthors(ctx context.Context, query domain.AuthorQuery) (domain.AuthorResponse, error) {
+	sortFields, err := domain.ParseSort(query.Sort, database.AuthorSortable)
+	if err != nil {
+		return domain.AuthorResponse{}, err
+	}
+	if len(sortFields) == 0 {
+		sortFields = defaultAuthorSort
+	}
+	sortKey := domain.FormatSort(sortFields)
+	after, err := decodeCursor(query.After, sortKey)
+	if err != nil {
+		return domain.AuthorResponse{}, err
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultPageLimit
+	}
+
+	sort := toDatabaseSort(sortFields)
+	records, err := a.db.ListAuthor(ctx, toDatabaseFilter(query.Filter), sort, after, query.Limit+1)
+	if err != nil {
+		return domain.AuthorResponse{}, fmt.Errorf("failed to list authors: %w", toDomainError(err))
+	}
+
+	response := domain.AuthorResponse{Authors: make([]domain.Author, 0, min(len(records), query.Limit))}
+	if len(records) > query.Limit {
+		records = records[:query.Limit]
+		response.NextCursor = encodeCursor(sortKey, database.AuthorCursor(records[len(records)-1], sort))
+	}
+	for _, record := range records {
+		response.Authors = append(response.Authors, toDomainAuthor(record))
+	}
+	return response, nil
 }
 
 func (a authorsService) GetAuthor(ctx context.Context, id int) (domain.Author, error) {
-	//TODO implement me
-	panic("implement me")
+	record, err := a.db.GetAuthor(ctx, id)
+	if err != nil {
+		return domain.Author{}, fmt.Errorf("failed to get author: %w", toDomainError(err))
+	}
+	return toDomainAuthor(record), nil
 }
 
 func (a authorsService) UpdateAuthor(ctx context.Context, author domain.Author) (domain.Author, error) {
-	//TODO implement me
-	panic("implement me")
+	record, err := validateAuthor(author)
+	if err != nil {
+		return domain.Author{}, err
+	}
+	var updated domain.Author
+	err = a.db.WithinTx(ctx, func(ctx context.Context) error {
+		before, err := a.GetAuthor(ctx, author.ID)
+		if err != nil {
+			return err
+		}
+
+		err = a.db.UpdateAuthor(ctx, database.Author{
+			ID:            author.ID,
+			FirstName:     record.FirstName,
+			LastName:      record.LastName,
+			BirthDate:     record.BirthDate,
+			DeathDate:     record.DeathDate,
+			Nationality:   record.Nationality,
+			Bio:           record.Bio,
+			Website:       record.Website,
+			PhotoURL:      record.PhotoURL,
+			ORCID:         record.ORCID,
+			VIAF:          record.VIAF,
+			OpenLibraryID: record.OpenLibraryID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update author: %w", toDomainError(err))
+		}
+		updated, err = a.GetAuthor(ctx, author.ID)
+		if err != nil {
+			return err
+		}
+		return a.record(ctx, domain.AuditActionUpdate, domain.AuditEntityAuthor, author.ID, before, updated)
+	})
+	if err != nil {
+		return domain.Author{}, err
+	}
+	return updated, nil
 }
 
-func (a authorsService) DeleteAuthor(ctx context.Context, id int) (domain.Author, error) {
-	//TODO implement me
-	panic("implement me")
+func (a authorsService) DeleteAuthor(ctx context.Context, id int, options domain.DeleteOptions) (domain.Author, error) {
+	author, err := a.GetAuthor(ctx, id)
+	if err != nil {
+		return domain.Author{}, err
+	}
+
+	if !options.Permanent {
+		err := a.db.WithinTx(ctx, func(ctx context.Context) error {
+			if err := a.db.SoftDeleteAuthor(ctx, id); err != nil {
+				return fmt.Errorf("failed to soft delete author: %w", toDomainError(err))
+			}
+			return a.record(ctx, domain.AuditActionDelete, domain.AuditEntityAuthor, id, author, nil)
+		})
+		if err != nil {
+			return domain.Author{}, err
+		}
+		return author, nil
+	}
+
+	// without book-service the books of the author cannot be checked
+	if a.books == nil {
+		return domain.Author{}, domain.ErrBookServiceDisabled
+	}
+	bookIDs, err := a.authorBookIDs(ctx, id)
+	if err != nil {
+		return domain.Author{}, err
+	}
+	if len(bookIDs) > 0 {
+		return domain.Author{}, &domain.AuthorHasBooksError{BookIDs: bookIDs}
+	}
+
+	if err := a.deleteAuthor(ctx, id, domain.AuditActionPermanentDelete, author); err != nil {
+		return domain.Author{}, err
+	}
+	return author, nil
+}
+
+// deleteAuthor removes an author and their uploaded photo for good and records it as action.
+// The photo is only removed once the deletion is committed.
+func (a authorsService) deleteAuthor(ctx context.Context, id int, action string, before any) error {
+	err := a.db.WithinTx(ctx, func(ctx context.Context) error {
+		if err := a.db.DeleteAuthor(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete author: %w", toDomainError(err))
+		}
+		return a.record(ctx, action, domain.AuditEntityAuthor, id, before, nil)
+	})
+	if err != nil {
+		return err
+	}
+	if a.photos != nil {
+		if err := a.photos.DeletePhoto(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete photo: %w", err)
+		}
+	}
+	return nil
+}
+
+func (a authorsService) RestoreAuthor(ctx context.Context, id int) (domain.Author, error) {
+	var author domain.Author
+	err := a.db.WithinTx(ctx, func(ctx context.Context) error {
+		if err := a.db.RestoreAuthor(ctx, id); err != nil {
+			return fmt.Errorf("failed to restore author: %w", toDomainError(err))
+		}
+		var err error
+		author, err = a.GetAuthor(ctx, id)
+		if err != nil {
+			return err
+		}
+		return a.record(ctx, domain.AuditActionRestore, domain.AuditEntityAuthor, id, nil, author)
+	})
+	if err != nil {
+		return domain.Author{}, err
+	}
+	return author, nil
+}
+
+// PurgeAuthors deletes for good the authors soft deleted before the given time.
+// Authors whose books are still in book-service are kept until the books are
+// reassigned or deleted, so nothing is purged without book-service.
+func (a authorsService) PurgeAuthors(ctx context.Context, before time.Time) (int, error) {
+	if a.books == nil {
+		return 0, domain.ErrBookServiceDisabled
+	}
+	ids, err := a.db.DeletedAuthorIDs(ctx, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list deleted authors: %w", err)
+	}
+
+	purged := 0
+	for _, id := range ids {
+		bookIDs, err := a.authorBookIDs(ctx, id)
+		if err != nil {
+			return purged, err
+		}
+		if len(bookIDs) > 0 {
+			continue
+		}
+		if err := a.deleteAuthor(ctx, id, domain.AuditActionPurge, nil); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
 }
 
 func (a authorsService) CreateAuthor(ctx context.Context, author domain.Author) (domain.Author, error) {
-	//TODO implement me
-	panic("implement me")
+	record, err := validateAuthor(author)
+	if err != nil {
+		return domain.Author{}, err
+	}
+
+	err = a.db.WithinTx(ctx, func(ctx context.Context) error {
+		created, err := a.db.AddAuthor(ctx, record)
+		if err != nil {
+			return fmt.Errorf("failed to create author: %w", err)
+		}
+		author = toDomainAuthor(created)
+		return a.record(ctx, domain.AuditActionCreate, domain.AuditEntityAuthor, author.ID, nil, author)
+	})
+	if err != nil {
+		return domain.Author{}, err
+	}
+	return author, nil
+}
+
+// NewAuthorsService creates an AuthorsService, books may be nil
+// in which case bibliographies and book counts are unavailable
+func NewAuthorsService(db database.Database, books books.Client, photos photos.Store) AuthorsService {
+	return tracedAuthorsService{next: &authorsService{db: db, books: books, photos: photos}}
+}
+
+// maxBioLength bounds the length of a biography in characters
+const maxBioLength = 5000
+
+// validateAuthor checks the fields of an author and parses its dates into a record
+func validateAuthor(author domain.Author) (database.NewAuthor, error) {
+	if author.FirstName == "" || author.LastName == "" {
+		return database.NewAuthor{}, fmt.Errorf("%w: first_name and last_name are required", domain.ErrInvalidAuthor)
+	}
+	birthDate, err := parseDate("birth_date", author.BirthDate)
+	if err != nil {
+		return database.NewAuthor{}, err
+	}
+	deathDate, err := parseDate("death_date", author.DeathDate)
+	if err != nil {
+		return database.NewAuthor{}, err
+	}
+	if birthDate != nil && deathDate != nil && deathDate.Before(*birthDate) {
+		return database.NewAuthor{}, fmt.Errorf("%w: death_date must not be before birth_date", domain.ErrInvalidAuthor)
+	}
+	if utf8.RuneCountInString(author.Bio) > maxBioLength {
+		return database.NewAuthor{}, fmt.Errorf("%w: bio must not be longer than %d characters", domain.ErrInvalidAuthor, maxBioLength)
+	}
+	if author.Website != "" && !isWebURL(author.Website) {
+		return database.NewAuthor{}, fmt.Errorf("%w: website must be an http or https URL", domain.ErrInvalidAuthor)
+	}
+	// an uploaded photo keeps its path when the author is replaced
+	uploaded := author.ID != 0 && author.PhotoURL == domain.PhotoPath(author.ID)
+	if author.PhotoURL != "" && !uploaded && !isWebURL(author.PhotoURL) {
+		return database.NewAuthor{}, fmt.Errorf("%w: photo_url must be an http or https URL", domain.ErrInvalidAuthor)
+	}
+	if err := validateExternalIDs(author.ExternalIDs); err != nil {
+		return database.NewAuthor{}, err
+	}
+
+	return database.NewAuthor{
+		FirstName:     author.FirstName,
+		LastName:      author.LastName,
+		BirthDate:     birthDate,
+		DeathDate:     deathDate,
+		Nationality:   author.Nationality,
+		Bio:           author.Bio,
+		Website:       author.Website,
+		PhotoURL:      author.PhotoURL,
+		ORCID:         author.ExternalIDs.ORCID,
+		VIAF:          author.ExternalIDs.VIAF,
+		OpenLibraryID: author.ExternalIDs.OpenLibrary,
+	}, nil
+}
+
+// parseDate parses an optional date field, nil when it is empty
+func parseDate(field, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse(domain.BirthDateLayout, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be formatted as %s", domain.ErrInvalidAuthor, field, domain.BirthDateLayout)
+	}
+	return &date, nil
+}
+
+func toDomainAuthor(record database.Author) domain.Author {
+	author := domain.Author{
+		ID:          record.ID,
+		FirstName:   record.FirstName,
+		LastName:    record.LastName,
+		Nationality: record.Nationality,
+		Bio:         record.Bio,
+		Website:     record.Website,
+		PhotoURL:    record.PhotoURL,
+		ExternalIDs: domain.ExternalIDs{
+			ORCID:       record.ORCID,
+			VIAF:        record.VIAF,
+			OpenLibrary: record.OpenLibraryID,
+		},
+	}
+	if record.BirthDate != nil {
+		author.BirthDate = record.BirthDate.Format(domain.BirthDateLayout)
+	}
+	if record.DeathDate != nil {
+		author.DeathDate = record.DeathDate.Format(domain.BirthDateLayout)
+	}
+	author.DeletedAt = record.DeletedAt
+	return author
+}
+
+// toDatabaseFilter converts a domain filter into a database filter
+func toDatabaseFilter(filter domain.AuthorFilter) database.AuthorFilter {
+	return database.AuthorFilter{
+		FirstName:      filter.FirstName,
+		LastName:       filter.LastName,
+		Name:           filter.Name,
+		Nationality:    filter.Nationality,
+		BornFrom:       filter.BornFrom,
+		BornTo:         filter.BornTo,
+		IncludeDeleted: filter.IncludeDeleted,
+	}
 }
 
-func NewAuthorsService(db database.Database) AuthorsService {
-	return &authorsService{db: db}
+// toDomainError maps database errors the handlers need to tell apart onto domain errors
+func toDomainError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrAuthorNotFound):
+		return domain.ErrAuthorNotFound
+	case errors.Is(err, database.ErrInvalidCursor):
+		return domain.ErrInvalidCursor
+	case errors.Is(err, database.ErrInvalidSort):
+		return domain.ErrInvalidSort
+	}
+	return err
 }
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"time"
 
 	"app/server/domain"
 
@@ -12,22 +13,67 @@ type AuthorsServiceMock struct {
 	mock.Mock
 }
 
+func (m *AuthorsServiceMock) GetAuthors(ctx context.Context, query domain.AuthorQuery) (domain.AuthorResponse, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).(domain.AuthorResponse), args.Error(1)
+}
+
 func (m *AuthorsServiceMock) GetAuthor(ctx context.Context, id int) (domain.Author, error) {
-	//TODO implement me
-	panic("implement me")
+	args := m.Called(ctx, id)
+	return args.Get(0).(domain.Author), args.Error(1)
 }
 
 func (m *AuthorsServiceMock) UpdateAuthor(ctx context.Context, author domain.Author) (domain.Author, error) {
-	//TODO implement me
-	panic("implement me")
+	args := m.Called(ctx, author)
+	return args.Get(0).(domain.Author), args.Error(1)
 }
 
-func (m *AuthorsServiceMock) DeleteAuthor(ctx context.Context, id int) (domain.Author, error) {
-	//TODO implement me
-	panic("implement me")
+func (m *AuthorsServiceMock) DeleteAuthor(ctx context.Context, id int, options domain.DeleteOptions) (domain.Author, error) {
+	args := m.Called(ctx, id, options)
+	return args.Get(0).(domain.Author), args.Error(1)
+}
+
+func (m *AuthorsServiceMock) RestoreAuthor(ctx context.Context, id int) (domain.Author, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(domain.Author), args.Error(1)
+}
+
+func (m *AuthorsServiceMock) PurgeAuthors(ctx context.Context, before time.Time) (int, error) {
+	args := m.Called(ctx, before)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *AuthorsServiceMock) ReassignAndDeleteAuthor(ctx context.Context, id, toAuthorID int) (domain.ReassignResponse, error) {
+	args := m.Called(ctx, id, toAuthorID)
+	return args.Get(0).(domain.ReassignResponse), args.Error(1)
 }
 
 func (m *AuthorsServiceMock) CreateAuthor(ctx context.Context, author domain.Author) (domain.Author, error) {
-	//TODO implement me
-	panic("implement me")
+	args := m.Called(ctx, author)
+	return args.Get(0).(domain.Author), args.Error(1)
+}
+
+func (m *AuthorsServiceMock) GetAuthorStats(ctx context.Context, id int) (domain.AuthorStats, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(domain.AuthorStats), args.Error(1)
+}
+
+func (m *AuthorsServiceMock) GetAuthorBooks(ctx context.Context, id int, query domain.BibliographyQuery) (domain.BibliographyResponse, error) {
+	args := m.Called(ctx, id, query)
+	return args.Get(0).(domain.BibliographyResponse), args.Error(1)
+}
+
+func (m *AuthorsServiceMock) UploadAuthorPhoto(ctx context.Context, id int, data []byte) (domain.Author, error) {
+	args := m.Called(ctx, id, data)
+	return args.Get(0).(domain.Author), args.Error(1)
+}
+
+func (m *AuthorsServiceMock) GetAuthorPhoto(ctx context.Context, id int) (domain.Photo, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(domain.Photo), args.Error(1)
+}
+
+func (m *AuthorsServiceMock) GetAuditLog(ctx context.Context, query domain.AuditQuery) ([]domain.AuditEntry, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).([]domain.AuditEntry), args.Error(1)
 }
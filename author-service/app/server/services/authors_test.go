@@ -1 +1,174 @@
 package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"app/datasources/database"
+	"app/server/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAuthors_Pages(t *testing.T) {
+	db, err := database.NewDatabase(context.Background(), "", database.PoolConfig{})
+	require.NoError(t, err)
+	service := NewAuthorsService(db, nil, nil)
+	for _, name := range []string{"Mary", "Anne", "Mary", "Charlotte", "Emily"} {
+		_, err := service.CreateAuthor(context.Background(), domain.Author{FirstName: name, LastName: "Doe"})
+		require.NoError(t, err)
+	}
+
+	var names []string
+	query := domain.AuthorQuery{Limit: 2}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3)
+		page, err := service.GetAuthors(context.Background(), query)
+		require.NoError(t, err)
+		for _, a := range page.Authors {
+			names = append(names, a.FirstName)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.After = page.NextCursor
+	}
+	assert.Equal(t, []string{"Anne", "Charlotte", "Emily", "Mary", "Mary"}, names)
+}
+
+func TestGetAuthors_Sort(t *testing.T) {
+	db, err := database.NewDatabase(context.Background(), "", database.PoolConfig{})
+	require.NoError(t, err)
+	service := NewAuthorsService(db, nil, nil)
+	for _, name := range [][2]string{{"Mary", "Shelley"}, {"Anne", "Bronte"}, {"Emily", "Bronte"}} {
+		_, err := service.CreateAuthor(context.Background(), domain.Author{FirstName: name[0], LastName: name[1]})
+		require.NoError(t, err)
+	}
+
+	page, err := service.GetAuthors(context.Background(), domain.AuthorQuery{Sort: "last_name,-first_name", Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Authors, 2)
+	assert.Equal(t, "Emily", page.Authors[0].FirstName)
+	assert.Equal(t, "Anne", page.Authors[1].FirstName)
+
+	// the cursor is bound to the sort it was issued for
+	_, err = service.GetAuthors(context.Background(), domain.AuthorQuery{After: page.NextCursor, Limit: 2})
+	assert.ErrorIs(t, err, domain.ErrInvalidCursor)
+
+	_, err = service.GetAuthors(context.Background(), domain.AuthorQuery{Sort: "age"})
+	assert.ErrorIs(t, err, domain.ErrInvalidSort)
+}
+
+func TestGetAuthors_InvalidCursor(t *testing.T) {
+	service := NewAuthorsService(new(database.DatabaseMock), nil, nil)
+
+	_, err := service.GetAuthors(context.Background(), domain.AuthorQuery{After: "not a cursor!", Limit: 2})
+	assert.ErrorIs(t, err, domain.ErrInvalidCursor)
+}
+
+func TestGetAuthors_Fail(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("ListAuthor", mock.Anything, database.AuthorFilter{}, []database.SortField{{Field: "first_name"}}, (*database.Cursor)(nil), 3).Return([]database.Author(nil), assert.AnError)
+
+	service := NewAuthorsService(mockDB, nil, nil)
+	_, err := service.GetAuthors(context.Background(), domain.AuthorQuery{Limit: 2})
+	assert.ErrorContains(t, err, "failed to list authors")
+}
+
+func TestCreateAuthor(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("AddAuthor", mock.Anything, mock.MatchedBy(func(a database.NewAuthor) bool {
+		return a.FirstName == "Jane" && a.BirthDate != nil && a.BirthDate.Year() == 1775
+	})).Return(database.Author{ID: 3, FirstName: "Jane", LastName: "Austen"}, nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
+
+	service := NewAuthorsService(mockDB, nil, nil)
+	author, err := service.CreateAuthor(context.Background(), domain.Author{FirstName: "Jane", LastName: "Austen", BirthDate: "1775-12-16"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, author.ID)
+}
+
+func TestCreateAuthor_Invalid(t *testing.T) {
+	service := NewAuthorsService(new(database.DatabaseMock), nil, nil)
+
+	_, err := service.CreateAuthor(context.Background(), domain.Author{FirstName: "Jane"})
+	assert.ErrorIs(t, err, domain.ErrInvalidAuthor)
+
+	_, err = service.CreateAuthor(context.Background(), domain.Author{FirstName: "Jane", LastName: "Austen", BirthDate: "16/12/1775"})
+	assert.ErrorIs(t, err, domain.ErrInvalidAuthor)
+}
+
+func TestCreateAuthor_Profile(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("AddAuthor", mock.Anything, mock.MatchedBy(func(a database.NewAuthor) bool {
+		return a.DeathDate != nil && a.DeathDate.Year() == 1851 && a.ORCID == "0000-0002-1825-0097" && a.OpenLibraryID == "OL23919A"
+	})).Return(database.Author{ID: 3, FirstName: "Mary", LastName: "Shelley", ORCID: "0000-0002-1825-0097"}, nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
+
+	service := NewAuthorsService(mockDB, nil, nil)
+	author, err := service.CreateAuthor(context.Background(), domain.Author{
+		FirstName:   "Mary",
+		LastName:    "Shelley",
+		BirthDate:   "1797-08-30",
+		DeathDate:   "1851-02-01",
+		Website:     "https://maryshelley.example",
+		ExternalIDs: domain.ExternalIDs{ORCID: "0000-0002-1825-0097", VIAF: "95216565", OpenLibrary: "OL23919A"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "0000-0002-1825-0097", author.ExternalIDs.ORCID)
+}
+
+func TestCreateAuthor_InvalidProfile(t *testing.T) {
+	service := NewAuthorsService(new(database.DatabaseMock), nil, nil)
+
+	for name, author := range map[string]domain.Author{
+		"death before birth": {BirthDate: "1851-02-01", DeathDate: "1797-08-30"},
+		"death date format":  {DeathDate: "1851"},
+		"bio too long":       {Bio: strings.Repeat("a", maxBioLength+1)},
+		"website scheme":     {Website: "ftp://maryshelley.example"},
+		"relative photo":     {PhotoURL: "/api/v1/authors/0/photo"},
+		"orcid checksum":     {ExternalIDs: domain.ExternalIDs{ORCID: "0000-0002-1825-0098"}},
+		"viaf letters":       {ExternalIDs: domain.ExternalIDs{VIAF: "VIAF95216565"}},
+		"open library work":  {ExternalIDs: domain.ExternalIDs{OpenLibrary: "OL45883W"}},
+	} {
+		author.FirstName, author.LastName = "Mary", "Shelley"
+		_, err := service.CreateAuthor(context.Background(), author)
+		assert.ErrorIs(t, err, domain.ErrInvalidAuthor, name)
+	}
+}
+
+func TestIsORCID(t *testing.T) {
+	assert.True(t, isORCID("0000-0002-1825-0097"))
+	assert.True(t, isORCID("0000-0002-1694-233X"))
+	assert.False(t, isORCID("0000-0002-1694-2339"))
+	assert.False(t, isORCID("0000000218250097"))
+}
+
+func TestDeleteAuthor_NotFound(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthor", mock.Anything, 4).Return(database.Author{}, database.ErrAuthorNotFound)
+
+	service := NewAuthorsService(mockDB, nil, nil)
+	_, err := service.DeleteAuthor(context.Background(), 4, domain.DeleteOptions{})
+	assert.ErrorIs(t, err, domain.ErrAuthorNotFound)
+	mockDB.AssertNotCalled(t, "DeleteAuthor", mock.Anything, mock.Anything)
+}
+
+func TestRestoreAuthor(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("RestoreAuthor", mock.Anything, 4).Return(nil)
+	mockDB.On("GetAuthor", mock.Anything, 4).Return(database.Author{ID: 4, FirstName: "Mary"}, nil)
+	mockDB.On("RestoreAuthor", mock.Anything, 5).Return(database.ErrAuthorNotFound)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
+
+	service := NewAuthorsService(mockDB, nil, nil)
+	author, err := service.RestoreAuthor(context.Background(), 4)
+	require.NoError(t, err)
+	assert.Equal(t, "Mary", author.FirstName)
+
+	_, err = service.RestoreAuthor(context.Background(), 5)
+	assert.ErrorIs(t, err, domain.ErrAuthorNotFound)
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"app/datasources/books"
+	"app/server/domain"
+)
+
+// forwardCaller makes the calls to book-service for the caller of the request
+// being served, so book-service applies its own access rules to them
+func forwardCaller(ctx context.Context) context.Context {
+	actor := domain.ActorFromContext(ctx)
+	return books.WithCaller(ctx, books.Caller{
+		UserID:    actor.ID,
+		Role:      actor.Role,
+		RequestID: domain.RequestIDFromContext(ctx),
+		Token:     actor.Token,
+	})
+}
+
+// GetAuthorStats asks book-service for the counts of the books of an author
+func (a authorsService) GetAuthorStats(ctx context.Context, id int) (domain.AuthorStats, error) {
+	if a.books == nil {
+		return domain.AuthorStats{}, domain.ErrBookServiceDisabled
+	}
+
+	stats, err := a.books.GetAuthorStats(forwardCaller(ctx), id)
+	if err != nil {
+		return domain.AuthorStats{}, fmt.Errorf("%w: %w", domain.ErrBookServiceUnavailable, err)
+	}
+	return domain.AuthorStats{
+		Titles:          stats.Titles,
+		TotalCopies:     stats.TotalCopies,
+		AvailableCopies: stats.AvailableCopies,
+		ActiveLoans:     stats.ActiveLoans,
+	}, nil
+}
+
+// GetAuthorBooks returns a page of the books of an existing author from book-service
+func (a authorsService) GetAuthorBooks(ctx context.Context, id int, query domain.BibliographyQuery) (domain.BibliographyResponse, error) {
+	if _, err := a.db.GetAuthor(ctx, id); err != nil {
+		return domain.BibliographyResponse{}, fmt.Errorf("failed to get author: %w", toDomainError(err))
+	}
+	if a.books == nil {
+		return domain.BibliographyResponse{}, domain.ErrBookServiceDisabled
+	}
+
+	page, err := a.books.ListAuthorBooks(forwardCaller(ctx), id, books.PageQuery{Sort: query.Sort, After: query.After, Limit: query.Limit})
+	var statusErr *books.StatusError
+	if books.IsClientError(err) && errors.As(err, &statusErr) {
+		return domain.BibliographyResponse{}, fmt.Errorf("%w: %s", domain.ErrInvalidBibliography, statusErr.Message)
+	}
+	if err != nil {
+		return domain.BibliographyResponse{}, fmt.Errorf("%w: %w", domain.ErrBookServiceUnavailable, err)
+	}
+
+	response := domain.BibliographyResponse{
+		AuthorID:   id,
+		Books:      make([]domain.Book, 0, len(page.Books)),
+		NextCursor: page.NextCursor,
+	}
+	for _, book := range page.Books {
+		response.Books = append(response.Books, domain.Book{
+			ID:          book.ID,
+			Title:       book.Title,
+			ISBN:        book.ISBN,
+			ISBN10:      book.ISBN10,
+			CategoryID:  book.CategoryID,
+			PublishDate: book.PublishDate,
+			Description: book.Description,
+		})
+	}
+	return response, nil
+}
+
+// bookIDsPageLimit is the page size used to collect the books of an author
+const bookIDsPageLimit = 100
+
+// authorBookIDs collects the ids of all books of an author from book-service
+func (a authorsService) authorBookIDs(ctx context.Context, id int) ([]int, error) {
+	var ids []int
+	query := books.PageQuery{Limit: bookIDsPageLimit}
+	for {
+		page, err := a.books.ListAuthorBooks(forwardCaller(ctx), id, query)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", domain.ErrBookServiceUnavailable, err)
+		}
+		for _, book := range page.Books {
+			ids = append(ids, book.ID)
+		}
+		if page.NextCursor == "" {
+			return ids, nil
+		}
+		query.After = page.NextCursor
+	}
+}
+
+// ReassignAndDeleteAuthor moves every book of an author to another existing author
+// and permanently deletes the author once no book is left, see DeleteAuthor
+func (a authorsService) ReassignAndDeleteAuthor(ctx context.Context, id, toAuthorID int) (domain.ReassignResponse, error) {
+	if toAuthorID == id {
+		return domain.ReassignResponse{}, fmt.Errorf("%w: the books must move to another author", domain.ErrInvalidReassign)
+	}
+	if _, err := a.GetAuthor(ctx, id); err != nil {
+		return domain.ReassignResponse{}, err
+	}
+	_, err := a.GetAuthor(ctx, toAuthorID)
+	if errors.Is(err, domain.ErrAuthorNotFound) {
+		return domain.ReassignResponse{}, fmt.Errorf("%w: author %d not found", domain.ErrInvalidReassign, toAuthorID)
+	}
+	if err != nil {
+		return domain.ReassignResponse{}, err
+	}
+	if a.books == nil {
+		return domain.ReassignResponse{}, domain.ErrBookServiceDisabled
+	}
+
+	moved, err := a.books.ReassignAuthorBooks(forwardCaller(ctx), id, toAuthorID)
+	if err != nil {
+		return domain.ReassignResponse{}, fmt.Errorf("%w: %w", domain.ErrBookServiceUnavailable, err)
+	}
+	err = a.record(ctx, domain.AuditActionReassignBooks, domain.AuditEntityAuthor, id, nil, map[string]int{
+		"to_author_id": toAuthorID,
+		"reassigned":   moved,
+	})
+	if err != nil {
+		return domain.ReassignResponse{}, err
+	}
+	author, err := a.DeleteAuthor(ctx, id, domain.DeleteOptions{Permanent: true})
+	if err != nil {
+		return domain.ReassignResponse{}, err
+	}
+	return domain.ReassignResponse{Author: author, ToAuthorID: toAuthorID, Reassigned: moved}, nil
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"app/datasources/books"
+	"app/datasources/database"
+	"app/datasources/photos"
+	"app/server/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAuthorStats(t *testing.T) {
+	client := new(books.ClientMock)
+	client.On("GetAuthorStats", mock.Anything, 4).Return(books.AuthorStats{Titles: 2, TotalCopies: 5, AvailableCopies: 4, ActiveLoans: 1}, nil)
+
+	service := NewAuthorsService(new(database.DatabaseMock), client, nil)
+	stats, err := service.GetAuthorStats(context.Background(), 4)
+	require.NoError(t, err)
+	assert.Equal(t, domain.AuthorStats{Titles: 2, TotalCopies: 5, AvailableCopies: 4, ActiveLoans: 1}, stats)
+}
+
+func TestGetAuthorStats_NoBookService(t *testing.T) {
+	service := NewAuthorsService(new(database.DatabaseMock), nil, nil)
+	_, err := service.GetAuthorStats(context.Background(), 4)
+	assert.ErrorIs(t, err, domain.ErrBookServiceDisabled)
+}
+
+func TestGetAuthorBooks(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthor", mock.Anything, 4).Return(database.Author{ID: 4}, nil)
+	client := new(books.ClientMock)
+	client.On("ListAuthorBooks", mock.Anything, 4, books.PageQuery{Sort: "title", Limit: 2}).
+		Return(books.BooksPage{Books: []books.Book{{ID: 1, Title: "Frankenstein", AuthorID: 4}}, NextCursor: "next"}, nil)
+
+	service := NewAuthorsService(mockDB, client, nil)
+	page, err := service.GetAuthorBooks(context.Background(), 4, domain.BibliographyQuery{Sort: "title", Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 4, page.AuthorID)
+	assert.Equal(t, []domain.Book{{ID: 1, Title: "Frankenstein"}}, page.Books)
+	assert.Equal(t, "next", page.NextCursor)
+}
+
+func TestGetAuthorBooks_AuthorNotFound(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthor", mock.Anything, 4).Return(database.Author{}, database.ErrAuthorNotFound)
+	client := new(books.ClientMock)
+
+	service := NewAuthorsService(mockDB, client, nil)
+	_, err := service.GetAuthorBooks(context.Background(), 4, domain.BibliographyQuery{})
+	assert.ErrorIs(t, err, domain.ErrAuthorNotFound)
+	client.AssertNotCalled(t, "ListAuthorBooks", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetAuthorBooks_BookServiceErrors(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthor", mock.Anything, 4).Return(database.Author{ID: 4}, nil)
+	client := new(books.ClientMock)
+	client.On("ListAuthorBooks", mock.Anything, 4, books.PageQuery{After: "broken"}).
+		Return(books.BooksPage{}, &books.StatusError{StatusCode: 400, Message: "invalid cursor"})
+	client.On("ListAuthorBooks", mock.Anything, 4, books.PageQuery{}).
+		Return(books.BooksPage{}, &books.StatusError{StatusCode: 500, Message: "internal error"})
+
+	service := NewAuthorsService(mockDB, client, nil)
+	_, err := service.GetAuthorBooks(context.Background(), 4, domain.BibliographyQuery{After: "broken"})
+	assert.ErrorIs(t, err, domain.ErrInvalidBibliography)
+	assert.ErrorContains(t, err, "invalid cursor")
+
+	_, err = service.GetAuthorBooks(context.Background(), 4, domain.BibliographyQuery{})
+	assert.ErrorIs(t, err, domain.ErrBookServiceUnavailable)
+}
+
+func TestDeleteAuthor_HasBooks(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthor", mock.Anything, 4).Return(database.Author{ID: 4}, nil)
+	client := new(books.ClientMock)
+	client.On("ListAuthorBooks", mock.Anything, 4, books.PageQuery{Limit: bookIDsPageLimit}).
+		Return(books.BooksPage{Books: []books.Book{{ID: 1}, {ID: 2}}, NextCursor: "next"}, nil)
+	client.On("ListAuthorBooks", mock.Anything, 4, books.PageQuery{After: "next", Limit: bookIDsPageLimit}).
+		Return(books.BooksPage{Books: []books.Book{{ID: 5}}}, nil)
+
+	service := NewAuthorsService(mockDB, client, nil)
+	_, err := service.DeleteAuthor(context.Background(), 4, domain.DeleteOptions{Permanent: true})
+	var hasBooks *domain.AuthorHasBooksError
+	require.ErrorAs(t, err, &hasBooks)
+	assert.ErrorIs(t, err, domain.ErrAuthorHasBooks)
+	assert.Equal(t, []int{1, 2, 5}, hasBooks.BookIDs)
+	mockDB.AssertNotCalled(t, "DeleteAuthor", mock.Anything, mock.Anything)
+}
+
+func TestDeleteAuthor_NoBooks(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthor", mock.Anything, 4).Return(database.Author{ID: 4}, nil)
+	mockDB.On("DeleteAuthor", mock.Anything, 4).Return(nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.MatchedBy(func(e database.NewAuditEntry) bool {
+		return e.Action == "permanent_delete" && e.EntityID == 4
+	})).Return(nil)
+	client := new(books.ClientMock)
+	client.On("ListAuthorBooks", mock.Anything, 4, mock.Anything).Return(books.BooksPage{}, nil)
+
+	store := new(photos.StoreMock)
+	store.On("DeletePhoto", mock.Anything, 4).Return(nil)
+
+	service := NewAuthorsService(mockDB, client, store)
+	author, err := service.DeleteAuthor(context.Background(), 4, domain.DeleteOptions{Permanent: true})
+	require.NoError(t, err)
+	assert.Equal(t, 4, author.ID)
+	mockDB.AssertExpectations(t)
+}
+
+func TestDeleteAuthor_NoBookService(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthor", mock.Anything, 4).Return(database.Author{ID: 4}, nil)
+
+	service := NewAuthorsService(mockDB, nil, nil)
+	_, err := service.DeleteAuthor(context.Background(), 4, domain.DeleteOptions{Permanent: true})
+	assert.ErrorIs(t, err, domain.ErrBookServiceDisabled)
+	mockDB.AssertNotCalled(t, "DeleteAuthor", mock.Anything, mock.Anything)
+}
+
+func TestDeleteAuthor_Soft(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthor", mock.Anything, 4).Return(database.Author{ID: 4}, nil)
+	mockDB.On("SoftDeleteAuthor", mock.Anything, 4).Return(nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
+
+	// soft deletes keep the row, so the books are not checked
+	service := NewAuthorsService(mockDB, nil, nil)
+	_, err := service.DeleteAuthor(context.Background(), 4, domain.DeleteOptions{})
+	require.NoError(t, err)
+	mockDB.AssertExpectations(t)
+}
+
+func TestPurgeAuthors(t *testing.T) {
+	before := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("DeletedAuthorIDs", mock.Anything, before).Return([]int{4, 6}, nil)
+	mockDB.On("DeleteAuthor", mock.Anything, 6).Return(nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
+	client := new(books.ClientMock)
+	client.On("ListAuthorBooks", mock.Anything, 4, mock.Anything).Return(books.BooksPage{Books: []books.Book{{ID: 1}}}, nil)
+	client.On("ListAuthorBooks", mock.Anything, 6, mock.Anything).Return(books.BooksPage{}, nil)
+	store := new(photos.StoreMock)
+	store.On("DeletePhoto", mock.Anything, 6).Return(nil)
+
+	// author 4 still has a book and is kept
+	service := NewAuthorsService(mockDB, client, store)
+	purged, err := service.PurgeAuthors(context.Background(), before)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	mockDB.AssertNotCalled(t, "DeleteAuthor", mock.Anything, 4)
+	store.AssertExpectations(t)
+}
+
+func TestPurgeAuthors_NoBookService(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+
+	service := NewAuthorsService(mockDB, nil, nil)
+	_, err := service.PurgeAuthors(context.Background(), time.Now())
+	assert.ErrorIs(t, err, domain.ErrBookServiceDisabled)
+	mockDB.AssertNotCalled(t, "DeletedAuthorIDs", mock.Anything, mock.Anything)
+}
+
+func TestReassignAndDeleteAuthor(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthor", mock.Anything, 4).Return(database.Author{ID: 4, FirstName: "Mary"}, nil)
+	mockDB.On("GetAuthor", mock.Anything, 6).Return(database.Author{ID: 6}, nil)
+	mockDB.On("DeleteAuthor", mock.Anything, 4).Return(nil)
+	client := new(books.ClientMock)
+	// book-service gets the call as the caller of author-service
+	forwarded := mock.MatchedBy(func(ctx context.Context) bool {
+		return books.CallerFromContext(ctx) == books.Caller{UserID: "42", Role: "admin", RequestID: "req-1", Token: "tok"}
+	})
+	client.On("ReassignAuthorBooks", forwarded, 4, 6).Return(3, nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
+	client.On("ListAuthorBooks", forwarded, 4, mock.Anything).Return(books.BooksPage{}, nil)
+
+	service := NewAuthorsService(mockDB, client, nil)
+	ctx := domain.WithRequestID(domain.WithActor(context.Background(), domain.Actor{ID: "42", Role: "admin", Token: "tok"}), "req-1")
+	response, err := service.ReassignAndDeleteAuthor(ctx, 4, 6)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReassignResponse{Author: domain.Author{ID: 4, FirstName: "Mary"}, ToAuthorID: 6, Reassigned: 3}, response)
+	mockDB.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func TestReassignAndDeleteAuthor_Invalid(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthor", mock.Anything, 4).Return(database.Author{ID: 4}, nil)
+	mockDB.On("GetAuthor", mock.Anything, 6).Return(database.Author{}, database.ErrAuthorNotFound)
+	client := new(books.ClientMock)
+
+	service := NewAuthorsService(mockDB, client, nil)
+	_, err := service.ReassignAndDeleteAuthor(context.Background(), 4, 4)
+	assert.ErrorIs(t, err, domain.ErrInvalidReassign)
+	_, err = service.ReassignAndDeleteAuthor(context.Background(), 4, 6)
+	assert.ErrorIs(t, err, domain.ErrInvalidReassign)
+	client.AssertNotCalled(t, "ReassignAuthorBooks", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"app/server/domain"
+)
+
+// maxURLLength bounds the length of the website and photo URLs
+const maxURLLength = 2048
+
+var (
+	orcidPattern       = regexp.MustCompile(`^\d{4}-\d{4}-\d{4}-\d{3}[\dX]$`)
+	viafPattern        = regexp.MustCompile(`^[1-9]\d{0,21}$`)
+	openLibraryPattern = regexp.MustCompile(`^OL[1-9]\d*A$`)
+)
+
+// validateExternalIDs checks the format of the set identifiers
+func validateExternalIDs(ids domain.ExternalIDs) error {
+	if ids.ORCID != "" && !isORCID(ids.ORCID) {
+		return fmt.Errorf("%w: orcid must be a valid ORCID iD such as 0000-0002-1825-0097", domain.ErrInvalidAuthor)
+	}
+	if ids.VIAF != "" && !viafPattern.MatchString(ids.VIAF) {
+		return fmt.Errorf("%w: viaf must be a numeric VIAF id", domain.ErrInvalidAuthor)
+	}
+	if ids.OpenLibrary != "" && !openLibraryPattern.MatchString(ids.OpenLibrary) {
+		return fmt.Errorf("%w: open_library must be an Open Library author key such as OL23919A", domain.ErrInvalidAuthor)
+	}
+	return nil
+}
+
+// isORCID checks the format and the ISO 7064 MOD 11-2 check digit of an ORCID iD
+func isORCID(id string) bool {
+	if !orcidPattern.MatchString(id) {
+		return false
+	}
+	total := 0
+	for _, r := range id[:len(id)-1] {
+		if r != '-' {
+			total = (total + int(r-'0')) * 2
+		}
+	}
+	check := (12 - total%11) % 11
+	want := byte('0' + check)
+	if check == 10 {
+		want = 'X'
+	}
+	return id[len(id)-1] == want
+}
+
+// isWebURL reports whether value is an absolute http or https URL
+func isWebURL(value string) bool {
+	if len(value) > maxURLLength {
+		return false
+	}
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"app/datasources/photos"
+	"app/server/domain"
+)
+
+// photoTypes are the image types accepted as author photos
+var photoTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// UploadAuthorPhoto stores data as the photo of an existing author and points
+// their photo_url at it. The type is detected from the content.
+func (a authorsService) UploadAuthorPhoto(ctx context.Context, id int, data []byte) (domain.Author, error) {
+	if len(data) == 0 || len(data) > domain.MaxPhotoSize {
+		return domain.Author{}, fmt.Errorf("%w: the photo must not be empty or larger than %d bytes", domain.ErrInvalidPhoto, domain.MaxPhotoSize)
+	}
+	contentType := http.DetectContentType(data)
+	if !photoTypes[contentType] {
+		return domain.Author{}, fmt.Errorf("%w: the photo must be a JPEG, PNG or WebP image", domain.ErrInvalidPhoto)
+	}
+	before, err := a.GetAuthor(ctx, id)
+	if err != nil {
+		return domain.Author{}, err
+	}
+
+	if err := a.photos.SavePhoto(ctx, id, photos.Photo{ContentType: contentType, Data: data}); err != nil {
+		return domain.Author{}, fmt.Errorf("failed to save photo: %w", err)
+	}
+	var author domain.Author
+	err = a.db.WithinTx(ctx, func(ctx context.Context) error {
+		if err := a.db.SetAuthorPhoto(ctx, id, domain.PhotoPath(id)); err != nil {
+			return fmt.Errorf("failed to set author photo: %w", toDomainError(err))
+		}
+		author, err = a.GetAuthor(ctx, id)
+		if err != nil {
+			return err
+		}
+		return a.record(ctx, domain.AuditActionUploadPhoto, domain.AuditEntityAuthor, id, before, author)
+	})
+	if err != nil {
+		return domain.Author{}, err
+	}
+	return author, nil
+}
+
+// GetAuthorPhoto returns the uploaded photo of an author, ErrPhotoNotFound
+// when their photo_url does not point at an uploaded photo
+func (a authorsService) GetAuthorPhoto(ctx context.Context, id int) (domain.Photo, error) {
+	author, err := a.GetAuthor(ctx, id)
+	if err != nil {
+		return domain.Photo{}, err
+	}
+	if author.PhotoURL != domain.PhotoPath(id) {
+		return domain.Photo{}, domain.ErrPhotoNotFound
+	}
+
+	photo, err := a.photos.GetPhoto(ctx, id)
+	if errors.Is(err, photos.ErrPhotoNotFound) {
+		return domain.Photo{}, domain.ErrPhotoNotFound
+	}
+	if err != nil {
+		return domain.Photo{}, fmt.Errorf("failed to get photo: %w", err)
+	}
+	return domain.Photo{ContentType: photo.ContentType, Data: photo.Data}, nil
+}
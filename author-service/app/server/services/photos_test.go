@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"app/datasources/database"
+	"app/datasources/photos"
+	"app/server/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// pngHeader is the start of a PNG file, enough to detect its type
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestUploadAuthorPhoto(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthor", mock.Anything, 3).Return(database.Author{ID: 3, FirstName: "Mary"}, nil).Once()
+	mockDB.On("SetAuthorPhoto", mock.Anything, 3, "/api/v1/authors/3/photo").Return(nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
+	mockDB.On("GetAuthor", mock.Anything, 3).Return(database.Author{ID: 3, FirstName: "Mary", PhotoURL: "/api/v1/authors/3/photo"}, nil)
+	store := new(photos.StoreMock)
+	store.On("SavePhoto", mock.Anything, 3, photos.Photo{ContentType: "image/png", Data: pngHeader}).Return(nil)
+
+	service := NewAuthorsService(mockDB, nil, store)
+	author, err := service.UploadAuthorPhoto(context.Background(), 3, pngHeader)
+	require.NoError(t, err)
+	assert.Equal(t, "/api/v1/authors/3/photo", author.PhotoURL)
+	store.AssertExpectations(t)
+}
+
+func TestUploadAuthorPhoto_Invalid(t *testing.T) {
+	store := new(photos.StoreMock)
+	service := NewAuthorsService(new(database.DatabaseMock), nil, store)
+
+	_, err := service.UploadAuthorPhoto(context.Background(), 3, []byte("GIF89a"))
+	assert.ErrorIs(t, err, domain.ErrInvalidPhoto)
+	_, err = service.UploadAuthorPhoto(context.Background(), 3, nil)
+	assert.ErrorIs(t, err, domain.ErrInvalidPhoto)
+	store.AssertNotCalled(t, "SavePhoto", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetAuthorPhoto(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthor", mock.Anything, 3).Return(database.Author{ID: 3, PhotoURL: "/api/v1/authors/3/photo"}, nil)
+	mockDB.On("GetAuthor", mock.Anything, 4).Return(database.Author{ID: 4, PhotoURL: "https://example.com/4.jpg"}, nil)
+	store := new(photos.StoreMock)
+	store.On("GetPhoto", mock.Anything, 3).Return(photos.Photo{ContentType: "image/png", Data: pngHeader}, nil)
+
+	service := NewAuthorsService(mockDB, nil, store)
+	photo, err := service.GetAuthorPhoto(context.Background(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, domain.Photo{ContentType: "image/png", Data: pngHeader}, photo)
+
+	// a photo linked elsewhere is not served
+	_, err = service.GetAuthorPhoto(context.Background(), 4)
+	assert.ErrorIs(t, err, domain.ErrPhotoNotFound)
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"app/server/domain"
+
+	"library/tracing"
+)
+
+// tracedAuthorsService runs every call of the service it wraps in a span named after the method
+type tracedAuthorsService struct {
+	next AuthorsService
+}
+
+// traced runs call in a span, failed calls mark the span failed
+func traced[T any](ctx context.Context, method string, call func(context.Context) (T, error)) (T, error) {
+	ctx, span := tracing.Start(ctx, method)
+	defer span.End()
+	result, err := call(ctx)
+	tracing.RecordError(span, err)
+	return result, err
+}
+
+func tracedCall(ctx context.Context, method string, call func(context.Context) error) error {
+	_, err := traced(ctx, method, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, call(ctx)
+	})
+	return err
+}
+
+func (s tracedAuthorsService) GetAuthors(ctx context.Context, query domain.AuthorQuery) (domain.AuthorResponse, error) {
+	return traced(ctx, "AuthorsService.GetAuthors", func(ctx context.Context) (domain.AuthorResponse, error) {
+		return s.next.GetAuthors(ctx, query)
+	})
+}
+
+func (s tracedAuthorsService) GetAuthor(ctx context.Context, id int) (domain.Author, error) {
+	return traced(ctx, "AuthorsService.GetAuthor", func(ctx context.Context) (domain.Author, error) {
+		return s.next.GetAuthor(ctx, id)
+	})
+}
+
+func (s tracedAuthorsService) UpdateAuthor(ctx context.Context, author domain.Author) (domain.Author, error) {
+	return traced(ctx, "AuthorsService.UpdateAuthor", func(ctx context.Context) (domain.Author, error) {
+		return s.next.UpdateAuthor(ctx, author)
+	})
+}
+
+func (s tracedAuthorsService) DeleteAuthor(ctx context.Context, id int, options domain.DeleteOptions) (domain.Author, error) {
+	return traced(ctx, "AuthorsService.DeleteAuthor", func(ctx context.Context) (domain.Author, error) {
+		return s.next.DeleteAuthor(ctx, id, options)
+	})
+}
+
+func (s tracedAuthorsService) RestoreAuthor(ctx context.Context, id int) (domain.Author, error) {
+	return traced(ctx, "AuthorsService.RestoreAuthor", func(ctx context.Context) (domain.Author, error) {
+		return s.next.RestoreAuthor(ctx, id)
+	})
+}
+
+func (s tracedAuthorsService) PurgeAuthors(ctx context.Context, before time.Time) (int, error) {
+	return traced(ctx, "AuthorsService.PurgeAuthors", func(ctx context.Context) (int, error) {
+		return s.next.PurgeAuthors(ctx, before)
+	})
+}
+
+func (s tracedAuthorsService) ReassignAndDeleteAuthor(ctx context.Context, id, toAuthorID int) (domain.ReassignResponse, error) {
+	return traced(ctx, "AuthorsService.ReassignAndDeleteAuthor", func(ctx context.Context) (domain.ReassignResponse, error) {
+		return s.next.ReassignAndDeleteAuthor(ctx, id, toAuthorID)
+	})
+}
+
+func (s tracedAuthorsService) CreateAuthor(ctx context.Context, author domain.Author) (domain.Author, error) {
+	return traced(ctx, "AuthorsService.CreateAuthor", func(ctx context.Context) (domain.Author, error) {
+		return s.next.CreateAuthor(ctx, author)
+	})
+}
+
+func (s tracedAuthorsService) GetAuthorStats(ctx context.Context, id int) (domain.AuthorStats, error) {
+	return traced(ctx, "AuthorsService.GetAuthorStats", func(ctx context.Context) (domain.AuthorStats, error) {
+		return s.next.GetAuthorStats(ctx, id)
+	})
+}
+
+func (s tracedAuthorsService) GetAuthorBooks(ctx context.Context, id int, query domain.BibliographyQuery) (domain.BibliographyResponse, error) {
+	return traced(ctx, "AuthorsService.GetAuthorBooks", func(ctx context.Context) (domain.BibliographyResponse, error) {
+		return s.next.GetAuthorBooks(ctx, id, query)
+	})
+}
+
+func (s tracedAuthorsService) UploadAuthorPhoto(ctx context.Context, id int, data []byte) (domain.Author, error) {
+	return traced(ctx, "AuthorsService.UploadAuthorPhoto", func(ctx context.Context) (domain.Author, error) {
+		return s.next.UploadAuthorPhoto(ctx, id, data)
+	})
+}
+
+func (s tracedAuthorsService) GetAuthorPhoto(ctx context.Context, id int) (domain.Photo, error) {
+	return traced(ctx, "AuthorsService.GetAuthorPhoto", func(ctx context.Context) (domain.Photo, error) {
+		return s.next.GetAuthorPhoto(ctx, id)
+	})
+}
+
+func (s tracedAuthorsService) GetAuditLog(ctx context.Context, query domain.AuditQuery) ([]domain.AuditEntry, error) {
+	return traced(ctx, "AuthorsService.GetAuditLog", func(ctx context.Context) ([]domain.AuditEntry, error) {
+		return s.next.GetAuditLog(ctx, query)
+	})
+}
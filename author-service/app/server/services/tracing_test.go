@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"app/datasources/database"
+	"app/server/domain"
+
+	"library/tracing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTracedAuthorsService(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracing.SetDefault(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer tracing.SetDefault(noop.NewTracerProvider())
+
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthor", mock.MatchedBy(func(ctx context.Context) bool {
+		return trace.SpanContextFromContext(ctx).IsValid()
+	}), 4).Return(database.Author{}, database.ErrAuthorNotFound)
+
+	ctx, parent := tracing.Start(context.Background(), "DELETE /api/v1/authors/:id")
+	_, err := NewAuthorsService(mockDB, nil, nil).DeleteAuthor(ctx, 4, domain.DeleteOptions{})
+	assert.ErrorIs(t, err, domain.ErrAuthorNotFound)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "AuthorsService.DeleteAuthor", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, sdktrace.Status{Code: codes.Error, Description: err.Error()}, spans[0].Status())
+	mockDB.AssertExpectations(t)
+}
@@ -1,9 +1,68 @@
 CREATE TABLE IF NOT EXISTS authors (
-     id INT PRIMARY KEY AUTO_INCREMENT,
-     first_name VARCHAR(100) NOT NULL,
-     last_name VARCHAR(100) NOT NULL,
+     id SERIAL PRIMARY KEY,
+     -- ICU en-US collation, the in-memory backend pages in the same order
+     first_name VARCHAR(100) COLLATE "en-US-x-icu" NOT NULL,
+     last_name VARCHAR(100) COLLATE "en-US-x-icu" NOT NULL,
      birth_date DATE,
-     nationality VARCHAR(100),
+     death_date DATE CHECK (death_date >= birth_date),
+     nationality VARCHAR(100) COLLATE "en-US-x-icu" NOT NULL DEFAULT '',
+     bio TEXT NOT NULL DEFAULT '',
+     website VARCHAR(2048) NOT NULL DEFAULT '',
+     photo_url VARCHAR(2048) NOT NULL DEFAULT '',
+     -- external identifiers, empty when unknown
+     orcid VARCHAR(19) NOT NULL DEFAULT '',
+     viaf VARCHAR(22) NOT NULL DEFAULT '',
+     open_library_id VARCHAR(20) NOT NULL DEFAULT '',
      created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+     -- set by soft deletes, such authors are hidden but still referenced by their books
+     deleted_at TIMESTAMP
 );
+
+-- keyset pagination reads (first_name, id) in index order
+CREATE INDEX IF NOT EXISTS idx_authors_first_name_id ON authors (first_name, id);
+
+CREATE INDEX IF NOT EXISTS idx_authors_nationality ON authors (nationality);
+CREATE INDEX IF NOT EXISTS idx_authors_birth_date ON authors (birth_date);
+
+-- audit_log is append-only, the triggers reject any change to recorded entries
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL,
+    actor_role VARCHAR(50) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    entity VARCHAR(50) NOT NULL,
+    entity_id INT NOT NULL,
+    changes JSONB NOT NULL,
+    request_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log (entity, entity_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_no_update ON audit_log;
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+-- outbox holds the domain events until the relay published them
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(100) NOT NULL,
+    aggregate_id INT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX idx_outbox_pending ON outbox (id) WHERE published_at IS NULL;
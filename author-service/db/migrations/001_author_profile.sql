@@ -0,0 +1,10 @@
+-- Adds the biography, death date, links and external identifiers of authors
+-- to databases created before they were part of init_db.sql.
+ALTER TABLE authors
+    ADD COLUMN IF NOT EXISTS death_date DATE CHECK (death_date >= birth_date),
+    ADD COLUMN IF NOT EXISTS bio TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS website VARCHAR(2048) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS photo_url VARCHAR(2048) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS orcid VARCHAR(19) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS viaf VARCHAR(22) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS open_library_id VARCHAR(20) NOT NULL DEFAULT '';
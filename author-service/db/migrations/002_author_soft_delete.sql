@@ -0,0 +1,2 @@
+-- Lets authors be soft deleted while their books still reference them.
+ALTER TABLE authors ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
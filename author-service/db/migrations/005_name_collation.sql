@@ -0,0 +1,5 @@
+-- Names sort with the ICU en-US collation, the in-memory backend pages in the same order.
+ALTER TABLE authors
+    ALTER COLUMN first_name TYPE VARCHAR(100) COLLATE "en-US-x-icu",
+    ALTER COLUMN last_name TYPE VARCHAR(100) COLLATE "en-US-x-icu",
+    ALTER COLUMN nationality TYPE VARCHAR(100) COLLATE "en-US-x-icu";
@@ -2,30 +2,137 @@ package main
 
 import (
 	"log/slog"
-	"os"
+	"time"
+
+	"app/datasources/database"
+	"app/datasources/notifications"
+	"app/server"
+	"app/server/services"
+
+	"library/config"
+	"library/events"
+	"library/middleware"
+	"library/tracing"
 )
 
-// Configuration is used to store values from environment variables
+// Configuration is used to store the settings of the service, see config.Loader for
+// where they are read from
 type Configuration struct {
 	Port        string
 	DatabaseURL string
+	Pool        database.PoolConfig
+	// Server holds the HTTP timeouts, the origins allowed by CORS, the JWT key and the response cache
+	Server     server.Config
+	LoanPolicy database.LoanPolicy
+	// PurgeRetention is how long deleted books are kept, zero disables purging
+	PurgeRetention time.Duration
+	PurgeInterval  time.Duration
+	// Events selects where the outbox relay publishes domain events, an empty sink disables it
+	Events        events.Config
+	RelayInterval time.Duration
+	// WebhookInterval is how often due webhook deliveries are sent, zero disables sending
+	WebhookInterval time.Duration
+	WebhookRetry    services.WebhookRetryPolicy
+	// Notifier sends the loan reminders, which go out every ReminderInterval for loans
+	// due within ReminderDueSoon. A zero interval disables them.
+	Notifier         notifications.Config
+	ReminderInterval time.Duration
+	ReminderDueSoon  time.Duration
+	// LogLevel is the lowest level logged, debug also logs every database query
+	LogLevel slog.Level
+	// Tracing selects where spans are exported, an empty exporter disables tracing
+	Tracing tracing.Config
+	// HealthTimeout bounds every readiness check
+	HealthTimeout time.Duration
+	// DrainDelay is how long the service keeps serving once it reports draining on shutdown
+	DrainDelay time.Duration
+	// ShutdownTimeout is how long requests in flight are given to finish on shutdown
+	ShutdownTimeout time.Duration
 }
 
-// NewConfiguration reads environment variables and returns a new Configuration
-func NewConfiguration() *Configuration {
-	dbURL := getEnvOrDefault("DATABASE_URL", "")
+// NewConfiguration reads the settings of the service from loader and returns them,
+// along with every invalid one
+func NewConfiguration(loader *config.Loader) (*Configuration, error) {
+	dbURL := loader.String("database.url", "DATABASE_URL", "", config.SecretURL())
 	if dbURL == "" {
 		slog.Warn("DATABASE_URL is not set")
 	}
-	return &Configuration{
-		Port:        getEnvOrDefault("PORT", "3000"),
+	conf := &Configuration{
+		Port:        loader.String("port", "PORT", "3000"),
 		DatabaseURL: dbURL,
+		Pool: database.PoolConfig{
+			MaxConns: loader.Int("database.max_conns", "DATABASE_MAX_CONNS", 0, config.Min(0)),
+			MinConns: loader.Int("database.min_conns", "DATABASE_MIN_CONNS", 0, config.Min(0)),
+		},
+		Server: server.Config{
+			ReadTimeout:  loader.Duration("server.read_timeout", "SERVER_READ_TIMEOUT_SECONDS", 0, time.Second, config.Min(time.Duration(0))),
+			WriteTimeout: loader.Duration("server.write_timeout", "SERVER_WRITE_TIMEOUT_SECONDS", 0, time.Second, config.Min(time.Duration(0))),
+			IdleTimeout:  loader.Duration("server.idle_timeout", "SERVER_IDLE_TIMEOUT_SECONDS", 0, time.Second, config.Min(time.Duration(0))),
+			CORSOrigins:  loader.Strings("cors.origins", "CORS_ALLOWED_ORIGINS", nil),
+			JWTKey:       loader.String("auth.jwt_key", "JWT_SIGNING_KEY", "", config.Secret()),
+			Cache: middleware.CacheConfig{
+				Expiration: loader.Duration("cache.expiration", "CACHE_EXPIRATION_SECONDS", 0, time.Second, config.Min(time.Duration(0))),
+				MaxBytes:   loader.Int("cache.max_bytes", "CACHE_MAX_BYTES", 16<<20, config.Min(0)),
+			},
+		},
+		LoanPolicy:     newLoanPolicy(loader),
+		PurgeRetention: max(loader.Duration("purge.retention", "PURGE_RETENTION_DAYS", 30*24*time.Hour, 24*time.Hour), 0),
+		PurgeInterval:  loader.Duration("purge.interval", "PURGE_INTERVAL_MINUTES", time.Hour, time.Minute),
+		Events: events.Config{
+			Sink: loader.String("events.sink", "EVENT_SINK", "",
+				config.OneOf("", events.SinkWebhook, events.SinkNATS, events.SinkMemory)),
+			URL:           loader.String("events.url", "EVENT_SINK_URL", "", config.Secret()),
+			SubjectPrefix: loader.String("events.subject_prefix", "EVENT_SUBJECT_PREFIX", "library"),
+		},
+		RelayInterval:   loader.Duration("events.relay_interval", "EVENT_RELAY_INTERVAL_SECONDS", 5*time.Second, time.Second),
+		WebhookInterval: loader.Duration("webhooks.delivery_interval", "WEBHOOK_DELIVERY_INTERVAL_SECONDS", 5*time.Second, time.Second),
+		WebhookRetry:    newWebhookRetryPolicy(loader),
+		Notifier: notifications.Config{
+			Notifier: loader.String("notifier.kind", "NOTIFIER", notifications.NotifierLog,
+				config.OneOf(notifications.NotifierLog, notifications.NotifierWebhook, notifications.NotifierSMTP)),
+			URL:          loader.String("notifier.url", "NOTIFIER_URL", "", config.Secret()),
+			SMTPAddr:     loader.String("smtp.addr", "SMTP_ADDR", ""),
+			SMTPUsername: loader.String("smtp.username", "SMTP_USERNAME", ""),
+			SMTPPassword: loader.String("smtp.password", "SMTP_PASSWORD", "", config.Secret()),
+			From:         loader.String("smtp.from", "SMTP_FROM", ""),
+		},
+		ReminderInterval: loader.Duration("reminders.interval", "REMINDER_INTERVAL_MINUTES", time.Hour, time.Minute),
+		ReminderDueSoon:  max(loader.Duration("reminders.days_before", "REMINDER_DAYS_BEFORE", 48*time.Hour, 24*time.Hour), 0),
+		LogLevel:         loader.Level("log.level", "LOG_LEVEL", slog.LevelInfo),
+		HealthTimeout:    loader.Duration("health.timeout", "HEALTH_CHECK_TIMEOUT_SECONDS", 2*time.Second, time.Second, config.Min(time.Millisecond)),
+		DrainDelay:       loader.Duration("shutdown.drain_delay", "SHUTDOWN_DRAIN_DELAY_SECONDS", 5*time.Second, time.Second, config.Min(time.Duration(0))),
+		ShutdownTimeout:  loader.Duration("shutdown.timeout", "SHUTDOWN_TIMEOUT_SECONDS", 20*time.Second, time.Second, config.Min(time.Millisecond)),
+		Tracing: tracing.Config{
+			Exporter: loader.String("tracing.exporter", "TRACE_EXPORTER", "",
+				config.OneOf("", tracing.ExporterOTLP, tracing.ExporterStdout, tracing.ExporterMemory)),
+			Endpoint: loader.String("tracing.endpoint", "OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			Service:  loader.String("tracing.service", "OTEL_SERVICE_NAME", "book-service"),
+		},
 	}
+	return conf, loader.Err()
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return defaultValue
+// newWebhookRetryPolicy overrides the default webhook retry policy with the webhooks.* settings
+func newWebhookRetryPolicy(loader *config.Loader) services.WebhookRetryPolicy {
+	policy := services.DefaultWebhookRetryPolicy()
+	policy.MaxAttempts = max(loader.Int("webhooks.max_attempts", "WEBHOOK_MAX_ATTEMPTS", policy.MaxAttempts), 1)
+	policy.BaseDelay = loader.Duration("webhooks.retry_base", "WEBHOOK_RETRY_BASE_SECONDS", policy.BaseDelay, time.Second)
+	policy.MaxDelay = loader.Duration("webhooks.retry_max", "WEBHOOK_RETRY_MAX_MINUTES", policy.MaxDelay, time.Minute)
+	return policy
+}
+
+// newLoanPolicy overrides the default loan policy with the loan.* settings
+func newLoanPolicy(loader *config.Loader) database.LoanPolicy {
+	policy := database.DefaultLoanPolicy()
+	policy.LoanPeriod = loader.Duration("loan.period", "LOAN_PERIOD_DAYS", policy.LoanPeriod, 24*time.Hour)
+	policy.DefaultMaxLoans = loader.Int("loan.max_default", "LOAN_MAX_DEFAULT", policy.DefaultMaxLoans, config.Min(0))
+	// LOAN_MAX_PER_ROLE has the form "member=5,admin=10"
+	policy.MaxLoansByRole = loader.IntMap("loan.max_per_role", "LOAN_MAX_PER_ROLE", policy.MaxLoansByRole)
+	policy.BlockOnFines = loader.Bool("loan.block_on_fines", "LOAN_BLOCK_ON_FINES", policy.BlockOnFines)
+	policy.MaxUnpaidFines = loader.Float("loan.max_unpaid_fines", "LOAN_MAX_UNPAID_FINES", policy.MaxUnpaidFines, config.Min(0.0))
+	policy.BlockOnOverdue = loader.Bool("loan.block_on_overdue", "LOAN_BLOCK_ON_OVERDUE", policy.BlockOnOverdue)
+	policy.AllowDuplicateTitle = loader.Bool("loan.allow_duplicate_title", "LOAN_ALLOW_DUPLICATE_TITLE", policy.AllowDuplicateTitle)
+	policy.ReplacementFee = loader.Float("loan.replacement_fee", "LOAN_REPLACEMENT_FEE", policy.ReplacementFee, config.Min(0.0))
+	policy.MaxRenewals = loader.Int("loan.max_renewals", "LOAN_MAX_RENEWALS", policy.MaxRenewals, config.Min(0))
+	return policy
 }
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"regexp"
@@ -11,16 +12,17 @@ import (
 
 // Book represents a book in the database
 type Book struct {
-	ID            int       `db:"id"`
-	Title         string    `db:"title"`
-	ISBN          string    `db:"isbn"`
-	AuthorID      int       `db:"author_id"`
-	CategoryID    int       `db:"category_id"`
-	Stock         int       `db:"stock"`
-	PublishedDate time.Time `db:"published_date"`
-	Description   string    `db:"description"`
-	CreatedAt     time.Time `db:"created_at"`
-	UpdatedAt     time.Time `db:"updated_at"`
+	ID            int        `db:"id"`
+	Title         string     `db:"title"`
+	ISBN          string     `db:"isbn"`
+	AuthorID      int        `db:"author_id"`
+	CategoryID    int        `db:"category_id"`
+	Stock         int        `db:"stock"`
+	PublishedDate time.Time  `db:"published_date"`
+	Description   string     `db:"description"`
+	CreatedAt     time.Time  `db:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at"`
+	DeletedAt     *time.Time `db:"deleted_at"`
 }
 
 // NewBook represents a new book to be created to the database
@@ -34,18 +36,40 @@ type NewBook struct {
 	Description   string
 }
 
+// BorrowingRecord represents a loan of a book to a user
 type BorrowingRecord struct {
-	ID         int
-	BookID     int
-	UserID     int
-	BorrowedAt time.Time
-	ReturnedAt time.Time
-	DueDate    time.Time
+	ID         int        `db:"id"`
+	BookID     int        `db:"book_id"`
+	UserID     int        `db:"user_id"`
+	BorrowedAt time.Time  `db:"borrowed_at"`
+	ReturnedAt *time.Time `db:"returned_at"`
+	DueDate    time.Time  `db:"due_date"`
+	Status     string     `db:"status"`
+	Renewals   int        `db:"renewals"`
+}
+
+// Loan states accepted by LoanFilter
+const (
+	LoanStateCurrent  = "current"
+	LoanStateReturned = "returned"
+	LoanStateOverdue  = "overdue"
+	LoanStateLost     = "lost"
+)
+
+// LoanFilter narrows the borrowing records returned by ListLoans
+type LoanFilter struct {
+	UserID int
+	BookID int
+	// State is one of the LoanState constants, empty matches every loan
+	State string
+	// Now is the reference time used to decide whether a loan is overdue
+	Now time.Time
 }
 
 type NewBorrowingRecord struct {
 	BookID     int
 	UserID     int
+	Role       string
 	BorrowedAt time.Time
 	ReturnedAt time.Time
 	Status     string
@@ -64,37 +88,326 @@ type NewBookRecommendation struct {
 	Score             float32
 }
 
+// AuthorStats sums up the books of one author. Copies on loan are not in Stock, so
+// TotalCopies adds them to the available ones; lost copies are in neither.
+type AuthorStats struct {
+	Titles          int `db:"titles"`
+	TotalCopies     int `db:"total_copies"`
+	AvailableCopies int `db:"available_copies"`
+	ActiveLoans     int `db:"active_loans"`
+}
+
+// BookFilter narrows a book listing, zero fields match every book that is not deleted
+type BookFilter struct {
+	AuthorID   int
+	CategoryID int
+	// IncludeDeleted lists soft deleted books as well
+	IncludeDeleted bool
+}
+
+func (f BookFilter) matches(book Book) bool {
+	return (f.AuthorID == 0 || book.AuthorID == f.AuthorID) &&
+		(f.CategoryID == 0 || book.CategoryID == f.CategoryID) &&
+		(f.IncludeDeleted || book.DeletedAt == nil)
+}
+
+// AuditEntry is a write recorded in the audit log. Changes is a JSON object
+// holding the before and after value of every field the write changed.
+type AuditEntry struct {
+	ID        int64           `db:"id"`
+	Actor     string          `db:"actor"`
+	ActorRole string          `db:"actor_role"`
+	Action    string          `db:"action"`
+	Entity    string          `db:"entity"`
+	EntityID  int             `db:"entity_id"`
+	Changes   json.RawMessage `db:"changes"`
+	RequestID string          `db:"request_id"`
+	CreatedAt time.Time       `db:"created_at"`
+}
+
+// NewAuditEntry represents a write to be added to the audit log
+type NewAuditEntry struct {
+	Actor     string
+	ActorRole string
+	Action    string
+	Entity    string
+	EntityID  int
+	Changes   json.RawMessage
+	RequestID string
+}
+
+// AuditFilter narrows the audit log, zero fields match every entry
+type AuditFilter struct {
+	Entity   string
+	EntityID int
+	Actor    string
+}
+
+func (f AuditFilter) matches(entry AuditEntry) bool {
+	return (f.Entity == "" || entry.Entity == f.Entity) &&
+		(f.EntityID == 0 || entry.EntityID == f.EntityID) &&
+		(f.Actor == "" || entry.Actor == f.Actor)
+}
+
+// Event types written to the outbox
+const (
+	EventBookCreated  = "book.created"
+	EventBookUpdated  = "book.updated"
+	EventBookBorrowed = "book.borrowed"
+	EventBookReserved = "book.reserved"
+	EventBookReturned = "book.returned"
+	EventBookRenewed  = "book.renewed"
+	EventBookOverdue  = "book.overdue"
+	EventBookLost     = "book.lost"
+	EventBookDeleted  = "book.deleted"
+	EventBookRestored = "book.restored"
+	EventBookPurged   = "book.purged"
+)
+
+// OutboxEvent is a domain event written in the same transaction as the change it
+// describes. PublishedAt is set once the relay delivered it.
+type OutboxEvent struct {
+	ID          int64           `db:"id"`
+	Type        string          `db:"event_type"`
+	AggregateID int             `db:"aggregate_id"`
+	Payload     json.RawMessage `db:"payload"`
+	CreatedAt   time.Time       `db:"created_at"`
+	PublishedAt *time.Time      `db:"published_at"`
+}
+
+// bookEvent is the payload of the book.created and book.updated events
+type bookEvent struct {
+	ID            int       `json:"id"`
+	Title         string    `json:"title"`
+	ISBN          string    `json:"isbn"`
+	AuthorID      int       `json:"author_id"`
+	CategoryID    int       `json:"category_id"`
+	Stock         int       `json:"stock"`
+	PublishedDate time.Time `json:"published_date"`
+	Description   string    `json:"description"`
+}
+
+func newBookEvent(id int, book NewBook) bookEvent {
+	return bookEvent{
+		ID:            id,
+		Title:         book.Title,
+		ISBN:          book.ISBN,
+		AuthorID:      book.AuthorID,
+		CategoryID:    book.CategoryID,
+		Stock:         book.Stock,
+		PublishedDate: book.PublishedDate,
+		Description:   book.Description,
+	}
+}
+
+// bookRefEvent is the payload of the book.deleted, book.restored and book.purged events
+type bookRefEvent struct {
+	ID int `json:"id"`
+}
+
+// loanEvent is the payload of the loan events, from book.borrowed to book.lost
+type loanEvent struct {
+	LoanID     int        `json:"loan_id"`
+	BookID     int        `json:"book_id"`
+	UserID     int        `json:"user_id"`
+	Status     string     `json:"status"`
+	BorrowedAt time.Time  `json:"borrowed_at"`
+	DueDate    time.Time  `json:"due_date"`
+	ReturnedAt *time.Time `json:"returned_at,omitempty"`
+}
+
+func newLoanEvent(loan BorrowingRecord) loanEvent {
+	return loanEvent{
+		LoanID:     loan.ID,
+		BookID:     loan.BookID,
+		UserID:     loan.UserID,
+		Status:     loan.Status,
+		BorrowedAt: loan.BorrowedAt,
+		DueDate:    loan.DueDate,
+		ReturnedAt: loan.ReturnedAt,
+	}
+}
+
+// loanEventType is the event written when a loan moves to the given status
+func loanEventType(status string) string {
+	switch status {
+	case LoanStatusReserved:
+		return EventBookReserved
+	case LoanStatusRenewed:
+		return EventBookRenewed
+	case LoanStatusOverdue:
+		return EventBookOverdue
+	case LoanStatusReturned:
+		return EventBookReturned
+	case LoanStatusLost:
+		return EventBookLost
+	}
+	return EventBookBorrowed
+}
+
+// newEvent encodes the payload of an event about the given aggregate
+func newEvent(eventType string, aggregateID int, payload any) (OutboxEvent, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return OutboxEvent{}, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	return OutboxEvent{Type: eventType, AggregateID: aggregateID, Payload: encoded}, nil
+}
+
+// Database stores the books and their loans. Deleted books are only marked deleted
+// and are hidden from every method except listings with BookFilter.IncludeDeleted,
+// RestoreBook, PurgeBooks, ExistingISBNs and ReassignAuthorBooks.
 type Database interface {
-	LoadAllBooks(ctx context.Context) ([]Book, error)
+	LoadAllBooks(ctx context.Context, filter BookFilter) ([]Book, error)
+
+	// StreamBooks calls fn for every book matching filter in sort order, the sort is checked like in ListBooks
+	StreamBooks(ctx context.Context, filter BookFilter, sort []SortField, fn func(Book) error) error
+
+	// ListBooks returns up to limit books in sort order, starting after the cursor if set.
+	// Sort fields must be whitelisted, ErrInvalidSort is returned otherwise.
+	ListBooks(ctx context.Context, filter BookFilter, sort []SortField, after *Cursor, limit int) ([]Book, error)
 
 	GetBookByID(ctx context.Context, bookID int) (Book, error)
 
-	CreateBook(ctx context.Context, newBook NewBook) error
+	// GetAuthorStats counts the books, copies and running loans of an author
+	GetAuthorStats(ctx context.Context, authorID int) (AuthorStats, error)
+
+	// ReassignAuthorBooks moves every book of one author that is not deleted to another and returns how many were moved
+	ReassignAuthorBooks(ctx context.Context, fromAuthorID, toAuthorID int) (int, error)
+
+	GetBookByISBN(ctx context.Context, isbn string) (Book, error)
+
+	LoadBooksByIDs(ctx context.Context, ids []int) ([]Book, error)
+
+	LoadBooksByAuthorsOrCategories(ctx context.Context, authorIDs, categoryIDs []int, limit int) ([]Book, error)
+
+	// CreateBook adds a book and returns its id
+	CreateBook(ctx context.Context, newBook NewBook) (int, error)
+
+	CreateBooks(ctx context.Context, newBooks []NewBook) (int, error)
+
+	ExistingISBNs(ctx context.Context, isbns []string) ([]string, error)
 
 	UpdateBook(ctx context.Context, book Book) error
 
+	// DeleteBook marks a book deleted, ErrBookNotFound is returned if there is no such book
+	// and ErrBookOnLoan while it has active loans
 	DeleteBook(ctx context.Context, id int) error
 
+	// RestoreBook clears the deletion mark of a book, ErrBookNotFound is returned if it is not deleted
+	RestoreBook(ctx context.Context, id int) error
+
+	// PurgeBooks permanently removes the books deleted before the given time and returns how many were removed.
+	// Books with loans are kept, so the loan history stays complete.
+	PurgeBooks(ctx context.Context, before time.Time) (int, error)
+
+	SearchBooks(ctx context.Context, query string, limit, offset int) ([]BookSearchResult, error)
+
 	BorrowBook(ctx context.Context, book NewBorrowingRecord) error
 
 	ReturnBook(ctx context.Context, book BorrowingRecord) error
 
-	GetRecommendedBooks(ctx context.Context, bookID int) ([]BookRecommendation, error)
+	ListLoans(ctx context.Context, filter LoanFilter, limit, offset int) ([]BorrowingRecord, error)
+
+	// CountOverdueLoans returns how many loans are past their due date at now
+	CountOverdueLoans(ctx context.Context, now time.Time) (int, error)
+
+	UpdateLoanStatus(ctx context.Context, loanID int, status string, at time.Time) (BorrowingRecord, error)
+
+	// RenewLoan extends the due date of a loan of userID, the loan is not found
+	// when it belongs to another user
+	RenewLoan(ctx context.Context, userID, loanID int, at time.Time) (BorrowingRecord, error)
+
+	// GetRecommendedBooks returns the recommendations of all the books in bookIDs
+	GetRecommendedBooks(ctx context.Context, bookIDs []int) ([]BookRecommendation, error)
 
 	AddRecommendedBook(ctx context.Context, book NewBookRecommendation) error
 
+	// WithinTx runs fn in a single transaction, the changes made through the context
+	// given to fn are committed together when it returns nil and rolled back otherwise
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+
+	// WithinRepeatableReadTx is WithinTx at the repeatable read isolation level, fn is run
+	// again a few times when the transaction fails to serialize with a concurrent one.
+	// Inside the transaction of WithinTx it keeps running in that transaction.
+	WithinRepeatableReadTx(ctx context.Context, fn func(ctx context.Context) error) error
+
+	// AddAuditEntry appends an entry to the audit log, entries are never changed or removed
+	AddAuditEntry(ctx context.Context, entry NewAuditEntry) error
+
+	// ListAuditEntries returns the audit log newest first
+	ListAuditEntries(ctx context.Context, filter AuditFilter, limit, offset int) ([]AuditEntry, error)
+
+	// PendingEvents returns up to limit outbox events not published yet, oldest first.
+	// CreateBook, UpdateBook, BorrowBook and ReturnBook write them with their change.
+	PendingEvents(ctx context.Context, limit int) ([]OutboxEvent, error)
+
+	// MarkEventPublished records that the outbox event was delivered
+	MarkEventPublished(ctx context.Context, id int64) error
+
+	AddWebhookSubscription(ctx context.Context, subscription NewWebhookSubscription) (WebhookSubscription, error)
+
+	ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error)
+
+	// DeleteWebhookSubscription removes a subscription together with its deliveries
+	DeleteWebhookSubscription(ctx context.Context, id int) error
+
+	// EnqueueWebhookDeliveries adds a pending delivery of the event for every subscription
+	// wanting its type and returns how many were added. An event already delivered to a
+	// subscription is not added again.
+	EnqueueWebhookDeliveries(ctx context.Context, delivery NewWebhookDelivery) (int, error)
+
+	// ClaimWebhookDeliveries returns up to limit pending deliveries due at now, oldest first,
+	// and pushes their next attempt lease into the future so no other worker picks them up
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+
+	// RecordWebhookAttempt stores the outcome of an attempt and counts it
+	RecordWebhookAttempt(ctx context.Context, id int64, attempt WebhookAttempt) error
+
+	// ListWebhookDeliveries returns the delivery log newest first
+	ListWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter, limit, offset int) ([]WebhookDelivery, error)
+
+	// RetryWebhookDelivery makes a dead delivery pending again with a fresh set of attempts,
+	// ErrDeliveryNotDead is returned for deliveries that have not given up
+	RetryWebhookDelivery(ctx context.Context, id int64, at time.Time) error
+
+	// LoansToNotify returns up to limit loans due a notification, earliest due date first
+	LoansToNotify(ctx context.Context, filter NoticeFilter, limit int) ([]LoanNotice, error)
+
+	// RecordNotification remembers a sent notification so it is not sent again
+	RecordNotification(ctx context.Context, notification SentNotification) error
+
+	// RecordNotificationFailure remembers a notification that could not be sent, replacing
+	// the previous failure of the same notification
+	RecordNotificationFailure(ctx context.Context, failure FailedNotification) error
+
+	// GetNotificationPreferences returns the preferences of a user, the defaults if none were set
+	GetNotificationPreferences(ctx context.Context, userID int) (NotificationPreferences, error)
+
+	// SetNotificationPreferences stores the preferences of a user, replacing any previous ones
+	SetNotificationPreferences(ctx context.Context, preferences NotificationPreferences) (NotificationPreferences, error)
+
+	// Ping checks that the database can be reached
+	Ping(ctx context.Context) error
+
 	CloseConnections()
 }
 
-// NewDatabase creates a new Database instance
-func NewDatabase(ctx context.Context, databaseURL string) (Database, error) {
+// NewDatabase creates a new Database instance enforcing the given loan policy
+// PoolConfig sizes the PostgreSQL connection pool, zero values keep the pgx defaults
+type PoolConfig struct {
+	MaxConns int
+	MinConns int
+}
+
+func NewDatabase(ctx context.Context, databaseURL string, pool PoolConfig, policy LoanPolicy) (Database, error) {
 	if databaseURL == "" {
 		slog.Info("Using in-memory database implementation")
-		return newMemoryDB(), nil
+		return newMemoryDB(policy), nil
 	}
 
 	if strings.HasPrefix(databaseURL, "postgres://") {
-		db, err := newPostgresDB(ctx, databaseURL)
+		db, err := newPostgresDB(ctx, databaseURL, pool, policy)
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize PostgreSQL database connection: %w", err)
 		}
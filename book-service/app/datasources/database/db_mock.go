@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -20,8 +21,31 @@ func (m *DatabaseMock) ReturnBook(ctx context.Context, book BorrowingRecord) err
 	return args.Error(0)
 }
 
-func (m *DatabaseMock) GetRecommendedBooks(ctx context.Context, bookID int) ([]BookRecommendation, error) {
-	args := m.Called(ctx, bookID)
+func (m *DatabaseMock) ListLoans(ctx context.Context, filter LoanFilter, limit, offset int) ([]BorrowingRecord, error) {
+	args := m.Called(ctx, filter, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]BorrowingRecord), args.Error(1)
+}
+
+func (m *DatabaseMock) CountOverdueLoans(ctx context.Context, now time.Time) (int, error) {
+	args := m.Called(ctx, now)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *DatabaseMock) UpdateLoanStatus(ctx context.Context, loanID int, status string, at time.Time) (BorrowingRecord, error) {
+	args := m.Called(ctx, loanID, status, at)
+	return args.Get(0).(BorrowingRecord), args.Error(1)
+}
+
+func (m *DatabaseMock) RenewLoan(ctx context.Context, userID, loanID int, at time.Time) (BorrowingRecord, error) {
+	args := m.Called(ctx, userID, loanID, at)
+	return args.Get(0).(BorrowingRecord), args.Error(1)
+}
+
+func (m *DatabaseMock) GetRecommendedBooks(ctx context.Context, bookIDs []int) ([]BookRecommendation, error) {
+	args := m.Called(ctx, bookIDs)
 	return args.Get(0).([]BookRecommendation), args.Error(1)
 }
 
@@ -30,17 +54,163 @@ func (m *DatabaseMock) AddRecommendedBook(ctx context.Context, book NewBookRecom
 	return args.Error(0)
 }
 
-func (m *DatabaseMock) LoadAllBooks(ctx context.Context) ([]Book, error) {
+// WithinTx runs fn directly, the calls it makes are matched like any other
+func (m *DatabaseMock) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (m *DatabaseMock) WithinRepeatableReadTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (m *DatabaseMock) AddAuditEntry(ctx context.Context, entry NewAuditEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+func (m *DatabaseMock) ListAuditEntries(ctx context.Context, filter AuditFilter, limit, offset int) ([]AuditEntry, error) {
+	args := m.Called(ctx, filter, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]AuditEntry), args.Error(1)
+}
+
+func (m *DatabaseMock) PendingEvents(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	args := m.Called(ctx, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]OutboxEvent), args.Error(1)
+}
+
+func (m *DatabaseMock) MarkEventPublished(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *DatabaseMock) AddWebhookSubscription(ctx context.Context, subscription NewWebhookSubscription) (WebhookSubscription, error) {
+	args := m.Called(ctx, subscription)
+	return args.Get(0).(WebhookSubscription), args.Error(1)
+}
+
+func (m *DatabaseMock) ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
 	args := m.Called(ctx)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
+	return args.Get(0).([]WebhookSubscription), args.Error(1)
+}
+
+func (m *DatabaseMock) DeleteWebhookSubscription(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *DatabaseMock) EnqueueWebhookDeliveries(ctx context.Context, delivery NewWebhookDelivery) (int, error) {
+	args := m.Called(ctx, delivery)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *DatabaseMock) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	args := m.Called(ctx, now, lease, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]WebhookDelivery), args.Error(1)
+}
+
+func (m *DatabaseMock) RecordWebhookAttempt(ctx context.Context, id int64, attempt WebhookAttempt) error {
+	args := m.Called(ctx, id, attempt)
+	return args.Error(0)
+}
+
+func (m *DatabaseMock) ListWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter, limit, offset int) ([]WebhookDelivery, error) {
+	args := m.Called(ctx, filter, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]WebhookDelivery), args.Error(1)
+}
+
+func (m *DatabaseMock) RetryWebhookDelivery(ctx context.Context, id int64, at time.Time) error {
+	args := m.Called(ctx, id, at)
+	return args.Error(0)
+}
+
+func (m *DatabaseMock) LoansToNotify(ctx context.Context, filter NoticeFilter, limit int) ([]LoanNotice, error) {
+	args := m.Called(ctx, filter, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]LoanNotice), args.Error(1)
+}
+
+func (m *DatabaseMock) RecordNotification(ctx context.Context, notification SentNotification) error {
+	args := m.Called(ctx, notification)
+	return args.Error(0)
+}
+
+func (m *DatabaseMock) RecordNotificationFailure(ctx context.Context, failure FailedNotification) error {
+	args := m.Called(ctx, failure)
+	return args.Error(0)
+}
+
+func (m *DatabaseMock) GetNotificationPreferences(ctx context.Context, userID int) (NotificationPreferences, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(NotificationPreferences), args.Error(1)
+}
+
+func (m *DatabaseMock) SetNotificationPreferences(ctx context.Context, preferences NotificationPreferences) (NotificationPreferences, error) {
+	args := m.Called(ctx, preferences)
+	return args.Get(0).(NotificationPreferences), args.Error(1)
+}
+
+func (m *DatabaseMock) LoadAllBooks(ctx context.Context, filter BookFilter) ([]Book, error) {
+	args := m.Called(ctx, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
 	return args.Get(0).([]Book), args.Error(1)
 }
 
-func (m *DatabaseMock) CreateBook(ctx context.Context, newBook NewBook) error {
+func (m *DatabaseMock) GetBookByID(ctx context.Context, bookID int) (Book, error) {
+	args := m.Called(ctx, bookID)
+	return args.Get(0).(Book), args.Error(1)
+}
+
+func (m *DatabaseMock) GetBookByISBN(ctx context.Context, isbn string) (Book, error) {
+	args := m.Called(ctx, isbn)
+	return args.Get(0).(Book), args.Error(1)
+}
+
+func (m *DatabaseMock) SearchBooks(ctx context.Context, query string, limit, offset int) ([]BookSearchResult, error) {
+	args := m.Called(ctx, query, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]BookSearchResult), args.Error(1)
+}
+
+func (m *DatabaseMock) LoadBooksByIDs(ctx context.Context, ids []int) ([]Book, error) {
+	args := m.Called(ctx, ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]Book), args.Error(1)
+}
+
+func (m *DatabaseMock) LoadBooksByAuthorsOrCategories(ctx context.Context, authorIDs, categoryIDs []int, limit int) ([]Book, error) {
+	args := m.Called(ctx, authorIDs, categoryIDs, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]Book), args.Error(1)
+}
+
+func (m *DatabaseMock) CreateBook(ctx context.Context, newBook NewBook) (int, error) {
 	args := m.Called(ctx, newBook)
-	return args.Error(0)
+	return args.Int(0), args.Error(1)
 }
 
 func (m *DatabaseMock) DeleteBook(ctx context.Context, id int) error {
@@ -48,10 +218,61 @@ func (m *DatabaseMock) DeleteBook(ctx context.Context, id int) error {
 	return args.Error(0)
 }
 
+func (m *DatabaseMock) RestoreBook(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *DatabaseMock) PurgeBooks(ctx context.Context, before time.Time) (int, error) {
+	args := m.Called(ctx, before)
+	return args.Int(0), args.Error(1)
+}
+
 func (m *DatabaseMock) UpdateBook(ctx context.Context, book Book) error {
 	args := m.Called(ctx, book)
 	return args.Error(0)
 }
 
+func (m *DatabaseMock) Ping(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
 func (m *DatabaseMock) CloseConnections() {
 }
+
+func (m *DatabaseMock) CreateBooks(ctx context.Context, newBooks []NewBook) (int, error) {
+	args := m.Called(ctx, newBooks)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *DatabaseMock) ExistingISBNs(ctx context.Context, isbns []string) ([]string, error) {
+	args := m.Called(ctx, isbns)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *DatabaseMock) StreamBooks(ctx context.Context, filter BookFilter, sort []SortField, fn func(Book) error) error {
+	args := m.Called(ctx, filter, sort, fn)
+	return args.Error(0)
+}
+
+func (m *DatabaseMock) ListBooks(ctx context.Context, filter BookFilter, sort []SortField, after *Cursor, limit int) ([]Book, error) {
+	args := m.Called(ctx, filter, sort, after, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]Book), args.Error(1)
+}
+
+func (m *DatabaseMock) GetAuthorStats(ctx context.Context, authorID int) (AuthorStats, error) {
+	args := m.Called(ctx, authorID)
+	return args.Get(0).(AuthorStats), args.Error(1)
+}
+
+func (m *DatabaseMock) ReassignAuthorBooks(ctx context.Context, fromAuthorID, toAuthorID int) (int, error) {
+	args := m.Called(ctx, fromAuthorID, toAuthorID)
+	return args.Int(0), args.Error(1)
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const defaultLoanPeriod = 3 * 24 * time.Hour
+
+// Names of the loan policy rules reported in LoanRuleError
+const (
+	RuleMaxLoans       = "max_loans"
+	RuleUnpaidFines    = "unpaid_fines"
+	RuleOverdueLoans   = "overdue_loans"
+	RuleDuplicateTitle = "duplicate_title"
+	RuleMaxRenewals    = "max_renewals"
+)
+
+var (
+	ErrBookNotFound     = errors.New("book not found")
+	ErrBookNotAvailable = errors.New("book is not available")
+	ErrDuplicateISBN    = errors.New("a book with this isbn already exists")
+	ErrBookOnLoan       = errors.New("book has active loans")
+)
+
+// LoanPolicy holds the eligibility rules checked before a book is lent out
+type LoanPolicy struct {
+	// LoanPeriod is added to the borrow time to compute the due date
+	LoanPeriod time.Duration
+	// MaxLoansByRole limits concurrent loans per user role, 0 means unlimited
+	MaxLoansByRole map[string]int
+	// DefaultMaxLoans applies to roles missing from MaxLoansByRole, 0 means unlimited
+	DefaultMaxLoans int
+	// BlockOnFines enables the MaxUnpaidFines check
+	BlockOnFines bool
+	// MaxUnpaidFines is the highest unpaid fine total that still allows borrowing
+	MaxUnpaidFines float64
+	// BlockOnOverdue rejects users holding any overdue loan
+	BlockOnOverdue bool
+	// AllowDuplicateTitle lets a user borrow a second copy of a book they already hold
+	AllowDuplicateTitle bool
+	// ReplacementFee is charged as a fine when a loan is reported lost
+	ReplacementFee float64
+	// MaxRenewals caps how often a loan may be renewed, 0 means unlimited
+	MaxRenewals int
+}
+
+// DefaultLoanPolicy returns the policy used when nothing else is configured
+func DefaultLoanPolicy() LoanPolicy {
+	return LoanPolicy{
+		LoanPeriod:      defaultLoanPeriod,
+		MaxLoansByRole:  map[string]int{"member": 5, "admin": 10},
+		DefaultMaxLoans: 3,
+		BlockOnFines:    true,
+		MaxUnpaidFines:  10,
+		BlockOnOverdue:  true,
+		ReplacementFee:  25,
+		MaxRenewals:     2,
+	}
+}
+
+// LoanRuleError is returned by BorrowBook and renewals when the loan policy rejects a request
+type LoanRuleError struct {
+	Rule   string
+	Reason string
+}
+
+func (e *LoanRuleError) Error() string {
+	return fmt.Sprintf("loan rule %s violated: %s", e.Rule, e.Reason)
+}
+
+// loanStats is a snapshot of a user's loans and fines taken inside the borrow transaction
+type loanStats struct {
+	activeLoans   int
+	overdueLoans  int
+	sameBookLoans int
+	unpaidFines   float64
+}
+
+func (p LoanPolicy) dueDate(borrowedAt time.Time) time.Time {
+	if p.LoanPeriod <= 0 {
+		return borrowedAt.Add(defaultLoanPeriod)
+	}
+	return borrowedAt.Add(p.LoanPeriod)
+}
+
+func (p LoanPolicy) maxLoans(role string) int {
+	if limit, ok := p.MaxLoansByRole[role]; ok {
+		return limit
+	}
+	return p.DefaultMaxLoans
+}
+
+// check returns a LoanRuleError for the first rule the stats violate
+func (p LoanPolicy) check(role string, stats loanStats) error {
+	if limit := p.maxLoans(role); limit > 0 && stats.activeLoans >= limit {
+		return &LoanRuleError{
+			Rule:   RuleMaxLoans,
+			Reason: fmt.Sprintf("user already has %d of %d allowed loans", stats.activeLoans, limit),
+		}
+	}
+	if p.BlockOnFines && stats.unpaidFines > p.MaxUnpaidFines {
+		return &LoanRuleError{
+			Rule:   RuleUnpaidFines,
+			Reason: fmt.Sprintf("unpaid fines of %.2f exceed the %.2f limit", stats.unpaidFines, p.MaxUnpaidFines),
+		}
+	}
+	if p.BlockOnOverdue && stats.overdueLoans > 0 {
+		return &LoanRuleError{
+			Rule:   RuleOverdueLoans,
+			Reason: fmt.Sprintf("user has %d overdue loans", stats.overdueLoans),
+		}
+	}
+	if !p.AllowDuplicateTitle && stats.sameBookLoans > 0 {
+		return &LoanRuleError{
+			Rule:   RuleDuplicateTitle,
+			Reason: "user already has a copy of this book",
+		}
+	}
+	return nil
+}
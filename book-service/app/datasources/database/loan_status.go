@@ -0,0 +1,108 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Statuses of a BorrowingRecord over the loan lifecycle
+const (
+	LoanStatusReserved = "reserved"
+	LoanStatusBorrowed = "borrowed"
+	LoanStatusRenewed  = "renewed"
+	LoanStatusOverdue  = "overdue"
+	LoanStatusReturned = "returned"
+	LoanStatusLost     = "lost"
+)
+
+var ErrLoanNotFound = errors.New("borrowing record not found or already returned")
+
+// loanTransitions lists the statuses each status may move to,
+// returned and lost are terminal
+var loanTransitions = map[string][]string{
+	LoanStatusReserved: {LoanStatusBorrowed, LoanStatusReturned},
+	LoanStatusBorrowed: {LoanStatusRenewed, LoanStatusOverdue, LoanStatusReturned, LoanStatusLost},
+	LoanStatusRenewed:  {LoanStatusRenewed, LoanStatusOverdue, LoanStatusReturned, LoanStatusLost},
+	LoanStatusOverdue:  {LoanStatusReturned, LoanStatusLost},
+}
+
+// LoanTransitionError is returned when a loan cannot move to the requested status
+type LoanTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *LoanTransitionError) Error() string {
+	return fmt.Sprintf("loan cannot move from %s to %s", e.From, e.To)
+}
+
+// IsValidLoanStatus reports whether status is one of the LoanStatus constants
+func IsValidLoanStatus(status string) bool {
+	_, ok := loanTransitions[status]
+	return ok || status == LoanStatusReturned || status == LoanStatusLost
+}
+
+func canTransitionLoan(from, to string) bool {
+	for _, next := range loanTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// effectiveLoanStatus reports a running loan past its due date as overdue
+// even if the stored status has not caught up yet
+func effectiveLoanStatus(status string, dueDate, at time.Time) string {
+	if (status == LoanStatusBorrowed || status == LoanStatusRenewed) && dueDate.Before(at) {
+		return LoanStatusOverdue
+	}
+	return status
+}
+
+// initialLoanStatus validates the status a new borrowing record is created with
+func initialLoanStatus(status string) (string, error) {
+	switch status {
+	case "":
+		return LoanStatusBorrowed, nil
+	case LoanStatusReserved, LoanStatusBorrowed:
+		return status, nil
+	}
+	return "", fmt.Errorf("loans cannot start as %q", status)
+}
+
+// transitionLoan validates the move of loan to status `to` at time `at`
+// and returns the record with its status and dates updated
+func (p LoanPolicy) transitionLoan(loan BorrowingRecord, to string, at time.Time) (BorrowingRecord, error) {
+	from := effectiveLoanStatus(loan.Status, loan.DueDate, at)
+	if to == LoanStatusOverdue {
+		// marking overdue only persists what effectiveLoanStatus derives
+		if from != LoanStatusOverdue || loan.Status == LoanStatusOverdue {
+			return loan, &LoanTransitionError{From: loan.Status, To: to}
+		}
+		from = loan.Status
+	}
+	if !canTransitionLoan(from, to) {
+		return loan, &LoanTransitionError{From: from, To: to}
+	}
+
+	switch to {
+	case LoanStatusBorrowed:
+		loan.BorrowedAt = at
+		loan.DueDate = p.dueDate(at)
+	case LoanStatusRenewed:
+		if p.MaxRenewals > 0 && loan.Renewals >= p.MaxRenewals {
+			return loan, &LoanRuleError{
+				Rule:   RuleMaxRenewals,
+				Reason: fmt.Sprintf("loan was already renewed %d of %d allowed times", loan.Renewals, p.MaxRenewals),
+			}
+		}
+		loan.DueDate = p.dueDate(loan.DueDate)
+		loan.Renewals++
+	case LoanStatusReturned:
+		loan.ReturnedAt = &at
+	}
+	loan.Status = to
+	return loan, nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransitionLoan(t *testing.T) {
+	policy := DefaultLoanPolicy()
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	dueDate := borrowedAt.Add(3 * 24 * time.Hour)
+	beforeDue := borrowedAt.Add(time.Hour)
+	afterDue := dueDate.Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		from  string
+		to    string
+		at    time.Time
+		valid bool
+	}{
+		{"pick up reservation", LoanStatusReserved, LoanStatusBorrowed, beforeDue, true},
+		{"cancel reservation", LoanStatusReserved, LoanStatusReturned, beforeDue, true},
+		{"reservation cannot be lost", LoanStatusReserved, LoanStatusLost, beforeDue, false},
+		{"renew", LoanStatusBorrowed, LoanStatusRenewed, beforeDue, true},
+		{"renew again", LoanStatusRenewed, LoanStatusRenewed, beforeDue, true},
+		{"renew past due", LoanStatusBorrowed, LoanStatusRenewed, afterDue, false},
+		{"mark overdue past due", LoanStatusBorrowed, LoanStatusOverdue, afterDue, true},
+		{"mark overdue before due", LoanStatusBorrowed, LoanStatusOverdue, beforeDue, false},
+		{"mark overdue twice", LoanStatusOverdue, LoanStatusOverdue, afterDue, false},
+		{"return overdue", LoanStatusOverdue, LoanStatusReturned, afterDue, true},
+		{"lose overdue", LoanStatusOverdue, LoanStatusLost, afterDue, true},
+		{"returned is terminal", LoanStatusReturned, LoanStatusBorrowed, beforeDue, false},
+		{"lost is terminal", LoanStatusLost, LoanStatusReturned, beforeDue, false},
+		{"unknown status", LoanStatusBorrowed, "stolen", beforeDue, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan := BorrowingRecord{BorrowedAt: borrowedAt, DueDate: dueDate, Status: tt.from}
+			got, err := policy.transitionLoan(loan, tt.to, tt.at)
+			if !tt.valid {
+				var transitionErr *LoanTransitionError
+				assert.ErrorAs(t, err, &transitionErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.to, got.Status)
+		})
+	}
+}
+
+func TestTransitionLoan_UpdatesDates(t *testing.T) {
+	policy := DefaultLoanPolicy()
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	loan := BorrowingRecord{BorrowedAt: borrowedAt, DueDate: policy.dueDate(borrowedAt), Status: LoanStatusReserved}
+
+	pickedUp := borrowedAt.Add(24 * time.Hour)
+	loan, err := policy.transitionLoan(loan, LoanStatusBorrowed, pickedUp)
+	assert.NoError(t, err)
+	assert.Equal(t, pickedUp, loan.BorrowedAt)
+	assert.Equal(t, pickedUp.Add(3*24*time.Hour), loan.DueDate)
+
+	loan, err = policy.transitionLoan(loan, LoanStatusRenewed, pickedUp)
+	assert.NoError(t, err)
+	assert.Equal(t, pickedUp.Add(6*24*time.Hour), loan.DueDate)
+	assert.Equal(t, 1, loan.Renewals)
+
+	loan, err = policy.transitionLoan(loan, LoanStatusReturned, pickedUp)
+	assert.NoError(t, err)
+	assert.Equal(t, &pickedUp, loan.ReturnedAt)
+}
+
+func TestTransitionLoan_MaxRenewals(t *testing.T) {
+	policy := DefaultLoanPolicy()
+	policy.MaxRenewals = 2
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	loan := BorrowingRecord{BorrowedAt: borrowedAt, DueDate: policy.dueDate(borrowedAt), Status: LoanStatusBorrowed}
+
+	for range policy.MaxRenewals {
+		var err error
+		loan, err = policy.transitionLoan(loan, LoanStatusRenewed, borrowedAt)
+		assert.NoError(t, err)
+	}
+
+	_, err := policy.transitionLoan(loan, LoanStatusRenewed, borrowedAt)
+	var ruleErr *LoanRuleError
+	assert.ErrorAs(t, err, &ruleErr)
+	assert.Equal(t, RuleMaxRenewals, ruleErr.Rule)
+
+	policy.MaxRenewals = 0
+	loan, err = policy.transitionLoan(loan, LoanStatusRenewed, borrowedAt)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, loan.Renewals)
+}
@@ -1,59 +1,959 @@
 package database
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
 
-func newMemoryDB() Database {
+func newMemoryDB(policy LoanPolicy) Database {
 	return &memoryDB{
-		records:   make([]Book, 0, 10),
-		idCounter: 0,
+		records:     make([]Book, 0, 10),
+		loans:       make([]BorrowingRecord, 0, 10),
+		fines:       make(map[int]float64),
+		preferences: make(map[int]NotificationPreferences),
+		notified:    make(map[SentNotification]bool),
+		failed:      make(map[noticeKey]FailedNotification),
+		idCounter:   0,
+		policy:      policy,
 	}
 }
 
 type memoryDB struct {
-	records   []Book
-	idCounter int
+	mu            sync.Mutex
+	records       []Book
+	loans         []BorrowingRecord
+	bookRecs      []BookRecommendation
+	audit         []AuditEntry
+	outbox        []OutboxEvent
+	webhooks      []WebhookSubscription
+	deliveries    []WebhookDelivery
+	webhookID     int
+	deliveryID    int64
+	preferences   map[int]NotificationPreferences
+	notified      map[SentNotification]bool
+	failed        map[noticeKey]FailedNotification
+	fines         map[int]float64
+	idCounter     int
+	loanIDCounter int
+	policy        LoanPolicy
+}
+
+// findBook returns the index of the book in records or -1 if it is missing or deleted
+func (db *memoryDB) findBook(bookID int) int {
+	for i, book := range db.records {
+		if book.ID == bookID && book.DeletedAt == nil {
+			return i
+		}
+	}
+	return -1
 }
 
 func (db *memoryDB) GetBookByID(ctx context.Context, bookID int) (Book, error) {
-	return db.records[db.idCounter], nil
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.findBook(bookID)
+	if i < 0 {
+		return Book{}, fmt.Errorf("book with ID %d: %w", bookID, ErrBookNotFound)
+	}
+	return db.records[i], nil
+}
+
+func (db *memoryDB) GetBookByISBN(ctx context.Context, isbn string) (Book, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, book := range db.records {
+		if book.ISBN != "" && book.ISBN == isbn && book.DeletedAt == nil {
+			return book, nil
+		}
+	}
+	return Book{}, fmt.Errorf("book with ISBN %s: %w", isbn, ErrBookNotFound)
 }
 
 func (db *memoryDB) BorrowBook(ctx context.Context, book NewBorrowingRecord) error {
+	status, err := initialLoanStatus(book.Status)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.findBook(book.BookID)
+	if i < 0 {
+		return ErrBookNotFound
+	}
+	if db.records[i].Stock == 0 {
+		return ErrBookNotAvailable
+	}
+
+	stats := loanStats{unpaidFines: db.fines[book.UserID]}
+	for _, loan := range db.loans {
+		if loan.UserID != book.UserID || !isActiveLoan(loan) {
+			continue
+		}
+		stats.activeLoans++
+		if loan.DueDate.Before(book.BorrowedAt) {
+			stats.overdueLoans++
+		}
+		if loan.BookID == book.BookID {
+			stats.sameBookLoans++
+		}
+	}
+	if err := db.policy.check(book.Role, stats); err != nil {
+		return err
+	}
+
+	loan := BorrowingRecord{
+		ID:         db.loanIDCounter + 1,
+		BookID:     book.BookID,
+		UserID:     book.UserID,
+		BorrowedAt: book.BorrowedAt,
+		DueDate:    db.policy.dueDate(book.BorrowedAt),
+		Status:     status,
+	}
+	if err := db.addEvent(loanEventType(status), book.BookID, newLoanEvent(loan)); err != nil {
+		return err
+	}
+	db.records[i].Stock--
+	db.loanIDCounter++
+	db.loans = append(db.loans, loan)
 	return nil
 }
 
-func (db *memoryDB) ReturnBook(ctx context.Context, books BorrowingRecord) error {
-	return nil
+func (db *memoryDB) ReturnBook(ctx context.Context, book BorrowingRecord) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, loan := range db.loans {
+		if loan.UserID == book.UserID && loan.BookID == book.BookID && isActiveLoan(loan) {
+			_, err := db.transitionLoan(i, LoanStatusReturned, time.Now())
+			return err
+		}
+	}
+	return ErrLoanNotFound
+}
+
+func (db *memoryDB) UpdateLoanStatus(ctx context.Context, loanID int, status string, at time.Time) (BorrowingRecord, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, loan := range db.loans {
+		if loan.ID == loanID {
+			return db.transitionLoan(i, status, at)
+		}
+	}
+	return BorrowingRecord{}, ErrLoanNotFound
+}
+
+func (db *memoryDB) RenewLoan(ctx context.Context, userID, loanID int, at time.Time) (BorrowingRecord, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, loan := range db.loans {
+		if loan.ID == loanID && loan.UserID == userID {
+			return db.transitionLoan(i, LoanStatusRenewed, at)
+		}
+	}
+	return BorrowingRecord{}, ErrLoanNotFound
+}
+
+// transitionLoan moves the loan at index i to status and adds the event of the change
+func (db *memoryDB) transitionLoan(i int, status string, at time.Time) (BorrowingRecord, error) {
+	loan, err := db.applyLoanTransition(i, status, at)
+	if err != nil {
+		return BorrowingRecord{}, err
+	}
+	if err := db.addEvent(loanEventType(status), loan.BookID, newLoanEvent(loan)); err != nil {
+		return BorrowingRecord{}, err
+	}
+	return loan, nil
+}
+
+// applyLoanTransition mirrors postgresDB.applyLoanTransition for the loan at index i
+func (db *memoryDB) applyLoanTransition(i int, to string, at time.Time) (BorrowingRecord, error) {
+	loan, err := db.policy.transitionLoan(db.loans[i], to, at)
+	if err != nil {
+		return BorrowingRecord{}, err
+	}
+	db.loans[i] = loan
+
+	switch to {
+	case LoanStatusReturned:
+		// copies of deleted books still go back to stock, like in PostgreSQL
+		for j := range db.records {
+			if db.records[j].ID == loan.BookID {
+				db.records[j].Stock++
+			}
+		}
+	case LoanStatusLost:
+		db.fines[loan.UserID] += db.policy.ReplacementFee
+	}
+	return loan, nil
+}
+
+func (db *memoryDB) GetAuthorStats(_ context.Context, authorID int) (AuthorStats, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var stats AuthorStats
+	books := make(map[int]bool)
+	for _, book := range db.records {
+		if book.AuthorID == authorID && book.DeletedAt == nil {
+			stats.Titles++
+			stats.AvailableCopies += book.Stock
+			books[book.ID] = true
+		}
+	}
+	for _, loan := range db.loans {
+		if books[loan.BookID] && isActiveLoan(loan) {
+			stats.ActiveLoans++
+		}
+	}
+	stats.TotalCopies = stats.AvailableCopies + stats.ActiveLoans
+	return stats, nil
+}
+
+func isActiveLoan(loan BorrowingRecord) bool {
+	return loan.Status != LoanStatusReturned && loan.Status != LoanStatusLost
+}
+
+func (db *memoryDB) ListLoans(ctx context.Context, filter LoanFilter, limit, offset int) ([]BorrowingRecord, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	loans := make([]BorrowingRecord, 0)
+	// newest loans first, matching the PostgreSQL ordering
+	for i := len(db.loans) - 1; i >= 0; i-- {
+		loan := db.loans[i]
+		if filter.UserID != 0 && loan.UserID != filter.UserID {
+			continue
+		}
+		if filter.BookID != 0 && loan.BookID != filter.BookID {
+			continue
+		}
+
+		loan.Status = effectiveLoanStatus(loan.Status, loan.DueDate, filter.Now)
+		switch filter.State {
+		case LoanStateCurrent:
+			if !isActiveLoan(loan) {
+				continue
+			}
+		case LoanStateReturned, LoanStateOverdue, LoanStateLost:
+			if loan.Status != filter.State {
+				continue
+			}
+		}
+		loans = append(loans, loan)
+	}
+
+	if offset >= len(loans) {
+		return []BorrowingRecord{}, nil
+	}
+	loans = loans[offset:]
+	if limit > 0 && limit < len(loans) {
+		loans = loans[:limit]
+	}
+	return loans, nil
+}
+
+func (db *memoryDB) CountOverdueLoans(ctx context.Context, now time.Time) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	count := 0
+	for _, loan := range db.loans {
+		if effectiveLoanStatus(loan.Status, loan.DueDate, now) == LoanStatusOverdue {
+			count++
+		}
+	}
+	return count, nil
 }
 
 func (db *memoryDB) AddRecommendedBook(ctx context.Context, book NewBookRecommendation) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.bookRecs = append(db.bookRecs, BookRecommendation{
+		ID:                len(db.bookRecs) + 1,
+		BookID:            book.BookID,
+		RecommendedBookID: book.RecommendedBookID,
+		Score:             book.Score,
+	})
 	return nil
 }
 
-func (db *memoryDB) GetRecommendedBooks(ctx context.Context, bookID int) ([]BookRecommendation, error) {
-	return []BookRecommendation{}, nil
+func (db *memoryDB) GetRecommendedBooks(ctx context.Context, bookIDs []int) ([]BookRecommendation, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	recs := []BookRecommendation{}
+	for _, rec := range db.bookRecs {
+		if slices.Contains(bookIDs, rec.BookID) {
+			recs = append(recs, rec)
+		}
+	}
+	return recs, nil
+}
+
+func (db *memoryDB) LoadAllBooks(_ context.Context, filter BookFilter) ([]Book, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	books := make([]Book, 0, len(db.records))
+	for _, book := range db.records {
+		if filter.matches(book) {
+			books = append(books, book)
+		}
+	}
+	return books, nil
+}
+
+// ListBooks mirrors the PostgreSQL listing, strings compare like the text columns of the database
+func (db *memoryDB) ListBooks(ctx context.Context, filter BookFilter, sort []SortField, after *Cursor, limit int) ([]Book, error) {
+	keys, err := resolveSort(bookSortColumns, sort)
+	if err != nil {
+		return nil, err
+	}
+	books, err := db.LoadAllBooks(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		values, err := cursorValues(keys, *after)
+		if err != nil {
+			return nil, err
+		}
+		books = slices.DeleteFunc(books, func(b Book) bool {
+			return compareKeyset(keys, b, b.ID, values, after.ID) <= 0
+		})
+	}
+	slices.SortFunc(books, func(a, b Book) int {
+		return compareKeyset(keys, a, a.ID, rowValues(keys, b), b.ID)
+	})
+	if limit > 0 && limit < len(books) {
+		books = books[:limit]
+	}
+	return books, nil
+}
+
+func (db *memoryDB) StreamBooks(ctx context.Context, filter BookFilter, sort []SortField, fn func(Book) error) error {
+	books, err := db.ListBooks(ctx, filter, sort, nil, 0)
+	if err != nil {
+		return err
+	}
+	for _, book := range books {
+		if err := fn(book); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *memoryDB) LoadBooksByIDs(_ context.Context, ids []int) ([]Book, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	books := []Book{}
+	for _, book := range db.records {
+		if slices.Contains(ids, book.ID) && book.DeletedAt == nil {
+			books = append(books, book)
+		}
+	}
+	return books, nil
+}
+
+func (db *memoryDB) LoadBooksByAuthorsOrCategories(_ context.Context, authorIDs, categoryIDs []int, limit int) ([]Book, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	books := []Book{}
+	for _, book := range db.records {
+		if len(books) == limit {
+			break
+		}
+		if book.DeletedAt != nil {
+			continue
+		}
+		if slices.Contains(authorIDs, book.AuthorID) || slices.Contains(categoryIDs, book.CategoryID) {
+			books = append(books, book)
+		}
+	}
+	return books, nil
+}
+
+func (db *memoryDB) SearchBooks(_ context.Context, query string, limit, offset int) ([]BookSearchResult, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	live := slices.DeleteFunc(slices.Clone(db.records), func(b Book) bool { return b.DeletedAt != nil })
+	return searchBooks(live, query, limit, offset), nil
+}
+
+func (db *memoryDB) CreateBook(_ context.Context, newBook NewBook) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.isbnTaken(newBook.ISBN) {
+		return 0, ErrDuplicateISBN
+	}
+	event, err := newEvent(EventBookCreated, db.idCounter, newBookEvent(db.idCounter, newBook))
+	if err != nil {
+		return 0, err
+	}
+	id := db.insertBook(newBook)
+	db.appendEvent(event)
+	return id, nil
 }
 
-func (db *memoryDB) LoadAllBooks(_ context.Context) ([]Book, error) {
-	return db.records, nil
+func (db *memoryDB) CreateBooks(_ context.Context, newBooks []NewBook) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// check every book first so a duplicate leaves the store untouched like a failed insert
+	seen := make(map[string]bool, len(newBooks))
+	for _, newBook := range newBooks {
+		if db.isbnTaken(newBook.ISBN) || (newBook.ISBN != "" && seen[newBook.ISBN]) {
+			return 0, ErrDuplicateISBN
+		}
+		seen[newBook.ISBN] = true
+	}
+	for _, newBook := range newBooks {
+		id := db.insertBook(newBook)
+		if err := db.addEvent(EventBookCreated, id, newBookEvent(id, newBook)); err != nil {
+			return 0, err
+		}
+	}
+	return len(newBooks), nil
+}
+
+func (db *memoryDB) ExistingISBNs(_ context.Context, isbns []string) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	existing := []string{}
+	for _, isbn := range isbns {
+		if db.isbnTaken(isbn) {
+			existing = append(existing, isbn)
+		}
+	}
+	return existing, nil
 }
 
-func (db *memoryDB) CreateBook(_ context.Context, newBook NewBook) error {
+func (db *memoryDB) isbnTaken(isbn string) bool {
+	if isbn == "" {
+		return false
+	}
+	for _, book := range db.records {
+		if book.ISBN == isbn {
+			return true
+		}
+	}
+	return false
+}
+
+// insertBook appends a book and returns its id
+func (db *memoryDB) insertBook(newBook NewBook) int {
+	now := time.Now()
 	db.records = append(db.records, Book{
-		ID:    db.idCounter,
-		Title: newBook.Title,
+		ID:            db.idCounter,
+		Title:         newBook.Title,
+		ISBN:          newBook.ISBN,
+		AuthorID:      newBook.AuthorID,
+		CategoryID:    newBook.CategoryID,
+		Stock:         newBook.Stock,
+		PublishedDate: newBook.PublishedDate,
+		Description:   newBook.Description,
+		CreatedAt:     now,
+		UpdatedAt:     now,
 	})
 	db.idCounter++
-	return nil
+	return db.idCounter - 1
+}
+
+func (db *memoryDB) ReassignAuthorBooks(_ context.Context, fromAuthorID, toAuthorID int) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	moved := 0
+	now := time.Now()
+	for i := range db.records {
+		book := &db.records[i]
+		if book.AuthorID != fromAuthorID || book.DeletedAt != nil {
+			continue
+		}
+		book.AuthorID = toAuthorID
+		book.UpdatedAt = now
+		err := db.addEvent(EventBookUpdated, book.ID, bookEvent{
+			ID:            book.ID,
+			Title:         book.Title,
+			ISBN:          book.ISBN,
+			AuthorID:      book.AuthorID,
+			CategoryID:    book.CategoryID,
+			Stock:         book.Stock,
+			PublishedDate: book.PublishedDate,
+			Description:   book.Description,
+		})
+		if err != nil {
+			return 0, err
+		}
+		moved++
+	}
+	return moved, nil
 }
 
 func (db *memoryDB) UpdateBook(_ context.Context, book Book) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.findBook(book.ID)
+	if i < 0 {
+		return ErrBookNotFound
+	}
+	if book.ISBN != db.records[i].ISBN && db.isbnTaken(book.ISBN) {
+		return ErrDuplicateISBN
+	}
+	updated := NewBook{
+		Title:         book.Title,
+		ISBN:          book.ISBN,
+		AuthorID:      book.AuthorID,
+		CategoryID:    book.CategoryID,
+		Stock:         book.Stock,
+		PublishedDate: book.PublishedDate,
+		Description:   book.Description,
+	}
+	event, err := newEvent(EventBookUpdated, book.ID, newBookEvent(book.ID, updated))
+	if err != nil {
+		return err
+	}
+
+	record := &db.records[i]
+	record.Title, record.ISBN = updated.Title, updated.ISBN
+	record.AuthorID, record.CategoryID = updated.AuthorID, updated.CategoryID
+	record.Stock, record.PublishedDate, record.Description = updated.Stock, updated.PublishedDate, updated.Description
+	record.UpdatedAt = time.Now()
+	db.appendEvent(event)
 	return nil
 }
 
 func (db *memoryDB) DeleteBook(_ context.Context, id int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.findBook(id)
+	if i < 0 {
+		return ErrBookNotFound
+	}
+	for _, loan := range db.loans {
+		if loan.BookID == id && isActiveLoan(loan) {
+			return ErrBookOnLoan
+		}
+	}
+	event, err := newEvent(EventBookDeleted, id, bookRefEvent{ID: id})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	db.records[i].DeletedAt = &now
+	db.appendEvent(event)
+	return nil
+}
+
+func (db *memoryDB) RestoreBook(_ context.Context, id int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, book := range db.records {
+		if book.ID == id && book.DeletedAt != nil {
+			event, err := newEvent(EventBookRestored, id, bookRefEvent{ID: id})
+			if err != nil {
+				return err
+			}
+			db.records[i].DeletedAt = nil
+			db.records[i].UpdatedAt = time.Now()
+			db.appendEvent(event)
+			return nil
+		}
+	}
+	return ErrBookNotFound
+}
+
+// PurgeBooks drops the purged books together with their recommendations, mirroring
+// the PostgreSQL schema. Books with loans are kept for their loan history.
+func (db *memoryDB) PurgeBooks(_ context.Context, before time.Time) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	lent := make(map[int]bool)
+	for _, loan := range db.loans {
+		lent[loan.BookID] = true
+	}
+	purged := make(map[int]bool)
+	var events []OutboxEvent
+	for _, b := range db.records {
+		if b.DeletedAt != nil && b.DeletedAt.Before(before) && !lent[b.ID] {
+			event, err := newEvent(EventBookPurged, b.ID, bookRefEvent{ID: b.ID})
+			if err != nil {
+				return 0, err
+			}
+			purged[b.ID] = true
+			events = append(events, event)
+		}
+	}
+	db.records = slices.DeleteFunc(db.records, func(b Book) bool {
+		return purged[b.ID]
+	})
+	db.bookRecs = slices.DeleteFunc(db.bookRecs, func(r BookRecommendation) bool {
+		return purged[r.BookID] || purged[r.RecommendedBookID]
+	})
+	for _, event := range events {
+		db.appendEvent(event)
+	}
+	return len(purged), nil
+}
+
+func (db *memoryDB) Ping(context.Context) error {
 	return nil
 }
 
 func (db *memoryDB) CloseConnections() {
 }
+
+func (db *memoryDB) AddWebhookSubscription(_ context.Context, subscription NewWebhookSubscription) (WebhookSubscription, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.webhookID++
+	created := WebhookSubscription{
+		ID:         db.webhookID,
+		URL:        subscription.URL,
+		Secret:     subscription.Secret,
+		EventTypes: slices.Clone(subscription.EventTypes),
+		CreatedAt:  time.Now(),
+	}
+	if created.EventTypes == nil {
+		created.EventTypes = []string{}
+	}
+	db.webhooks = append(db.webhooks, created)
+	return created, nil
+}
+
+func (db *memoryDB) ListWebhookSubscriptions(_ context.Context) ([]WebhookSubscription, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return slices.Clone(db.webhooks), nil
+}
+
+func (db *memoryDB) DeleteWebhookSubscription(_ context.Context, id int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := slices.IndexFunc(db.webhooks, func(s WebhookSubscription) bool { return s.ID == id })
+	if i < 0 {
+		return ErrWebhookNotFound
+	}
+	db.webhooks = slices.Delete(db.webhooks, i, i+1)
+	db.deliveries = slices.DeleteFunc(db.deliveries, func(d WebhookDelivery) bool { return d.SubscriptionID == id })
+	return nil
+}
+
+func (db *memoryDB) EnqueueWebhookDeliveries(_ context.Context, delivery NewWebhookDelivery) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	enqueued := 0
+	for _, subscription := range db.webhooks {
+		if !subscription.wants(delivery.EventType) || db.hasDelivery(subscription.ID, delivery.EventID) {
+			continue
+		}
+		db.deliveryID++
+		nextAttemptAt := now
+		db.deliveries = append(db.deliveries, WebhookDelivery{
+			ID:             db.deliveryID,
+			SubscriptionID: subscription.ID,
+			EventID:        delivery.EventID,
+			EventType:      delivery.EventType,
+			Payload:        slices.Clone(delivery.Payload),
+			Status:         DeliveryPending,
+			NextAttemptAt:  &nextAttemptAt,
+			CreatedAt:      now,
+		})
+		enqueued++
+	}
+	return enqueued, nil
+}
+
+// hasDelivery reports whether an event was already enqueued for a subscription, the caller holds db.mu
+func (db *memoryDB) hasDelivery(subscriptionID int, eventID int64) bool {
+	return slices.ContainsFunc(db.deliveries, func(d WebhookDelivery) bool {
+		return d.SubscriptionID == subscriptionID && d.EventID == eventID
+	})
+}
+
+func (db *memoryDB) ClaimWebhookDeliveries(_ context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	claimed := []WebhookDelivery{}
+	leasedUntil := now.Add(lease)
+	for i := range db.deliveries {
+		if len(claimed) == limit {
+			break
+		}
+		delivery := &db.deliveries[i]
+		if delivery.Status != DeliveryPending || delivery.NextAttemptAt == nil || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		until := leasedUntil
+		delivery.NextAttemptAt = &until
+		claimed = append(claimed, *delivery)
+	}
+	return claimed, nil
+}
+
+func (db *memoryDB) RecordWebhookAttempt(_ context.Context, id int64, attempt WebhookAttempt) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.findDelivery(id)
+	if i < 0 {
+		return ErrDeliveryNotFound
+	}
+	attempt.apply(&db.deliveries[i])
+	return nil
+}
+
+// findDelivery returns the index of the delivery or -1, the caller holds db.mu
+func (db *memoryDB) findDelivery(id int64) int {
+	return slices.IndexFunc(db.deliveries, func(d WebhookDelivery) bool { return d.ID == id })
+}
+
+func (db *memoryDB) ListWebhookDeliveries(_ context.Context, filter WebhookDeliveryFilter, limit, offset int) ([]WebhookDelivery, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	deliveries := []WebhookDelivery{}
+	for i := len(db.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if !filter.matches(db.deliveries[i]) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		deliveries = append(deliveries, db.deliveries[i])
+	}
+	return deliveries, nil
+}
+
+func (db *memoryDB) RetryWebhookDelivery(_ context.Context, id int64, at time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.findDelivery(id)
+	if i < 0 {
+		return ErrDeliveryNotFound
+	}
+	delivery := &db.deliveries[i]
+	if delivery.Status != DeliveryDead {
+		return ErrDeliveryNotDead
+	}
+	delivery.Status = DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &at
+	return nil
+}
+
+func (db *memoryDB) LoansToNotify(_ context.Context, filter NoticeFilter, limit int) ([]LoanNotice, error) {
+	if _, ok := noticePreferenceColumns[filter.Kind]; !ok {
+		return nil, fmt.Errorf("unknown notification kind %q", filter.Kind)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	notices := []LoanNotice{}
+	for _, loan := range db.loans {
+		if loan.Status != LoanStatusBorrowed && loan.Status != LoanStatusRenewed && loan.Status != LoanStatusOverdue {
+			continue
+		}
+		if loan.DueDate.Before(filter.DueAfter) || !loan.DueDate.Before(filter.DueBefore) {
+			continue
+		}
+		book := db.findBook(loan.BookID)
+		if book < 0 {
+			continue
+		}
+		preferences := db.userPreferences(loan.UserID)
+		sent := SentNotification{LoanID: loan.ID, UserID: loan.UserID, Kind: filter.Kind, DueDate: loan.DueDate}
+		if !preferences.wants(filter.Kind) || db.notified[sent] {
+			continue
+		}
+		failure, failed := db.failed[noticeKey{loanID: loan.ID, kind: filter.Kind, dueDate: loan.DueDate}]
+		if failed && failure.NextAttemptAt.After(filter.Now) {
+			continue
+		}
+		notices = append(notices, LoanNotice{
+			LoanID:    loan.ID,
+			BookID:    loan.BookID,
+			UserID:    loan.UserID,
+			BookTitle: db.records[book].Title,
+			DueDate:   loan.DueDate,
+			Email:     preferences.Email,
+			Attempts:  failure.Attempts,
+		})
+	}
+
+	slices.SortStableFunc(notices, func(a, b LoanNotice) int { return a.DueDate.Compare(b.DueDate) })
+	if limit < len(notices) {
+		notices = notices[:limit]
+	}
+	return notices, nil
+}
+
+func (db *memoryDB) RecordNotification(_ context.Context, notification SentNotification) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.notified[notification] = true
+	return nil
+}
+
+// noticeKey identifies a notification of a loan for one due date
+type noticeKey struct {
+	loanID  int
+	kind    string
+	dueDate time.Time
+}
+
+func (db *memoryDB) RecordNotificationFailure(_ context.Context, failure FailedNotification) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.failed[noticeKey{loanID: failure.LoanID, kind: failure.Kind, dueDate: failure.DueDate}] = failure
+	return nil
+}
+
+// userPreferences returns the preferences of a user or the defaults, the caller holds db.mu
+func (db *memoryDB) userPreferences(userID int) NotificationPreferences {
+	if preferences, ok := db.preferences[userID]; ok {
+		return preferences
+	}
+	return DefaultNotificationPreferences(userID)
+}
+
+func (db *memoryDB) GetNotificationPreferences(_ context.Context, userID int) (NotificationPreferences, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.userPreferences(userID), nil
+}
+
+func (db *memoryDB) SetNotificationPreferences(_ context.Context, preferences NotificationPreferences) (NotificationPreferences, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	preferences.UpdatedAt = time.Now()
+	db.preferences[preferences.UserID] = preferences
+	return preferences, nil
+}
+
+// WithinTx runs fn directly, the memory database applies every change on its own
+// and has nothing to roll back
+func (db *memoryDB) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// WithinRepeatableReadTx runs fn directly like WithinTx
+func (db *memoryDB) WithinRepeatableReadTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (db *memoryDB) AddAuditEntry(_ context.Context, entry NewAuditEntry) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.audit = append(db.audit, AuditEntry{
+		ID:        int64(len(db.audit) + 1),
+		Actor:     entry.Actor,
+		ActorRole: entry.ActorRole,
+		Action:    entry.Action,
+		Entity:    entry.Entity,
+		EntityID:  entry.EntityID,
+		Changes:   slices.Clone(entry.Changes),
+		RequestID: entry.RequestID,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (db *memoryDB) ListAuditEntries(_ context.Context, filter AuditFilter, limit, offset int) ([]AuditEntry, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	entries := []AuditEntry{}
+	for i := len(db.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		if !filter.matches(db.audit[i]) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		entries = append(entries, db.audit[i])
+	}
+	return entries, nil
+}
+
+// addEvent writes an event to the outbox, the caller holds db.mu
+func (db *memoryDB) addEvent(eventType string, aggregateID int, payload any) error {
+	event, err := newEvent(eventType, aggregateID, payload)
+	if err != nil {
+		return err
+	}
+	db.appendEvent(event)
+	return nil
+}
+
+// appendEvent assigns the next id to an encoded event and appends it, the caller holds db.mu
+func (db *memoryDB) appendEvent(event OutboxEvent) {
+	event.ID = int64(len(db.outbox) + 1)
+	event.CreatedAt = time.Now()
+	db.outbox = append(db.outbox, event)
+}
+
+func (db *memoryDB) PendingEvents(_ context.Context, limit int) ([]OutboxEvent, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	events := []OutboxEvent{}
+	for _, event := range db.outbox {
+		if len(events) == limit {
+			break
+		}
+		if event.PublishedAt == nil {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (db *memoryDB) MarkEventPublished(_ context.Context, id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i := range db.outbox {
+		if db.outbox[i].ID == id {
+			now := time.Now()
+			db.outbox[i].PublishedAt = &now
+			return nil
+		}
+	}
+	return nil
+}
@@ -2,43 +2,633 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMemoryDB_LoadBooks(t *testing.T) {
-	db := newMemoryDB()
-	books, err := db.LoadAllBooks(context.Background())
+	db := newMemoryDB(DefaultLoanPolicy())
+	books, err := db.LoadAllBooks(context.Background(), BookFilter{})
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(books))
 }
 
 func TestMemoryDB_SaveBook(t *testing.T) {
-	db := newMemoryDB()
+	db := newMemoryDB(DefaultLoanPolicy())
 	newBook := NewBook{Title: "Title"}
-	err := db.CreateBook(context.Background(), newBook)
+	id, err := db.CreateBook(context.Background(), newBook)
 	assert.Nil(t, err)
+	assert.Equal(t, 0, id)
 
-	books, err := db.LoadAllBooks(context.Background())
+	books, err := db.LoadAllBooks(context.Background(), BookFilter{})
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(books))
 	assertBook(t, books[0], 0, newBook)
 }
 
 func TestMemoryDB_SaveBookMultiple(t *testing.T) {
-	db := newMemoryDB()
+	db := newMemoryDB(DefaultLoanPolicy())
 	newBook1 := NewBook{Title: "Title1"}
-	err := db.CreateBook(context.Background(), newBook1)
+	_, err := db.CreateBook(context.Background(), newBook1)
 	assert.Nil(t, err)
 
 	newBook2 := NewBook{Title: "Title2"}
-	err = db.CreateBook(context.Background(), newBook2)
+	id, err := db.CreateBook(context.Background(), newBook2)
 	assert.Nil(t, err)
+	assert.Equal(t, 1, id)
 
-	books, err := db.LoadAllBooks(context.Background())
+	books, err := db.LoadAllBooks(context.Background(), BookFilter{})
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(books))
 	assertBook(t, books[0], 0, newBook1)
 	assertBook(t, books[1], 1, newBook2)
 }
+
+func TestMemoryDB_LoadAllBooks_Filter(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	_, err := db.CreateBooks(context.Background(), []NewBook{
+		{Title: "Title1", AuthorID: 1, CategoryID: 1},
+		{Title: "Title2", AuthorID: 2, CategoryID: 1},
+		{Title: "Title3", AuthorID: 2, CategoryID: 2},
+	})
+	assert.Nil(t, err)
+
+	books, err := db.LoadAllBooks(context.Background(), BookFilter{AuthorID: 2, CategoryID: 1})
+	assert.Nil(t, err)
+	assert.Len(t, books, 1)
+	assert.Equal(t, "Title2", books[0].Title)
+}
+
+func TestMemoryDB_GetAuthorStats(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	_, err := db.CreateBooks(ctx, []NewBook{
+		{Title: "Title1", AuthorID: 1, Stock: 2},
+		{Title: "Title2", AuthorID: 1, Stock: 3},
+		{Title: "Title3", AuthorID: 2, Stock: 4},
+	})
+	assert.Nil(t, err)
+	borrowedAt := time.Now()
+	assert.Nil(t, db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 1, Role: "member", BorrowedAt: borrowedAt}))
+	assert.Nil(t, db.BorrowBook(ctx, NewBorrowingRecord{BookID: 2, UserID: 1, Role: "member", BorrowedAt: borrowedAt}))
+
+	stats, err := db.GetAuthorStats(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, AuthorStats{Titles: 2, TotalCopies: 5, AvailableCopies: 4, ActiveLoans: 1}, stats)
+
+	stats, err = db.GetAuthorStats(ctx, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, AuthorStats{}, stats)
+}
+
+func TestMemoryDB_ReassignAuthorBooks(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	_, err := db.CreateBooks(ctx, []NewBook{
+		{Title: "Title1", AuthorID: 1},
+		{Title: "Title2", AuthorID: 2},
+		{Title: "Title3", AuthorID: 1},
+	})
+	assert.Nil(t, err)
+
+	moved, err := db.ReassignAuthorBooks(ctx, 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, moved)
+
+	books, err := db.LoadAllBooks(ctx, BookFilter{AuthorID: 2})
+	assert.Nil(t, err)
+	assert.Len(t, books, 3)
+}
+
+func TestMemoryDB_DeleteBook(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	_, err := db.CreateBooks(ctx, []NewBook{{Title: "Title1", Stock: 1}, {Title: "Title2"}})
+	assert.Nil(t, err)
+	assert.Nil(t, db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 1, Role: "member", BorrowedAt: time.Now()}))
+
+	assert.ErrorIs(t, db.DeleteBook(ctx, 0), ErrBookOnLoan)
+	assert.Nil(t, db.ReturnBook(ctx, BorrowingRecord{BookID: 0, UserID: 1}))
+	assert.Nil(t, db.DeleteBook(ctx, 0))
+	assert.ErrorIs(t, db.DeleteBook(ctx, 0), ErrBookNotFound)
+	_, err = db.GetBookByID(ctx, 0)
+	assert.NotNil(t, err)
+	books, err := db.LoadAllBooks(ctx, BookFilter{})
+	assert.Nil(t, err)
+	assert.Len(t, books, 1)
+	books, err = db.LoadAllBooks(ctx, BookFilter{IncludeDeleted: true})
+	assert.Nil(t, err)
+	assert.Len(t, books, 2)
+
+	// the loan history is kept
+	loans, err := db.ListLoans(ctx, LoanFilter{BookID: 0}, 10, 0)
+	assert.Nil(t, err)
+	assert.Len(t, loans, 1)
+
+	assert.Nil(t, db.RestoreBook(ctx, 0))
+	assert.ErrorIs(t, db.RestoreBook(ctx, 0), ErrBookNotFound)
+	_, err = db.GetBookByID(ctx, 0)
+	assert.Nil(t, err)
+}
+
+func TestMemoryDB_PurgeBooks(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	_, err := db.CreateBooks(ctx, []NewBook{{Title: "Title1", Stock: 1}, {Title: "Title2"}})
+	assert.Nil(t, err)
+	assert.Nil(t, db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 1, Role: "member", BorrowedAt: time.Now()}))
+	assert.Nil(t, db.ReturnBook(ctx, BorrowingRecord{BookID: 0, UserID: 1}))
+	assert.Nil(t, db.DeleteBook(ctx, 0))
+	assert.Nil(t, db.DeleteBook(ctx, 1))
+
+	purged, err := db.PurgeBooks(ctx, time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, purged)
+
+	// the lent out book stays for its loan history
+	purged, err = db.PurgeBooks(ctx, time.Now().Add(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, purged)
+	books, err := db.LoadAllBooks(ctx, BookFilter{IncludeDeleted: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0}, bookIDs(books))
+	loans, err := db.ListLoans(ctx, LoanFilter{}, 10, 0)
+	assert.Nil(t, err)
+	assert.Len(t, loans, 1)
+}
+
+func TestMemoryDB_ListBooks(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	_, err := db.CreateBooks(context.Background(), []NewBook{
+		{Title: "b", AuthorID: 1},
+		{Title: "a", AuthorID: 1},
+		{Title: "b", AuthorID: 1},
+		{Title: "B", AuthorID: 1},
+		{Title: "c", AuthorID: 2},
+	})
+	assert.Nil(t, err)
+
+	// titles compare like the en-US collation, so case only breaks ties
+	byTitle := []SortField{{Field: "title"}}
+	page, err := db.ListBooks(context.Background(), BookFilter{AuthorID: 1}, byTitle, nil, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 0}, bookIDs(page))
+
+	page, err = db.ListBooks(context.Background(), BookFilter{AuthorID: 1}, byTitle, &Cursor{Keys: []string{"b"}, ID: 0}, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2, 3}, bookIDs(page))
+}
+
+func TestMemoryDB_ListBooks_Sort(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	_, err := db.CreateBooks(context.Background(), []NewBook{
+		{Title: "b", PublishedDate: day(1)},
+		{Title: "a", PublishedDate: day(2)},
+		{Title: "c", PublishedDate: day(2)},
+		{Title: "a", PublishedDate: day(2)},
+	})
+	assert.Nil(t, err)
+
+	sort := []SortField{{Field: "published_date", Desc: true}, {Field: "title"}}
+	var ids []int
+	var after *Cursor
+	for {
+		page, err := db.ListBooks(context.Background(), BookFilter{}, sort, after, 1)
+		assert.Nil(t, err)
+		if len(page) == 0 {
+			break
+		}
+		ids = append(ids, page[0].ID)
+		cursor := BookCursor(page[0], sort)
+		after = &cursor
+	}
+	assert.Equal(t, []int{1, 3, 2, 0}, ids)
+}
+
+func TestMemoryDB_ListBooks_InvalidSort(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+
+	_, err := db.ListBooks(context.Background(), BookFilter{}, []SortField{{Field: "isbn"}}, nil, 10)
+	assert.ErrorIs(t, err, ErrInvalidSort)
+
+	_, err = db.ListBooks(context.Background(), BookFilter{}, []SortField{{Field: "stock"}}, &Cursor{Keys: []string{"many"}}, 10)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func bookIDs(books []Book) []int {
+	ids := make([]int, 0, len(books))
+	for _, book := range books {
+		ids = append(ids, book.ID)
+	}
+	return ids
+}
+
+func TestMemoryDB_GetBookByISBN(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	newBook := NewBook{Title: "Atomic Habits", ISBN: "9780735211292"}
+	mustCreateBook(t, db, newBook)
+
+	book, err := db.GetBookByISBN(context.Background(), "9780735211292")
+	assert.Nil(t, err)
+	assertBook(t, book, 0, newBook)
+
+	_, err = db.GetBookByISBN(context.Background(), "9780804429573")
+	assert.ErrorIs(t, err, ErrBookNotFound)
+
+	_, err = db.CreateBook(context.Background(), NewBook{Title: "Copy", ISBN: "9780735211292"})
+	assert.ErrorIs(t, err, ErrDuplicateISBN)
+}
+
+func TestMemoryDB_CreateBook_WithoutISBN(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+
+	mustCreateBook(t, db, NewBook{Title: "book1"})
+	mustCreateBook(t, db, NewBook{Title: "book2"})
+
+	count, err := db.CreateBooks(context.Background(), []NewBook{{Title: "book3"}, {Title: "book4"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestMemoryDB_BorrowBook(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	mustCreateBook(t, db, NewBook{Title: "Title", Stock: 2})
+
+	err := db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 1, Role: "member", BorrowedAt: borrowedAt})
+	assert.Nil(t, err)
+
+	book, err := db.GetBookByID(ctx, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, book.Stock)
+
+	err = db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 1, Role: "member", BorrowedAt: borrowedAt})
+	var ruleErr *LoanRuleError
+	assert.ErrorAs(t, err, &ruleErr)
+	assert.Equal(t, RuleDuplicateTitle, ruleErr.Rule)
+
+	err = db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 2, Role: "member", BorrowedAt: borrowedAt.Add(4 * 24 * time.Hour)})
+	assert.Nil(t, err)
+
+	err = db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 3, Role: "member", BorrowedAt: borrowedAt})
+	assert.ErrorIs(t, err, ErrBookNotAvailable)
+
+	assert.Nil(t, db.ReturnBook(ctx, BorrowingRecord{BookID: 0, UserID: 1}))
+	assert.NotNil(t, db.ReturnBook(ctx, BorrowingRecord{BookID: 0, UserID: 1}))
+}
+
+func TestMemoryDB_BorrowBook_OverdueBlocks(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	mustCreateBook(t, db, NewBook{Title: "Title1", Stock: 1})
+	mustCreateBook(t, db, NewBook{Title: "Title2", Stock: 1})
+
+	assert.Nil(t, db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 1, BorrowedAt: borrowedAt}))
+
+	err := db.BorrowBook(ctx, NewBorrowingRecord{BookID: 1, UserID: 1, BorrowedAt: borrowedAt.Add(7 * 24 * time.Hour)})
+	var ruleErr *LoanRuleError
+	assert.ErrorAs(t, err, &ruleErr)
+	assert.Equal(t, RuleOverdueLoans, ruleErr.Rule)
+}
+
+func TestMemoryDB_ListLoans(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	mustCreateBook(t, db, NewBook{Title: "Title1", Stock: 2})
+	mustCreateBook(t, db, NewBook{Title: "Title2", Stock: 2})
+	assert.Nil(t, db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 1, BorrowedAt: borrowedAt}))
+	assert.Nil(t, db.BorrowBook(ctx, NewBorrowingRecord{BookID: 1, UserID: 1, BorrowedAt: borrowedAt}))
+	assert.Nil(t, db.BorrowBook(ctx, NewBorrowingRecord{BookID: 1, UserID: 2, BorrowedAt: borrowedAt}))
+	assert.Nil(t, db.ReturnBook(ctx, BorrowingRecord{BookID: 0, UserID: 1}))
+
+	now := borrowedAt.Add(5 * 24 * time.Hour)
+
+	loans, err := db.ListLoans(ctx, LoanFilter{UserID: 1, Now: now}, 10, 0)
+	assert.Nil(t, err)
+	assert.Len(t, loans, 2)
+	assert.Equal(t, 1, loans[0].BookID)
+	assert.Equal(t, LoanStatusOverdue, loans[0].Status)
+	assert.Equal(t, LoanStatusReturned, loans[1].Status)
+
+	loans, err = db.ListLoans(ctx, LoanFilter{UserID: 1, State: LoanStateCurrent, Now: now}, 10, 0)
+	assert.Nil(t, err)
+	assert.Len(t, loans, 1)
+
+	loans, err = db.ListLoans(ctx, LoanFilter{BookID: 1, State: LoanStateOverdue, Now: now}, 1, 1)
+	assert.Nil(t, err)
+	assert.Len(t, loans, 1)
+	assert.Equal(t, 1, loans[0].UserID)
+
+	count, err := db.CountOverdueLoans(ctx, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	count, err = db.CountOverdueLoans(ctx, borrowedAt)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestMemoryDB_RenewLoan(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	mustCreateBook(t, db, NewBook{Title: "Title1", Stock: 1})
+	assert.Nil(t, db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 1, BorrowedAt: borrowedAt}))
+
+	_, err := db.RenewLoan(ctx, 2, 1, borrowedAt)
+	assert.ErrorIs(t, err, ErrLoanNotFound)
+
+	for range DefaultLoanPolicy().MaxRenewals {
+		_, err = db.RenewLoan(ctx, 1, 1, borrowedAt)
+		assert.Nil(t, err)
+	}
+	_, err = db.RenewLoan(ctx, 1, 1, borrowedAt)
+	var ruleErr *LoanRuleError
+	assert.ErrorAs(t, err, &ruleErr)
+}
+
+func TestMemoryDB_UpdateLoanStatus_Lost(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	mustCreateBook(t, db, NewBook{Title: "Title1", Stock: 1})
+	mustCreateBook(t, db, NewBook{Title: "Title2", Stock: 1})
+	assert.Nil(t, db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 1, BorrowedAt: borrowedAt}))
+
+	loan, err := db.UpdateLoanStatus(ctx, 1, LoanStatusLost, borrowedAt.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, LoanStatusLost, loan.Status)
+
+	book, err := db.GetBookByID(ctx, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, book.Stock)
+
+	_, err = db.UpdateLoanStatus(ctx, 1, LoanStatusReturned, borrowedAt.Add(time.Hour))
+	var transitionErr *LoanTransitionError
+	assert.ErrorAs(t, err, &transitionErr)
+
+	// the replacement fee is over the unpaid fines limit
+	err = db.BorrowBook(ctx, NewBorrowingRecord{BookID: 1, UserID: 1, BorrowedAt: borrowedAt.Add(time.Hour)})
+	var ruleErr *LoanRuleError
+	assert.ErrorAs(t, err, &ruleErr)
+	assert.Equal(t, RuleUnpaidFines, ruleErr.Rule)
+}
+
+func TestMemoryDB_BorrowBook_InvalidStatus(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	err := db.BorrowBook(context.Background(), NewBorrowingRecord{BookID: 0, UserID: 1, Status: LoanStatusReturned})
+	assert.NotNil(t, err)
+}
+
+func TestMemoryDB_AuditLog(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	for _, entry := range []NewAuditEntry{
+		{Actor: "1", Action: "create", Entity: "book", EntityID: 0},
+		{Actor: "2", Action: "update", Entity: "book", EntityID: 0},
+		{Actor: "1", Action: "update_status", Entity: "loan", EntityID: 4},
+		{Actor: "1", Action: "delete", Entity: "book", EntityID: 0},
+	} {
+		require.NoError(t, db.AddAuditEntry(ctx, entry))
+	}
+	actions := func(filter AuditFilter, limit, offset int) []string {
+		entries, err := db.ListAuditEntries(ctx, filter, limit, offset)
+		require.NoError(t, err)
+		var actions []string
+		for _, entry := range entries {
+			actions = append(actions, entry.Action)
+		}
+		return actions
+	}
+
+	// newest first
+	assert.Equal(t, []string{"delete", "update", "create"}, actions(AuditFilter{Entity: "book"}, 10, 0))
+	assert.Equal(t, []string{"delete", "update_status", "create"}, actions(AuditFilter{Actor: "1"}, 10, 0))
+	assert.Equal(t, []string{"update_status"}, actions(AuditFilter{Actor: "1"}, 1, 1))
+	assert.Equal(t, []string{"update_status"}, actions(AuditFilter{Entity: "loan", EntityID: 4}, 10, 0))
+}
+
+func TestMemoryDB_Outbox(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	mustCreateBook(t, db, NewBook{Title: "Dune", Stock: 1})
+	require.NoError(t, db.UpdateBook(ctx, Book{ID: 0, Title: "Dune Messiah", Stock: 1}))
+	require.NoError(t, db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 5, BorrowedAt: time.Now()}))
+	require.NoError(t, db.ReturnBook(ctx, BorrowingRecord{BookID: 0, UserID: 5}))
+	assert.ErrorIs(t, db.UpdateBook(ctx, Book{ID: 9, Title: "Missing"}), ErrBookNotFound)
+
+	book, err := db.GetBookByID(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "Dune Messiah", book.Title)
+
+	events, err := db.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+		assert.Equal(t, 0, event.AggregateID)
+	}
+	assert.Equal(t, []string{EventBookCreated, EventBookUpdated, EventBookBorrowed, EventBookReturned}, types)
+	assert.JSONEq(t, `"Dune Messiah"`, string(mustField(t, events[1].Payload, "title")))
+
+	require.NoError(t, db.MarkEventPublished(ctx, events[0].ID))
+	events, err = db.PendingEvents(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, EventBookUpdated, events[0].Type)
+}
+
+func TestMemoryDB_Outbox_LoansAndDeletes(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	mustCreateBook(t, db, NewBook{Title: "Dune", Stock: 1})
+	mustCreateBook(t, db, NewBook{Title: "Emma", Stock: 1})
+	require.NoError(t, db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 5, BorrowedAt: time.Now()}))
+	_, err := db.RenewLoan(ctx, 5, 1, time.Now())
+	require.NoError(t, err)
+	_, err = db.UpdateLoanStatus(ctx, 1, LoanStatusLost, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, db.DeleteBook(ctx, 1))
+	require.NoError(t, db.RestoreBook(ctx, 1))
+	require.NoError(t, db.DeleteBook(ctx, 1))
+	purged, err := db.PurgeBooks(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+
+	events, err := db.PendingEvents(ctx, 20)
+	require.NoError(t, err)
+	var types []string
+	for _, event := range events[2:] {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{EventBookBorrowed, EventBookRenewed, EventBookLost,
+		EventBookDeleted, EventBookRestored, EventBookDeleted, EventBookPurged}, types)
+	assert.JSONEq(t, `"lost"`, string(mustField(t, events[4].Payload, "status")))
+	assert.Equal(t, 1, events[8].AggregateID)
+	assert.JSONEq(t, `{"id":1}`, string(events[8].Payload))
+}
+
+func TestMemoryDB_Outbox_ImportsAndReassignments(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	_, err := db.CreateBooks(ctx, []NewBook{
+		{Title: "Dune", AuthorID: 1},
+		{Title: "Emma", AuthorID: 1},
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.DeleteBook(ctx, 1))
+	moved, err := db.ReassignAuthorBooks(ctx, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, moved)
+
+	// the deleted book stays with its author
+	books, err := db.LoadAllBooks(ctx, BookFilter{AuthorID: 1, IncludeDeleted: true})
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, 1, books[0].ID)
+
+	events, err := db.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{EventBookCreated, EventBookCreated, EventBookDeleted, EventBookUpdated}, types)
+	assert.Equal(t, 1, events[1].AggregateID)
+	assert.JSONEq(t, `"Emma"`, string(mustField(t, events[1].Payload, "title")))
+	assert.Equal(t, 0, events[3].AggregateID)
+	assert.JSONEq(t, `2`, string(mustField(t, events[3].Payload, "author_id")))
+}
+
+func TestMemoryDB_WebhookDeliveries(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	all, err := db.AddWebhookSubscription(ctx, NewWebhookSubscription{URL: "http://all.example", Secret: "s1"})
+	require.NoError(t, err)
+	loans, err := db.AddWebhookSubscription(ctx, NewWebhookSubscription{
+		URL: "http://loans.example", Secret: "s2", EventTypes: []string{EventBookBorrowed},
+	})
+	require.NoError(t, err)
+
+	enqueued, err := db.EnqueueWebhookDeliveries(ctx, NewWebhookDelivery{EventID: 1, EventType: EventBookCreated})
+	require.NoError(t, err)
+	assert.Equal(t, 1, enqueued)
+	enqueued, err = db.EnqueueWebhookDeliveries(ctx, NewWebhookDelivery{EventID: 2, EventType: EventBookBorrowed})
+	require.NoError(t, err)
+	assert.Equal(t, 2, enqueued)
+	enqueued, err = db.EnqueueWebhookDeliveries(ctx, NewWebhookDelivery{EventID: 2, EventType: EventBookBorrowed})
+	require.NoError(t, err)
+	assert.Zero(t, enqueued, "an event is enqueued once per subscription")
+
+	now := time.Now().Add(time.Second)
+	claimed, err := db.ClaimWebhookDeliveries(ctx, now, time.Minute, 2)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	assert.Equal(t, int64(1), claimed[0].ID)
+	assert.Equal(t, now.Add(time.Minute), *claimed[0].NextAttemptAt)
+	claimed, err = db.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1, "leased deliveries are not claimed again")
+	assert.Equal(t, loans.ID, claimed[0].SubscriptionID)
+
+	require.NoError(t, db.RecordWebhookAttempt(ctx, 1, WebhookAttempt{Status: DeliveryDelivered, ResponseStatus: 200, At: now}))
+	require.NoError(t, db.RecordWebhookAttempt(ctx, 2, WebhookAttempt{Status: DeliveryDead, ResponseStatus: 500, Error: "boom", At: now}))
+	assert.ErrorIs(t, db.RecordWebhookAttempt(ctx, 9, WebhookAttempt{Status: DeliveryDead}), ErrDeliveryNotFound)
+
+	dead, err := db.ListWebhookDeliveries(ctx, WebhookDeliveryFilter{SubscriptionID: all.ID, Status: DeliveryDead}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 1, dead[0].Attempts)
+	assert.Equal(t, "boom", dead[0].LastError)
+	assert.Nil(t, dead[0].NextAttemptAt)
+
+	assert.ErrorIs(t, db.RetryWebhookDelivery(ctx, 1, now), ErrDeliveryNotDead)
+	assert.ErrorIs(t, db.RetryWebhookDelivery(ctx, 9, now), ErrDeliveryNotFound)
+	require.NoError(t, db.RetryWebhookDelivery(ctx, 2, now))
+	claimed, err = db.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, int64(2), claimed[0].ID)
+	assert.Zero(t, claimed[0].Attempts)
+
+	require.NoError(t, db.DeleteWebhookSubscription(ctx, all.ID))
+	assert.ErrorIs(t, db.DeleteWebhookSubscription(ctx, all.ID), ErrWebhookNotFound)
+	remaining, err := db.ListWebhookDeliveries(ctx, WebhookDeliveryFilter{}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, loans.ID, remaining[0].SubscriptionID)
+}
+
+func TestMemoryDB_LoansToNotify(t *testing.T) {
+	db := newMemoryDB(DefaultLoanPolicy())
+	ctx := context.Background()
+	mustCreateBook(t, db, NewBook{Title: "Dune", Stock: 3})
+	now := time.Now()
+	// due in DefaultLoanPolicy().LoanPeriod
+	require.NoError(t, db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 5, BorrowedAt: now}))
+	require.NoError(t, db.BorrowBook(ctx, NewBorrowingRecord{BookID: 0, UserID: 6, BorrowedAt: now}))
+	_, err := db.SetNotificationPreferences(ctx, NotificationPreferences{UserID: 6, Overdue: true})
+	require.NoError(t, err)
+
+	filter := NoticeFilter{Kind: NotificationDueSoon, DueAfter: now, DueBefore: now.Add(30 * 24 * time.Hour)}
+	notices, err := db.LoansToNotify(ctx, filter, 10)
+	require.NoError(t, err)
+	require.Len(t, notices, 1, "user 6 opted out of due soon reminders")
+	assert.Equal(t, 5, notices[0].UserID)
+	assert.Equal(t, "Dune", notices[0].BookTitle)
+
+	require.NoError(t, db.RecordNotification(ctx, SentNotification{
+		LoanID: notices[0].LoanID, UserID: 5, Kind: NotificationDueSoon, DueDate: notices[0].DueDate,
+	}))
+	notices, err = db.LoansToNotify(ctx, filter, 10)
+	require.NoError(t, err)
+	assert.Empty(t, notices)
+
+	notices, err = db.LoansToNotify(ctx, NoticeFilter{Kind: NotificationOverdue, DueBefore: now}, 10)
+	require.NoError(t, err)
+	assert.Empty(t, notices, "no loan is overdue yet")
+
+	// a failed notification is left out until its next attempt
+	overdue := NoticeFilter{Kind: NotificationOverdue, DueBefore: now.Add(30 * 24 * time.Hour), Now: now}
+	notices, err = db.LoansToNotify(ctx, overdue, 10)
+	require.NoError(t, err)
+	require.Len(t, notices, 2)
+	require.NoError(t, db.RecordNotificationFailure(ctx, FailedNotification{
+		LoanID: notices[0].LoanID, Kind: NotificationOverdue, DueDate: notices[0].DueDate, Attempts: 1, NextAttemptAt: now.Add(time.Hour),
+	}))
+	notices, err = db.LoansToNotify(ctx, overdue, 10)
+	require.NoError(t, err)
+	require.Len(t, notices, 1)
+	assert.Equal(t, 6, notices[0].UserID)
+	overdue.Now = now.Add(time.Hour)
+	notices, err = db.LoansToNotify(ctx, overdue, 10)
+	require.NoError(t, err)
+	require.Len(t, notices, 2)
+	assert.Equal(t, 1, notices[0].Attempts)
+
+	preferences, err := db.GetNotificationPreferences(ctx, 7)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultNotificationPreferences(7), preferences)
+}
+
+// mustField returns the raw value of a field of a JSON object
+func mustField(t *testing.T, data json.RawMessage, field string) json.RawMessage {
+	t.Helper()
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &fields))
+	return fields[field]
+}
+
+func mustCreateBook(t *testing.T, db Database, newBook NewBook) {
+	t.Helper()
+	_, err := db.CreateBook(context.Background(), newBook)
+	require.NoError(t, err)
+}
@@ -0,0 +1,77 @@
+package database
+
+import "time"
+
+// Kinds of loan notifications
+const (
+	NotificationDueSoon = "due_soon"
+	NotificationOverdue = "overdue"
+)
+
+// NotificationPreferences are the notifications a user wants and where to send them.
+// Users without stored preferences get every notification and have no email address.
+type NotificationPreferences struct {
+	UserID    int       `db:"user_id"`
+	Email     string    `db:"email"`
+	DueSoon   bool      `db:"due_soon"`
+	Overdue   bool      `db:"overdue"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// DefaultNotificationPreferences are the preferences of a user who never set any
+func DefaultNotificationPreferences(userID int) NotificationPreferences {
+	return NotificationPreferences{UserID: userID, DueSoon: true, Overdue: true}
+}
+
+// wants reports whether the preferences allow notifications of the given kind
+func (p NotificationPreferences) wants(kind string) bool {
+	switch kind {
+	case NotificationDueSoon:
+		return p.DueSoon
+	case NotificationOverdue:
+		return p.Overdue
+	}
+	return false
+}
+
+// NoticeFilter selects the running loans of books not deleted due in [DueAfter, DueBefore)
+// that have not been sent a notification of Kind for their current due date, skipping users
+// who opted out and notifications that failed and are not to be tried again before Now
+type NoticeFilter struct {
+	Kind      string
+	DueAfter  time.Time
+	DueBefore time.Time
+	Now       time.Time
+}
+
+// LoanNotice is a loan a notification is due for, Email is "" when the user set none.
+// Attempts counts the failed attempts at sending the notification.
+type LoanNotice struct {
+	LoanID    int       `db:"loan_id"`
+	BookID    int       `db:"book_id"`
+	UserID    int       `db:"user_id"`
+	BookTitle string    `db:"book_title"`
+	DueDate   time.Time `db:"due_date"`
+	Email     string    `db:"email"`
+	Attempts  int       `db:"attempts"`
+}
+
+// SentNotification records that a notification went out, a renewed loan has a new
+// due date and is notified again
+type SentNotification struct {
+	LoanID  int
+	UserID  int
+	Kind    string
+	DueDate time.Time
+}
+
+// FailedNotification records a notification the notifier could not send, it is not
+// tried again before NextAttemptAt
+type FailedNotification struct {
+	LoanID        int
+	Kind          string
+	DueDate       time.Time
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+}
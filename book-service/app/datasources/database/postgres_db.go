@@ -1,14 +1,20 @@
 package database
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
+	"library/metrics"
+
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type PostgresPool interface {
@@ -16,32 +22,239 @@ type PostgresPool interface {
 	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
 	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
 	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+	Ping(ctx context.Context) error
 	Close()
 }
 
-func newPostgresDB(ctx context.Context, databaseURL string) (Database, error) {
-	dbpool, err := pgxpool.New(ctx, databaseURL)
+func newPostgresDB(ctx context.Context, databaseURL string, pool PoolConfig, policy LoanPolicy) (Database, error) {
+	config, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse database URL: %v", err)
+	}
+	if pool.MaxConns > 0 {
+		config.MaxConns = int32(pool.MaxConns)
+	}
+	if pool.MinConns > 0 {
+		config.MinConns = int32(pool.MinConns)
+	}
+	config.ConnConfig.Tracer = queryTracer{slow: slowQuery}
+	dbpool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create connection pool: %v", err)
 	}
+	if err := metrics.RegisterPool(prometheus.DefaultRegisterer, dbpool); err != nil {
+		dbpool.Close()
+		return nil, fmt.Errorf("unable to register pool metrics: %v", err)
+	}
 	return &postgresDB{
-		pool: dbpool,
+		pool:   dbpool,
+		policy: policy,
 	}, nil
 }
 
 type postgresDB struct {
-	pool PostgresPool
+	pool   PostgresPool
+	policy LoanPolicy
+}
+
+// querier runs statements either on the pool or on the transaction of WithinTx
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+type txKey struct{}
+
+func (db *postgresDB) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return db.withinTx(ctx, pgx.TxOptions{}, fn)
+}
+
+// maxSerializationAttempts bounds how often WithinRepeatableReadTx runs fn
+const maxSerializationAttempts = 3
+
+func (db *postgresDB) WithinRepeatableReadTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	// a savepoint keeps the snapshot of the outer transaction, running it again cannot help
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return db.withinTx(ctx, pgx.TxOptions{}, fn)
+	}
+	var err error
+	for attempt := 0; attempt < maxSerializationAttempts; attempt++ {
+		err = db.withinTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead}, fn)
+		if !serializationFailure(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (db *postgresDB) withinTx(ctx context.Context, opts pgx.TxOptions, fn func(ctx context.Context) error) error {
+	tx, err := db.begin(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// conn returns the transaction of WithinTx if ctx carries one, the pool otherwise
+func (db *postgresDB) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return db.pool
+}
+
+// begin starts a transaction, or a savepoint inside the transaction of WithinTx.
+// A savepoint keeps the isolation level of the outer transaction.
+func (db *postgresDB) begin(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx.Begin(ctx)
+	}
+	return db.pool.BeginTx(ctx, opts)
+}
+
+// nullableISBN stores a missing ISBN as NULL, which the UNIQUE constraint lets any
+// number of books share
+func nullableISBN(isbn string) any {
+	if isbn == "" {
+		return nil
+	}
+	return isbn
+}
+
+// serializationFailure reports whether err is a transaction failing to serialize with a
+// concurrent one, which succeeds when run again
+func serializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "40001"
+}
+
+// uniqueViolation turns a violation of the books.isbn UNIQUE constraint into ErrDuplicateISBN
+func uniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "books_isbn_key" {
+		return ErrDuplicateISBN
+	}
+	return err
+}
+
+// GetAuthorStats counts the copies on the shelf, which are the stock, and the copies on loan,
+// which are the loans neither returned nor lost; together they are the total copies
+func (db *postgresDB) GetAuthorStats(ctx context.Context, authorID int) (AuthorStats, error) {
+	query := `
+		WITH author_books AS (
+		    SELECT id, stock FROM books WHERE author_id = $1 AND deleted_at IS NULL
+		), shelf AS (
+		    SELECT COUNT(*) AS titles, COALESCE(SUM(stock), 0) AS copies FROM author_books
+		), loans AS (
+		    SELECT COUNT(*) AS copies
+		    FROM borrowing_records r
+		    JOIN author_books b ON b.id = r.book_id
+		    WHERE r.status NOT IN ('returned', 'lost')
+		)
+		SELECT shelf.titles,
+		       shelf.copies + loans.copies AS total_copies,
+		       shelf.copies AS available_copies,
+		       loans.copies AS active_loans
+		FROM shelf, loans`
+
+	var stats AuthorStats
+	err := db.conn(ctx).QueryRow(ctx, query, authorID).
+		Scan(&stats.Titles, &stats.TotalCopies, &stats.AvailableCopies, &stats.ActiveLoans)
+	if err != nil {
+		return AuthorStats{}, fmt.Errorf("failed to count author books: %w", err)
+	}
+	return stats, nil
+}
+
+// bookEventColumns are the columns of a book in the order of the fields of bookEvent
+const bookEventColumns = `id, title, COALESCE(isbn, ''), author_id, category_id, stock, published_date, description`
+
+// ReassignAuthorBooks moves the books of an author that are not deleted and writes a
+// book.updated event for each of them in the same transaction
+func (db *postgresDB) ReassignAuthorBooks(ctx context.Context, fromAuthorID, toAuthorID int) (int, error) {
+	tx, err := db.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		UPDATE books SET author_id = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE author_id = $2 AND deleted_at IS NULL
+		RETURNING `+bookEventColumns, toAuthorID, fromAuthorID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reassign author books: %w", err)
+	}
+	moved, err := pgx.CollectRows(rows, pgx.RowToStructByPos[bookEvent])
+	if err != nil {
+		return 0, fmt.Errorf("failed to reassign author books: %w", err)
+	}
+
+	for _, book := range moved {
+		if err := insertEvent(ctx, tx, EventBookUpdated, book.ID, book); err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(moved), nil
 }
 
 func (db *postgresDB) GetBookByID(ctx context.Context, bookID int) (Book, error) {
 	query := `
-		SELECT id, title, isbn, author_id, category_id, stock, 
-		       published_date, description, created_at, updated_at
+		SELECT id, title, COALESCE(isbn, '') AS isbn, author_id, category_id, stock, 
+		       published_date, description, created_at, updated_at, deleted_at
+		FROM books
+		WHERE id = $1 AND deleted_at IS NULL`
+
+	var book Book
+	err := db.conn(ctx).QueryRow(ctx, query, bookID).Scan(
+		&book.ID,
+		&book.Title,
+		&book.ISBN,
+		&book.AuthorID,
+		&book.CategoryID,
+		&book.Stock,
+		&book.PublishedDate,
+		&book.Description,
+		&book.CreatedAt,
+		&book.UpdatedAt,
+		&book.DeletedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Book{}, fmt.Errorf("book with ID %d: %w", bookID, ErrBookNotFound)
+		}
+		return Book{}, fmt.Errorf("unable to query book: %w", err)
+	}
+
+	return book, nil
+}
+
+func (db *postgresDB) GetBookByISBN(ctx context.Context, isbn string) (Book, error) {
+	query := `
+		SELECT id, title, COALESCE(isbn, '') AS isbn, author_id, category_id, stock,
+		       published_date, description, created_at, updated_at, deleted_at
 		FROM books
-		WHERE id = $1`
+		WHERE isbn = $1 AND deleted_at IS NULL`
 
 	var book Book
-	err := db.pool.QueryRow(ctx, query, bookID).Scan(
+	err := db.conn(ctx).QueryRow(ctx, query, isbn).Scan(
 		&book.ID,
 		&book.Title,
 		&book.ISBN,
@@ -52,11 +265,12 @@ func (db *postgresDB) GetBookByID(ctx context.Context, bookID int) (Book, error)
 		&book.Description,
 		&book.CreatedAt,
 		&book.UpdatedAt,
+		&book.DeletedAt,
 	)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return Book{}, fmt.Errorf("book with ID %d not found", bookID)
+			return Book{}, fmt.Errorf("book with ISBN %s: %w", isbn, ErrBookNotFound)
 		}
 		return Book{}, fmt.Errorf("unable to query book: %w", err)
 	}
@@ -64,12 +278,154 @@ func (db *postgresDB) GetBookByID(ctx context.Context, bookID int) (Book, error)
 	return book, nil
 }
 
-func (db *postgresDB) LoadAllBooks(ctx context.Context) ([]Book, error) {
+func (db *postgresDB) LoadAllBooks(ctx context.Context, filter BookFilter) ([]Book, error) {
+	where, args := bookFilterClause(filter)
+	query := `
+		SELECT id, title, COALESCE(isbn, '') AS isbn, author_id, category_id, stock, 
+		       published_date, description, created_at, updated_at, deleted_at
+		FROM books` + where + `
+		ORDER BY id`
+	rows, err := db.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query books table: %w", err)
+	}
+	defer rows.Close()
+
+	books, err := pgx.CollectRows(rows, pgx.RowToStructByName[Book])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows: %w", err)
+	}
+	return books, nil
+}
+
+// StreamBooks calls fn for every book matching filter in sort order, ties broken by id,
+// while the rows are read, so memory stays bounded whatever the size of the table
+func (db *postgresDB) StreamBooks(ctx context.Context, filter BookFilter, sort []SortField, fn func(Book) error) error {
+	keys, err := resolveSort(bookSortColumns, sort)
+	if err != nil {
+		return err
+	}
+
+	where, args := bookFilterClause(filter)
+	query := `
+		SELECT id, title, COALESCE(isbn, '') AS isbn, author_id, category_id, stock, 
+		       published_date, description, created_at, updated_at, deleted_at
+		FROM books` + where + `
+		ORDER BY ` + orderByClause(keys)
+	rows, err := db.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query books table: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		book, err := pgx.RowToStructByName[Book](rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan book: %w", err)
+		}
+		if err := fn(book); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read books: %w", err)
+	}
+	return nil
+}
+
+func (db *postgresDB) ListBooks(ctx context.Context, filter BookFilter, sort []SortField, after *Cursor, limit int) ([]Book, error) {
+	keys, err := resolveSort(bookSortColumns, sort)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := bookFilterClause(filter)
+	if after != nil {
+		values, err := cursorValues(keys, *after)
+		if err != nil {
+			return nil, err
+		}
+		var keyset string
+		keyset, args = keysetClause(keys, values, after.ID, args)
+		if where == "" {
+			where = "\n\t\tWHERE " + keyset
+		} else {
+			where += " AND " + keyset
+		}
+	}
+	args = append(args, limit)
+	query := `
+		SELECT id, title, COALESCE(isbn, '') AS isbn, author_id, category_id, stock, 
+		       published_date, description, created_at, updated_at, deleted_at
+		FROM books` + where + fmt.Sprintf(`
+		ORDER BY %s
+		LIMIT $%d`, orderByClause(keys), len(args))
+
+	rows, err := db.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query books table: %w", err)
+	}
+	defer rows.Close()
+
+	books, err := pgx.CollectRows(rows, pgx.RowToStructByName[Book])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows: %w", err)
+	}
+	return books, nil
+}
+
+// bookFilterClause returns the WHERE clause and arguments selecting the books matching filter
+func bookFilterClause(filter BookFilter) (string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if filter.AuthorID != 0 {
+		args = append(args, filter.AuthorID)
+		conditions = append(conditions, fmt.Sprintf("author_id = $%d", len(args)))
+	}
+	if filter.CategoryID != 0 {
+		args = append(args, filter.CategoryID)
+		conditions = append(conditions, fmt.Sprintf("category_id = $%d", len(args)))
+	}
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "\n\t\tWHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (db *postgresDB) LoadBooksByIDs(ctx context.Context, ids []int) ([]Book, error) {
+	query := `
+		SELECT id, title, COALESCE(isbn, '') AS isbn, author_id, category_id, stock, 
+		       published_date, description, created_at, updated_at, deleted_at
+		FROM books
+		WHERE id = ANY($1) AND deleted_at IS NULL
+		ORDER BY id`
+	rows, err := db.conn(ctx).Query(ctx, query, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query books table: %w", err)
+	}
+	defer rows.Close()
+
+	books, err := pgx.CollectRows(rows, pgx.RowToStructByName[Book])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows: %w", err)
+	}
+	return books, nil
+}
+
+func (db *postgresDB) LoadBooksByAuthorsOrCategories(ctx context.Context, authorIDs, categoryIDs []int, limit int) ([]Book, error) {
 	query := `
-		SELECT id, title, isbn, author_id, category_id, stock, 
-		       published_date, description, created_at, updated_at
-		FROM books`
-	rows, err := db.pool.Query(ctx, query)
+		SELECT id, title, COALESCE(isbn, '') AS isbn, author_id, category_id, stock, 
+		       published_date, description, created_at, updated_at, deleted_at
+		FROM books
+		WHERE (author_id = ANY($1) OR category_id = ANY($2)) AND deleted_at IS NULL
+		ORDER BY id
+		LIMIT $3`
+	rows, err := db.conn(ctx).Query(ctx, query, authorIDs, categoryIDs, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query books table: %w", err)
 	}
@@ -82,26 +438,160 @@ func (db *postgresDB) LoadAllBooks(ctx context.Context) ([]Book, error) {
 	return books, nil
 }
 
-func (db *postgresDB) CreateBook(ctx context.Context, newBook NewBook) error {
-	_, err := db.pool.Exec(ctx,
+func (db *postgresDB) SearchBooks(ctx context.Context, query string, limit, offset int) ([]BookSearchResult, error) {
+	rows, err := db.conn(ctx).Query(ctx, `
+		SELECT id, title, COALESCE(isbn, '') AS isbn, author_id, category_id, stock,
+		       published_date, description, created_at, updated_at, deleted_at,
+		       ts_rank(search_vector, websearch_to_tsquery('english', $1)) + similarity(title, $1) AS rank,
+		       ts_headline('english', COALESCE(NULLIF(description, ''), title), websearch_to_tsquery('english', $1),
+		                   E'StartSel=\x02, StopSel=\x03, MaxFragments=1, MaxWords=20, MinWords=5') AS snippet
+		FROM books
+		WHERE (search_vector @@ websearch_to_tsquery('english', $1) OR title % $1) AND deleted_at IS NULL
+		ORDER BY rank DESC, id
+		LIMIT $2 OFFSET $3`, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search books: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]BookSearchResult, 0)
+	for rows.Next() {
+		var r BookSearchResult
+		if err := rows.Scan(
+			&r.Book.ID,
+			&r.Book.Title,
+			&r.Book.ISBN,
+			&r.Book.AuthorID,
+			&r.Book.CategoryID,
+			&r.Book.Stock,
+			&r.Book.PublishedDate,
+			&r.Book.Description,
+			&r.Book.CreatedAt,
+			&r.Book.UpdatedAt,
+			&r.Book.DeletedAt,
+			&r.Rank,
+			&r.Snippet,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		r.Snippet = markHighlights(r.Snippet)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read search results: %w", err)
+	}
+
+	return results, nil
+}
+
+func (db *postgresDB) CreateBook(ctx context.Context, newBook NewBook) (int, error) {
+	tx, err := db.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	err = tx.QueryRow(ctx,
 		`INSERT INTO books (title, isbn, author_id, category_id, stock, published_date, description)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id`,
 		newBook.Title,
-		newBook.ISBN,
+		nullableISBN(newBook.ISBN),
 		newBook.AuthorID,
 		newBook.CategoryID,
 		newBook.Stock,
 		newBook.PublishedDate,
 		newBook.Description,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert book: %w", uniqueViolation(err))
+	}
+
+	if err := insertEvent(ctx, tx, EventBookCreated, id, newBookEvent(id, newBook)); err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return id, nil
+}
+
+// CreateBooks inserts books in one statement, so either all of them are inserted or none,
+// and writes a book.created event for each of them in the same transaction
+func (db *postgresDB) CreateBooks(ctx context.Context, newBooks []NewBook) (int, error) {
+	tx, err := db.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		titles       = make([]string, len(newBooks))
+		isbns        = make([]*string, len(newBooks))
+		authorIDs    = make([]int, len(newBooks))
+		categoryIDs  = make([]int, len(newBooks))
+		stocks       = make([]int, len(newBooks))
+		publishDates = make([]time.Time, len(newBooks))
+		descriptions = make([]string, len(newBooks))
 	)
+	for i, book := range newBooks {
+		titles[i], authorIDs[i], categoryIDs[i] = book.Title, book.AuthorID, book.CategoryID
+		stocks[i], publishDates[i], descriptions[i] = book.Stock, book.PublishedDate, book.Description
+		if book.ISBN != "" {
+			isbns[i] = &newBooks[i].ISBN
+		}
+	}
+	rows, err := tx.Query(ctx, `
+		INSERT INTO books (title, isbn, author_id, category_id, stock, published_date, description)
+		SELECT * FROM unnest($1::text[], $2::text[], $3::int[], $4::int[], $5::int[], $6::date[], $7::text[])
+		RETURNING `+bookEventColumns,
+		titles, isbns, authorIDs, categoryIDs, stocks, publishDates, descriptions)
 	if err != nil {
-		return fmt.Errorf("failed to insert book: %w", err)
+		return 0, fmt.Errorf("failed to insert books: %w", uniqueViolation(err))
 	}
-	return nil
+	created, err := pgx.CollectRows(rows, pgx.RowToStructByPos[bookEvent])
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert books: %w", uniqueViolation(err))
+	}
+
+	for _, book := range created {
+		if err := insertEvent(ctx, tx, EventBookCreated, book.ID, book); err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(created), nil
+}
+
+// ExistingISBNs returns the ISBNs from isbns that already belong to a book
+func (db *postgresDB) ExistingISBNs(ctx context.Context, isbns []string) ([]string, error) {
+	rows, err := db.conn(ctx).Query(ctx, `SELECT isbn FROM books WHERE isbn = ANY($1)`, isbns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query isbns: %w", err)
+	}
+
+	existing, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect isbns: %w", err)
+	}
+	return existing, nil
 }
 
 func (db *postgresDB) UpdateBook(ctx context.Context, book Book) error {
-	_, err := db.pool.Exec(ctx,
+	tx, err := db.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
 		`UPDATE books
 		 SET title = $1,
 		     isbn = $2,
@@ -110,9 +600,9 @@ func (db *postgresDB) UpdateBook(ctx context.Context, book Book) error {
 		     stock = $5,
 		     published_date = $6,
 		     description = $7
-		 WHERE id = $8`,
+		 WHERE id = $8 AND deleted_at IS NULL`,
 		book.Title,
-		book.ISBN,
+		nullableISBN(book.ISBN),
 		book.AuthorID,
 		book.CategoryID,
 		book.Stock,
@@ -121,37 +611,165 @@ func (db *postgresDB) UpdateBook(ctx context.Context, book Book) error {
 		book.ID,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to update book: %w", err)
+		return fmt.Errorf("failed to update book: %w", uniqueViolation(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBookNotFound
+	}
+
+	payload := newBookEvent(book.ID, NewBook{
+		Title:         book.Title,
+		ISBN:          book.ISBN,
+		AuthorID:      book.AuthorID,
+		CategoryID:    book.CategoryID,
+		Stock:         book.Stock,
+		PublishedDate: book.PublishedDate,
+		Description:   book.Description,
+	})
+	if err := insertEvent(ctx, tx, EventBookUpdated, book.ID, payload); err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 	return nil
 }
 
+// DeleteBook marks a book deleted, its loans are kept until the book is purged
 func (db *postgresDB) DeleteBook(ctx context.Context, id int) error {
-	_, err := db.pool.Exec(ctx, "DELETE FROM books WHERE id = $1", id)
+	tx, err := db.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// the row lock waits for borrows of the book in flight, they lock it too
+	var onLoan bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM borrowing_records
+		                WHERE book_id = b.id AND status NOT IN ('returned', 'lost'))
+		 FROM books b WHERE b.id = $1 AND b.deleted_at IS NULL FOR UPDATE`, id).Scan(&onLoan)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrBookNotFound
+	}
 	if err != nil {
+		return fmt.Errorf("failed to query book: %w", err)
+	}
+	if onLoan {
+		return ErrBookOnLoan
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE books SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1`, id); err != nil {
 		return fmt.Errorf("failed to delete book: %w", err)
 	}
+	if err := insertEvent(ctx, tx, EventBookDeleted, id, bookRefEvent{ID: id}); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (db *postgresDB) RestoreBook(ctx context.Context, id int) error {
+	tx, err := db.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE books SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to restore book: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBookNotFound
+	}
+	if err := insertEvent(ctx, tx, EventBookRestored, id, bookRefEvent{ID: id}); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
+// PurgeBooks removes the books deleted before the given time for good, their
+// recommendations go with them. Books that were ever lent out are kept for their loan history.
+func (db *postgresDB) PurgeBooks(ctx context.Context, before time.Time) (int, error) {
+	tx, err := db.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`DELETE FROM books b WHERE b.deleted_at < $1
+		 AND NOT EXISTS (SELECT 1 FROM borrowing_records r WHERE r.book_id = b.id)
+		 RETURNING b.id`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge books: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge books: %w", err)
+	}
+	for _, id := range ids {
+		if err := insertEvent(ctx, tx, EventBookPurged, id, bookRefEvent{ID: id}); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(ids), nil
+}
+
+// BorrowBook runs at repeatable read. Every borrow first updates the row of the user in
+// borrowers, so of two concurrent borrows by a user, which could each pass the loan limit
+// on their own, the second fails to serialize and is run again by WithinRepeatableReadTx,
+// then seeing the loan of the first.
 func (db *postgresDB) BorrowBook(ctx context.Context, book NewBorrowingRecord) error {
-	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	status, err := initialLoanStatus(book.Status)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.begin(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
 	if err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
+	_, err = tx.Exec(ctx, `
+		INSERT INTO borrowers (user_id, last_borrowed_at) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET last_borrowed_at = EXCLUDED.last_borrowed_at`, book.UserID, book.BorrowedAt)
+	if err != nil {
+		return fmt.Errorf("failed to lock user loans: %w", err)
+	}
+
 	var stock int
-	err = tx.QueryRow(ctx, "SELECT stock FROM books WHERE id = $1 FOR UPDATE", book.BookID).Scan(&stock)
+	err = tx.QueryRow(ctx, "SELECT stock FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", book.BookID).Scan(&stock)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			return fmt.Errorf("book not found")
+			return ErrBookNotFound
 		}
 		return fmt.Errorf("failed to query book: %w", err)
 	}
 
 	if stock == 0 {
-		return fmt.Errorf("book is not available")
+		return ErrBookNotAvailable
+	}
+
+	stats, err := db.loanStats(ctx, tx, book)
+	if err != nil {
+		return err
+	}
+	if err := db.policy.check(book.Role, stats); err != nil {
+		return err
 	}
 
 	_, err = tx.Exec(ctx, "UPDATE books SET stock = $1 WHERE id = $2", stock-1, book.BookID)
@@ -159,13 +777,25 @@ func (db *postgresDB) BorrowBook(ctx context.Context, book NewBorrowingRecord) e
 		return fmt.Errorf("failed to decrement stock: %w", err)
 	}
 
-	_, err = tx.Exec(ctx, `
-		INSERT INTO borrowing_records (user_id, book_id, borrowed_at, due_date)
-		VALUES ($1, $2, $3, $4)`, book.UserID, book.BookID, book.BorrowedAt, book.BorrowedAt.Add(3*24*time.Hour))
+	loan := BorrowingRecord{
+		BookID:     book.BookID,
+		UserID:     book.UserID,
+		BorrowedAt: book.BorrowedAt,
+		DueDate:    db.policy.dueDate(book.BorrowedAt),
+		Status:     status,
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO borrowing_records (user_id, book_id, borrowed_at, due_date, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`, loan.UserID, loan.BookID, loan.BorrowedAt, loan.DueDate, loan.Status).Scan(&loan.ID)
 	if err != nil {
 		return fmt.Errorf("failed to insert borrowing record: %w", err)
 	}
 
+	if err := insertEvent(ctx, tx, loanEventType(status), book.BookID, newLoanEvent(loan)); err != nil {
+		return err
+	}
+
 	err = tx.Commit(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
@@ -174,43 +804,64 @@ func (db *postgresDB) BorrowBook(ctx context.Context, book NewBorrowingRecord) e
 	return nil
 }
 
+// loanStats reads the user's current loans and unpaid fines within the borrow transaction
+func (db *postgresDB) loanStats(ctx context.Context, tx pgx.Tx, book NewBorrowingRecord) (loanStats, error) {
+	var stats loanStats
+	err := tx.QueryRow(ctx, `
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE due_date < $2),
+		       COUNT(*) FILTER (WHERE book_id = $3)
+		FROM borrowing_records
+		WHERE user_id = $1 AND status NOT IN ('returned', 'lost')`, book.UserID, book.BorrowedAt, book.BookID).
+		Scan(&stats.activeLoans, &stats.overdueLoans, &stats.sameBookLoans)
+	if err != nil {
+		return loanStats{}, fmt.Errorf("failed to query user loans: %w", err)
+	}
+
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(SUM(amount), 0)
+		FROM fines
+		WHERE user_id = $1 AND paid_at IS NULL`, book.UserID).Scan(&stats.unpaidFines)
+	if err != nil {
+		return loanStats{}, fmt.Errorf("failed to query user fines: %w", err)
+	}
+
+	return stats, nil
+}
+
+const selectLoanColumns = `
+		SELECT id, book_id, user_id, borrowed_at, returned_at, due_date, status, renewals
+		FROM borrowing_records`
+
 func (db *postgresDB) ReturnBook(ctx context.Context, book BorrowingRecord) error {
-	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	tx, err := db.begin(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
 	if err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	var exists bool
-	err = tx.QueryRow(ctx, `
-		SELECT EXISTS (
-			SELECT 1 FROM borrowing_records
-			WHERE user_id = $1 AND book_id = $2 AND returned_at IS NULL
-		)
-	`, book.UserID, book.BookID).Scan(&exists)
+	rows, err := tx.Query(ctx, selectLoanColumns+`
+		WHERE user_id = $1 AND book_id = $2 AND status NOT IN ('returned', 'lost')
+		ORDER BY borrowed_at LIMIT 1
+		FOR UPDATE`, book.UserID, book.BookID)
 	if err != nil {
 		return fmt.Errorf("failed to check borrowing record: %w", err)
 	}
-	if !exists {
-		return fmt.Errorf("borrowing record not found or already returned")
+	loan, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[BorrowingRecord])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrLoanNotFound
+		}
+		return fmt.Errorf("failed to check borrowing record: %w", err)
 	}
 
-	_, err = tx.Exec(ctx, `
-		UPDATE borrowing_records
-		SET returned_at = $1
-		WHERE user_id = $2 AND book_id = $3 AND returned_at IS NULL
-	`, time.Now(), book.UserID, book.BookID)
+	loan, err = db.applyLoanTransition(ctx, tx, loan, LoanStatusReturned, time.Now())
 	if err != nil {
-		return fmt.Errorf("failed to update borrowing record: %w", err)
+		return err
 	}
 
-	_, err = tx.Exec(ctx, `
-		UPDATE books
-		SET stock = stock + 1
-		WHERE id = $1
-	`, book.BookID)
-	if err != nil {
-		return fmt.Errorf("failed to increment book stock: %w", err)
+	if err := insertEvent(ctx, tx, EventBookReturned, loan.BookID, newLoanEvent(loan)); err != nil {
+		return err
 	}
 
 	err = tx.Commit(ctx)
@@ -221,8 +872,157 @@ func (db *postgresDB) ReturnBook(ctx context.Context, book BorrowingRecord) erro
 	return nil
 }
 
-func (db *postgresDB) GetRecommendedBooks(ctx context.Context, bookID int) ([]BookRecommendation, error) {
-	rows, err := db.pool.Query(ctx, "SELECT id, book_id, recommended_book_id, score  FROM book_recommendation WHERE book_id = $1", bookID)
+func (db *postgresDB) UpdateLoanStatus(ctx context.Context, loanID int, status string, at time.Time) (BorrowingRecord, error) {
+	return db.updateLoan(ctx, status, at, `
+		WHERE id = $1
+		FOR UPDATE`, loanID)
+}
+
+func (db *postgresDB) RenewLoan(ctx context.Context, userID, loanID int, at time.Time) (BorrowingRecord, error) {
+	return db.updateLoan(ctx, LoanStatusRenewed, at, `
+		WHERE id = $1 AND user_id = $2
+		FOR UPDATE`, loanID, userID)
+}
+
+// updateLoan moves the loan the where clause locks to status
+func (db *postgresDB) updateLoan(ctx context.Context, status string, at time.Time, where string, args ...any) (BorrowingRecord, error) {
+	tx, err := db.begin(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	if err != nil {
+		return BorrowingRecord{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, selectLoanColumns+where, args...)
+	if err != nil {
+		return BorrowingRecord{}, fmt.Errorf("failed to query borrowing record: %w", err)
+	}
+	loan, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[BorrowingRecord])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return BorrowingRecord{}, ErrLoanNotFound
+		}
+		return BorrowingRecord{}, fmt.Errorf("failed to query borrowing record: %w", err)
+	}
+
+	loan, err = db.applyLoanTransition(ctx, tx, loan, status, at)
+	if err != nil {
+		return BorrowingRecord{}, err
+	}
+
+	if err := insertEvent(ctx, tx, loanEventType(status), loan.BookID, newLoanEvent(loan)); err != nil {
+		return BorrowingRecord{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return BorrowingRecord{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return loan, nil
+}
+
+// applyLoanTransition validates and stores a status change of a locked loan
+// together with its effect on stock and fines
+func (db *postgresDB) applyLoanTransition(ctx context.Context, tx pgx.Tx, loan BorrowingRecord, to string, at time.Time) (BorrowingRecord, error) {
+	loan, err := db.policy.transitionLoan(loan, to, at)
+	if err != nil {
+		return BorrowingRecord{}, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE borrowing_records
+		SET status = $1, borrowed_at = $2, due_date = $3, returned_at = $4, renewals = $5
+		WHERE id = $6`, loan.Status, loan.BorrowedAt, loan.DueDate, loan.ReturnedAt, loan.Renewals, loan.ID)
+	if err != nil {
+		return BorrowingRecord{}, fmt.Errorf("failed to update borrowing record: %w", err)
+	}
+
+	switch to {
+	case LoanStatusReturned:
+		_, err = tx.Exec(ctx, `
+			UPDATE books
+			SET stock = stock + 1
+			WHERE id = $1`, loan.BookID)
+		if err != nil {
+			return BorrowingRecord{}, fmt.Errorf("failed to increment book stock: %w", err)
+		}
+	case LoanStatusLost:
+		// the copy left stock when it was borrowed and is never put back,
+		// the borrower is charged for its replacement instead
+		if db.policy.ReplacementFee > 0 {
+			_, err = tx.Exec(ctx, `
+				INSERT INTO fines (user_id, loan_id, amount, reason)
+				VALUES ($1, $2, $3, $4)`, loan.UserID, loan.ID, db.policy.ReplacementFee, "lost book replacement")
+			if err != nil {
+				return BorrowingRecord{}, fmt.Errorf("failed to charge replacement fee: %w", err)
+			}
+		}
+	}
+
+	return loan, nil
+}
+
+func (db *postgresDB) ListLoans(ctx context.Context, filter LoanFilter, limit, offset int) ([]BorrowingRecord, error) {
+	args := []interface{}{filter.Now}
+	var where []string
+
+	if filter.UserID != 0 {
+		args = append(args, filter.UserID)
+		where = append(where, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if filter.BookID != 0 {
+		args = append(args, filter.BookID)
+		where = append(where, fmt.Sprintf("book_id = $%d", len(args)))
+	}
+	switch filter.State {
+	case LoanStateCurrent:
+		where = append(where, "status NOT IN ('returned', 'lost')")
+	case LoanStateReturned:
+		where = append(where, "status = 'returned'")
+	case LoanStateOverdue:
+		where = append(where, "(status = 'overdue' OR (status IN ('borrowed', 'renewed') AND due_date < $1))")
+	case LoanStateLost:
+		where = append(where, "status = 'lost'")
+	}
+
+	query := `
+		SELECT id, book_id, user_id, borrowed_at, returned_at, due_date,
+		       CASE WHEN status IN ('borrowed', 'renewed') AND due_date < $1 THEN 'overdue'
+		            ELSE status END AS status, renewals
+		FROM borrowing_records`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	args = append(args, limit, offset)
+	query += fmt.Sprintf(" ORDER BY borrowed_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := db.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query borrowing records: %w", err)
+	}
+	defer rows.Close()
+
+	loans, err := pgx.CollectRows(rows, pgx.RowToStructByName[BorrowingRecord])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows: %w", err)
+	}
+	return loans, nil
+}
+
+func (db *postgresDB) CountOverdueLoans(ctx context.Context, now time.Time) (int, error) {
+	var count int
+	err := db.conn(ctx).QueryRow(ctx, `
+		SELECT count(*) FROM borrowing_records
+		WHERE status = 'overdue' OR (status IN ('borrowed', 'renewed') AND due_date < $1)`, now).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count overdue loans: %w", err)
+	}
+	return count, nil
+}
+
+func (db *postgresDB) GetRecommendedBooks(ctx context.Context, bookIDs []int) ([]BookRecommendation, error) {
+	rows, err := db.conn(ctx).Query(ctx, "SELECT id, book_id, recommended_book_id, score  FROM book_recommendation WHERE book_id = ANY($1)", bookIDs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query book recommendations: %w", err)
 	}
@@ -238,7 +1038,7 @@ func (db *postgresDB) GetRecommendedBooks(ctx context.Context, bookID int) ([]Bo
 }
 
 func (db *postgresDB) AddRecommendedBook(ctx context.Context, book NewBookRecommendation) error {
-	_, err := db.pool.Exec(ctx, "INSERT INTO book_recommendation (book_id, recommended_book_id, score) VALUES ($1, $2, $3)", book.BookID, book.RecommendedBookID, book.Score)
+	_, err := db.conn(ctx).Exec(ctx, "INSERT INTO book_recommendation (book_id, recommended_book_id, score) VALUES ($1, $2, $3)", book.BookID, book.RecommendedBookID, book.Score)
 	if err != nil {
 		return fmt.Errorf("failed to add recommended book: %w", err)
 	}
@@ -246,6 +1046,383 @@ func (db *postgresDB) AddRecommendedBook(ctx context.Context, book NewBookRecomm
 	return nil
 }
 
+// insertEvent writes an event to the outbox within tx, so it is only published if tx commits
+func insertEvent(ctx context.Context, tx pgx.Tx, eventType string, aggregateID int, payload any) error {
+	event, err := newEvent(eventType, aggregateID, payload)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO outbox (event_type, aggregate_id, payload) VALUES ($1, $2, $3)`,
+		event.Type, event.AggregateID, event.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to insert %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+func (db *postgresDB) PendingEvents(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	rows, err := db.conn(ctx).Query(ctx,
+		`SELECT id, event_type, aggregate_id, payload, created_at, published_at
+		 FROM outbox
+		 WHERE published_at IS NULL
+		 ORDER BY id
+		 LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, pgx.RowToStructByName[OutboxEvent])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	return events, nil
+}
+
+func (db *postgresDB) MarkEventPublished(ctx context.Context, id int64) error {
+	_, err := db.conn(ctx).Exec(ctx, `UPDATE outbox SET published_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark event %d published: %w", id, err)
+	}
+	return nil
+}
+
+const webhookSubscriptionColumns = `id, url, secret, event_types, created_at`
+
+const webhookDeliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts,
+		       response_status, last_error, next_attempt_at, created_at, delivered_at`
+
+func (db *postgresDB) AddWebhookSubscription(ctx context.Context, subscription NewWebhookSubscription) (WebhookSubscription, error) {
+	eventTypes := subscription.EventTypes
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+	rows, err := db.conn(ctx).Query(ctx,
+		`INSERT INTO webhook_subscriptions (url, secret, event_types)
+		 VALUES ($1, $2, $3)
+		 RETURNING `+webhookSubscriptionColumns,
+		subscription.URL, subscription.Secret, eventTypes)
+	if err != nil {
+		return WebhookSubscription{}, fmt.Errorf("failed to insert webhook subscription: %w", err)
+	}
+	created, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[WebhookSubscription])
+	if err != nil {
+		return WebhookSubscription{}, fmt.Errorf("failed to insert webhook subscription: %w", err)
+	}
+	return created, nil
+}
+
+func (db *postgresDB) ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	rows, err := db.conn(ctx).Query(ctx, `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook subscriptions: %w", err)
+	}
+	subscriptions, err := pgx.CollectRows(rows, pgx.RowToStructByName[WebhookSubscription])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows: %w", err)
+	}
+	return subscriptions, nil
+}
+
+// DeleteWebhookSubscription relies on ON DELETE CASCADE to remove the deliveries
+func (db *postgresDB) DeleteWebhookSubscription(ctx context.Context, id int) error {
+	tag, err := db.conn(ctx).Exec(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (db *postgresDB) EnqueueWebhookDeliveries(ctx context.Context, delivery NewWebhookDelivery) (int, error) {
+	tag, err := db.conn(ctx).Exec(ctx,
+		`INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, next_attempt_at)
+		 SELECT id, $1, $2, $3, CURRENT_TIMESTAMP
+		 FROM webhook_subscriptions
+		 WHERE cardinality(event_types) = 0 OR $2 = ANY(event_types)
+		 ON CONFLICT (subscription_id, event_id) DO NOTHING`,
+		delivery.EventID, delivery.EventType, delivery.Payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// ClaimWebhookDeliveries skips the rows other workers have locked, so concurrent
+// workers claim disjoint deliveries
+func (db *postgresDB) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	rows, err := db.conn(ctx).Query(ctx,
+		`UPDATE webhook_deliveries
+		 SET next_attempt_at = $2
+		 WHERE id IN (
+		     SELECT id FROM webhook_deliveries
+		     WHERE status = 'pending' AND next_attempt_at <= $1
+		     ORDER BY next_attempt_at, id
+		     LIMIT $3
+		     FOR UPDATE SKIP LOCKED)
+		 RETURNING `+webhookDeliveryColumns,
+		now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	deliveries, err := pgx.CollectRows(rows, pgx.RowToStructByName[WebhookDelivery])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows: %w", err)
+	}
+	// RETURNING does not keep the order of the subquery
+	slices.SortFunc(deliveries, func(a, b WebhookDelivery) int { return cmp.Compare(a.ID, b.ID) })
+	return deliveries, nil
+}
+
+func (db *postgresDB) RecordWebhookAttempt(ctx context.Context, id int64, attempt WebhookAttempt) error {
+	var recorded WebhookDelivery
+	attempt.apply(&recorded)
+	tag, err := db.conn(ctx).Exec(ctx,
+		`UPDATE webhook_deliveries
+		 SET status = $2,
+		     attempts = attempts + 1,
+		     response_status = $3,
+		     last_error = $4,
+		     next_attempt_at = $5,
+		     delivered_at = $6
+		 WHERE id = $1`,
+		id, recorded.Status, recorded.ResponseStatus, recorded.LastError, recorded.NextAttemptAt, recorded.DeliveredAt)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook attempt: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDeliveryNotFound
+	}
+	return nil
+}
+
+func (db *postgresDB) ListWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter, limit, offset int) ([]WebhookDelivery, error) {
+	var (
+		args  []interface{}
+		where []string
+	)
+	if filter.SubscriptionID != 0 {
+		args = append(args, filter.SubscriptionID)
+		where = append(where, fmt.Sprintf("subscription_id = $%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where = append(where, fmt.Sprintf("status = $%d", len(args)))
+	}
+
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	args = append(args, limit, offset)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := db.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	deliveries, err := pgx.CollectRows(rows, pgx.RowToStructByName[WebhookDelivery])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (db *postgresDB) RetryWebhookDelivery(ctx context.Context, id int64, at time.Time) error {
+	tag, err := db.conn(ctx).Exec(ctx,
+		`UPDATE webhook_deliveries
+		 SET status = 'pending', attempts = 0, next_attempt_at = $2
+		 WHERE id = $1 AND status = 'dead'`, id, at)
+	if err != nil {
+		return fmt.Errorf("failed to retry webhook delivery: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	var exists bool
+	err = db.conn(ctx).QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM webhook_deliveries WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to query webhook delivery: %w", err)
+	}
+	if exists {
+		return ErrDeliveryNotDead
+	}
+	return ErrDeliveryNotFound
+}
+
+// noticePreferenceColumns maps each kind of notification to the preference opting into it
+var noticePreferenceColumns = map[string]string{
+	NotificationDueSoon: "due_soon",
+	NotificationOverdue: "overdue",
+}
+
+func (db *postgresDB) LoansToNotify(ctx context.Context, filter NoticeFilter, limit int) ([]LoanNotice, error) {
+	column, ok := noticePreferenceColumns[filter.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown notification kind %q", filter.Kind)
+	}
+	rows, err := db.conn(ctx).Query(ctx, `
+		SELECT l.id AS loan_id, l.book_id, l.user_id, b.title AS book_title, l.due_date,
+		       COALESCE(p.email, '') AS email, COALESCE(f.attempts, 0) AS attempts
+		FROM borrowing_records l
+		JOIN books b ON b.id = l.book_id
+		LEFT JOIN notification_preferences p ON p.user_id = l.user_id
+		LEFT JOIN loan_notification_failures f
+		       ON f.loan_id = l.id AND f.kind = $3 AND f.due_date = l.due_date
+		WHERE l.status IN ('borrowed', 'renewed', 'overdue')
+		  AND b.deleted_at IS NULL
+		  AND l.due_date >= $1 AND l.due_date < $2
+		  AND COALESCE(p.`+column+`, TRUE)
+		  AND (f.next_attempt_at IS NULL OR f.next_attempt_at <= $4)
+		  AND NOT EXISTS (
+		      SELECT 1 FROM loan_notifications n
+		      WHERE n.loan_id = l.id AND n.kind = $3 AND n.due_date = l.due_date)
+		ORDER BY l.due_date, l.id
+		LIMIT $5`,
+		filter.DueAfter, filter.DueBefore, filter.Kind, filter.Now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query loans to notify: %w", err)
+	}
+	notices, err := pgx.CollectRows(rows, pgx.RowToStructByName[LoanNotice])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows: %w", err)
+	}
+	return notices, nil
+}
+
+func (db *postgresDB) RecordNotification(ctx context.Context, notification SentNotification) error {
+	_, err := db.conn(ctx).Exec(ctx,
+		`INSERT INTO loan_notifications (loan_id, user_id, kind, due_date)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (loan_id, kind, due_date) DO NOTHING`,
+		notification.LoanID, notification.UserID, notification.Kind, notification.DueDate)
+	if err != nil {
+		return fmt.Errorf("failed to record notification: %w", err)
+	}
+	return nil
+}
+
+func (db *postgresDB) RecordNotificationFailure(ctx context.Context, failure FailedNotification) error {
+	_, err := db.conn(ctx).Exec(ctx,
+		`INSERT INTO loan_notification_failures (loan_id, kind, due_date, attempts, last_error, next_attempt_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (loan_id, kind, due_date) DO UPDATE
+		 SET attempts = EXCLUDED.attempts, last_error = EXCLUDED.last_error, next_attempt_at = EXCLUDED.next_attempt_at`,
+		failure.LoanID, failure.Kind, failure.DueDate, failure.Attempts, failure.LastError, failure.NextAttemptAt)
+	if err != nil {
+		return fmt.Errorf("failed to record notification failure: %w", err)
+	}
+	return nil
+}
+
+const notificationPreferencesColumns = `user_id, email, due_soon, overdue, updated_at`
+
+func (db *postgresDB) GetNotificationPreferences(ctx context.Context, userID int) (NotificationPreferences, error) {
+	rows, err := db.conn(ctx).Query(ctx,
+		`SELECT `+notificationPreferencesColumns+` FROM notification_preferences WHERE user_id = $1`, userID)
+	if err != nil {
+		return NotificationPreferences{}, fmt.Errorf("failed to query notification preferences: %w", err)
+	}
+	preferences, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[NotificationPreferences])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DefaultNotificationPreferences(userID), nil
+	}
+	if err != nil {
+		return NotificationPreferences{}, fmt.Errorf("failed to collect rows: %w", err)
+	}
+	return preferences, nil
+}
+
+func (db *postgresDB) SetNotificationPreferences(ctx context.Context, preferences NotificationPreferences) (NotificationPreferences, error) {
+	rows, err := db.conn(ctx).Query(ctx,
+		`INSERT INTO notification_preferences (user_id, email, due_soon, overdue)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (user_id) DO UPDATE
+		 SET email = EXCLUDED.email, due_soon = EXCLUDED.due_soon, overdue = EXCLUDED.overdue,
+		     updated_at = CURRENT_TIMESTAMP
+		 RETURNING `+notificationPreferencesColumns,
+		preferences.UserID, preferences.Email, preferences.DueSoon, preferences.Overdue)
+	if err != nil {
+		return NotificationPreferences{}, fmt.Errorf("failed to store notification preferences: %w", err)
+	}
+	stored, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[NotificationPreferences])
+	if err != nil {
+		return NotificationPreferences{}, fmt.Errorf("failed to store notification preferences: %w", err)
+	}
+	return stored, nil
+}
+
+func (db *postgresDB) AddAuditEntry(ctx context.Context, entry NewAuditEntry) error {
+	_, err := db.conn(ctx).Exec(ctx,
+		`INSERT INTO audit_log (actor, actor_role, action, entity, entity_id, changes, request_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		entry.Actor,
+		entry.ActorRole,
+		entry.Action,
+		entry.Entity,
+		entry.EntityID,
+		entry.Changes,
+		entry.RequestID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add audit entry: %w", err)
+	}
+	return nil
+}
+
+func (db *postgresDB) ListAuditEntries(ctx context.Context, filter AuditFilter, limit, offset int) ([]AuditEntry, error) {
+	var (
+		args  []interface{}
+		where []string
+	)
+	if filter.Entity != "" {
+		args = append(args, filter.Entity)
+		where = append(where, fmt.Sprintf("entity = $%d", len(args)))
+	}
+	if filter.EntityID != 0 {
+		args = append(args, filter.EntityID)
+		where = append(where, fmt.Sprintf("entity_id = $%d", len(args)))
+	}
+	if filter.Actor != "" {
+		args = append(args, filter.Actor)
+		where = append(where, fmt.Sprintf("actor = $%d", len(args)))
+	}
+
+	query := `
+		SELECT id, actor, actor_role, action, entity, entity_id, changes, request_id, created_at
+		FROM audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	args = append(args, limit, offset)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := db.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries, err := pgx.CollectRows(rows, pgx.RowToStructByName[AuditEntry])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect rows: %w", err)
+	}
+	return entries, nil
+}
+
+func (db *postgresDB) Ping(ctx context.Context) error {
+	if err := db.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	return nil
+}
+
 func (db *postgresDB) CloseConnections() {
 	db.pool.Close()
 }
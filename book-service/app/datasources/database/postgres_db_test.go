@@ -2,10 +2,11 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/jackc/pgx/v5"
-	"github.com/stretchr/testify/mock"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/require"
 	"testing"
 	"time"
@@ -21,18 +22,18 @@ func TestPostgresDB_GetBookByID_Success(t *testing.T) {
 
 	fixedTime := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
 	query := `
-		SELECT id, title, isbn, author_id, category_id, stock, 
-		       published_date, description, created_at, updated_at
+		SELECT id, title, COALESCE(isbn, '') AS isbn, author_id, category_id, stock, 
+		       published_date, description, created_at, updated_at, deleted_at
 		FROM books
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`
 	headerRow := []string{"id", "title", "isbn", "author_id", "category_id", "stock", "published_date",
-		"description", "created_at", "updated_at"}
+		"description", "created_at", "updated_at", "deleted_at"}
 
 	mockPool.ExpectQuery(EscapeQuery(query)).
 		WithArgs(1).
 		WillReturnRows(pgxmock.NewRows(headerRow).
 			AddRow(1, "book1", "1234567890", 1, 2, 10,
-				fixedTime, "a book desc", fixedTime, fixedTime))
+				fixedTime, "a book desc", fixedTime, fixedTime, nil))
 
 	db := &postgresDB{
 		pool: mockPool,
@@ -58,10 +59,10 @@ func TestPostgresDB_GetBookByID_Fail(t *testing.T) {
 	defer mockPool.Close()
 
 	query := `
-		SELECT id, title, isbn, author_id, category_id, stock, 
-		       published_date, description, created_at, updated_at
+		SELECT id, title, COALESCE(isbn, '') AS isbn, author_id, category_id, stock, 
+		       published_date, description, created_at, updated_at, deleted_at
 		FROM books
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`
 
 	mockPool.ExpectQuery(EscapeQuery(query)).
 		WithArgs(999).
@@ -74,7 +75,7 @@ func TestPostgresDB_GetBookByID_Fail(t *testing.T) {
 	result, err := db.GetBookByID(context.Background(), 999)
 
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "not found")
+	assert.ErrorIs(t, err, ErrBookNotFound)
 	assert.Equal(t, Book{}, result)
 
 	assert.Nil(t, mockPool.ExpectationsWereMet())
@@ -87,19 +88,19 @@ func TestPostgresDB_GetBooks_Success(t *testing.T) {
 	defer mockPool.Close()
 
 	mockPool.ExpectQuery(EscapeQuery(`
-	SELECT id, title, isbn, author_id, category_id, stock, 
-	       published_date, description, created_at, updated_at
+	SELECT id, title, COALESCE(isbn, '') AS isbn, author_id, category_id, stock, 
+	       published_date, description, created_at, updated_at, deleted_at
 	FROM books`)).
 		WillReturnRows(pgxmock.NewRows([]string{
 			"id", "title", "isbn", "author_id", "category_id", "stock",
-			"published_date", "description", "created_at", "updated_at"}).
+			"published_date", "description", "created_at", "updated_at", "deleted_at"}).
 			AddRow(1, "book1", "1234567890", 1, 2, 10,
-				fixedTime, "a book desc", time.Now(), time.Now()))
+				fixedTime, "a book desc", time.Now(), time.Now(), nil))
 
 	db := postgresDB{
 		pool: mockPool,
 	}
-	result, err := db.LoadAllBooks(context.Background())
+	result, err := db.LoadAllBooks(context.Background(), BookFilter{})
 
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(result))
@@ -122,35 +123,103 @@ func TestPostgresDB_GetBooks_Fail(t *testing.T) {
 	assert.Nil(t, err)
 
 	mockPool.ExpectQuery(EscapeQuery(`
-	SELECT id, title, isbn, author_id, category_id, stock, 
-	       published_date, description, created_at, updated_at
+	SELECT id, title, COALESCE(isbn, '') AS isbn, author_id, category_id, stock, 
+	       published_date, description, created_at, updated_at, deleted_at
 	FROM books`)).
 		WillReturnError(assert.AnError)
 
 	db := postgresDB{
 		pool: mockPool,
 	}
-	result, err := db.LoadAllBooks(context.Background())
+	result, err := db.LoadAllBooks(context.Background(), BookFilter{})
 
 	assert.Nil(t, result)
 	assert.ErrorContains(t, err, "failed to query books table")
 	assert.Nil(t, mockPool.ExpectationsWereMet())
 }
 
-func TestPostgresDB_CreateBook_Success(t *testing.T) {
+func TestPostgresDB_LoadBooksByIDs_Success(t *testing.T) {
 	mockPool, err := pgxmock.NewPool()
-	assert.Nil(t, err)
+	require.NoError(t, err)
+	defer mockPool.Close()
+
 	fixedTime := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	mockPool.ExpectQuery(EscapeQuery("WHERE id = ANY($1) AND deleted_at IS NULL")).
+		WithArgs([]int{1, 3}).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "title", "isbn", "author_id", "category_id", "stock",
+			"published_date", "description", "created_at", "updated_at", "deleted_at"}).
+			AddRow(1, "book1", "1234567890", 1, 2, 10, fixedTime, "a book desc", fixedTime, fixedTime, nil))
 
-	mockPool.ExpectExec(EscapeQuery(`INSERT INTO books (title, isbn, author_id, category_id, stock, published_date, description)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)`)).
-		WithArgs("book1", "1234567890", 1, 2, 10, fixedTime, "a book desc").
-		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	db := &postgresDB{pool: mockPool}
+	books, err := db.LoadBooksByIDs(context.Background(), []int{1, 3})
 
-	db := postgresDB{
-		pool: mockPool,
-	}
-	err = db.CreateBook(context.Background(), NewBook{
+	require.NoError(t, err)
+	assert.Len(t, books, 1)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_LoadBooksByAuthorsOrCategories_Fail(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	mockPool.ExpectQuery(EscapeQuery("WHERE (author_id = ANY($1) OR category_id = ANY($2)) AND deleted_at IS NULL")).
+		WithArgs([]int{1}, []int{2}, 50).
+		WillReturnError(assert.AnError)
+
+	db := &postgresDB{pool: mockPool}
+	books, err := db.LoadBooksByAuthorsOrCategories(context.Background(), []int{1}, []int{2}, 50)
+
+	assert.ErrorContains(t, err, "failed to query books table")
+	assert.Nil(t, books)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_SearchBooks_Success(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	fixedTime := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	mockPool.ExpectQuery(EscapeQuery("WHERE (search_vector @@ websearch_to_tsquery('english', $1) OR title % $1) AND deleted_at IS NULL")).
+		WithArgs("habits", 10, 0).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "title", "isbn", "author_id", "category_id", "stock",
+			"published_date", "description", "created_at", "updated_at", "deleted_at", "rank", "snippet"}).
+			AddRow(2, "Atomic Habits", "9780735211292", 1, 2, 10,
+				fixedTime, "Tiny changes", fixedTime, fixedTime, nil, 0.9, "<b>Atomic</b> \x02Habits\x03"))
+
+	db := &postgresDB{pool: mockPool}
+	results, err := db.SearchBooks(context.Background(), "habits", 10, 0)
+
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "Atomic Habits", results[0].Book.Title)
+	assert.Equal(t, 0.9, results[0].Rank)
+	assert.Equal(t, "&lt;b&gt;Atomic&lt;/b&gt; <mark>Habits</mark>", results[0].Snippet)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_SearchBooks_Fail(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	mockPool.ExpectQuery("FROM books").
+		WithArgs("habits", 10, 0).
+		WillReturnError(assert.AnError)
+
+	db := &postgresDB{pool: mockPool}
+	results, err := db.SearchBooks(context.Background(), "habits", 10, 0)
+
+	assert.ErrorContains(t, err, "failed to search books")
+	assert.Nil(t, results)
+}
+
+func TestPostgresDB_CreateBook_Success(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+	fixedTime := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	book := NewBook{
 		Title:         "book1",
 		ISBN:          "1234567890",
 		AuthorID:      1,
@@ -158,9 +227,28 @@ func TestPostgresDB_CreateBook_Success(t *testing.T) {
 		Stock:         10,
 		PublishedDate: fixedTime,
 		Description:   "a book desc",
-	})
+	}
+	payload, err := json.Marshal(newBookEvent(7, book))
+	require.NoError(t, err)
+
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectQuery(EscapeQuery(`INSERT INTO books (title, isbn, author_id, category_id, stock, published_date, description)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id`)).
+		WithArgs("book1", "1234567890", 1, 2, 10, fixedTime, "a book desc").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(7))
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO outbox (event_type, aggregate_id, payload) VALUES ($1, $2, $3)`)).
+		WithArgs(EventBookCreated, 7, json.RawMessage(payload)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mockPool.ExpectCommit()
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	id, err := db.CreateBook(context.Background(), book)
 
 	assert.Nil(t, err)
+	assert.Equal(t, 7, id)
 	assert.Nil(t, mockPool.ExpectationsWereMet())
 }
 
@@ -169,15 +257,18 @@ func TestPostgresDB_CreateBook_Fail(t *testing.T) {
 	assert.Nil(t, err)
 	fixedTime := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
 
-	mockPool.ExpectExec(EscapeQuery(`INSERT INTO books (title, isbn, author_id, category_id, stock, published_date, description)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)`)).
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectQuery(EscapeQuery(`INSERT INTO books (title, isbn, author_id, category_id, stock, published_date, description)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id`)).
 		WithArgs("book1", "1234567890", 1, 2, 10, fixedTime, "a book desc").
 		WillReturnError(assert.AnError)
+	mockPool.ExpectRollback()
 
 	db := postgresDB{
 		pool: mockPool,
 	}
-	err = db.CreateBook(context.Background(), NewBook{
+	_, err = db.CreateBook(context.Background(), NewBook{
 		Title:         "book1",
 		ISBN:          "1234567890",
 		AuthorID:      1,
@@ -191,11 +282,280 @@ func TestPostgresDB_CreateBook_Fail(t *testing.T) {
 	assert.Nil(t, mockPool.ExpectationsWereMet())
 }
 
+func TestPostgresDB_CreateBook_DuplicateISBN(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectQuery(EscapeQuery(`INSERT INTO books`)).
+		WithArgs("book1", "9780735211292", 0, 0, 0, time.Time{}, "").
+		WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "books_isbn_key"})
+	mockPool.ExpectRollback()
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	_, err = db.CreateBook(context.Background(), NewBook{Title: "book1", ISBN: "9780735211292"})
+
+	assert.ErrorIs(t, err, ErrDuplicateISBN)
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_StreamBooks(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+	fixedTime := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	mockPool.ExpectQuery(EscapeQuery("WHERE author_id = $1 AND category_id = $2 AND deleted_at IS NULL\n\t\tORDER BY title, id")).
+		WithArgs(3, 2).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "title", "isbn", "author_id", "category_id", "stock",
+			"published_date", "description", "created_at", "updated_at", "deleted_at"}).
+			AddRow(1, "book1", "9780735211292", 3, 2, 1, fixedTime, "desc", fixedTime, fixedTime, nil).
+			AddRow(2, "book2", "9780804429573", 3, 2, 1, fixedTime, "desc", fixedTime, fixedTime, nil))
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	var titles []string
+	err = db.StreamBooks(context.Background(), BookFilter{AuthorID: 3, CategoryID: 2}, []SortField{{Field: "title"}}, func(book Book) error {
+		titles = append(titles, book.Title)
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"book1", "book2"}, titles)
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_StreamBooks_CallbackFails(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+	fixedTime := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	mockPool.ExpectQuery("FROM books").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "title", "isbn", "author_id", "category_id", "stock",
+			"published_date", "description", "created_at", "updated_at", "deleted_at"}).
+			AddRow(1, "book1", "9780735211292", 3, 2, 1, fixedTime, "desc", fixedTime, fixedTime, nil))
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	err = db.StreamBooks(context.Background(), BookFilter{}, nil, func(book Book) error {
+		return assert.AnError
+	})
+
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestPostgresDB_ListBooks(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+	fixedTime := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	fixedDate := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	mockPool.ExpectQuery(EscapeQuery("WHERE author_id = $1 AND deleted_at IS NULL AND "+
+		"((published_date < $2) OR (published_date = $2 AND title > $3) OR (published_date = $2 AND title = $3 AND id > $4))"+
+		"\n\t\tORDER BY published_date DESC, title, id\n\t\tLIMIT $5")).
+		WithArgs(3, fixedDate, "book1", 1, 2).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "title", "isbn", "author_id", "category_id", "stock",
+			"published_date", "description", "created_at", "updated_at", "deleted_at"}).
+			AddRow(2, "book2", "9780804429573", 3, 2, 1, fixedTime, "desc", fixedTime, fixedTime, nil))
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	sort := []SortField{{Field: "published_date", Desc: true}, {Field: "title"}}
+	after := &Cursor{Keys: []string{"2020-01-02T00:00:00Z", "book1"}, ID: 1}
+	books, err := db.ListBooks(context.Background(), BookFilter{AuthorID: 3}, sort, after, 2)
+
+	assert.Nil(t, err)
+	assert.Len(t, books, 1)
+	assert.Equal(t, "book2", books[0].Title)
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_GetAuthorStats(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+
+	mockPool.ExpectQuery(EscapeQuery("shelf.copies + loans.copies AS total_copies")).
+		WithArgs(7).
+		WillReturnRows(pgxmock.NewRows([]string{"titles", "total_copies", "available_copies", "active_loans"}).AddRow(3, 12, 10, 2))
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	stats, err := db.GetAuthorStats(context.Background(), 7)
+
+	assert.Nil(t, err)
+	assert.Equal(t, AuthorStats{Titles: 3, TotalCopies: 12, AvailableCopies: 10, ActiveLoans: 2}, stats)
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
+// bookEventRows are the rows returned by the statements that write book events
+func bookEventRows(ids ...int) *pgxmock.Rows {
+	rows := pgxmock.NewRows([]string{"id", "title", "isbn", "author_id", "category_id", "stock", "published_date", "description"})
+	for _, id := range ids {
+		rows.AddRow(id, fmt.Sprintf("book%d", id), "", 9, 1, 1, time.Time{}, "")
+	}
+	return rows
+}
+
+func TestPostgresDB_ReassignAuthorBooks(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectQuery(EscapeQuery("WHERE author_id = $2 AND deleted_at IS NULL\n\t\tRETURNING")).
+		WithArgs(9, 7).
+		WillReturnRows(bookEventRows(1, 2, 3))
+	for _, id := range []int{1, 2, 3} {
+		mockPool.ExpectExec("INSERT INTO outbox").
+			WithArgs(EventBookUpdated, id, pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	}
+	mockPool.ExpectCommit()
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	moved, err := db.ReassignAuthorBooks(context.Background(), 7, 9)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, moved)
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_ListBooks_FirstPage(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+
+	mockPool.ExpectQuery(EscapeQuery("FROM books\n\t\tWHERE deleted_at IS NULL\n\t\tORDER BY title, id\n\t\tLIMIT $1")).
+		WithArgs(5).
+		WillReturnError(assert.AnError)
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	_, err = db.ListBooks(context.Background(), BookFilter{}, []SortField{{Field: "title"}}, nil, 5)
+
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_CreateBook_WithoutISBN(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	// a missing ISBN is stored as NULL, so the UNIQUE constraint lets both books in
+	for id, title := range []string{"book1", "book2"} {
+		mockPool.ExpectBeginTx(pgx.TxOptions{})
+		mockPool.ExpectQuery(EscapeQuery(`INSERT INTO books`)).
+			WithArgs(title, nil, 0, 0, 0, time.Time{}, "").
+			WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(id + 1))
+		mockPool.ExpectExec(EscapeQuery(`INSERT INTO outbox`)).
+			WithArgs(EventBookCreated, id+1, pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mockPool.ExpectCommit()
+	}
+
+	db := &postgresDB{pool: mockPool}
+	for _, title := range []string{"book1", "book2"} {
+		_, err = db.CreateBook(context.Background(), NewBook{Title: title})
+		require.NoError(t, err)
+	}
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_CreateBooks(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+
+	isbn := "9780441013593"
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectQuery(EscapeQuery("SELECT * FROM unnest(")).
+		WithArgs([]string{"book1", "book2"}, []*string{nil, &isbn}, []int{0, 0}, []int{0, 0}, []int{0, 0},
+			[]time.Time{{}, {}}, []string{"", ""}).
+		WillReturnRows(bookEventRows(1, 2))
+	for _, id := range []int{1, 2} {
+		mockPool.ExpectExec("INSERT INTO outbox").
+			WithArgs(EventBookCreated, id, pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	}
+	mockPool.ExpectCommit()
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	count, err := db.CreateBooks(context.Background(), []NewBook{{Title: "book1"}, {Title: "book2", ISBN: isbn}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_CreateBooks_DuplicateISBN(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectQuery(EscapeQuery("SELECT * FROM unnest(")).
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(),
+			pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "books_isbn_key"})
+	mockPool.ExpectRollback()
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	_, err = db.CreateBooks(context.Background(), []NewBook{{Title: "book1", ISBN: "9780441013593"}})
+
+	assert.ErrorIs(t, err, ErrDuplicateISBN)
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_ExistingISBNs(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+
+	mockPool.ExpectQuery(EscapeQuery(`SELECT isbn FROM books WHERE isbn = ANY($1)`)).
+		WithArgs([]string{"9780735211292", "9780804429573"}).
+		WillReturnRows(pgxmock.NewRows([]string{"isbn"}).AddRow("9780804429573"))
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	existing, err := db.ExistingISBNs(context.Background(), []string{"9780735211292", "9780804429573"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"9780804429573"}, existing)
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_GetBookByISBN_NotFound(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+
+	mockPool.ExpectQuery(EscapeQuery(`WHERE isbn = $1`)).
+		WithArgs("9780735211292").
+		WillReturnError(pgx.ErrNoRows)
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	_, err = db.GetBookByISBN(context.Background(), "9780735211292")
+
+	assert.ErrorIs(t, err, ErrBookNotFound)
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
 func TestPostgresDB_UpdateBook_Success(t *testing.T) {
 	mockPool, err := pgxmock.NewPool()
 	assert.Nil(t, err)
 	fixedTime := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
 
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
 	mockPool.ExpectExec(EscapeQuery(`UPDATE books
 		 SET title = $1,
 		     isbn = $2,
@@ -204,9 +564,13 @@ func TestPostgresDB_UpdateBook_Success(t *testing.T) {
 		     stock = $5,
 		     published_date = $6,
 		     description = $7
-		 WHERE id = $8`)).
+		 WHERE id = $8 AND deleted_at IS NULL`)).
 		WithArgs("book1", "1234567890", 1, 2, 10, fixedTime, "a book desc", 21).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO outbox`)).
+		WithArgs(EventBookUpdated, 21, pgxmock.AnyArg()).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mockPool.ExpectCommit()
 
 	db := postgresDB{
 		pool: mockPool,
@@ -231,6 +595,7 @@ func TestPostgresDB_UpdateBook_Fail(t *testing.T) {
 	assert.Nil(t, err)
 	fixedTime := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
 
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
 	mockPool.ExpectExec(EscapeQuery(`UPDATE books
 		 SET title = $1,
 		     isbn = $2,
@@ -239,9 +604,10 @@ func TestPostgresDB_UpdateBook_Fail(t *testing.T) {
 		     stock = $5,
 		     published_date = $6,
 		     description = $7
-		 WHERE id = $8`)).
+		 WHERE id = $8 AND deleted_at IS NULL`)).
 		WithArgs("book1", "1234567890", 1, 2, 10, fixedTime, "a book desc", 21).
 		WillReturnError(assert.AnError)
+	mockPool.ExpectRollback()
 
 	db := postgresDB{
 		pool: mockPool,
@@ -261,13 +627,26 @@ func TestPostgresDB_UpdateBook_Fail(t *testing.T) {
 	assert.Nil(t, mockPool.ExpectationsWereMet())
 }
 
+// deleteBookQuery locks the book and tells whether it has active loans
+const deleteBookQuery = `SELECT EXISTS (SELECT 1 FROM borrowing_records
+		                WHERE book_id = b.id AND status NOT IN ('returned', 'lost'))
+		 FROM books b WHERE b.id = $1 AND b.deleted_at IS NULL FOR UPDATE`
+
 func TestPostgresDB_DeleteBook_Success(t *testing.T) {
 	mockPool, err := pgxmock.NewPool()
 	assert.Nil(t, err)
 
-	mockPool.ExpectExec(EscapeQuery(`DELETE FROM books WHERE id = $1`)).
+	mockPool.ExpectBegin()
+	mockPool.ExpectQuery(EscapeQuery(deleteBookQuery)).
 		WithArgs(21).
-		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+	mockPool.ExpectExec(EscapeQuery(`UPDATE books SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1`)).
+		WithArgs(21).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO outbox (event_type, aggregate_id, payload) VALUES ($1, $2, $3)`)).
+		WithArgs(EventBookDeleted, 21, json.RawMessage(`{"id":21}`)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mockPool.ExpectCommit()
 
 	db := postgresDB{
 		pool: mockPool,
@@ -278,45 +657,152 @@ func TestPostgresDB_DeleteBook_Success(t *testing.T) {
 	assert.Nil(t, mockPool.ExpectationsWereMet())
 }
 
-func TestPostgresDB_DeleteBook_Fail(t *testing.T) {
+func TestPostgresDB_DeleteBook_NotFound(t *testing.T) {
 	mockPool, err := pgxmock.NewPool()
 	assert.Nil(t, err)
 
-	mockPool.ExpectExec(EscapeQuery(`DELETE FROM books WHERE id = $1`)).
+	mockPool.ExpectBegin()
+	mockPool.ExpectQuery(EscapeQuery(deleteBookQuery)).
 		WithArgs(21).
-		WillReturnError(assert.AnError)
+		WillReturnError(pgx.ErrNoRows)
+	mockPool.ExpectRollback()
 
 	db := postgresDB{
 		pool: mockPool,
 	}
 	err = db.DeleteBook(context.Background(), 21)
 
-	assert.ErrorContains(t, err, "failed to delete book")
+	assert.ErrorIs(t, err, ErrBookNotFound)
 	assert.Nil(t, mockPool.ExpectationsWereMet())
 }
 
-func TestPostgresDB_BorrowBook_Success(t *testing.T) {
+func TestPostgresDB_DeleteBook_OnLoan(t *testing.T) {
 	mockPool, err := pgxmock.NewPool()
-	assert.NoError(t, err)
-	defer mockPool.Close()
-
-	ctx := context.Background()
-	bookID := 1
-	userID := 123
-	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
-	dueDate := borrowedAt.Add(3 * 24 * time.Hour)
+	assert.Nil(t, err)
 
-	mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
-	mockPool.ExpectQuery("SELECT stock FROM books WHERE id = \\$1 FOR UPDATE").
-		WithArgs(bookID).
-		WillReturnRows(pgxmock.NewRows([]string{"stock"}).AddRow(5))
+	mockPool.ExpectBegin()
+	mockPool.ExpectQuery(EscapeQuery(deleteBookQuery)).
+		WithArgs(21).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+	mockPool.ExpectRollback()
 
-	mockPool.ExpectExec("UPDATE books SET stock = \\$1 WHERE id = \\$2").
-		WithArgs(4, bookID).
-		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	db := postgresDB{
+		pool: mockPool,
+	}
+	err = db.DeleteBook(context.Background(), 21)
 
-	mockPool.ExpectExec("INSERT INTO borrowing_records").
-		WithArgs(userID, bookID, borrowedAt, dueDate).
+	assert.ErrorIs(t, err, ErrBookOnLoan)
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_DeleteBook_Fail(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+
+	mockPool.ExpectBegin()
+	mockPool.ExpectQuery(EscapeQuery(deleteBookQuery)).
+		WithArgs(21).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+	mockPool.ExpectExec(EscapeQuery(`UPDATE books SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1`)).
+		WithArgs(21).
+		WillReturnError(assert.AnError)
+	mockPool.ExpectRollback()
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	err = db.DeleteBook(context.Background(), 21)
+
+	assert.ErrorContains(t, err, "failed to delete book")
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_RestoreBook(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+
+	query := EscapeQuery(`UPDATE books SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NOT NULL`)
+	mockPool.ExpectBegin()
+	mockPool.ExpectExec(query).
+		WithArgs(21).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO outbox (event_type, aggregate_id, payload) VALUES ($1, $2, $3)`)).
+		WithArgs(EventBookRestored, 21, json.RawMessage(`{"id":21}`)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mockPool.ExpectCommit()
+	mockPool.ExpectBegin()
+	mockPool.ExpectExec(query).
+		WithArgs(22).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mockPool.ExpectRollback()
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	assert.Nil(t, db.RestoreBook(context.Background(), 21))
+	assert.ErrorIs(t, db.RestoreBook(context.Background(), 22), ErrBookNotFound)
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_PurgeBooks(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.Nil(t, err)
+	before := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	mockPool.ExpectBegin()
+	mockPool.ExpectQuery(EscapeQuery(`DELETE FROM books b WHERE b.deleted_at < $1
+		 AND NOT EXISTS (SELECT 1 FROM borrowing_records r WHERE r.book_id = b.id)
+		 RETURNING b.id`)).
+		WithArgs(before).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(4).AddRow(9))
+	for _, id := range []int{4, 9} {
+		mockPool.ExpectExec(EscapeQuery(`INSERT INTO outbox`)).
+			WithArgs(EventBookPurged, id, pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	}
+	mockPool.ExpectCommit()
+
+	db := postgresDB{
+		pool: mockPool,
+	}
+	purged, err := db.PurgeBooks(context.Background(), before)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, purged)
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_BorrowBook_Success(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	ctx := context.Background()
+	bookID := 1
+	userID := 123
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	dueDate := borrowedAt.Add(3 * 24 * time.Hour)
+
+	mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	expectUserLock(mockPool, userID, borrowedAt)
+	mockPool.ExpectQuery(EscapeQuery("SELECT stock FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE")).
+		WithArgs(bookID).
+		WillReturnRows(pgxmock.NewRows([]string{"stock"}).AddRow(5))
+	expectLoanStats(mockPool, userID, bookID, borrowedAt, 0, 0, 0, 0)
+
+	mockPool.ExpectExec("UPDATE books SET stock = \\$1 WHERE id = \\$2").
+		WithArgs(4, bookID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	mockPool.ExpectQuery("INSERT INTO borrowing_records").
+		WithArgs(userID, bookID, borrowedAt, dueDate, LoanStatusBorrowed).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(9))
+	payload, err := json.Marshal(loanEvent{
+		LoanID: 9, BookID: bookID, UserID: userID, Status: LoanStatusBorrowed, BorrowedAt: borrowedAt, DueDate: dueDate,
+	})
+	require.NoError(t, err)
+	mockPool.ExpectExec("INSERT INTO outbox").
+		WithArgs(EventBookBorrowed, bookID, json.RawMessage(payload)).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
 	mockPool.ExpectCommit()
@@ -358,13 +844,30 @@ func TestPostgresDB_BorrowBook_Fail(t *testing.T) {
 		assert.ErrorContains(t, err, "failed to start transaction")
 	})
 
+	t.Run("fail to lock user loans", func(t *testing.T) {
+		mockPool, err := pgxmock.NewPool()
+		assert.NoError(t, err)
+		defer mockPool.Close()
+
+		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+		mockPool.ExpectExec("INSERT INTO borrowers").
+			WithArgs(userID, borrowedAt).
+			WillReturnError(errors.New("lock error"))
+
+		db := &postgresDB{pool: mockPool}
+		err = db.BorrowBook(ctx, book)
+
+		assert.ErrorContains(t, err, "failed to lock user loans")
+	})
+
 	t.Run("book not found", func(t *testing.T) {
 		mockPool, err := pgxmock.NewPool()
 		assert.NoError(t, err)
 		defer mockPool.Close()
 
 		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
-		mockPool.ExpectQuery(EscapeQuery(`SELECT stock FROM books WHERE id = $1 FOR UPDATE`)).
+		expectUserLock(mockPool, userID, borrowedAt)
+		mockPool.ExpectQuery(EscapeQuery(`SELECT stock FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`)).
 			WithArgs(bookID).
 			WillReturnError(pgx.ErrNoRows)
 
@@ -380,7 +883,8 @@ func TestPostgresDB_BorrowBook_Fail(t *testing.T) {
 		defer mockPool.Close()
 
 		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
-		mockPool.ExpectQuery(EscapeQuery(`SELECT stock FROM books WHERE id = $1 FOR UPDATE`)).
+		expectUserLock(mockPool, userID, borrowedAt)
+		mockPool.ExpectQuery(EscapeQuery(`SELECT stock FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`)).
 			WithArgs(bookID).
 			WillReturnError(errors.New("query error"))
 
@@ -396,7 +900,8 @@ func TestPostgresDB_BorrowBook_Fail(t *testing.T) {
 		defer mockPool.Close()
 
 		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
-		mockPool.ExpectQuery(EscapeQuery(`SELECT stock FROM books WHERE id = $1 FOR UPDATE`)).
+		expectUserLock(mockPool, userID, borrowedAt)
+		mockPool.ExpectQuery(EscapeQuery(`SELECT stock FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`)).
 			WithArgs(bookID).
 			WillReturnRows(pgxmock.NewRows([]string{"stock"}).AddRow(0))
 
@@ -412,9 +917,11 @@ func TestPostgresDB_BorrowBook_Fail(t *testing.T) {
 		defer mockPool.Close()
 
 		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
-		mockPool.ExpectQuery(EscapeQuery(`SELECT stock FROM books WHERE id = $1 FOR UPDATE`)).
+		expectUserLock(mockPool, userID, borrowedAt)
+		mockPool.ExpectQuery(EscapeQuery(`SELECT stock FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`)).
 			WithArgs(bookID).
 			WillReturnRows(pgxmock.NewRows([]string{"stock"}).AddRow(1))
+		expectLoanStats(mockPool, userID, bookID, borrowedAt, 0, 0, 0, 0)
 		mockPool.ExpectExec(EscapeQuery(`UPDATE books SET stock = $1 WHERE id = $2`)).
 			WithArgs(0, bookID).
 			WillReturnError(errors.New("update stock failed"))
@@ -431,14 +938,16 @@ func TestPostgresDB_BorrowBook_Fail(t *testing.T) {
 		defer mockPool.Close()
 
 		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
-		mockPool.ExpectQuery(EscapeQuery(`SELECT stock FROM books WHERE id = $1 FOR UPDATE`)).
+		expectUserLock(mockPool, userID, borrowedAt)
+		mockPool.ExpectQuery(EscapeQuery(`SELECT stock FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`)).
 			WithArgs(bookID).
 			WillReturnRows(pgxmock.NewRows([]string{"stock"}).AddRow(1))
+		expectLoanStats(mockPool, userID, bookID, borrowedAt, 0, 0, 0, 0)
 		mockPool.ExpectExec(EscapeQuery(`UPDATE books SET stock = $1 WHERE id = $2`)).
 			WithArgs(0, bookID).
 			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
-		mockPool.ExpectExec(EscapeQuery(`INSERT INTO borrowing_records`)).
-			WithArgs(userID, bookID, borrowedAt, dueDate).
+		mockPool.ExpectQuery(EscapeQuery(`INSERT INTO borrowing_records`)).
+			WithArgs(userID, bookID, borrowedAt, dueDate, LoanStatusBorrowed).
 			WillReturnError(errors.New("insert fail"))
 
 		db := &postgresDB{pool: mockPool}
@@ -453,14 +962,19 @@ func TestPostgresDB_BorrowBook_Fail(t *testing.T) {
 		defer mockPool.Close()
 
 		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
-		mockPool.ExpectQuery(EscapeQuery(`SELECT stock FROM books WHERE id = $1 FOR UPDATE`)).
+		expectUserLock(mockPool, userID, borrowedAt)
+		mockPool.ExpectQuery(EscapeQuery(`SELECT stock FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`)).
 			WithArgs(bookID).
 			WillReturnRows(pgxmock.NewRows([]string{"stock"}).AddRow(1))
+		expectLoanStats(mockPool, userID, bookID, borrowedAt, 0, 0, 0, 0)
 		mockPool.ExpectExec(EscapeQuery(`UPDATE books SET stock = $1 WHERE id = $2`)).
 			WithArgs(0, bookID).
 			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
-		mockPool.ExpectExec(EscapeQuery(`INSERT INTO borrowing_records`)).
-			WithArgs(userID, bookID, borrowedAt, dueDate).
+		mockPool.ExpectQuery(EscapeQuery(`INSERT INTO borrowing_records`)).
+			WithArgs(userID, bookID, borrowedAt, dueDate, LoanStatusBorrowed).
+			WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(9))
+		mockPool.ExpectExec("INSERT INTO outbox").
+			WithArgs(EventBookBorrowed, bookID, pgxmock.AnyArg()).
 			WillReturnResult(pgxmock.NewResult("INSERT", 1))
 		mockPool.ExpectCommit().WillReturnError(errors.New("commit error"))
 
@@ -471,6 +985,98 @@ func TestPostgresDB_BorrowBook_Fail(t *testing.T) {
 	})
 }
 
+func TestPostgresDB_BorrowBook_PolicyRejects(t *testing.T) {
+	ctx := context.Background()
+	userID := 123
+	bookID := 456
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		role        string
+		active      int
+		overdue     int
+		sameBook    int
+		unpaidFines float64
+		rule        string
+	}{
+		{name: "too many loans for role", role: "member", active: 5, rule: RuleMaxLoans},
+		{name: "too many loans for unknown role", role: "guest", active: 3, rule: RuleMaxLoans},
+		{name: "unpaid fines over limit", role: "member", unpaidFines: 10.5, rule: RuleUnpaidFines},
+		{name: "overdue loan", role: "member", active: 1, overdue: 1, rule: RuleOverdueLoans},
+		{name: "same title already borrowed", role: "member", active: 1, sameBook: 1, rule: RuleDuplicateTitle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPool, err := pgxmock.NewPool()
+			require.NoError(t, err)
+			defer mockPool.Close()
+
+			mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+			expectUserLock(mockPool, userID, borrowedAt)
+			mockPool.ExpectQuery(EscapeQuery(`SELECT stock FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`)).
+				WithArgs(bookID).
+				WillReturnRows(pgxmock.NewRows([]string{"stock"}).AddRow(1))
+			expectLoanStats(mockPool, userID, bookID, borrowedAt, tt.active, tt.overdue, tt.sameBook, tt.unpaidFines)
+			mockPool.ExpectRollback()
+
+			db := &postgresDB{pool: mockPool, policy: DefaultLoanPolicy()}
+			err = db.BorrowBook(ctx, NewBorrowingRecord{
+				UserID:     userID,
+				BookID:     bookID,
+				Role:       tt.role,
+				BorrowedAt: borrowedAt,
+			})
+
+			var ruleErr *LoanRuleError
+			require.ErrorAs(t, err, &ruleErr)
+			assert.Equal(t, tt.rule, ruleErr.Rule)
+			assert.NoError(t, mockPool.ExpectationsWereMet())
+		})
+	}
+
+	t.Run("fail to query user loans", func(t *testing.T) {
+		mockPool, err := pgxmock.NewPool()
+		require.NoError(t, err)
+		defer mockPool.Close()
+
+		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+		expectUserLock(mockPool, userID, borrowedAt)
+		mockPool.ExpectQuery(EscapeQuery(`SELECT stock FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`)).
+			WithArgs(bookID).
+			WillReturnRows(pgxmock.NewRows([]string{"stock"}).AddRow(1))
+		mockPool.ExpectQuery("FROM borrowing_records").
+			WithArgs(userID, borrowedAt, bookID).
+			WillReturnError(errors.New("query error"))
+
+		db := &postgresDB{pool: mockPool, policy: DefaultLoanPolicy()}
+		err = db.BorrowBook(ctx, NewBorrowingRecord{UserID: userID, BookID: bookID, BorrowedAt: borrowedAt})
+
+		assert.ErrorContains(t, err, "failed to query user loans")
+	})
+}
+
+// expectUserLock expects the update of the borrowers row BorrowBook starts with
+func expectUserLock(mockPool pgxmock.PgxPoolIface, userID int, at time.Time) {
+	mockPool.ExpectExec("INSERT INTO borrowers").
+		WithArgs(userID, at).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+}
+
+func expectLoanStats(mockPool pgxmock.PgxPoolIface, userID, bookID int, at time.Time,
+	active, overdue, sameBook int, unpaidFines float64) {
+	mockPool.ExpectQuery("FROM borrowing_records").
+		WithArgs(userID, at, bookID).
+		WillReturnRows(pgxmock.NewRows([]string{"active", "overdue", "same_book"}).
+			AddRow(active, overdue, sameBook))
+	mockPool.ExpectQuery("FROM fines").
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows([]string{"unpaid"}).AddRow(unpaidFines))
+}
+
+var loanColumns = []string{"id", "book_id", "user_id", "borrowed_at", "returned_at", "due_date", "status", "renewals"}
+
 func TestPostgresDB_ReturnBook_Success(t *testing.T) {
 	mockPool, err := pgxmock.NewPool()
 	require.NoError(t, err)
@@ -480,41 +1086,35 @@ func TestPostgresDB_ReturnBook_Success(t *testing.T) {
 	ctx := context.Background()
 	userID := 1
 	bookID := 101
-
-	record := BorrowingRecord{
-		UserID: userID,
-		BookID: bookID,
-	}
+	borrowedAt := time.Now().Add(-time.Hour)
+	dueDate := borrowedAt.Add(3 * 24 * time.Hour)
 
 	mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
-
 	mockPool.ExpectQuery(EscapeQuery(`
-		SELECT EXISTS (
-			SELECT 1 FROM borrowing_records
-			WHERE user_id = $1 AND book_id = $2 AND returned_at IS NULL
-		)`)).
+		WHERE user_id = $1 AND book_id = $2 AND status NOT IN ('returned', 'lost')
+		ORDER BY borrowed_at LIMIT 1
+		FOR UPDATE`)).
 		WithArgs(userID, bookID).
-		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
-
+		WillReturnRows(pgxmock.NewRows(loanColumns).
+			AddRow(9, bookID, userID, borrowedAt, nil, dueDate, LoanStatusBorrowed, 0))
 	mockPool.ExpectExec(EscapeQuery(`
 		UPDATE borrowing_records
-		SET returned_at = $1
-		WHERE user_id = $2 AND book_id = $3 AND returned_at IS NULL
-	`)).
-		WithArgs(pgxmock.AnyArg(), userID, bookID).
+		SET status = $1, borrowed_at = $2, due_date = $3, returned_at = $4, renewals = $5
+		WHERE id = $6`)).
+		WithArgs(LoanStatusReturned, borrowedAt, dueDate, pgxmock.AnyArg(), 0, 9).
 		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
-
 	mockPool.ExpectExec(EscapeQuery(`
-		UPDATE books
-		SET stock = stock + 1
-		WHERE id = $1
-	`)).
+			UPDATE books
+			SET stock = stock + 1
+			WHERE id = $1`)).
 		WithArgs(bookID).
 		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
-
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO outbox`)).
+		WithArgs(EventBookReturned, bookID, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 	mockPool.ExpectCommit()
 
-	err = db.ReturnBook(ctx, record)
+	err = db.ReturnBook(ctx, BorrowingRecord{UserID: userID, BookID: bookID})
 	assert.NoError(t, err)
 	assert.NoError(t, mockPool.ExpectationsWereMet())
 }
@@ -523,12 +1123,22 @@ func TestPostgresDB_ReturnBook_Fail(t *testing.T) {
 	ctx := context.Background()
 	userID := 123
 	bookID := 456
+	borrowedAt := time.Now().Add(-time.Hour)
+	dueDate := borrowedAt.Add(3 * 24 * time.Hour)
 
 	book := BorrowingRecord{
 		UserID: userID,
 		BookID: bookID,
 	}
 
+	expectActiveLoan := func(mockPool pgxmock.PgxPoolIface) {
+		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+		mockPool.ExpectQuery("FROM borrowing_records").
+			WithArgs(userID, bookID).
+			WillReturnRows(pgxmock.NewRows(loanColumns).
+				AddRow(9, bookID, userID, borrowedAt, nil, dueDate, LoanStatusBorrowed, 0))
+	}
+
 	t.Run("fail to begin transaction", func(t *testing.T) {
 		mockPool, err := pgxmock.NewPool()
 		assert.NoError(t, err)
@@ -548,12 +1158,7 @@ func TestPostgresDB_ReturnBook_Fail(t *testing.T) {
 		defer mockPool.Close()
 
 		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
-		mockPool.ExpectQuery(EscapeQuery(`
-			SELECT EXISTS (
-				SELECT 1 FROM borrowing_records
-				WHERE user_id = $1 AND book_id = $2 AND returned_at IS NULL
-			)
-		`)).
+		mockPool.ExpectQuery("FROM borrowing_records").
 			WithArgs(userID, bookID).
 			WillReturnError(errors.New("query error"))
 
@@ -569,19 +1174,14 @@ func TestPostgresDB_ReturnBook_Fail(t *testing.T) {
 		defer mockPool.Close()
 
 		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
-		mockPool.ExpectQuery(EscapeQuery(`
-			SELECT EXISTS (
-				SELECT 1 FROM borrowing_records
-				WHERE user_id = $1 AND book_id = $2 AND returned_at IS NULL
-			)
-		`)).
+		mockPool.ExpectQuery("FROM borrowing_records").
 			WithArgs(userID, bookID).
-			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+			WillReturnRows(pgxmock.NewRows(loanColumns))
 
 		db := &postgresDB{pool: mockPool}
 		err = db.ReturnBook(ctx, book)
 
-		assert.ErrorContains(t, err, "borrowing record not found or already returned")
+		assert.ErrorIs(t, err, ErrLoanNotFound)
 	})
 
 	t.Run("fail to update borrowing record", func(t *testing.T) {
@@ -589,22 +1189,9 @@ func TestPostgresDB_ReturnBook_Fail(t *testing.T) {
 		assert.NoError(t, err)
 		defer mockPool.Close()
 
-		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
-		mockPool.ExpectQuery(EscapeQuery(`
-			SELECT EXISTS (
-				SELECT 1 FROM borrowing_records
-				WHERE user_id = $1 AND book_id = $2 AND returned_at IS NULL
-			)
-		`)).
-			WithArgs(userID, bookID).
-			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
-
-		mockPool.ExpectExec(EscapeQuery(`
-			UPDATE borrowing_records
-			SET returned_at = $1
-			WHERE user_id = $2 AND book_id = $3 AND returned_at IS NULL
-		`)).
-			WithArgs(mock.Anything, userID, bookID).
+		expectActiveLoan(mockPool)
+		mockPool.ExpectExec("UPDATE borrowing_records").
+			WithArgs(LoanStatusReturned, borrowedAt, dueDate, pgxmock.AnyArg(), 0, 9).
 			WillReturnError(errors.New("update error"))
 
 		db := &postgresDB{pool: mockPool}
@@ -618,29 +1205,11 @@ func TestPostgresDB_ReturnBook_Fail(t *testing.T) {
 		assert.NoError(t, err)
 		defer mockPool.Close()
 
-		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
-		mockPool.ExpectQuery(EscapeQuery(`
-			SELECT EXISTS (
-				SELECT 1 FROM borrowing_records
-				WHERE user_id = $1 AND book_id = $2 AND returned_at IS NULL
-			)
-		`)).
-			WithArgs(userID, bookID).
-			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
-
-		mockPool.ExpectExec(EscapeQuery(`
-			UPDATE borrowing_records
-			SET returned_at = $1
-			WHERE user_id = $2 AND book_id = $3 AND returned_at IS NULL
-		`)).
-			WithArgs(pgxmock.AnyArg(), userID, bookID).
+		expectActiveLoan(mockPool)
+		mockPool.ExpectExec("UPDATE borrowing_records").
+			WithArgs(LoanStatusReturned, borrowedAt, dueDate, pgxmock.AnyArg(), 0, 9).
 			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
-
-		mockPool.ExpectExec(EscapeQuery(`
-			UPDATE books
-			SET stock = stock + 1
-			WHERE id = $1
-		`)).
+		mockPool.ExpectExec("UPDATE books").
 			WithArgs(bookID).
 			WillReturnError(fmt.Errorf("failed to increment book stock"))
 
@@ -655,32 +1224,16 @@ func TestPostgresDB_ReturnBook_Fail(t *testing.T) {
 		assert.NoError(t, err)
 		defer mockPool.Close()
 
-		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
-		mockPool.ExpectQuery(EscapeQuery(`
-			SELECT EXISTS (
-				SELECT 1 FROM borrowing_records
-				WHERE user_id = $1 AND book_id = $2 AND returned_at IS NULL
-			)
-		`)).
-			WithArgs(userID, bookID).
-			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
-
-		mockPool.ExpectExec(EscapeQuery(`
-			UPDATE borrowing_records
-			SET returned_at = $1
-			WHERE user_id = $2 AND book_id = $3 AND returned_at IS NULL
-		`)).
-			WithArgs(pgxmock.AnyArg(), userID, bookID).
+		expectActiveLoan(mockPool)
+		mockPool.ExpectExec("UPDATE borrowing_records").
+			WithArgs(LoanStatusReturned, borrowedAt, dueDate, pgxmock.AnyArg(), 0, 9).
 			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
-
-		mockPool.ExpectExec(EscapeQuery(`
-			UPDATE books
-			SET stock = stock + 1
-			WHERE id = $1
-		`)).
+		mockPool.ExpectExec("UPDATE books").
 			WithArgs(bookID).
 			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
-
+		mockPool.ExpectExec("INSERT INTO outbox").
+			WithArgs(EventBookReturned, bookID, pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
 		mockPool.ExpectCommit().WillReturnError(errors.New("commit error"))
 
 		db := &postgresDB{pool: mockPool}
@@ -690,6 +1243,207 @@ func TestPostgresDB_ReturnBook_Fail(t *testing.T) {
 	})
 }
 
+func TestPostgresDB_UpdateLoanStatus_Lost(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	dueDate := borrowedAt.Add(3 * 24 * time.Hour)
+	at := borrowedAt.Add(10 * 24 * time.Hour)
+
+	mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	mockPool.ExpectQuery(EscapeQuery(`
+		WHERE id = $1
+		FOR UPDATE`)).
+		WithArgs(9).
+		WillReturnRows(pgxmock.NewRows(loanColumns).
+			AddRow(9, 3, 7, borrowedAt, nil, dueDate, LoanStatusBorrowed, 0))
+	mockPool.ExpectExec("UPDATE borrowing_records").
+		WithArgs(LoanStatusLost, borrowedAt, dueDate, (*time.Time)(nil), 0, 9).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.ExpectExec(EscapeQuery(`
+				INSERT INTO fines (user_id, loan_id, amount, reason)
+				VALUES ($1, $2, $3, $4)`)).
+		WithArgs(7, 9, 25.0, "lost book replacement").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO outbox`)).
+		WithArgs(EventBookLost, 3, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mockPool.ExpectCommit()
+
+	db := &postgresDB{pool: mockPool, policy: DefaultLoanPolicy()}
+	loan, err := db.UpdateLoanStatus(context.Background(), 9, LoanStatusLost, at)
+
+	require.NoError(t, err)
+	assert.Equal(t, LoanStatusLost, loan.Status)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_UpdateLoanStatus_Renewed(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	dueDate := borrowedAt.Add(3 * 24 * time.Hour)
+
+	mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	mockPool.ExpectQuery("FROM borrowing_records").
+		WithArgs(9).
+		WillReturnRows(pgxmock.NewRows(loanColumns).
+			AddRow(9, 3, 7, borrowedAt, nil, dueDate, LoanStatusBorrowed, 0))
+	mockPool.ExpectExec("UPDATE borrowing_records").
+		WithArgs(LoanStatusRenewed, borrowedAt, dueDate.Add(3*24*time.Hour), (*time.Time)(nil), 1, 9).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO outbox`)).
+		WithArgs(EventBookRenewed, 3, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mockPool.ExpectCommit()
+
+	db := &postgresDB{pool: mockPool, policy: DefaultLoanPolicy()}
+	loan, err := db.UpdateLoanStatus(context.Background(), 9, LoanStatusRenewed, borrowedAt.Add(24*time.Hour))
+
+	require.NoError(t, err)
+	assert.Equal(t, dueDate.Add(3*24*time.Hour), loan.DueDate)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_RenewLoan(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	dueDate := borrowedAt.Add(3 * 24 * time.Hour)
+
+	mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	mockPool.ExpectQuery(EscapeQuery(`
+		WHERE id = $1 AND user_id = $2
+		FOR UPDATE`)).
+		WithArgs(9, 7).
+		WillReturnRows(pgxmock.NewRows(loanColumns).
+			AddRow(9, 3, 7, borrowedAt, nil, dueDate, LoanStatusRenewed, 2))
+	mockPool.ExpectRollback()
+
+	db := &postgresDB{pool: mockPool, policy: DefaultLoanPolicy()}
+	_, err = db.RenewLoan(context.Background(), 7, 9, borrowedAt.Add(24*time.Hour))
+
+	var ruleErr *LoanRuleError
+	require.ErrorAs(t, err, &ruleErr)
+	assert.Equal(t, RuleMaxRenewals, ruleErr.Rule)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_UpdateLoanStatus_Fail(t *testing.T) {
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	dueDate := borrowedAt.Add(3 * 24 * time.Hour)
+
+	t.Run("loan not found", func(t *testing.T) {
+		mockPool, err := pgxmock.NewPool()
+		require.NoError(t, err)
+		defer mockPool.Close()
+
+		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+		mockPool.ExpectQuery("FROM borrowing_records").
+			WithArgs(9).
+			WillReturnRows(pgxmock.NewRows(loanColumns))
+
+		db := &postgresDB{pool: mockPool}
+		_, err = db.UpdateLoanStatus(context.Background(), 9, LoanStatusReturned, borrowedAt)
+
+		assert.ErrorIs(t, err, ErrLoanNotFound)
+	})
+
+	t.Run("overdue loan cannot be renewed", func(t *testing.T) {
+		mockPool, err := pgxmock.NewPool()
+		require.NoError(t, err)
+		defer mockPool.Close()
+
+		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+		mockPool.ExpectQuery("FROM borrowing_records").
+			WithArgs(9).
+			WillReturnRows(pgxmock.NewRows(loanColumns).
+				AddRow(9, 3, 7, borrowedAt, nil, dueDate, LoanStatusBorrowed, 0))
+		mockPool.ExpectRollback()
+
+		db := &postgresDB{pool: mockPool}
+		_, err = db.UpdateLoanStatus(context.Background(), 9, LoanStatusRenewed, dueDate.Add(time.Hour))
+
+		var transitionErr *LoanTransitionError
+		require.ErrorAs(t, err, &transitionErr)
+		assert.Equal(t, LoanStatusOverdue, transitionErr.From)
+		assert.NoError(t, mockPool.ExpectationsWereMet())
+	})
+}
+
+func TestPostgresDB_ListLoans_Success(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	now := time.Date(2023, 10, 10, 12, 0, 0, 0, time.UTC)
+	borrowedAt := time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC)
+	dueDate := borrowedAt.Add(3 * 24 * time.Hour)
+
+	query := `
+		SELECT id, book_id, user_id, borrowed_at, returned_at, due_date,
+		       CASE WHEN status IN ('borrowed', 'renewed') AND due_date < $1 THEN 'overdue'
+		            ELSE status END AS status, renewals
+		FROM borrowing_records WHERE user_id = $2 AND (status = 'overdue' OR (status IN ('borrowed', 'renewed') AND due_date < $1)) ORDER BY borrowed_at DESC, id DESC LIMIT $3 OFFSET $4`
+
+	mockPool.ExpectQuery(EscapeQuery(query)).
+		WithArgs(now, 7, 10, 20).
+		WillReturnRows(pgxmock.NewRows(loanColumns).
+			AddRow(1, 3, 7, borrowedAt, nil, dueDate, "overdue", 0))
+
+	db := &postgresDB{pool: mockPool}
+	loans, err := db.ListLoans(context.Background(), LoanFilter{UserID: 7, State: LoanStateOverdue, Now: now}, 10, 20)
+
+	require.NoError(t, err)
+	require.Len(t, loans, 1)
+	assert.Equal(t, BorrowingRecord{ID: 1, BookID: 3, UserID: 7, BorrowedAt: borrowedAt, DueDate: dueDate, Status: LoanStatusOverdue}, loans[0])
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_ListLoans_Fail(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	now := time.Date(2023, 10, 10, 12, 0, 0, 0, time.UTC)
+	mockPool.ExpectQuery(EscapeQuery("FROM borrowing_records WHERE book_id = $2 AND status = 'returned'")).
+		WithArgs(now, 3, 10, 0).
+		WillReturnError(errors.New("query error"))
+
+	db := &postgresDB{pool: mockPool}
+	loans, err := db.ListLoans(context.Background(), LoanFilter{BookID: 3, State: LoanStateReturned, Now: now}, 10, 0)
+
+	assert.ErrorContains(t, err, "failed to query borrowing records")
+	assert.Nil(t, loans)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_CountOverdueLoans(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	now := time.Date(2023, 10, 10, 12, 0, 0, 0, time.UTC)
+	mockPool.ExpectQuery(EscapeQuery(`
+		SELECT count(*) FROM borrowing_records
+		WHERE status = 'overdue' OR (status IN ('borrowed', 'renewed') AND due_date < $1)`)).
+		WithArgs(now).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(4))
+
+	db := &postgresDB{pool: mockPool}
+	count, err := db.CountOverdueLoans(context.Background(), now)
+
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
 func TestPostgresDB_GetRecommendedBooks_Success(t *testing.T) {
 	mockPool, err := pgxmock.NewPool()
 	assert.NoError(t, err)
@@ -697,18 +1451,19 @@ func TestPostgresDB_GetRecommendedBooks_Success(t *testing.T) {
 
 	db := &postgresDB{pool: mockPool}
 	ctx := context.Background()
-	bookID := 1
+	bookIDs := []int{1, 3}
 
 	mockPool.ExpectQuery(EscapeQuery(`
-			SELECT id, book_id, recommended_book_id, score  FROM book_recommendation WHERE book_id = $1`)).
-		WithArgs(bookID).
+			SELECT id, book_id, recommended_book_id, score  FROM book_recommendation WHERE book_id = ANY($1)`)).
+		WithArgs(bookIDs).
 		WillReturnRows(pgxmock.NewRows([]string{"id", "book_id", "recommended_book_id", "score"}).
-			AddRow(bookID, 1, 2, 0.9))
+			AddRow(1, 1, 2, 0.9).
+			AddRow(2, 3, 2, 0.5))
 
-	books, err := db.GetRecommendedBooks(ctx, bookID)
+	books, err := db.GetRecommendedBooks(ctx, bookIDs)
 
 	assert.NoError(t, err)
-	assert.Len(t, books, 1)
+	assert.Len(t, books, 2)
 	assert.NoError(t, mockPool.ExpectationsWereMet())
 }
 
@@ -719,13 +1474,13 @@ func TestPostgresDB_GetRecommendedBooks_Fail(t *testing.T) {
 
 	db := &postgresDB{pool: mockPool}
 	ctx := context.Background()
-	bookID := 1
+	bookIDs := []int{1, 3}
 
 	mockPool.ExpectQuery(EscapeQuery(`
-			SELECT id, book_id, recommended_book_id, score  FROM book_recommendation WHERE book_id = $1`)).
-		WithArgs(bookID).
+			SELECT id, book_id, recommended_book_id, score  FROM book_recommendation WHERE book_id = ANY($1)`)).
+		WithArgs(bookIDs).
 		WillReturnError(fmt.Errorf("failed to query recommended_books"))
-	books, err := db.GetRecommendedBooks(ctx, bookID)
+	books, err := db.GetRecommendedBooks(ctx, bookIDs)
 
 	assert.ErrorContains(t, err, "failed to query recommended_books")
 	assert.Nil(t, books)
@@ -777,3 +1532,509 @@ func TestPostgresDB_AddRecommendedBook_Fail(t *testing.T) {
 	err = db.AddRecommendedBook(ctx, bookRecommendation)
 	assert.Error(t, err)
 }
+
+func TestPostgresDB_UpdateBook_NotFound(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectExec(EscapeQuery(`UPDATE books`)).
+		WithArgs("book1", nil, 0, 0, 0, time.Time{}, "", 21).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mockPool.ExpectRollback()
+
+	db := &postgresDB{pool: mockPool}
+	err = db.UpdateBook(context.Background(), Book{ID: 21, Title: "book1"})
+
+	assert.ErrorIs(t, err, ErrBookNotFound)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_CreateBook_EventFails(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectQuery(EscapeQuery(`INSERT INTO books`)).
+		WithArgs("book1", nil, 0, 0, 0, time.Time{}, "").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(7))
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO outbox`)).
+		WithArgs(EventBookCreated, 7, pgxmock.AnyArg()).
+		WillReturnError(assert.AnError)
+	mockPool.ExpectRollback()
+
+	db := &postgresDB{pool: mockPool}
+	_, err = db.CreateBook(context.Background(), NewBook{Title: "book1"})
+
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.ErrorContains(t, err, "failed to insert book.created event")
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_PendingEvents(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	createdAt := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	mockPool.ExpectQuery(EscapeQuery(`SELECT id, event_type, aggregate_id, payload, created_at, published_at
+		 FROM outbox
+		 WHERE published_at IS NULL
+		 ORDER BY id
+		 LIMIT $1`)).
+		WithArgs(50).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "event_type", "aggregate_id", "payload", "created_at", "published_at"}).
+			AddRow(int64(3), EventBookReturned, 7, json.RawMessage(`{"book_id":7}`), createdAt, nil))
+
+	db := &postgresDB{pool: mockPool}
+	events, err := db.PendingEvents(context.Background(), 50)
+
+	require.NoError(t, err)
+	assert.Equal(t, []OutboxEvent{{
+		ID: 3, Type: EventBookReturned, AggregateID: 7, Payload: json.RawMessage(`{"book_id":7}`), CreatedAt: createdAt,
+	}}, events)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_MarkEventPublished(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	mockPool.ExpectExec(EscapeQuery(`UPDATE outbox SET published_at = CURRENT_TIMESTAMP WHERE id = $1`)).
+		WithArgs(int64(3)).
+		WillReturnError(assert.AnError)
+
+	db := &postgresDB{pool: mockPool}
+	err = db.MarkEventPublished(context.Background(), 3)
+
+	assert.ErrorContains(t, err, "failed to mark event 3 published")
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_AddAuditEntry(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	changes := json.RawMessage(`{"title":{"before":"Old","after":"New"}}`)
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO audit_log (actor, actor_role, action, entity, entity_id, changes, request_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`)).
+		WithArgs("42", "admin", "update", "book", 3, changes, "req-1").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	db := &postgresDB{pool: mockPool}
+	err = db.AddAuditEntry(context.Background(), NewAuditEntry{
+		Actor:     "42",
+		ActorRole: "admin",
+		Action:    "update",
+		Entity:    "book",
+		EntityID:  3,
+		Changes:   changes,
+		RequestID: "req-1",
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_WithinTx_Commit(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	mockPool.ExpectBegin()
+	// DeleteBook opens its own transaction, which becomes a savepoint
+	mockPool.ExpectBegin()
+	mockPool.ExpectQuery(EscapeQuery(deleteBookQuery)).
+		WithArgs(21).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+	mockPool.ExpectExec(EscapeQuery(`UPDATE books SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1`)).
+		WithArgs(21).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO outbox (event_type, aggregate_id, payload) VALUES ($1, $2, $3)`)).
+		WithArgs(EventBookDeleted, 21, json.RawMessage(`{"id":21}`)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mockPool.ExpectCommit()
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO audit_log`)).
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mockPool.ExpectCommit()
+
+	db := &postgresDB{pool: mockPool}
+	err = db.WithinTx(context.Background(), func(ctx context.Context) error {
+		if err := db.DeleteBook(ctx, 21); err != nil {
+			return err
+		}
+		return db.AddAuditEntry(ctx, NewAuditEntry{Action: "delete", Entity: "book", EntityID: 21})
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_WithinTx_Rollback(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	mockPool.ExpectBegin()
+	// RestoreBook opens its own transaction, which becomes a savepoint
+	mockPool.ExpectBegin()
+	mockPool.ExpectExec(EscapeQuery(`UPDATE books SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NOT NULL`)).
+		WithArgs(21).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO outbox`)).
+		WithArgs(EventBookRestored, 21, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mockPool.ExpectCommit()
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO audit_log`)).
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnError(errors.New("disk full"))
+	mockPool.ExpectRollback()
+
+	db := &postgresDB{pool: mockPool}
+	err = db.WithinTx(context.Background(), func(ctx context.Context) error {
+		if err := db.RestoreBook(ctx, 21); err != nil {
+			return err
+		}
+		return db.AddAuditEntry(ctx, NewAuditEntry{Action: "restore", Entity: "book", EntityID: 21})
+	})
+
+	assert.ErrorContains(t, err, "failed to add audit entry")
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_WithinRepeatableReadTx_Retries(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	conflict := &pgconn.PgError{Code: "40001", Message: "could not serialize access due to concurrent update"}
+	mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	mockPool.ExpectRollback()
+	mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	mockPool.ExpectCommit()
+
+	db := &postgresDB{pool: mockPool}
+	runs := 0
+	err = db.WithinRepeatableReadTx(context.Background(), func(ctx context.Context) error {
+		runs++
+		if runs == 1 {
+			return fmt.Errorf("failed to borrow book: %w", conflict)
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, runs)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_WithinRepeatableReadTx_GivesUp(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	for range maxSerializationAttempts {
+		mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+		mockPool.ExpectRollback()
+	}
+
+	db := &postgresDB{pool: mockPool}
+	err = db.WithinRepeatableReadTx(context.Background(), func(ctx context.Context) error {
+		return &pgconn.PgError{Code: "40001"}
+	})
+
+	assert.True(t, serializationFailure(err))
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_ListAuditEntries(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	createdAt := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	query := `
+		SELECT id, actor, actor_role, action, entity, entity_id, changes, request_id, created_at
+		FROM audit_log WHERE entity = $1 AND actor = $2 ORDER BY id DESC LIMIT $3 OFFSET $4`
+	mockPool.ExpectQuery(EscapeQuery(query)).
+		WithArgs("book", "42", 10, 0).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "actor", "actor_role", "action", "entity", "entity_id", "changes", "request_id", "created_at"}).
+			AddRow(int64(5), "42", "admin", "delete", "book", 3, json.RawMessage(`{}`), "req-1", createdAt))
+
+	db := &postgresDB{pool: mockPool}
+	entries, err := db.ListAuditEntries(context.Background(), AuditFilter{Entity: "book", Actor: "42"}, 10, 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, []AuditEntry{{ID: 5, Actor: "42", ActorRole: "admin", Action: "delete", Entity: "book", EntityID: 3,
+		Changes: json.RawMessage(`{}`), RequestID: "req-1", CreatedAt: createdAt}}, entries)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_DeleteWebhookSubscription_NotFound(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	mockPool.ExpectExec(EscapeQuery(`DELETE FROM webhook_subscriptions WHERE id = $1`)).
+		WithArgs(4).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	db := &postgresDB{pool: mockPool}
+	err = db.DeleteWebhookSubscription(context.Background(), 4)
+
+	assert.ErrorIs(t, err, ErrWebhookNotFound)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_EnqueueWebhookDeliveries(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	payload := json.RawMessage(`{"id":3,"type":"book.created"}`)
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, next_attempt_at)
+		 SELECT id, $1, $2, $3, CURRENT_TIMESTAMP
+		 FROM webhook_subscriptions
+		 WHERE cardinality(event_types) = 0 OR $2 = ANY(event_types)
+		 ON CONFLICT (subscription_id, event_id) DO NOTHING`)).
+		WithArgs(int64(3), EventBookCreated, payload).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+
+	db := &postgresDB{pool: mockPool}
+	enqueued, err := db.EnqueueWebhookDeliveries(context.Background(),
+		NewWebhookDelivery{EventID: 3, EventType: EventBookCreated, Payload: payload})
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, enqueued)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_ClaimWebhookDeliveries(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	leasedUntil := now.Add(time.Minute)
+	columns := []string{"id", "subscription_id", "event_id", "event_type", "payload", "status", "attempts",
+		"response_status", "last_error", "next_attempt_at", "created_at", "delivered_at"}
+	mockPool.ExpectQuery(EscapeQuery(`UPDATE webhook_deliveries
+		 SET next_attempt_at = $2
+		 WHERE id IN (
+		     SELECT id FROM webhook_deliveries
+		     WHERE status = 'pending' AND next_attempt_at <= $1
+		     ORDER BY next_attempt_at, id
+		     LIMIT $3
+		     FOR UPDATE SKIP LOCKED)
+		 RETURNING `+webhookDeliveryColumns)).
+		WithArgs(now, leasedUntil, 10).
+		WillReturnRows(pgxmock.NewRows(columns).
+			AddRow(int64(8), 1, int64(4), EventBookUpdated, json.RawMessage(`{}`), DeliveryPending, 2, 500, "boom", &leasedUntil, now, nil).
+			AddRow(int64(6), 1, int64(3), EventBookCreated, json.RawMessage(`{}`), DeliveryPending, 0, 0, "", &leasedUntil, now, nil))
+
+	db := &postgresDB{pool: mockPool}
+	deliveries, err := db.ClaimWebhookDeliveries(context.Background(), now, time.Minute, 10)
+
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, int64(6), deliveries[0].ID)
+	assert.Equal(t, int64(8), deliveries[1].ID)
+	assert.Equal(t, "boom", deliveries[1].LastError)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_RecordWebhookAttempt(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	at := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	mockPool.ExpectExec(EscapeQuery(`UPDATE webhook_deliveries
+		 SET status = $2,
+		     attempts = attempts + 1,
+		     response_status = $3,
+		     last_error = $4,
+		     next_attempt_at = $5,
+		     delivered_at = $6
+		 WHERE id = $1`)).
+		WithArgs(int64(6), DeliveryDelivered, 204, "", (*time.Time)(nil), &at).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	db := &postgresDB{pool: mockPool}
+	err = db.RecordWebhookAttempt(context.Background(), 6,
+		WebhookAttempt{Status: DeliveryDelivered, ResponseStatus: 204, At: at})
+
+	assert.ErrorIs(t, err, ErrDeliveryNotFound)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_ListWebhookDeliveries(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	createdAt := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	columns := []string{"id", "subscription_id", "event_id", "event_type", "payload", "status", "attempts",
+		"response_status", "last_error", "next_attempt_at", "created_at", "delivered_at"}
+	mockPool.ExpectQuery(EscapeQuery(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries WHERE subscription_id = $1 AND status = $2 ORDER BY id DESC LIMIT $3 OFFSET $4`)).
+		WithArgs(2, DeliveryDead, 20, 0).
+		WillReturnRows(pgxmock.NewRows(columns).
+			AddRow(int64(6), 2, int64(3), EventBookCreated, json.RawMessage(`{}`), DeliveryDead, 8, 503, "webhook responded 503", nil, createdAt, nil))
+
+	db := &postgresDB{pool: mockPool}
+	deliveries, err := db.ListWebhookDeliveries(context.Background(),
+		WebhookDeliveryFilter{SubscriptionID: 2, Status: DeliveryDead}, 20, 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, []WebhookDelivery{{ID: 6, SubscriptionID: 2, EventID: 3, EventType: EventBookCreated,
+		Payload: json.RawMessage(`{}`), Status: DeliveryDead, Attempts: 8, ResponseStatus: 503,
+		LastError: "webhook responded 503", CreatedAt: createdAt}}, deliveries)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_RetryWebhookDelivery_NotDead(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	at := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	mockPool.ExpectExec(EscapeQuery(`UPDATE webhook_deliveries
+		 SET status = 'pending', attempts = 0, next_attempt_at = $2
+		 WHERE id = $1 AND status = 'dead'`)).
+		WithArgs(int64(6), at).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mockPool.ExpectQuery(EscapeQuery(`SELECT EXISTS (SELECT 1 FROM webhook_deliveries WHERE id = $1)`)).
+		WithArgs(int64(6)).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+
+	db := &postgresDB{pool: mockPool}
+	err = db.RetryWebhookDelivery(context.Background(), 6, at)
+
+	assert.ErrorIs(t, err, ErrDeliveryNotDead)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_LoansToNotify(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	dueDate := now.Add(24 * time.Hour)
+	mockPool.ExpectQuery(EscapeQuery(`
+		SELECT l.id AS loan_id, l.book_id, l.user_id, b.title AS book_title, l.due_date,
+		       COALESCE(p.email, '') AS email, COALESCE(f.attempts, 0) AS attempts
+		FROM borrowing_records l
+		JOIN books b ON b.id = l.book_id
+		LEFT JOIN notification_preferences p ON p.user_id = l.user_id
+		LEFT JOIN loan_notification_failures f
+		       ON f.loan_id = l.id AND f.kind = $3 AND f.due_date = l.due_date
+		WHERE l.status IN ('borrowed', 'renewed', 'overdue')
+		  AND b.deleted_at IS NULL
+		  AND l.due_date >= $1 AND l.due_date < $2
+		  AND COALESCE(p.due_soon, TRUE)
+		  AND (f.next_attempt_at IS NULL OR f.next_attempt_at <= $4)
+		  AND NOT EXISTS (
+		      SELECT 1 FROM loan_notifications n
+		      WHERE n.loan_id = l.id AND n.kind = $3 AND n.due_date = l.due_date)
+		ORDER BY l.due_date, l.id
+		LIMIT $5`)).
+		WithArgs(now, now.Add(48*time.Hour), NotificationDueSoon, now, 50).
+		WillReturnRows(pgxmock.NewRows([]string{"loan_id", "book_id", "user_id", "book_title", "due_date", "email", "attempts"}).
+			AddRow(4, 2, 5, "Dune", dueDate, "reader@example.com", 2))
+
+	db := &postgresDB{pool: mockPool}
+	notices, err := db.LoansToNotify(context.Background(),
+		NoticeFilter{Kind: NotificationDueSoon, DueAfter: now, DueBefore: now.Add(48 * time.Hour), Now: now}, 50)
+
+	require.NoError(t, err)
+	assert.Equal(t, []LoanNotice{{LoanID: 4, BookID: 2, UserID: 5, BookTitle: "Dune", DueDate: dueDate, Email: "reader@example.com", Attempts: 2}}, notices)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_LoansToNotify_UnknownKind(t *testing.T) {
+	db := &postgresDB{}
+	_, err := db.LoansToNotify(context.Background(), NoticeFilter{Kind: "weekly"}, 50)
+	assert.ErrorContains(t, err, `unknown notification kind "weekly"`)
+}
+
+func TestPostgresDB_GetNotificationPreferences_Defaults(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	mockPool.ExpectQuery(EscapeQuery(`SELECT user_id, email, due_soon, overdue, updated_at FROM notification_preferences WHERE user_id = $1`)).
+		WithArgs(5).
+		WillReturnRows(pgxmock.NewRows([]string{"user_id", "email", "due_soon", "overdue", "updated_at"}))
+
+	db := &postgresDB{pool: mockPool}
+	preferences, err := db.GetNotificationPreferences(context.Background(), 5)
+
+	require.NoError(t, err)
+	assert.Equal(t, DefaultNotificationPreferences(5), preferences)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_RecordNotification(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	dueDate := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO loan_notifications (loan_id, user_id, kind, due_date)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (loan_id, kind, due_date) DO NOTHING`)).
+		WithArgs(4, 5, NotificationOverdue, dueDate).
+		WillReturnError(assert.AnError)
+
+	db := &postgresDB{pool: mockPool}
+	err = db.RecordNotification(context.Background(),
+		SentNotification{LoanID: 4, UserID: 5, Kind: NotificationOverdue, DueDate: dueDate})
+
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_RecordNotificationFailure(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	dueDate := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	next := dueDate.Add(time.Hour)
+	mockPool.ExpectExec(EscapeQuery(`INSERT INTO loan_notification_failures (loan_id, kind, due_date, attempts, last_error, next_attempt_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (loan_id, kind, due_date) DO UPDATE
+		 SET attempts = EXCLUDED.attempts, last_error = EXCLUDED.last_error, next_attempt_at = EXCLUDED.next_attempt_at`)).
+		WithArgs(4, NotificationOverdue, dueDate, 2, "mail server down", next).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	db := &postgresDB{pool: mockPool}
+	err = db.RecordNotificationFailure(context.Background(), FailedNotification{
+		LoanID: 4, Kind: NotificationOverdue, DueDate: dueDate, Attempts: 2, LastError: "mail server down", NextAttemptAt: next,
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPostgresDB_Ping(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+
+	mockPool.ExpectPing()
+	mockPool.ExpectPing().WillReturnError(assert.AnError)
+
+	db := &postgresDB{pool: mockPool}
+	assert.NoError(t, db.Ping(context.Background()))
+	assert.ErrorIs(t, db.Ping(context.Background()), assert.AnError)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// titleWeight and descriptionWeight mirror the A and B weights of books.search_vector
+	titleWeight       = 1.0
+	descriptionWeight = 0.4
+	// trigramThreshold matches the pg_trgm default similarity threshold
+	trigramThreshold = 0.3
+	snippetRadius    = 60
+	highlightStart   = "<mark>"
+	highlightStop    = "</mark>"
+	// highlightStartSel and highlightStopSel delimit the matches until the snippet is
+	// escaped, control characters no book text is expected to contain
+	highlightStartSel = "\x02"
+	highlightStopSel  = "\x03"
+)
+
+// BookSearchResult is a book matched by SearchBooks with its relevance
+type BookSearchResult struct {
+	Book    Book
+	Rank    float64
+	Snippet string
+}
+
+// tokenize lower-cases text and splits it into letter and digit runs
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// trigrams returns the pg_trgm style trigram set of a word padded with blanks
+func trigrams(word string) map[string]struct{} {
+	padded := []rune("  " + word + " ")
+	set := make(map[string]struct{}, len(padded))
+	for i := 0; i+3 <= len(padded); i++ {
+		set[string(padded[i:i+3])] = struct{}{}
+	}
+	return set
+}
+
+// similarity is the share of trigrams two words have in common, as pg_trgm computes it
+func similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	shared := 0
+	for t := range ta {
+		if _, ok := tb[t]; ok {
+			shared++
+		}
+	}
+	union := len(ta) + len(tb) - shared
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
+
+// matchScore scores one query term against the words of a field,
+// exact and prefix matches count fully, close spellings by their similarity
+func matchScore(term string, words []string) float64 {
+	best := 0.0
+	for _, word := range words {
+		if word == term || strings.HasPrefix(word, term) {
+			return 1
+		}
+		if s := similarity(term, word); s >= trigramThreshold && s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+// rankBook scores a book against the query terms, 0 means no match
+func rankBook(book Book, terms []string) float64 {
+	titleWords := tokenize(book.Title)
+	descriptionWords := tokenize(book.Description)
+
+	rank := 0.0
+	for _, term := range terms {
+		rank += titleWeight*matchScore(term, titleWords) + descriptionWeight*matchScore(term, descriptionWords)
+	}
+	return rank / float64(len(terms))
+}
+
+// highlight returns a fragment of text around the first matching word, HTML escaped,
+// with every matching word wrapped in <mark> tags
+func highlight(text string, terms []string) string {
+	type span struct{ start, end int }
+	var matches []span
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+			j++
+		}
+		if termMatches(strings.ToLower(string(runes[i:j])), terms) {
+			matches = append(matches, span{i, j})
+		}
+		i = j
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+
+	from := max(matches[0].start-snippetRadius, 0)
+	to := min(matches[0].end+snippetRadius, len(runes))
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("...")
+	}
+	pos := from
+	for _, m := range matches {
+		if m.start < from || m.end > to {
+			continue
+		}
+		b.WriteString(string(runes[pos:m.start]))
+		b.WriteString(highlightStartSel)
+		b.WriteString(string(runes[m.start:m.end]))
+		b.WriteString(highlightStopSel)
+		pos = m.end
+	}
+	b.WriteString(string(runes[pos:to]))
+	if to < len(runes) {
+		b.WriteString("...")
+	}
+	return markHighlights(b.String())
+}
+
+// markHighlights escapes a snippet whose matches are delimited by the highlight
+// selectors, then turns the selectors into <mark> tags
+func markHighlights(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, highlightStartSel, highlightStart)
+	return strings.ReplaceAll(snippet, highlightStopSel, highlightStop)
+}
+
+// termMatches reports whether word matches any term the way matchScore matches a field
+func termMatches(word string, terms []string) bool {
+	for _, term := range terms {
+		if matchScore(term, []string{word}) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// searchBooks ranks books in memory the way the PostgreSQL search does
+func searchBooks(books []Book, query string, limit, offset int) []BookSearchResult {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return []BookSearchResult{}
+	}
+
+	results := make([]BookSearchResult, 0)
+	for _, book := range books {
+		rank := rankBook(book, terms)
+		if rank == 0 {
+			continue
+		}
+		snippet := highlight(book.Description, terms)
+		if snippet == "" {
+			snippet = highlight(book.Title, terms)
+		}
+		results = append(results, BookSearchResult{Book: book, Rank: rank, Snippet: snippet})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Book.ID < results[j].Book.ID
+	})
+
+	if offset >= len(results) {
+		return []BookSearchResult{}
+	}
+	results = results[offset:]
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var searchCatalog = []Book{
+	{ID: 1, Title: "The Seven Habits of Highly Effective People", Description: "A self-help classic about personal effectiveness."},
+	{ID: 2, Title: "Atomic Habits", Description: "Tiny changes, remarkable results."},
+	{ID: 3, Title: "Deep Work", Description: "Rules for focused success and good habits in a distracted world."},
+	{ID: 4, Title: "Dune", Description: "A desert planet and its spice."},
+}
+
+func TestSearchBooks_RanksTitleAboveDescription(t *testing.T) {
+	results := searchBooks(searchCatalog, "habits", 10, 0)
+
+	assert.Len(t, results, 3)
+	assert.Equal(t, 1, results[0].Book.ID)
+	assert.Equal(t, 2, results[1].Book.ID)
+	assert.Equal(t, 3, results[2].Book.ID)
+	assert.Greater(t, results[1].Rank, results[2].Rank)
+	assert.Contains(t, results[2].Snippet, "<mark>habits</mark>")
+}
+
+func TestSearchBooks_ToleratesTypos(t *testing.T) {
+	results := searchBooks(searchCatalog, "atomik habbits", 10, 0)
+
+	assert.NotEmpty(t, results)
+	assert.Equal(t, 2, results[0].Book.ID)
+	assert.Equal(t, "<mark>Atomic</mark> <mark>Habits</mark>", highlight(searchCatalog[1].Title, tokenize("atomik habbits")))
+}
+
+func TestSearchBooks_Pagination(t *testing.T) {
+	results := searchBooks(searchCatalog, "habits", 1, 1)
+	assert.Len(t, results, 1)
+	assert.Equal(t, 2, results[0].Book.ID)
+
+	assert.Empty(t, searchBooks(searchCatalog, "habits", 10, 5))
+	assert.Empty(t, searchBooks(searchCatalog, "   ", 10, 0))
+	assert.Empty(t, searchBooks(searchCatalog, "zzzz", 10, 0))
+}
+
+func TestHighlight_TrimsLongText(t *testing.T) {
+	text := "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt " +
+		"ut labore et dolore magna aliqua. Spice must flow. Ut enim ad minim veniam, quis nostrud " +
+		"exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat."
+
+	snippet := highlight(text, []string{"spice"})
+	assert.Contains(t, snippet, "<mark>Spice</mark>")
+	assert.True(t, len(snippet) < len(text))
+	assert.Equal(t, "...", snippet[:3])
+}
+
+func TestHighlight_EscapesText(t *testing.T) {
+	snippet := highlight(`<script>alert("spice")</script> & spice`, []string{"spice"})
+	assert.Equal(t, `&lt;script&gt;alert(&#34;<mark>spice</mark>&#34;)&lt;/script&gt; &amp; <mark>spice</mark>`, snippet)
+}
+
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, similarity("habits", "habits"))
+	assert.GreaterOrEqual(t, similarity("habbits", "habits"), trigramThreshold)
+	assert.Less(t, similarity("dune", "habits"), trigramThreshold)
+}
@@ -0,0 +1,215 @@
+package database
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort")
+	ErrInvalidCursor = errors.New("cursor does not match the sort")
+)
+
+// SortField orders a listing by one field, rows with equal values keep ascending id order
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Cursor is the keyset position of the last row of a page: the values of its
+// sort fields in text form and its id. The next page starts after that row.
+type Cursor struct {
+	Keys []string
+	ID   int
+}
+
+// sortColumn is a whitelisted sort field of rows of type T
+type sortColumn[T any] struct {
+	// column is the SQL expression the field sorts by
+	column string
+	// value returns the field of a row as a string, int or time.Time
+	value func(T) any
+}
+
+// bookSortColumns are the fields book listings can be sorted by
+var bookSortColumns = map[string]sortColumn[Book]{
+	"title":          {column: "title", value: func(b Book) any { return b.Title }},
+	"published_date": {column: "published_date", value: func(b Book) any { return b.PublishedDate }},
+	"created_at":     {column: "created_at", value: func(b Book) any { return b.CreatedAt }},
+	"author_id":      {column: "author_id", value: func(b Book) any { return b.AuthorID }},
+	"category_id":    {column: "category_id", value: func(b Book) any { return b.CategoryID }},
+	"stock":          {column: "stock", value: func(b Book) any { return b.Stock }},
+}
+
+// BookSortable reports whether book listings can be sorted by field
+func BookSortable(field string) bool {
+	_, ok := bookSortColumns[field]
+	return ok
+}
+
+// BookCursor returns the cursor of the page after book in a listing sorted by sort
+func BookCursor(book Book, sort []SortField) Cursor {
+	return rowCursor(bookSortColumns, book, book.ID, sort)
+}
+
+// sortKey is a resolved sort field
+type sortKey[T any] struct {
+	sortColumn[T]
+	desc bool
+}
+
+// resolveSort looks the sort fields up in the whitelist
+func resolveSort[T any](columns map[string]sortColumn[T], sort []SortField) ([]sortKey[T], error) {
+	keys := make([]sortKey[T], 0, len(sort))
+	for _, field := range sort {
+		column, ok := columns[field.Field]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidSort, field.Field)
+		}
+		keys = append(keys, sortKey[T]{sortColumn: column, desc: field.Desc})
+	}
+	return keys, nil
+}
+
+func rowCursor[T any](columns map[string]sortColumn[T], row T, id int, sort []SortField) Cursor {
+	cursor := Cursor{Keys: make([]string, 0, len(sort)), ID: id}
+	for _, field := range sort {
+		if column, ok := columns[field.Field]; ok {
+			cursor.Keys = append(cursor.Keys, formatSortValue(column.value(row)))
+		}
+	}
+	return cursor
+}
+
+// orderByClause returns the ORDER BY list of a sort with id as the final tie-breaker
+func orderByClause[T any](keys []sortKey[T]) string {
+	terms := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		if key.desc {
+			terms = append(terms, key.column+" DESC")
+		} else {
+			terms = append(terms, key.column)
+		}
+	}
+	return strings.Join(append(terms, "id"), ", ")
+}
+
+// keysetClause returns the condition selecting the rows after the cursor.
+// Mixed directions rule out a row comparison, so the condition is expanded to
+// (a > $1) OR (a = $1 AND b < $2) OR (a = $1 AND b = $2 AND id > $3).
+func keysetClause[T any](keys []sortKey[T], values []any, id int, args []any) (string, []any) {
+	placeholders := make([]string, 0, len(values)+1)
+	for _, value := range values {
+		args = append(args, value)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	args = append(args, id)
+	placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+
+	columns := make([]string, 0, len(keys)+1)
+	operators := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		columns = append(columns, key.column)
+		if key.desc {
+			operators = append(operators, "<")
+		} else {
+			operators = append(operators, ">")
+		}
+	}
+	columns = append(columns, "id")
+	operators = append(operators, ">")
+
+	branches := make([]string, 0, len(columns))
+	for i := range columns {
+		terms := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			terms = append(terms, columns[j]+" = "+placeholders[j])
+		}
+		terms = append(terms, columns[i]+" "+operators[i]+" "+placeholders[i])
+		branches = append(branches, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(branches, " OR ") + ")", args
+}
+
+// cursorValues parses the keys of a cursor into values typed like the sort fields
+func cursorValues[T any](keys []sortKey[T], cursor Cursor) ([]any, error) {
+	if len(cursor.Keys) != len(keys) {
+		return nil, ErrInvalidCursor
+	}
+	var zero T
+	values := make([]any, 0, len(keys))
+	for i, key := range keys {
+		value, err := parseSortValue(key.value(zero), cursor.Keys[i])
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// rowValues returns the sort field values of a row
+func rowValues[T any](keys []sortKey[T], row T) []any {
+	values := make([]any, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, key.value(row))
+	}
+	return values
+}
+
+// compareKeyset orders a row against the position given by the sort field
+// values and id of another row
+func compareKeyset[T any](keys []sortKey[T], row T, id int, values []any, otherID int) int {
+	for i, key := range keys {
+		if c := compareSortValues(key.value(row), values[i]); c != 0 {
+			if key.desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return cmp.Compare(id, otherID)
+}
+
+// compareSortValues compares two values of the same sort field,
+// strings compare like the text columns of the database
+func compareSortValues(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		return compareText(a, b.(string))
+	case int:
+		return cmp.Compare(a, b.(int))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	}
+	panic(fmt.Sprintf("unsupported sort value %T", a))
+}
+
+func formatSortValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	panic(fmt.Sprintf("unsupported sort value %T", value))
+}
+
+// parseSortValue parses text into a value of the same type as like
+func parseSortValue(like any, text string) (any, error) {
+	switch like.(type) {
+	case string:
+		return text, nil
+	case int:
+		return strconv.Atoi(text)
+	case time.Time:
+		return time.Parse(time.RFC3339Nano, text)
+	}
+	return nil, fmt.Errorf("unsupported sort value %T", like)
+}
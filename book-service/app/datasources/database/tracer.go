@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"library/logging"
+	"library/tracing"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// slowQuery is how long a query may take before it is logged as a warning
+const slowQuery = 500 * time.Millisecond
+
+// queryTracer logs the queries run on the pool with the logger of their context,
+// so they carry the id of the request or the name of the job that ran them, and
+// runs every query in a span of the trace of its context
+type queryTracer struct {
+	slow time.Duration
+}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	sql  string
+	at   time.Time
+	span trace.Span
+}
+
+func (t queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, span := tracing.Start(ctx, queryOperation(data.SQL), trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.statement", data.SQL),
+		))
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: data.SQL, at: time.Now(), span: span})
+}
+
+func (t queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	tracing.RecordError(start.span, data.Err)
+	start.span.End()
+
+	elapsed := time.Since(start.at)
+	attrs := []slog.Attr{
+		slog.String("sql", start.sql),
+		slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if data.Err != nil {
+		attrs = append(attrs, slog.String("error", data.Err.Error()))
+	}
+	level := slog.LevelDebug
+	if elapsed >= t.slow {
+		level = slog.LevelWarn
+	}
+	logging.FromContext(ctx).LogAttrs(ctx, level, "query", attrs...)
+}
+
+// queryOperation names the span of a query after its first keyword, such as SELECT
+func queryOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToUpper(fields[0])
+}
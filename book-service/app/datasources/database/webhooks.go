@@ -0,0 +1,100 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+)
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook subscription not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrDeliveryNotDead  = errors.New("webhook delivery is not dead")
+)
+
+// WebhookSubscription is a partner endpoint notified of the events in EventTypes,
+// of every event if EventTypes is empty
+type WebhookSubscription struct {
+	ID         int       `db:"id"`
+	URL        string    `db:"url"`
+	Secret     string    `db:"secret"`
+	EventTypes []string  `db:"event_types"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+func (s WebhookSubscription) wants(eventType string) bool {
+	return len(s.EventTypes) == 0 || slices.Contains(s.EventTypes, eventType)
+}
+
+type NewWebhookSubscription struct {
+	URL        string
+	Secret     string
+	EventTypes []string
+}
+
+// WebhookDelivery is the delivery of one event to one subscription, Payload is the request body
+type WebhookDelivery struct {
+	ID             int64           `db:"id"`
+	SubscriptionID int             `db:"subscription_id"`
+	EventID        int64           `db:"event_id"`
+	EventType      string          `db:"event_type"`
+	Payload        json.RawMessage `db:"payload"`
+	Status         string          `db:"status"`
+	Attempts       int             `db:"attempts"`
+	ResponseStatus int             `db:"response_status"`
+	LastError      string          `db:"last_error"`
+	NextAttemptAt  *time.Time      `db:"next_attempt_at"`
+	CreatedAt      time.Time       `db:"created_at"`
+	DeliveredAt    *time.Time      `db:"delivered_at"`
+}
+
+// NewWebhookDelivery is an event to be delivered to every subscription wanting its type
+type NewWebhookDelivery struct {
+	EventID   int64
+	EventType string
+	Payload   json.RawMessage
+}
+
+// WebhookAttempt is the outcome of one delivery attempt. Status is DeliveryDelivered,
+// DeliveryPending to be tried again at NextAttemptAt, or DeliveryDead to give up.
+type WebhookAttempt struct {
+	Status         string
+	ResponseStatus int
+	Error          string
+	At             time.Time
+	NextAttemptAt  time.Time
+}
+
+// WebhookDeliveryFilter narrows the delivery log, zero fields match every delivery
+type WebhookDeliveryFilter struct {
+	SubscriptionID int
+	Status         string
+}
+
+func (f WebhookDeliveryFilter) matches(delivery WebhookDelivery) bool {
+	return (f.SubscriptionID == 0 || delivery.SubscriptionID == f.SubscriptionID) &&
+		(f.Status == "" || delivery.Status == f.Status)
+}
+
+// apply updates a delivery with the outcome of an attempt like the PostgreSQL UPDATE does
+func (a WebhookAttempt) apply(delivery *WebhookDelivery) {
+	delivery.Status = a.Status
+	delivery.Attempts++
+	delivery.ResponseStatus = a.ResponseStatus
+	delivery.LastError = a.Error
+	delivery.NextAttemptAt = nil
+	switch a.Status {
+	case DeliveryDelivered:
+		delivery.DeliveredAt = &a.At
+	case DeliveryPending:
+		delivery.NextAttemptAt = &a.NextAttemptAt
+	}
+}
@@ -0,0 +1,77 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"library/logging"
+)
+
+// Notifier kinds accepted by New
+const (
+	NotifierSMTP    = "smtp"
+	NotifierWebhook = "webhook"
+	NotifierLog     = "log"
+)
+
+// ErrNoRecipient is returned by notifiers that cannot reach a user without an address
+var ErrNoRecipient = errors.New("the user has no address to notify")
+
+// Message is a rendered notification for a user about one of their loans
+type Message struct {
+	Kind    string `json:"kind"`
+	UserID  int    `json:"user_id"`
+	Email   string `json:"email,omitempty"`
+	LoanID  int    `json:"loan_id"`
+	BookID  int    `json:"book_id"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier sends messages to users
+type Notifier interface {
+	Notify(ctx context.Context, message Message) error
+}
+
+// Config selects the notifier and how it reaches users
+type Config struct {
+	// Notifier is one of the Notifier constants
+	Notifier string
+	// URL is the webhook endpoint
+	URL string
+	// SMTPAddr is the host:port of the mail server, From the sender address
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+}
+
+// New creates the notifier described by config
+func New(config Config) (Notifier, error) {
+	switch config.Notifier {
+	case NotifierSMTP:
+		if config.SMTPAddr == "" || config.From == "" {
+			return nil, fmt.Errorf("the %s notifier needs a server address and a sender", config.Notifier)
+		}
+		return newSMTPNotifier(config), nil
+	case NotifierWebhook:
+		if config.URL == "" {
+			return nil, fmt.Errorf("the %s notifier needs a URL", config.Notifier)
+		}
+		return newWebhookNotifier(config.URL), nil
+	case NotifierLog:
+		return logNotifier{}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", config.Notifier)
+	}
+}
+
+// logNotifier writes messages to the log instead of sending them
+type logNotifier struct{}
+
+func (logNotifier) Notify(ctx context.Context, message Message) error {
+	logging.FromContext(ctx).Info("notification", "kind", message.Kind, "user", message.UserID, "loan", message.LoanID,
+		"subject", message.Subject)
+	return nil
+}
@@ -0,0 +1,140 @@
+package notifications
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var message = Message{
+	Kind:    "due_soon",
+	UserID:  5,
+	Email:   "reader@example.com",
+	LoanID:  4,
+	BookID:  2,
+	Subject: "Dune is due in 2 days",
+	Body:    "Please return Dune by Monday.\n.\nThanks",
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	notifier, err := New(Config{Notifier: NotifierWebhook, URL: server.URL})
+	require.NoError(t, err)
+	require.NoError(t, notifier.Notify(context.Background(), message))
+	assert.Equal(t, message, received)
+}
+
+func TestWebhookNotifier_Rejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := newWebhookNotifier(server.URL).Notify(context.Background(), message)
+	assert.ErrorContains(t, err, "notification webhook responded 400")
+}
+
+// fakeSMTP accepts one connection and sends the envelope and data of the mail it
+// received on the returned channel
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "220 fake ESMTP\r\n")
+
+		var mail strings.Builder
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				fmt.Fprint(conn, "250 fake\r\n")
+			case strings.HasPrefix(command, "MAIL"), strings.HasPrefix(command, "RCPT"):
+				mail.WriteString(strings.TrimSpace(line) + "\n")
+				fmt.Fprint(conn, "250 OK\r\n")
+			case command == "DATA":
+				fmt.Fprint(conn, "354 go ahead\r\n")
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					mail.WriteString(line)
+				}
+				fmt.Fprint(conn, "250 OK\r\n")
+			case command == "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				received <- mail.String()
+				return
+			default:
+				fmt.Fprint(conn, "502 not implemented\r\n")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, received := fakeSMTP(t)
+	notifier, err := New(Config{Notifier: NotifierSMTP, SMTPAddr: addr, From: "library@example.com"})
+	require.NoError(t, err)
+
+	require.NoError(t, notifier.Notify(context.Background(), message))
+
+	mail := <-received
+	assert.Contains(t, mail, "MAIL FROM:<library@example.com>")
+	assert.Contains(t, mail, "RCPT TO:<reader@example.com>")
+	assert.Contains(t, mail, "Subject: Dune is due in 2 days\r\n")
+	// lines starting with a dot are escaped by the client
+	assert.Contains(t, mail, "Please return Dune by Monday.\r\n..\r\nThanks")
+}
+
+func TestSMTPNotifier_NoRecipient(t *testing.T) {
+	notifier := newSMTPNotifier(Config{SMTPAddr: "127.0.0.1:25", From: "library@example.com"})
+	err := notifier.Notify(context.Background(), Message{UserID: 5})
+	assert.ErrorIs(t, err, ErrNoRecipient)
+}
+
+func TestNew(t *testing.T) {
+	notifier, err := New(Config{Notifier: NotifierLog})
+	require.NoError(t, err)
+	assert.NoError(t, notifier.Notify(context.Background(), message))
+
+	_, err = New(Config{Notifier: NotifierSMTP, SMTPAddr: "mail:25"})
+	assert.ErrorContains(t, err, "needs a server address and a sender")
+	_, err = New(Config{Notifier: NotifierWebhook})
+	assert.ErrorContains(t, err, "needs a URL")
+	_, err = New(Config{Notifier: "sms"})
+	assert.ErrorContains(t, err, `unknown notifier "sms"`)
+}
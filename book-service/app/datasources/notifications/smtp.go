@@ -0,0 +1,105 @@
+package notifications
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// smtpTimeout bounds sending a single mail
+const smtpTimeout = 30 * time.Second
+
+// smtpNotifier mails messages to the address in the user preferences. The connection
+// is upgraded with STARTTLS when the server offers it.
+type smtpNotifier struct {
+	addr   string
+	host   string
+	auth   smtp.Auth
+	from   string
+	dialer net.Dialer
+}
+
+func newSMTPNotifier(config Config) *smtpNotifier {
+	host, _, _ := net.SplitHostPort(config.SMTPAddr)
+	n := &smtpNotifier{addr: config.SMTPAddr, host: host, from: config.From}
+	if config.SMTPUsername != "" {
+		n.auth = smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, host)
+	}
+	return n
+}
+
+// Notify mails the message, users without an email address get ErrNoRecipient
+func (n *smtpNotifier) Notify(ctx context.Context, message Message) error {
+	if message.Email == "" {
+		return ErrNoRecipient
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	conn, err := n.dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the mail server: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to the mail server: %w", err)
+	}
+
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to the mail server: %w", err)
+	}
+	defer client.Close()
+
+	if err := n.send(client, message); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return client.Quit()
+}
+
+func (n *smtpNotifier) send(client *smtp.Client, message Message) error {
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if err := client.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(message.Email); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.compose(message)); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// compose formats a plain text mail
+func (n *smtpNotifier) compose(message Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", message.Email)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,50 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"library/tracing"
+)
+
+// webhookTimeout bounds a single notification
+const webhookTimeout = 10 * time.Second
+
+// webhookNotifier POSTs every message as JSON to a single URL, which is in charge
+// of reaching the user
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookNotifier(url string) *webhookNotifier {
+	return &webhookNotifier{url: url, client: &http.Client{Timeout: webhookTimeout, Transport: tracing.NewTransport(nil)}}
+}
+
+// Notify sends the message, any response other than 2xx is an error
+func (n *webhookNotifier) Notify(ctx context.Context, message Message) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call notification webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification webhook responded %d", resp.StatusCode)
+	}
+	return nil
+}
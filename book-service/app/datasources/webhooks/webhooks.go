@@ -0,0 +1,122 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"library/tracing"
+)
+
+// requestTimeout bounds a single delivery attempt
+const requestTimeout = 10 * time.Second
+
+// Headers sent with every delivery. The signature lets partners check a request
+// came from us, the delivery id stays the same across the retries of a delivery.
+const (
+	HeaderSignature  = "X-Webhook-Signature"
+	HeaderDeliveryID = "X-Webhook-Delivery"
+	HeaderEventID    = "X-Event-ID"
+	HeaderEventType  = "X-Event-Type"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the signature header of a body sent at t, in the form
+// t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<body>">.
+// Signing the timestamp lets receivers reject replayed requests.
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac(secret, timestamp, body))
+}
+
+// Verify checks a signature header against the body and rejects signatures
+// older than tolerance, a zero tolerance accepts any age
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, mac(secret, timestamp, body)) {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 && now.Sub(time.Unix(unix, 0)) > tolerance {
+		return fmt.Errorf("%w: signed too long ago", ErrInvalidSignature)
+	}
+	return nil
+}
+
+func mac(secret, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// Request is one delivery attempt of an event to a subscriber
+type Request struct {
+	URL        string
+	Secret     string
+	DeliveryID int64
+	EventID    int64
+	EventType  string
+	Body       []byte
+}
+
+// Client POSTs signed deliveries
+type Client struct {
+	http *http.Client
+	now  func() time.Time
+}
+
+func NewClient() *Client {
+	return &Client{http: &http.Client{Timeout: requestTimeout, Transport: tracing.NewTransport(nil)}, now: time.Now}
+}
+
+// Send delivers a request and returns the response status. Any response other
+// than 2xx is an error, the status is returned with it when there was a response.
+func (c *Client) Send(ctx context.Context, request Request) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, request.URL, bytes.NewReader(request.Body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderSignature, Sign(request.Secret, c.now(), request.Body))
+	req.Header.Set(HeaderDeliveryID, strconv.FormatInt(request.DeliveryID, 10))
+	req.Header.Set(HeaderEventID, strconv.FormatInt(request.EventID, 10))
+	req.Header.Set(HeaderEventType, request.EventType)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
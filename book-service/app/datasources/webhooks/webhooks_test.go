@@ -0,0 +1,71 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign(t *testing.T) {
+	// computed with: printf '1696161600.{"id":1}' | openssl dgst -sha256 -hmac secret
+	signature := Sign("secret", time.Unix(1696161600, 0), []byte(`{"id":1}`))
+	assert.Equal(t, "t=1696161600,v1=de93ba836da2fcf743fe59a407d4f4e9c1473e378fec4e971031713b2fc00bfd", signature)
+}
+
+func TestVerify(t *testing.T) {
+	signedAt := time.Unix(1696161600, 0)
+	body := []byte(`{"id":1}`)
+	header := Sign("secret", signedAt, body)
+
+	assert.NoError(t, Verify("secret", header, body, time.Minute, signedAt.Add(time.Second)))
+	assert.ErrorIs(t, Verify("other", header, body, 0, signedAt), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", header, []byte(`{"id":2}`), 0, signedAt), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", header, body, time.Minute, signedAt.Add(time.Hour)), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", "v1=abc", body, 0, signedAt), ErrInvalidSignature)
+}
+
+func TestClient_Send(t *testing.T) {
+	signedAt := time.Unix(1696161600, 0)
+	var (
+		header http.Header
+		body   []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.now = func() time.Time { return signedAt }
+	status, err := client.Send(context.Background(), Request{
+		URL: server.URL, Secret: "secret", DeliveryID: 7, EventID: 3, EventType: "book.created", Body: []byte(`{"id":3}`),
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, `{"id":3}`, string(body))
+	assert.Equal(t, "7", header.Get(HeaderDeliveryID))
+	assert.Equal(t, "3", header.Get(HeaderEventID))
+	assert.Equal(t, "book.created", header.Get(HeaderEventType))
+	assert.NoError(t, Verify("secret", header.Get(HeaderSignature), body, time.Minute, signedAt))
+}
+
+func TestClient_Send_Rejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	status, err := NewClient().Send(context.Background(), Request{URL: server.URL, Body: []byte(`{}`)})
+
+	assert.ErrorContains(t, err, "webhook responded 502")
+	assert.Equal(t, http.StatusBadGateway, status)
+}
@@ -2,24 +2,155 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"app/datasources"
 	"app/datasources/database"
+	"app/datasources/notifications"
+	"app/datasources/webhooks"
 	"app/server"
+	"app/server/domain"
+	"app/server/services"
+
+	"library/config"
+	"library/events"
+	"library/health"
+	"library/jobs"
+	"library/logging"
+	"library/tracing"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// relayBatchSize is how many outbox events the relay reads at a time
+const relayBatchSize = 100
+
 func main() {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	if err := run(); err != nil {
+		slog.Error("service failed", "error", err)
+		os.Exit(1)
+	}
+}
 
-	conf := NewConfiguration()
-	db, err := database.NewDatabase(ctx, conf.DatabaseURL)
+// run starts the service and blocks until it is asked to stop with SIGINT or SIGTERM.
+// It then stops taking new requests, lets the ones in flight finish, stops the
+// background jobs and only then releases the database.
+func run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	loader, err := config.NewLoader(os.Args[1:])
+	if err != nil {
+		return err
+	}
+	conf, err := NewConfiguration(loader)
 	if err != nil {
-		log.Fatalf("failed to create database: %v", err)
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	// --print-config shows the settings the service would run with, secrets redacted
+	if loader.PrintConfig() {
+		return loader.Print(os.Stdout)
+	}
+	slog.SetDefault(logging.New(os.Stdout, conf.LogLevel))
+
+	tracer, err := tracing.New(ctx, conf.Tracing)
+	if err != nil {
+		return fmt.Errorf("failed to create tracer: %w", err)
+	}
+	if tracer != nil {
+		tracing.SetDefault(tracer)
+		// the spans left are flushed, but an unreachable collector must not hold up the exit
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+			defer cancel()
+			if err := tracer.Shutdown(shutdownCtx); err != nil {
+				slog.Warn("failed to shut down tracer", "error", err)
+			}
+		}()
+	}
+
+	db, err := database.NewDatabase(ctx, conf.DatabaseURL, conf.Pool, conf.LoanPolicy)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
 	}
 	defer db.CloseConnections()
 
-	app := server.NewServer(ctx, &datasources.DataSources{DB: db})
-	log.Fatal(app.Listen(":" + conf.Port))
+	// events always reach the webhook subscriptions, the configured sink is optional
+	dispatcher := services.NewWebhookDispatcher(db, webhooks.NewClient(), conf.WebhookRetry)
+	sinks := []events.Sink{dispatcher}
+	if conf.Events.Sink != "" {
+		sink, err := events.NewSink(conf.Events)
+		if err != nil {
+			return fmt.Errorf("failed to create event sink: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	sink := events.Fanout(sinks...)
+	defer sink.Close()
+
+	var notifier notifications.Notifier
+	if conf.ReminderInterval > 0 {
+		notifier, err = notifications.New(conf.Notifier)
+		if err != nil {
+			return fmt.Errorf("failed to create notifier: %w", err)
+		}
+	}
+
+	// the jobs run until the server has drained, so requests in flight still see their effects,
+	// and are stopped and waited for before the deferred closes above run
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers jobs.Group
+	defer workers.Wait()
+	defer stopWorkers()
+
+	if conf.PurgeRetention > 0 && conf.PurgeInterval > 0 {
+		service := services.NewBooksService(db)
+		purgeCtx := domain.WithActor(workerCtx, domain.Actor{ID: "purge-job", Role: "system"})
+		workers.Go(purgeCtx, "purge books", conf.PurgeInterval, jobs.Purge(service.PurgeBooks, conf.PurgeRetention))
+	}
+	if conf.RelayInterval > 0 {
+		workers.Go(workerCtx, "relay events", conf.RelayInterval, events.Relay(outbox{db}, sink, relayBatchSize))
+	}
+	if conf.WebhookInterval > 0 {
+		workers.Go(workerCtx, "deliver webhooks", conf.WebhookInterval, dispatcher.Deliver)
+	}
+	if conf.ReminderInterval > 0 {
+		reminders := services.NewLoanReminders(db, notifier, conf.ReminderDueSoon)
+		workers.Go(workerCtx, "send loan reminders", conf.ReminderInterval, reminders.Send)
+	}
+
+	if err := services.RegisterLoanMetrics(prometheus.DefaultRegisterer, db); err != nil {
+		return fmt.Errorf("failed to register loan metrics: %w", err)
+	}
+	checker := health.NewChecker(conf.HealthTimeout)
+	checker.Add("database", db.Ping)
+	app := server.NewServer(ctx, &datasources.DataSources{DB: db}, checker, conf.Server)
+	return health.Serve(ctx, app, ":"+conf.Port, checker, conf.DrainDelay, conf.ShutdownTimeout)
+}
+
+// outbox hands the events written to the outbox of the database to the relay
+type outbox struct {
+	database.Database
+}
+
+func (o outbox) PendingEvents(ctx context.Context, limit int) ([]events.Event, error) {
+	records, err := o.Database.PendingEvents(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]events.Event, 0, len(records))
+	for _, record := range records {
+		pending = append(pending, events.Event{
+			ID:          record.ID,
+			Type:        record.Type,
+			AggregateID: record.AggregateID,
+			Payload:     record.Payload,
+			OccurredAt:  record.CreatedAt,
+		})
+	}
+	return pending, nil
 }
@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Entities recorded in the audit log
+const (
+	AuditEntityBook   = "book"
+	AuditEntityLoan   = "loan"
+	AuditEntityAuthor = "author"
+
+	AuditEntityWebhook         = "webhook"
+	AuditEntityWebhookDelivery = "webhook_delivery"
+
+	AuditEntityNotificationPreferences = "notification_preferences"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditActionCreate        = "create"
+	AuditActionImport        = "import"
+	AuditActionUpdate        = "update"
+	AuditActionDelete        = "delete"
+	AuditActionRestore       = "restore"
+	AuditActionPurge         = "purge"
+	AuditActionBorrow        = "borrow"
+	AuditActionReserve       = "reserve"
+	AuditActionReturn        = "return"
+	AuditActionUpdateStatus  = "update_status"
+	AuditActionReassignBooks = "reassign_books"
+	AuditActionRetry         = "retry"
+)
+
+// AuditEntry is a recorded write. Changes holds the fields the write changed,
+// EntityID is 0 for writes that span several entities such as an import.
+type AuditEntry struct {
+	ID        int64                  `json:"id"`
+	Actor     string                 `json:"actor"`
+	ActorRole string                 `json:"actor_role"`
+	Action    string                 `json:"action"`
+	Entity    string                 `json:"entity"`
+	EntityID  int                    `json:"entity_id"`
+	Changes   map[string]FieldChange `json:"changes"`
+	RequestID string                 `json:"request_id,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// FieldChange is the value of a field before and after a write,
+// Before is null for created fields and After for removed ones
+type FieldChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditQuery selects a page of the audit log, zero fields match every entry
+type AuditQuery struct {
+	Entity   string
+	EntityID int
+	Actor    string
+	Limit    int
+	Offset   int
+}
+
+// AuditResponse represents a page of the audit log, newest entries first
+type AuditResponse struct {
+	Entries []AuditEntry `json:"entries"`
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+}
+
+// Actor is the caller a write is attributed to, set by the API gateway.
+// Background jobs act as the system role.
+type Actor struct {
+	ID   string
+	Role string
+}
+
+type actorKey struct{}
+
+type requestIDKey struct{}
+
+// WithActor returns a copy of ctx carrying the caller of a request
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the caller carried by ctx, the zero Actor if there is none
+func ActorFromContext(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// WithRequestID returns a copy of ctx carrying the id of the request being served
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request id carried by ctx or ""
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,23 @@
+package domain
+
+// AuthorStats sums up the books of an author. TotalCopies counts the copies
+// on the shelf and on loan, lost copies are not counted.
+type AuthorStats struct {
+	AuthorID        int `json:"author_id"`
+	Titles          int `json:"titles"`
+	TotalCopies     int `json:"total_copies"`
+	AvailableCopies int `json:"available_copies"`
+	ActiveLoans     int `json:"active_loans"`
+}
+
+// ReassignRequest names the author that takes over the books of another
+type ReassignRequest struct {
+	ToAuthorID int `json:"to_author_id"`
+}
+
+// ReassignResult reports how many books moved from one author to another
+type ReassignResult struct {
+	FromAuthorID int `json:"from_author_id"`
+	ToAuthorID   int `json:"to_author_id"`
+	Reassigned   int `json:"reassigned"`
+}
@@ -1,18 +1,78 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
 type Book struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	ISBN        string    `json:"isbn"`
-	AuthorID    int       `json:"author_id"`
-	CategoryID  int       `json:"category_id"`
-	PublishDate time.Time `json:"publish_date"`
-	Description string    `json:"description"`
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	ISBN        string     `json:"isbn"`
+	ISBN10      string     `json:"isbn10,omitempty"`
+	AuthorID    int        `json:"author_id"`
+	CategoryID  int        `json:"category_id"`
+	PublishDate time.Time  `json:"publish_date"`
+	Description string     `json:"description"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
 }
 
-// BooksResponse represents a response containing a list of books
+// ValidateBook checks the fields every new book needs
+func ValidateBook(book Book, now time.Time) error {
+	if book.Title == "" {
+		return errors.New("title is required")
+	}
+	if book.PublishDate.IsZero() {
+		return errors.New("published date is required")
+	}
+	if book.PublishDate.After(now) {
+		return errors.New("published date cannot be in the future")
+	}
+	return nil
+}
+
+// BookFilter narrows the books listed or exported, zero fields match every book
+type BookFilter struct {
+	AuthorID   int
+	CategoryID int
+	// IncludeDeleted lists soft deleted books as well, it is only honoured for admins
+	IncludeDeleted bool
+}
+
+// BookQuery selects a page of books. Sort is a ParseSort list, After is the
+// next_cursor of the previous page listed with the same sort.
+type BookQuery struct {
+	Filter BookFilter
+	Sort   string
+	After  string
+	Limit  int
+}
+
+// BooksResponse represents a page of books, NextCursor is empty on the last page
 type BooksResponse struct {
-	Books []Book `json:"books"`
+	Books      []Book `json:"books"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// BookSearchHit is a book matched by a search with its relevance score
+// and an HTML escaped description fragment with the matching words wrapped in <mark> tags
+type BookSearchHit struct {
+	Book    Book    `json:"book"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+// BookSearchResponse represents a page of search results ordered by relevance
+type BookSearchResponse struct {
+	Query   string          `json:"query"`
+	Results []BookSearchHit `json:"results"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+}
+
+// LoanRequest identifies the user borrowing or returning a book, the authenticated caller
+// when UserID is zero. Only admins may name another user. The role deciding the loan limit
+// is never taken from the request body, it is the one of the borrower.
+type LoanRequest struct {
+	UserID int `json:"user_id"`
 }
@@ -1,6 +1,42 @@
 package domain
 
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrBookNotFound     = errors.New("book not found")
+	ErrBookNotAvailable = errors.New("book is not available")
+	ErrDuplicateISBN    = errors.New("a book with this isbn already exists")
+	ErrBookOnLoan       = errors.New("book has active loans")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+	ErrInvalidReassign  = errors.New("books must be reassigned to another author")
+
+	ErrLoanNotFound          = errors.New("loan not found")
+	ErrInvalidLoanTransition = errors.New("invalid loan status change")
+	ErrMissingUser           = errors.New("user id is required")
+	ErrNotLoanOwner          = errors.New("only admins may lend and return books for other users")
+)
+
 // ErrorResponse is a struct that represents an error response
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
+
+// RuleViolationResponse is returned when a borrow or renewal request breaks a loan rule
+type RuleViolationResponse struct {
+	Error  string `json:"error"`
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+// LoanRuleError reports which loan rule rejected a borrow or renewal request and why
+type LoanRuleError struct {
+	Rule   string
+	Reason string
+}
+
+func (e *LoanRuleError) Error() string {
+	return fmt.Sprintf("loan rule %s violated: %s", e.Rule, e.Reason)
+}
@@ -0,0 +1,12 @@
+package domain
+
+import "errors"
+
+// Formats the catalog can be exported in
+const (
+	ExportFormatCSV   = "csv"
+	ExportFormatJSONL = "jsonl"
+	ExportFormatXML   = "xml"
+)
+
+var ErrUnsupportedExportFormat = errors.New("unsupported export format, use csv, jsonl or xml")
@@ -0,0 +1,53 @@
+package domain
+
+import "errors"
+
+// Formats accepted by the catalog import
+const (
+	ImportFormatCSV   = "csv"
+	ImportFormatJSONL = "jsonl"
+)
+
+// Outcomes of an imported row
+const (
+	ImportRowCreated = "created"
+	ImportRowSkipped = "skipped"
+	ImportRowInvalid = "invalid"
+)
+
+var ErrUnsupportedImportFormat = errors.New("unsupported import format, use csv or jsonl")
+
+// ImportError reports an import body that cannot be read as a whole, like a CSV header
+// without a title column. Rows that are invalid on their own are reported in the
+// ImportReport instead.
+type ImportError struct {
+	Err error
+}
+
+func (e *ImportError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// ImportRow reports what happened to one row of an import,
+// Line is the line the row starts on counting the CSV header
+type ImportRow struct {
+	Line   int    `json:"line"`
+	Status string `json:"status"`
+	Title  string `json:"title,omitempty"`
+	ISBN   string `json:"isbn,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportReport summarizes an import, in a dry run the created rows are
+// the ones that would have been created
+type ImportReport struct {
+	DryRun  bool        `json:"dry_run"`
+	Created int         `json:"created"`
+	Skipped int         `json:"skipped"`
+	Invalid int         `json:"invalid"`
+	Rows    []ImportRow `json:"rows"`
+}
@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// isbn13Prefix is the Bookland prefix every ISBN-10 maps to
+const isbn13Prefix = "978"
+
+var ErrInvalidISBN = errors.New("invalid isbn")
+
+// NormalizeISBN parses an ISBN-10 or ISBN-13, with or without hyphens and spaces,
+// verifies its check digit and prefix and returns it as an unhyphenated ISBN-13
+func NormalizeISBN(isbn string) (string, error) {
+	digits := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(isbn)))
+	switch len(digits) {
+	case 10:
+		return ISBN10To13(digits)
+	case 13:
+		if !validISBN13(digits) {
+			return "", fmt.Errorf("%w: %q has a wrong check digit", ErrInvalidISBN, isbn)
+		}
+		// other EAN-13 prefixes are valid barcodes but no ISBNs, e.g. 977 is for periodicals
+		if !strings.HasPrefix(digits, "978") && !strings.HasPrefix(digits, "979") {
+			return "", fmt.Errorf("%w: %q does not start with 978 or 979", ErrInvalidISBN, isbn)
+		}
+		return digits, nil
+	}
+	return "", fmt.Errorf("%w: %q must have 10 or 13 digits", ErrInvalidISBN, isbn)
+}
+
+// ISBN10To13 converts an unhyphenated ISBN-10 to its ISBN-13 form
+func ISBN10To13(isbn10 string) (string, error) {
+	if !validISBN10(isbn10) {
+		return "", fmt.Errorf("%w: %q is not a valid ISBN-10", ErrInvalidISBN, isbn10)
+	}
+	body := isbn13Prefix + isbn10[:9]
+	return body + string(isbn13CheckDigit(body)), nil
+}
+
+// ISBN13To10 converts an unhyphenated ISBN-13 to its ISBN-10 form,
+// only ISBNs with the 978 prefix have one
+func ISBN13To10(isbn13 string) (string, error) {
+	if !validISBN13(isbn13) {
+		return "", fmt.Errorf("%w: %q is not a valid ISBN-13", ErrInvalidISBN, isbn13)
+	}
+	if !strings.HasPrefix(isbn13, isbn13Prefix) {
+		return "", fmt.Errorf("%w: %q has no ISBN-10 form", ErrInvalidISBN, isbn13)
+	}
+	body := isbn13[3:12]
+	return body + string(isbn10CheckDigit(body)), nil
+}
+
+func validISBN10(isbn string) bool {
+	if len(isbn) != 10 || !allDigits(isbn[:9]) {
+		return false
+	}
+	return isbn[9] == isbn10CheckDigit(isbn[:9])
+}
+
+func validISBN13(isbn string) bool {
+	if len(isbn) != 13 || !allDigits(isbn) {
+		return false
+	}
+	return isbn[12] == isbn13CheckDigit(isbn[:12])
+}
+
+// isbn10CheckDigit weights the nine digits 10 down to 2, the check digit
+// brings the sum to a multiple of 11 and is X for 10
+func isbn10CheckDigit(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// isbn13CheckDigit weights the twelve digits alternately 1 and 3,
+// the check digit brings the sum to a multiple of 10
+func isbn13CheckDigit(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(body[i]-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
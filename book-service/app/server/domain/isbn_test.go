@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"9780735211292", "9780735211292"},
+		{"978-0-7352-1129-2", "9780735211292"},
+		{"0735211299", "9780735211292"},
+		{"0-7352-1129-9", "9780735211292"},
+		{" 080442957x ", "9780804429573"},
+		{"979-10-90636-07-1", "9791090636071"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := NormalizeISBN(tt.input)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNormalizeISBN_Invalid(t *testing.T) {
+	for _, input := range []string{"", "12345", "9780735211293", "0735211298", "97807352112AB", "X735211299"} {
+		t.Run(input, func(t *testing.T) {
+			_, err := NormalizeISBN(input)
+			assert.ErrorIs(t, err, ErrInvalidISBN)
+		})
+	}
+}
+
+func TestNormalizeISBN_NotBookland(t *testing.T) {
+	// both have a correct check digit but neither the 978 nor the 979 prefix
+	for _, input := range []string{"9771234567898", "1234567890128"} {
+		t.Run(input, func(t *testing.T) {
+			_, err := NormalizeISBN(input)
+			assert.ErrorIs(t, err, ErrInvalidISBN)
+		})
+	}
+}
+
+func TestISBN13To10(t *testing.T) {
+	isbn10, err := ISBN13To10("9780804429573")
+	assert.Nil(t, err)
+	assert.Equal(t, "080442957X", isbn10)
+
+	_, err = ISBN13To10("9791090636071")
+	assert.ErrorIs(t, err, ErrInvalidISBN)
+}
@@ -0,0 +1,45 @@
+package domain
+
+import "time"
+
+// Loan states accepted by the status filter of the loan listings
+const (
+	LoanStateCurrent  = "current"
+	LoanStateReturned = "returned"
+	LoanStateOverdue  = "overdue"
+	LoanStateLost     = "lost"
+)
+
+// Loan represents a book borrowed by a user
+type Loan struct {
+	ID         int        `json:"id"`
+	BookID     int        `json:"book_id"`
+	UserID     int        `json:"user_id"`
+	BorrowedAt time.Time  `json:"borrowed_at"`
+	DueDate    time.Time  `json:"due_date"`
+	ReturnedAt *time.Time `json:"returned_at,omitempty"`
+	Status     string     `json:"status"`
+	Renewals   int        `json:"renewals"`
+}
+
+// LoanStatusRequest changes the status of a loan, one of
+// reserved, borrowed, renewed, overdue, returned or lost
+type LoanStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// LoanQuery selects a page of loans for a user or a book
+type LoanQuery struct {
+	UserID int
+	BookID int
+	State  string
+	Limit  int
+	Offset int
+}
+
+// LoansResponse represents a page of loans
+type LoansResponse struct {
+	Loans  []Loan `json:"loans"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"errors"
+	"net/mail"
+	"time"
+)
+
+// NotificationPreferences are the loan notifications a user wants. Due soon reminders
+// go out before a loan is due, overdue notices once it is past due. Mail notifications
+// need an Email.
+type NotificationPreferences struct {
+	UserID    int        `json:"user_id"`
+	Email     string     `json:"email"`
+	DueSoon   bool       `json:"due_soon"`
+	Overdue   bool       `json:"overdue"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// ValidateNotificationPreferences checks the email address, which may be empty
+func ValidateNotificationPreferences(preferences NotificationPreferences) error {
+	if preferences.Email == "" {
+		return nil
+	}
+	address, err := mail.ParseAddress(preferences.Email)
+	if err != nil || address.Address != preferences.Email {
+		return errors.New("email must be a plain email address")
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package domain
+
+// ScoreBreakdown shows how each signal contributed to a recommendation,
+// every part is normalized to 0..1 and Total is their weighted sum
+type ScoreBreakdown struct {
+	Search   float64 `json:"search"`
+	Graph    float64 `json:"graph"`
+	Author   float64 `json:"author"`
+	Category float64 `json:"category"`
+	Total    float64 `json:"total"`
+}
+
+// Recommendation is a book recommended for a query
+type Recommendation struct {
+	Book      Book           `json:"book"`
+	Score     float64        `json:"score"`
+	Breakdown ScoreBreakdown `json:"breakdown"`
+}
+
+// RecommendationsResponse represents the recommendations for a query ordered by score
+type RecommendationsResponse struct {
+	Query           string           `json:"query"`
+	Recommendations []Recommendation `json:"recommendations"`
+}
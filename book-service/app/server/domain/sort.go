@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidSort = errors.New("invalid sort")
+
+// SortField orders a listing by one field, Desc reverses its order
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ParseSort parses a comma separated list of fields like "-published_date,title",
+// a leading - sorts that field descending. sortable decides which fields are allowed.
+func ParseSort(value string, sortable func(field string) bool) ([]SortField, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var (
+		fields []SortField
+		seen   = make(map[string]bool)
+	)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		field := SortField{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if field.Field == "" {
+			return nil, fmt.Errorf("%w: empty field in %q", ErrInvalidSort, value)
+		}
+		if !sortable(field.Field) {
+			return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidSort, field.Field)
+		}
+		if seen[field.Field] {
+			return nil, fmt.Errorf("%w: %q is listed twice", ErrInvalidSort, field.Field)
+		}
+		seen[field.Field] = true
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// FormatSort is the inverse of ParseSort
+func FormatSort(fields []SortField) string {
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field.Desc {
+			parts = append(parts, "-"+field.Field)
+		} else {
+			parts = append(parts, field.Field)
+		}
+	}
+	return strings.Join(parts, ",")
+}
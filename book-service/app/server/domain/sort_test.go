@@ -0,0 +1,25 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSort(t *testing.T) {
+	sortable := func(field string) bool { return field == "title" || field == "published_date" }
+
+	fields, err := ParseSort("-published_date, title", sortable)
+	assert.Nil(t, err)
+	assert.Equal(t, []SortField{{Field: "published_date", Desc: true}, {Field: "title"}}, fields)
+	assert.Equal(t, "-published_date,title", FormatSort(fields))
+
+	fields, err = ParseSort("", sortable)
+	assert.Nil(t, err)
+	assert.Empty(t, fields)
+
+	for _, value := range []string{"isbn", "title,", "-", "title,-title"} {
+		_, err := ParseSort(value, sortable)
+		assert.ErrorIs(t, err, ErrInvalidSort, value)
+	}
+}
@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// WebhookEventTypes are the events partners can subscribe to
+var WebhookEventTypes = []string{
+	"book.created",
+	"book.updated",
+	"book.borrowed",
+	"book.reserved",
+	"book.returned",
+	"book.renewed",
+	"book.overdue",
+	"book.lost",
+	"book.deleted",
+	"book.restored",
+	"book.purged",
+}
+
+// Webhook delivery states, a delivery is dead once it failed every attempt
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusDead      = "dead"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	// ErrDeliveryNotDead is returned when retrying a delivery that has not given up
+	ErrDeliveryNotDead = errors.New("only dead deliveries can be retried")
+)
+
+// WebhookSubscription is a partner endpoint notified of events. An empty EventTypes
+// receives every event. Secret is only returned when the subscription is created.
+type WebhookSubscription struct {
+	ID         int       `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ValidateWebhookSubscription checks the URL and event types of a new subscription
+func ValidateWebhookSubscription(subscription WebhookSubscription) error {
+	parsed, err := url.Parse(subscription.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	for _, eventType := range subscription.EventTypes {
+		if !slices.Contains(WebhookEventTypes, eventType) {
+			return fmt.Errorf("unknown event type %q", eventType)
+		}
+	}
+	return nil
+}
+
+// WebhookDelivery is the delivery of one event to one subscription. NextAttemptAt
+// is when a pending delivery is tried again, LastError and ResponseStatus describe
+// the latest failed attempt.
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	SubscriptionID int        `json:"subscription_id"`
+	EventID        int64      `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// WebhookDeliveryQuery selects a page of the deliveries of a subscription, newest first.
+// An empty Status matches every delivery.
+type WebhookDeliveryQuery struct {
+	SubscriptionID int
+	Status         string
+	Limit          int
+	Offset         int
+}
+
+// WebhookDeliveriesResponse represents a page of webhook deliveries
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Limit      int               `json:"limit"`
+	Offset     int               `json:"offset"`
+}
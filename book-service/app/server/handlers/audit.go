@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"app/server/domain"
+	"app/server/services"
+
+	"library/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetAuditLog returns a handler function that lists the audit log newest first,
+// narrowed by the entity, entity_id and actor parameters
+func GetAuditLog(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		limit, offset, err := parsePage(c)
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err.Error())
+		}
+		entityID := c.QueryInt("entity_id")
+		if entityID < 0 {
+			return sendError(c, fiber.StatusBadRequest, "entity_id must not be negative")
+		}
+
+		entries, err := service.GetAuditLog(c.UserContext(), domain.AuditQuery{
+			Entity:   c.Query("entity"),
+			EntityID: entityID,
+			Actor:    c.Query("actor"),
+			Limit:    limit,
+			Offset:   offset,
+		})
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("GetAuditLog failed", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+
+		return c.JSON(domain.AuditResponse{Entries: entries, Limit: limit, Offset: offset})
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"app/server/domain"
+	"app/server/services"
+
+	"library/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetAuditLog(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetAuditLog", mock.Anything, domain.AuditQuery{Entity: "book", Actor: "42", Limit: 5, Offset: 10}).
+		Return([]domain.AuditEntry{{ID: 3, Actor: "42", Action: "delete", Entity: "book", EntityID: 1}}, nil)
+
+	app := fiber.New()
+	app.Get("/api/v1/audit", middleware.RequireRole("admin"), GetAuditLog(mockService))
+
+	req := httptest.NewRequest("GET", "/api/v1/audit?entity=book&actor=42&limit=5&offset=10", nil)
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	req.Header.Set(middleware.HeaderUserRole, "admin")
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body := bodyFromResponse[domain.AuditResponse](t, resp)
+	assert.Len(t, body.Entries, 1)
+	assert.Equal(t, "delete", body.Entries[0].Action)
+	assert.Equal(t, 5, body.Limit)
+}
+
+func TestGetAuditLog_InvalidQuery(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+
+	app := fiber.New()
+	app.Get("/api/v1/audit", GetAuditLog(mockService))
+
+	for _, url := range []string{"/api/v1/audit?limit=0", "/api/v1/audit?entity_id=-1"} {
+		resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+		assert.Nil(t, err)
+		assert.Equal(t, 400, resp.StatusCode, url)
+	}
+}
+
+func TestWithActor(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("DeleteBook", mock.MatchedBy(func(ctx context.Context) bool {
+		return domain.ActorFromContext(ctx) == domain.Actor{ID: "42", Role: "admin"} &&
+			domain.RequestIDFromContext(ctx) == "req-1"
+	}), 1).Return(nil)
+
+	app := fiber.New()
+	app.Delete("/api/v1/books/:id", WithActor(), DeleteBook(mockService))
+
+	req := httptest.NewRequest("DELETE", "/api/v1/books/1", nil)
+	req.Header.Set(middleware.HeaderUserID, "42")
+	req.Header.Set(middleware.HeaderUserRole, "admin")
+	req.Header.Set(middleware.HeaderRequestID, "req-1")
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 204, resp.StatusCode)
+	mockService.AssertExpectations(t)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+
+	"app/server/domain"
+	"app/server/services"
+
+	"library/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetAuthorBooks returns a handler function that lists a page of the books of an author,
+// it takes the same sort, after and limit parameters as GetBooks
+func GetAuthorBooks(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authorID, err := c.ParamsInt("id")
+		if err != nil || authorID < 1 {
+			return sendError(c, fiber.StatusBadRequest, "invalid author id")
+		}
+		return listBooks(c, service, "GetAuthorBooks", domain.BookFilter{AuthorID: authorID})
+	}
+}
+
+// GetAuthorStats returns a handler function that counts the titles, copies and active loans of an author
+func GetAuthorStats(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authorID, err := c.ParamsInt("id")
+		if err != nil || authorID < 1 {
+			return sendError(c, fiber.StatusBadRequest, "invalid author id")
+		}
+
+		stats, err := service.GetAuthorStats(c.UserContext(), authorID)
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("GetAuthorStats failed", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+
+		return c.JSON(stats)
+	}
+}
+
+// ReassignAuthorBooks returns a handler function that moves every book of an author
+// to the author named by to_author_id in the body
+func ReassignAuthorBooks(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authorID, err := c.ParamsInt("id")
+		if err != nil || authorID < 1 {
+			return sendError(c, fiber.StatusBadRequest, "invalid author id")
+		}
+		var request domain.ReassignRequest
+		if err := c.BodyParser(&request); err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid request")
+		}
+
+		result, err := service.ReassignAuthorBooks(c.UserContext(), authorID, request.ToAuthorID)
+		if errors.Is(err, domain.ErrInvalidReassign) {
+			return sendError(c, fiber.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("ReassignAuthorBooks failed", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+
+		return c.JSON(result)
+	}
+}
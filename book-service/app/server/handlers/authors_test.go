@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"app/server/domain"
+	"app/server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var authorRoute = "/api/v1/authors/:id"
+
+func TestGetAuthorBooks(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetBooks", mock.Anything, domain.BookQuery{
+		Filter: domain.BookFilter{AuthorID: 7},
+		Sort:   "-published_date",
+		Limit:  5,
+	}).Return(domain.BooksResponse{Books: []domain.Book{{Title: "Title", AuthorID: 7}}}, nil)
+
+	app := fiber.New()
+	app.Get(authorRoute+"/books", GetAuthorBooks(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/v1/authors/7/books?sort=-published_date&limit=5", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body := bodyFromResponse[domain.BooksResponse](t, resp)
+	assert.Len(t, body.Books, 1)
+}
+
+func TestGetAuthorBooks_InvalidID(t *testing.T) {
+	app := fiber.New()
+	app.Get(authorRoute+"/books", GetAuthorBooks(new(services.BooksServiceMock)))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/v1/authors/abc/books", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestGetAuthorStats(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetAuthorStats", mock.Anything, 7).
+		Return(domain.AuthorStats{AuthorID: 7, Titles: 3, TotalCopies: 12, AvailableCopies: 10, ActiveLoans: 2}, nil)
+
+	app := fiber.New()
+	app.Get(authorRoute+"/stats", GetAuthorStats(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/v1/authors/7/stats", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body := bodyFromResponse[domain.AuthorStats](t, resp)
+	assert.Equal(t, 12, body.TotalCopies)
+	assert.Equal(t, 2, body.ActiveLoans)
+}
+
+func TestGetAuthorStats_ServiceFails(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetAuthorStats", mock.Anything, 7).Return(domain.AuthorStats{}, assert.AnError)
+
+	app := fiber.New()
+	app.Get(authorRoute+"/stats", GetAuthorStats(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/v1/authors/7/stats", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+}
+
+func TestReassignAuthorBooks(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("ReassignAuthorBooks", mock.Anything, 7, 9).
+		Return(domain.ReassignResult{FromAuthorID: 7, ToAuthorID: 9, Reassigned: 3}, nil)
+	mockService.On("ReassignAuthorBooks", mock.Anything, 7, 7).Return(domain.ReassignResult{}, domain.ErrInvalidReassign)
+
+	app := fiber.New()
+	app.Post(authorRoute+"/books/reassign", ReassignAuthorBooks(mockService))
+
+	req := httptest.NewRequest("POST", "/api/v1/authors/7/books/reassign", strings.NewReader(`{"to_author_id":9}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 3, bodyFromResponse[domain.ReassignResult](t, resp).Reassigned)
+
+	req = httptest.NewRequest("POST", "/api/v1/authors/7/books/reassign", strings.NewReader(`{"to_author_id":7}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
@@ -1,27 +1,179 @@
 package handlers
 
 import (
-	"log/slog"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"strconv"
+	"strings"
 	"time"
 
 	"app/server/domain"
 	"app/server/services"
 
+	"library/logging"
+	"library/middleware"
+
 	"github.com/gofiber/fiber/v2"
 )
 
-// GetBooks returns a handler function that retrieves all books
+// GetBooks returns a handler function that lists a page of books,
+// the after parameter takes the next_cursor of the previous page
 func GetBooks(service services.BooksService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		books, err := service.GetBooks(c.UserContext())
+		filter, err := parseBookFilter(c)
+		if err != nil {
+			return filterError(c, err)
+		}
+		return listBooks(c, service, "GetBooks", filter)
+	}
+}
+
+// listBooks responds with the page of books matching filter
+// selected by the sort, after and limit parameters
+func listBooks(c *fiber.Ctx, service services.BooksService, op string, filter domain.BookFilter) error {
+	limit := c.QueryInt("limit", defaultPageLimit)
+	if limit < 1 || limit > maxPageLimit {
+		return sendError(c, fiber.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxPageLimit))
+	}
+
+	response, err := service.GetBooks(c.UserContext(), domain.BookQuery{
+		Filter: filter,
+		Sort:   c.Query("sort"),
+		After:  c.Query("after"),
+		Limit:  limit,
+	})
+	if errors.Is(err, domain.ErrInvalidCursor) {
+		return sendError(c, fiber.StatusBadRequest, domain.ErrInvalidCursor.Error())
+	}
+	if errors.Is(err, domain.ErrInvalidSort) {
+		return sendError(c, fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error(op+" failed", "error", err)
+		return sendError(c, fiber.StatusInternalServerError, "internal error")
+	}
+
+	return c.JSON(response)
+}
+
+// ExportBooks returns a handler function that streams the books matching the list
+// filters in the list sort as csv, jsonl or xml, chosen by the format parameter
+func ExportBooks(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		format := c.Query("format", domain.ExportFormatCSV)
+		contentType, ok := exportContentTypes[format]
+		if !ok {
+			return sendError(c, fiber.StatusBadRequest, domain.ErrUnsupportedExportFormat.Error())
+		}
+		filter, err := parseBookFilter(c)
+		if err != nil {
+			return filterError(c, err)
+		}
+		// checked before the response starts, a stream cannot turn into a 400
+		sort, err := services.ParseBookSort(c.Query("sort"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err.Error())
+		}
+
+		// the stream writer runs after the handler returns, so it must not touch c
+		ctx := c.UserContext()
+		c.Attachment("books." + format)
+		c.Set(fiber.HeaderContentType, contentType)
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			if err := service.ExportBooks(ctx, filter, sort, format, w); err != nil {
+				logging.FromContext(ctx).Error("ExportBooks failed", "error", err)
+			}
+			if err := w.Flush(); err != nil {
+				logging.FromContext(ctx).Warn("ExportBooks flush failed", "error", err)
+			}
+		})
+		return nil
+	}
+}
+
+var exportContentTypes = map[string]string{
+	domain.ExportFormatCSV:   "text/csv; charset=utf-8",
+	domain.ExportFormatJSONL: "application/x-ndjson",
+	domain.ExportFormatXML:   fiber.MIMEApplicationXMLCharsetUTF8,
+}
+
+// errAdminOnly rejects the include_deleted parameter for callers that are not admins
+var errAdminOnly = errors.New("include_deleted is only allowed for admins")
+
+// parseBookFilter reads the author_id, category_id and include_deleted query parameters
+func parseBookFilter(c *fiber.Ctx) (domain.BookFilter, error) {
+	filter := domain.BookFilter{
+		AuthorID:       c.QueryInt("author_id"),
+		CategoryID:     c.QueryInt("category_id"),
+		IncludeDeleted: c.QueryBool("include_deleted"),
+	}
+	if filter.AuthorID < 0 || filter.CategoryID < 0 {
+		return domain.BookFilter{}, errors.New("author_id and category_id must not be negative")
+	}
+	if filter.IncludeDeleted && c.Get(middleware.HeaderUserRole) != "admin" {
+		return domain.BookFilter{}, errAdminOnly
+	}
+	return filter, nil
+}
+
+// filterError responds to a parseBookFilter error
+func filterError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errAdminOnly) {
+		return sendError(c, fiber.StatusForbidden, err.Error())
+	}
+	return sendError(c, fiber.StatusBadRequest, err.Error())
+}
+
+// SearchBooks returns a handler function that ranks books by relevance to the q parameter
+func SearchBooks(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		query := strings.TrimSpace(c.Query("q"))
+		if query == "" {
+			return sendError(c, fiber.StatusBadRequest, "q is required")
+		}
+		limit, offset, err := parsePage(c)
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err.Error())
+		}
+
+		hits, err := service.SearchBooks(c.UserContext(), query, limit, offset)
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("SearchBooks failed", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+
+		return c.JSON(domain.BookSearchResponse{
+			Query:   query,
+			Results: hits,
+			Limit:   limit,
+			Offset:  offset,
+		})
+	}
+}
+
+// RecommendBooks returns a handler function that recommends books for the q parameter
+func RecommendBooks(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		query := strings.TrimSpace(c.Query("q"))
+		if query == "" {
+			return sendError(c, fiber.StatusBadRequest, "q is required")
+		}
+		limit, _, err := parsePage(c)
 		if err != nil {
-			slog.Error("GetBooks failed", "error", err)
+			return sendError(c, fiber.StatusBadRequest, err.Error())
+		}
+
+		recommendations, err := service.RecommendBooks(c.UserContext(), query, limit)
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("RecommendBooks failed", "error", err)
 			return sendError(c, fiber.StatusInternalServerError, "internal error")
 		}
 
-		return c.JSON(domain.BooksResponse{
-			Books: books,
+		return c.JSON(domain.RecommendationsResponse{
+			Query:           query,
+			Recommendations: recommendations,
 		})
 	}
 }
@@ -34,7 +186,25 @@ func GetBook(service services.BooksService) fiber.Handler {
 
 		book, err := service.GetBook(c.UserContext(), id)
 		if err != nil {
-			slog.Error("GetBook failed", "error", err)
+			logging.FromContext(c.UserContext()).Error("GetBook failed", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+
+		return c.JSON(book)
+	}
+}
+
+// GetBookByISBN returns a handler function that looks a book up by its ISBN-10 or ISBN-13
+func GetBookByISBN(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		book, err := service.GetBookByISBN(c.UserContext(), c.Params("isbn"))
+		switch {
+		case errors.Is(err, domain.ErrInvalidISBN):
+			return sendError(c, fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrBookNotFound):
+			return sendError(c, fiber.StatusNotFound, "book not found")
+		case err != nil:
+			logging.FromContext(c.UserContext()).Error("GetBookByISBN failed", "error", err)
 			return sendError(c, fiber.StatusInternalServerError, "internal error")
 		}
 
@@ -47,65 +217,227 @@ func AddBook(service services.BooksService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		var book domain.Book
 		if err := c.BodyParser(&book); err != nil {
-			slog.Warn("AddBook request parsing failed", "error", err)
+			logging.FromContext(c.UserContext()).Warn("AddBook request parsing failed", "error", err)
 			return sendError(c, fiber.StatusBadRequest, "invalid request")
 		}
 
-		if book.Title == "" {
-			return sendError(c, fiber.StatusBadRequest, "title is required")
-		}
-
-		if book.PublishDate.IsZero() {
-			return sendError(c, fiber.StatusBadRequest, "published date is required")
-		}
-		if book.PublishDate.After(time.Now()) {
-			return sendError(c, fiber.StatusBadRequest, "published date cannot be in the future")
+		if err := domain.ValidateBook(book, time.Now()); err != nil {
+			return sendError(c, fiber.StatusBadRequest, err.Error())
 		}
 
 		err := service.SaveBook(c.UserContext(), book)
 		if err != nil {
-			slog.Error("AddBook failed", "error", err)
-			return sendError(c, fiber.StatusInternalServerError, "internal error")
+			return bookWriteError(c, "AddBook", err)
 		}
 		return c.SendStatus(fiber.StatusCreated)
 	}
 }
 
-// DeleteBook
-func DeleteBook(service services.BooksService) fiber.Handler {
+// ImportBooks returns a handler function that adds the books in a CSV or JSON Lines body
+// and reports the outcome of every row, dry_run=true only validates them
+func ImportBooks(service services.BooksService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		var book domain.Book
-		if err := c.BodyParser(&book); err != nil {
-			slog.Warn("DeleteBook request parsing failed", "error", err)
-			return sendError(c, fiber.StatusBadRequest, "invalid request")
+		format := importFormat(c)
+		if format == "" {
+			return sendError(c, fiber.StatusBadRequest, domain.ErrUnsupportedImportFormat.Error())
+		}
+
+		report, err := service.ImportBooks(c.UserContext(), format, bytes.NewReader(c.Body()), c.QueryBool("dry_run"))
+		var importErr *domain.ImportError
+		switch {
+		case err == nil:
+			return c.JSON(report)
+		case errors.As(err, &importErr):
+			return sendError(c, fiber.StatusBadRequest, importErr.Error())
+		case errors.Is(err, domain.ErrUnsupportedImportFormat):
+			return sendError(c, fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrDuplicateISBN):
+			// a book with the isbn was added while the import ran
+			return sendError(c, fiber.StatusConflict, err.Error())
+		}
+		logging.FromContext(c.UserContext()).Error("ImportBooks failed", "error", err)
+		return sendError(c, fiber.StatusInternalServerError, "internal error")
+	}
+}
+
+// importFormat takes the format from the format parameter or else from the content type
+func importFormat(c *fiber.Ctx) string {
+	format := c.Query("format")
+	if format == "" {
+		switch strings.TrimSpace(strings.Split(c.Get(fiber.HeaderContentType), ";")[0]) {
+		case "text/csv":
+			format = domain.ImportFormatCSV
+		case "application/jsonl", "application/x-ndjson", "application/x-jsonlines":
+			format = domain.ImportFormatJSONL
 		}
+	}
+	switch format {
+	case domain.ImportFormatCSV, domain.ImportFormatJSONL:
+		return format
+	}
+	return ""
+}
 
-		err := service.DeleteBook(c.UserContext(), book.ID)
+// DeleteBook returns a handler function that soft deletes the book in the path,
+// it is hidden from every listing until restored and purged after the retention period
+func DeleteBook(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
 		if err != nil {
-			slog.Error("DeleteBook failed", "error", err)
+			return sendError(c, fiber.StatusBadRequest, "invalid book id")
+		}
+
+		err = service.DeleteBook(c.UserContext(), id)
+		switch {
+		case errors.Is(err, domain.ErrBookNotFound):
+			return sendError(c, fiber.StatusNotFound, "book not found")
+		case errors.Is(err, domain.ErrBookOnLoan):
+			return sendError(c, fiber.StatusConflict, domain.ErrBookOnLoan.Error())
+		case err != nil:
+			logging.FromContext(c.UserContext()).Error("DeleteBook failed", "error", err)
 			return sendError(c, fiber.StatusInternalServerError, "internal error")
 		}
 		return c.SendStatus(fiber.StatusNoContent)
 	}
 }
 
+// RestoreBook returns a handler function that brings back a soft deleted book
+func RestoreBook(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid book id")
+		}
+
+		book, err := service.RestoreBook(c.UserContext(), id)
+		switch {
+		case errors.Is(err, domain.ErrBookNotFound):
+			return sendError(c, fiber.StatusNotFound, "deleted book not found")
+		case err != nil:
+			logging.FromContext(c.UserContext()).Error("RestoreBook failed", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+		return c.JSON(book)
+	}
+}
+
 // UpdateBook
 func UpdateBook(service services.BooksService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		var book domain.Book
 		if err := c.BodyParser(&book); err != nil {
-			slog.Warn("UpdateBook request parsing failed", "error", err)
+			logging.FromContext(c.UserContext()).Warn("UpdateBook request parsing failed", "error", err)
 			return sendError(c, fiber.StatusBadRequest, "invalid request")
 		}
 		err := service.UpdateBook(c.UserContext(), book)
 		if err != nil {
-			slog.Error("UpdateBook failed", "error", err)
-			return sendError(c, fiber.StatusInternalServerError, "internal error")
+			return bookWriteError(c, "UpdateBook", err)
 		}
 		return c.SendStatus(fiber.StatusCreated)
 	}
 }
 
+// BorrowBook returns a handler function that lends a copy of a book to a user
+func BorrowBook(service services.BooksService) fiber.Handler {
+	return lendBook(service.BorrowBook)
+}
+
+// ReserveBook returns a handler function that holds a copy of a book for a user to pick up
+func ReserveBook(service services.BooksService) fiber.Handler {
+	return lendBook(service.ReserveBook)
+}
+
+func lendBook(lend func(ctx context.Context, bookID int, request domain.LoanRequest) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid book id")
+		}
+
+		var request domain.LoanRequest
+		if err := parseLoanRequest(c, &request); err != nil {
+			logging.FromContext(c.UserContext()).Warn("lending request parsing failed", "error", err)
+			return sendError(c, fiber.StatusBadRequest, "invalid request")
+		}
+
+		err = lend(c.UserContext(), id, request)
+		var ruleErr *domain.LoanRuleError
+		switch {
+		case err == nil:
+			return c.SendStatus(fiber.StatusCreated)
+		case errors.Is(err, domain.ErrMissingUser):
+			return sendError(c, fiber.StatusBadRequest, domain.ErrMissingUser.Error())
+		case errors.Is(err, domain.ErrNotLoanOwner):
+			return sendError(c, fiber.StatusForbidden, domain.ErrNotLoanOwner.Error())
+		case errors.As(err, &ruleErr):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(domain.RuleViolationResponse{
+				Error:  "borrowing not allowed",
+				Rule:   ruleErr.Rule,
+				Reason: ruleErr.Reason,
+			})
+		case errors.Is(err, domain.ErrBookNotFound):
+			return sendError(c, fiber.StatusNotFound, "book not found")
+		case errors.Is(err, domain.ErrBookNotAvailable):
+			return sendError(c, fiber.StatusConflict, "book is not available")
+		}
+		logging.FromContext(c.UserContext()).Error("lending book failed", "error", err)
+		return sendError(c, fiber.StatusInternalServerError, "internal error")
+	}
+}
+
+// ReturnBook returns a handler function that records the return of a borrowed book
+func ReturnBook(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid book id")
+		}
+
+		var request domain.LoanRequest
+		if err := parseLoanRequest(c, &request); err != nil {
+			logging.FromContext(c.UserContext()).Warn("ReturnBook request parsing failed", "error", err)
+			return sendError(c, fiber.StatusBadRequest, "invalid request")
+		}
+
+		err = service.ReturnBook(c.UserContext(), id, request)
+		switch {
+		case err == nil:
+			return c.SendStatus(fiber.StatusNoContent)
+		case errors.Is(err, domain.ErrLoanNotFound):
+			return sendError(c, fiber.StatusNotFound, "no active loan for this book")
+		case errors.Is(err, domain.ErrMissingUser):
+			return sendError(c, fiber.StatusBadRequest, domain.ErrMissingUser.Error())
+		case errors.Is(err, domain.ErrNotLoanOwner):
+			return sendError(c, fiber.StatusForbidden, domain.ErrNotLoanOwner.Error())
+		}
+		logging.FromContext(c.UserContext()).Error("ReturnBook failed", "error", err)
+		return sendError(c, fiber.StatusInternalServerError, "internal error")
+	}
+}
+
+// parseLoanRequest reads the loan request in the body, which callers acting for
+// themselves may leave out
+func parseLoanRequest(c *fiber.Ctx, request *domain.LoanRequest) error {
+	if len(c.Body()) == 0 {
+		return nil
+	}
+	return c.BodyParser(request)
+}
+
+// bookWriteError reports a failed create or update of a book
+func bookWriteError(c *fiber.Ctx, operation string, err error) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidISBN):
+		return sendError(c, fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, domain.ErrDuplicateISBN):
+		return sendError(c, fiber.StatusConflict, domain.ErrDuplicateISBN.Error())
+	case errors.Is(err, domain.ErrBookNotFound):
+		return sendError(c, fiber.StatusNotFound, "book not found")
+	}
+	logging.FromContext(c.UserContext()).Error(operation+" failed", "error", err)
+	return sendError(c, fiber.StatusInternalServerError, "internal error")
+}
+
 func sendError(c *fiber.Ctx, code int, message string) error {
 	return c.Status(code).JSON(domain.ErrorResponse{
 		Error: message,
@@ -3,13 +3,19 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"app/server/domain"
 	"app/server/services"
 
+	"library/middleware"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -17,9 +23,12 @@ import (
 
 var booksRoute = "/api/v1/books"
 
+var publishDate = time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+
 func TestGetBooks(t *testing.T) {
 	mockService := new(services.BooksServiceMock)
-	mockService.On("GetBooks", mock.Anything).Return([]domain.Book{{Title: "Title"}}, nil)
+	mockService.On("GetBooks", mock.Anything, domain.BookQuery{Limit: defaultPageLimit}).
+		Return(domain.BooksResponse{Books: []domain.Book{{Title: "Title"}}, NextCursor: "next"}, nil)
 
 	app := fiber.New()
 	app.Get(booksRoute, GetBooks(mockService))
@@ -30,11 +39,12 @@ func TestGetBooks(t *testing.T) {
 
 	body := bodyFromResponse[domain.BooksResponse](t, resp)
 	assert.Len(t, body.Books, 1)
+	assert.Equal(t, "next", body.NextCursor)
 }
 
 func TestGetBooks_ServiceFails(t *testing.T) {
 	mockService := new(services.BooksServiceMock)
-	mockService.On("GetBooks", mock.Anything).Return(nil, assert.AnError)
+	mockService.On("GetBooks", mock.Anything, domain.BookQuery{Limit: defaultPageLimit}).Return(domain.BooksResponse{}, assert.AnError)
 
 	app := fiber.New()
 	app.Get(booksRoute, GetBooks(mockService))
@@ -47,14 +57,305 @@ func TestGetBooks_ServiceFails(t *testing.T) {
 	assert.Equal(t, "internal error", body.Error)
 }
 
+func TestGetBooks_Filtered(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetBooks", mock.Anything, domain.BookQuery{
+		Filter: domain.BookFilter{AuthorID: 3, CategoryID: 2},
+		Sort:   "-published_date,title",
+		After:  "abc",
+		Limit:  5,
+	}).Return(domain.BooksResponse{Books: []domain.Book{}}, nil)
+
+	app := fiber.New()
+	app.Get(booksRoute, GetBooks(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", booksRoute+"?author_id=3&category_id=2&sort=-published_date,title&after=abc&limit=5", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	mockService.AssertExpectations(t)
+}
+
+func TestGetBooks_IncludeDeleted(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetBooks", mock.Anything, domain.BookQuery{
+		Filter: domain.BookFilter{IncludeDeleted: true},
+		Limit:  defaultPageLimit,
+	}).Return(domain.BooksResponse{Books: []domain.Book{}}, nil)
+
+	app := fiber.New()
+	app.Get(booksRoute, GetBooks(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", booksRoute+"?include_deleted=true", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	req := httptest.NewRequest("GET", booksRoute+"?include_deleted=true", nil)
+	req.Header.Set(middleware.HeaderUserRole, "admin")
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	mockService.AssertExpectations(t)
+}
+
+func TestGetBooks_InvalidCursor(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetBooks", mock.Anything, domain.BookQuery{After: "bad", Limit: defaultPageLimit}).
+		Return(domain.BooksResponse{}, domain.ErrInvalidCursor)
+
+	app := fiber.New()
+	app.Get(booksRoute, GetBooks(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", booksRoute+"?after=bad", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestGetBooks_InvalidSort(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetBooks", mock.Anything, domain.BookQuery{Sort: "isbn", Limit: defaultPageLimit}).
+		Return(domain.BooksResponse{}, fmt.Errorf("%w: cannot sort by %q", domain.ErrInvalidSort, "isbn"))
+
+	app := fiber.New()
+	app.Get(booksRoute, GetBooks(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", booksRoute+"?sort=isbn", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	body := bodyFromResponse[domain.ErrorResponse](t, resp)
+	assert.Equal(t, `invalid sort: cannot sort by "isbn"`, body.Error)
+}
+
+func TestGetBooks_InvalidLimit(t *testing.T) {
+	app := fiber.New()
+	app.Get(booksRoute, GetBooks(new(services.BooksServiceMock)))
+
+	resp, err := app.Test(httptest.NewRequest("GET", booksRoute+"?limit=500", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestExportBooks(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	sort := []domain.SortField{{Field: "published_date", Desc: true}}
+	mockService.On("ExportBooks", mock.Anything, domain.BookFilter{CategoryID: 2}, sort, domain.ExportFormatJSONL, mock.Anything).
+		Run(func(args mock.Arguments) {
+			_, _ = args.Get(4).(io.Writer).Write([]byte(`{"id":1}` + "\n"))
+		}).
+		Return(nil)
+
+	app := fiber.New()
+	app.Get(booksRoute+"/export", ExportBooks(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", booksRoute+"/export?format=jsonl&category_id=2&sort=-published_date", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="books.jsonl"`, resp.Header.Get("Content-Disposition"))
+
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":1}`+"\n", string(body))
+}
+
+func TestExportBooks_UnsupportedFormat(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+
+	app := fiber.New()
+	app.Get(booksRoute+"/export", ExportBooks(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", booksRoute+"/export?format=pdf", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestExportBooks_InvalidSort(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+
+	app := fiber.New()
+	app.Get(booksRoute+"/export", ExportBooks(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", booksRoute+"/export?sort=description", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	mockService.AssertNotCalled(t, "ExportBooks", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSearchBooks(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("SearchBooks", mock.Anything, "atomic habits", 20, 0).
+		Return([]domain.BookSearchHit{{Book: domain.Book{ID: 2, Title: "Atomic Habits"}, Score: 0.9}}, nil)
+
+	app := fiber.New()
+	app.Get(booksRoute+"/search", SearchBooks(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", booksRoute+"/search?q=atomic+habits", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body := bodyFromResponse[domain.BookSearchResponse](t, resp)
+	assert.Equal(t, "atomic habits", body.Query)
+	assert.Len(t, body.Results, 1)
+}
+
+func TestSearchBooks_MissingQuery(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+
+	app := fiber.New()
+	app.Get(booksRoute+"/search", SearchBooks(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", booksRoute+"/search?q=+", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestRecommendBooks(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("RecommendBooks", mock.Anything, "habits", 5).Return([]domain.Recommendation{{
+		Book:      domain.Book{ID: 2, Title: "Atomic Habits"},
+		Score:     1.5,
+		Breakdown: domain.ScoreBreakdown{Search: 1, Author: 1, Category: 1, Total: 1.5},
+	}}, nil)
+
+	app := fiber.New()
+	app.Get(booksRoute+"/recommendations", RecommendBooks(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", booksRoute+"/recommendations?q=habits&limit=5", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body := bodyFromResponse[domain.RecommendationsResponse](t, resp)
+	assert.Equal(t, "habits", body.Query)
+	assert.Len(t, body.Recommendations, 1)
+	assert.Equal(t, 1.0, body.Recommendations[0].Breakdown.Search)
+}
+
+func TestRecommendBooks_MissingQuery(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+
+	app := fiber.New()
+	app.Get(booksRoute+"/recommendations", RecommendBooks(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", booksRoute+"/recommendations", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestGetBookByISBN(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetBookByISBN", mock.Anything, "0-7352-1129-9").
+		Return(domain.Book{ID: 2, ISBN: "9780735211292", ISBN10: "0735211299"}, nil)
+
+	app := fiber.New()
+	app.Get(booksRoute+"/isbn/:isbn", GetBookByISBN(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", booksRoute+"/isbn/0-7352-1129-9", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body := bodyFromResponse[domain.Book](t, resp)
+	assert.Equal(t, "9780735211292", body.ISBN)
+}
+
+func TestGetBookByISBN_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"invalid", domain.ErrInvalidISBN, 400},
+		{"not found", domain.ErrBookNotFound, 404},
+		{"service fails", assert.AnError, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(services.BooksServiceMock)
+			mockService.On("GetBookByISBN", mock.Anything, "9780735211292").Return(domain.Book{}, tt.err)
+
+			app := fiber.New()
+			app.Get(booksRoute+"/isbn/:isbn", GetBookByISBN(mockService))
+
+			resp, err := app.Test(httptest.NewRequest("GET", booksRoute+"/isbn/9780735211292", nil))
+			assert.Nil(t, err)
+			assert.Equal(t, tt.code, resp.StatusCode)
+		})
+	}
+}
+
+func TestAddBook_DuplicateISBN(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("SaveBook", mock.Anything, mock.Anything).Return(domain.ErrDuplicateISBN)
+
+	app := fiber.New()
+	app.Post(booksRoute, AddBook(mockService))
+
+	resp, err := app.Test(postRequest(booksRoute, `{"title":"Title","isbn":"9780735211292","publish_date":"2020-01-02T00:00:00Z"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 409, resp.StatusCode)
+}
+
+func TestImportBooks(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("ImportBooks", mock.Anything, domain.ImportFormatCSV, mock.Anything, true).
+		Return(domain.ImportReport{DryRun: true, Created: 1, Rows: []domain.ImportRow{{Line: 2, Status: domain.ImportRowCreated}}}, nil)
+
+	app := fiber.New()
+	app.Post(booksRoute+"/import", ImportBooks(mockService))
+
+	req := httptest.NewRequest("POST", booksRoute+"/import?dry_run=true", bytes.NewBufferString("title\nAtomic Habits\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body := bodyFromResponse[domain.ImportReport](t, resp)
+	assert.True(t, body.DryRun)
+	assert.Equal(t, 1, body.Created)
+}
+
+func TestImportBooks_UnknownFormat(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+
+	app := fiber.New()
+	app.Post(booksRoute+"/import", ImportBooks(mockService))
+
+	resp, err := app.Test(postRequest(booksRoute+"/import", `{"title":"Title"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestImportBooks_Errors(t *testing.T) {
+	for _, tt := range []struct {
+		err    error
+		status int
+	}{
+		{&domain.ImportError{Err: errors.New("csv header has no title column")}, 400},
+		{fmt.Errorf("failed to import books: %w", domain.ErrDuplicateISBN), 409},
+		{assert.AnError, 500},
+	} {
+		mockService := new(services.BooksServiceMock)
+		mockService.On("ImportBooks", mock.Anything, domain.ImportFormatCSV, mock.Anything, false).
+			Return(domain.ImportReport{}, tt.err)
+
+		app := fiber.New()
+		app.Post(booksRoute+"/import", ImportBooks(mockService))
+
+		req := httptest.NewRequest("POST", booksRoute+"/import", bytes.NewBufferString("isbn\n9780735211292\n"))
+		req.Header.Set("Content-Type", "text/csv")
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.status, resp.StatusCode, tt.err.Error())
+	}
+}
+
 func TestAddBook(t *testing.T) {
 	mockService := new(services.BooksServiceMock)
-	mockService.On("SaveBook", mock.Anything, domain.Book{Title: "Title"}).Return(nil)
+	mockService.On("SaveBook", mock.Anything, domain.Book{Title: "Title", PublishDate: publishDate}).Return(nil)
 
 	app := fiber.New()
 	app.Post(booksRoute, AddBook(mockService))
 
-	resp, err := app.Test(postRequest(booksRoute, `{"title":"Title"}`))
+	resp, err := app.Test(postRequest(booksRoute, `{"title":"Title","publish_date":"2020-01-02T00:00:00Z"}`))
 	assert.Nil(t, err)
 	assert.Equal(t, 201, resp.StatusCode)
 }
@@ -75,12 +376,12 @@ func TestAddBook_InvalidRequest(t *testing.T) {
 
 func TestAddBook_ServiceFails(t *testing.T) {
 	mockService := new(services.BooksServiceMock)
-	mockService.On("SaveBook", mock.Anything, domain.Book{Title: "Title"}).Return(assert.AnError)
+	mockService.On("SaveBook", mock.Anything, domain.Book{Title: "Title", PublishDate: publishDate}).Return(assert.AnError)
 
 	app := fiber.New()
 	app.Post(booksRoute, AddBook(mockService))
 
-	resp, err := app.Test(postRequest(booksRoute, `{"title":"Title"}`))
+	resp, err := app.Test(postRequest(booksRoute, `{"title":"Title","publish_date":"2020-01-02T00:00:00Z"}`))
 	assert.Nil(t, err)
 	assert.Equal(t, 500, resp.StatusCode)
 
@@ -88,6 +389,136 @@ func TestAddBook_ServiceFails(t *testing.T) {
 	assert.Equal(t, "internal error", body.Error)
 }
 
+func TestDeleteBook(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("DeleteBook", mock.Anything, 3).Return(nil)
+	mockService.On("DeleteBook", mock.Anything, 4).Return(fmt.Errorf("failed to delete book: %w", domain.ErrBookNotFound))
+	mockService.On("DeleteBook", mock.Anything, 5).Return(fmt.Errorf("failed to delete book: %w", domain.ErrBookOnLoan))
+
+	app := fiber.New()
+	app.Delete(booksRoute+"/:id", DeleteBook(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("DELETE", booksRoute+"/3", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 204, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("DELETE", booksRoute+"/4", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("DELETE", booksRoute+"/5", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 409, resp.StatusCode)
+}
+
+func TestRestoreBook(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("RestoreBook", mock.Anything, 3).Return(domain.Book{ID: 3, Title: "Title"}, nil)
+	mockService.On("RestoreBook", mock.Anything, 4).Return(domain.Book{}, domain.ErrBookNotFound)
+
+	app := fiber.New()
+	app.Post(booksRoute+"/:id/restore", RestoreBook(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("POST", booksRoute+"/3/restore", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "Title", bodyFromResponse[domain.Book](t, resp).Title)
+
+	resp, err = app.Test(httptest.NewRequest("POST", booksRoute+"/4/restore", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+func TestBorrowBook(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("BorrowBook", mock.Anything, 7, domain.LoanRequest{UserID: 2}).Return(nil)
+
+	app := fiber.New()
+	app.Post(booksRoute+"/:id/borrow", BorrowBook(mockService))
+
+	// the role comes from X-User-Role, a role in the body is ignored
+	resp, err := app.Test(postRequest(booksRoute+"/7/borrow", `{"user_id":2,"role":"admin"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 201, resp.StatusCode)
+}
+
+func TestBorrowBook_RuleViolation(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("BorrowBook", mock.Anything, 7, mock.Anything).
+		Return(&domain.LoanRuleError{Rule: "max_loans", Reason: "user already has 5 of 5 allowed loans"})
+
+	app := fiber.New()
+	app.Post(booksRoute+"/:id/borrow", BorrowBook(mockService))
+
+	resp, err := app.Test(postRequest(booksRoute+"/7/borrow", `{"user_id":2}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 422, resp.StatusCode)
+
+	body := bodyFromResponse[domain.RuleViolationResponse](t, resp)
+	assert.Equal(t, "max_loans", body.Rule)
+	assert.Equal(t, "user already has 5 of 5 allowed loans", body.Reason)
+}
+
+func TestBorrowBook_NotAvailable(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("BorrowBook", mock.Anything, 7, mock.Anything).Return(domain.ErrBookNotAvailable)
+
+	app := fiber.New()
+	app.Post(booksRoute+"/:id/borrow", BorrowBook(mockService))
+
+	resp, err := app.Test(postRequest(booksRoute+"/7/borrow", `{"user_id":2}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 409, resp.StatusCode)
+}
+
+func TestReserveBook(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("ReserveBook", mock.Anything, 7, domain.LoanRequest{UserID: 2}).Return(nil)
+
+	app := fiber.New()
+	app.Post(booksRoute+"/:id/reserve", ReserveBook(mockService))
+
+	resp, err := app.Test(postRequest(booksRoute+"/7/reserve", `{"user_id":2}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 201, resp.StatusCode)
+}
+
+func TestBorrowBook_MissingUser(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("BorrowBook", mock.Anything, 7, domain.LoanRequest{}).Return(domain.ErrMissingUser)
+
+	app := fiber.New()
+	app.Post(booksRoute+"/:id/borrow", BorrowBook(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("POST", booksRoute+"/7/borrow", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestBorrowBook_NotOwner(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("BorrowBook", mock.Anything, 7, domain.LoanRequest{UserID: 2}).Return(domain.ErrNotLoanOwner)
+
+	app := fiber.New()
+	app.Post(booksRoute+"/:id/borrow", BorrowBook(mockService))
+
+	resp, err := app.Test(postRequest(booksRoute+"/7/borrow", `{"user_id":2}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+}
+
+func TestReturnBook_NotOwner(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("ReturnBook", mock.Anything, 7, domain.LoanRequest{UserID: 2}).Return(domain.ErrNotLoanOwner)
+
+	app := fiber.New()
+	app.Post(booksRoute+"/:id/return", ReturnBook(mockService))
+
+	resp, err := app.Test(postRequest(booksRoute+"/7/return", `{"user_id":2}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+}
+
 func postRequest(url string, body string) *http.Request {
 	req := httptest.NewRequest("POST", url, bytes.NewBufferString(body))
 	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
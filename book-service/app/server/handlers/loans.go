@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"app/server/domain"
+	"app/server/services"
+
+	"library/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// GetUserLoans returns a handler function that lists the loans of a user
+func GetUserLoans(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid user id")
+		}
+		return listLoans(c, service, domain.LoanQuery{UserID: userID})
+	}
+}
+
+// GetBookLoans returns a handler function that lists the loans of a book
+func GetBookLoans(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		bookID, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid book id")
+		}
+		return listLoans(c, service, domain.LoanQuery{BookID: bookID})
+	}
+}
+
+// UpdateLoanStatus returns a handler function that moves a loan to a new status
+func UpdateLoanStatus(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var request domain.LoanStatusRequest
+		if err := c.BodyParser(&request); err != nil {
+			logging.FromContext(c.UserContext()).Warn("UpdateLoanStatus request parsing failed", "error", err)
+			return sendError(c, fiber.StatusBadRequest, "invalid request")
+		}
+		return changeLoanStatus(c, service, request.Status)
+	}
+}
+
+// RenewLoan returns a handler function that extends the due date of a loan of the user
+func RenewLoan(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid user id")
+		}
+		loanID, err := strconv.Atoi(c.Params("loan_id"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid loan id")
+		}
+
+		loan, err := service.RenewLoan(c.UserContext(), userID, loanID)
+		return sendLoan(c, "RenewLoan", loan, err)
+	}
+}
+
+func changeLoanStatus(c *fiber.Ctx, service services.BooksService, status string) error {
+	loanID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return sendError(c, fiber.StatusBadRequest, "invalid loan id")
+	}
+
+	loan, err := service.UpdateLoanStatus(c.UserContext(), loanID, status)
+	return sendLoan(c, "UpdateLoanStatus", loan, err)
+}
+
+// sendLoan responds with the loan a status change of method returned, or with its error
+func sendLoan(c *fiber.Ctx, method string, loan domain.Loan, err error) error {
+	var ruleErr *domain.LoanRuleError
+	switch {
+	case err == nil:
+		return c.JSON(loan)
+	case errors.Is(err, domain.ErrLoanNotFound):
+		return sendError(c, fiber.StatusNotFound, "loan not found")
+	case errors.Is(err, domain.ErrInvalidLoanTransition):
+		return sendError(c, fiber.StatusConflict, err.Error())
+	case errors.As(err, &ruleErr):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(domain.RuleViolationResponse{
+			Error:  "loan status change not allowed",
+			Rule:   ruleErr.Rule,
+			Reason: ruleErr.Reason,
+		})
+	}
+	logging.FromContext(c.UserContext()).Error(method+" failed", "error", err)
+	return sendError(c, fiber.StatusInternalServerError, "internal error")
+}
+
+func listLoans(c *fiber.Ctx, service services.BooksService, query domain.LoanQuery) error {
+	query.State = c.Query("status")
+	switch query.State {
+	case "", domain.LoanStateCurrent, domain.LoanStateReturned, domain.LoanStateOverdue, domain.LoanStateLost:
+	default:
+		return sendError(c, fiber.StatusBadRequest, "status must be one of current, returned, overdue, lost")
+	}
+
+	limit, offset, err := parsePage(c)
+	if err != nil {
+		return sendError(c, fiber.StatusBadRequest, err.Error())
+	}
+	query.Limit, query.Offset = limit, offset
+
+	loans, err := service.GetLoans(c.UserContext(), query)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("GetLoans failed", "error", err)
+		return sendError(c, fiber.StatusInternalServerError, "internal error")
+	}
+
+	return c.JSON(domain.LoansResponse{
+		Loans:  loans,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// parsePage reads the limit and offset query parameters
+func parsePage(c *fiber.Ctx) (int, int, error) {
+	limit := c.QueryInt("limit", defaultPageLimit)
+	if limit < 1 || limit > maxPageLimit {
+		return 0, 0, fiber.NewError(fiber.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxPageLimit))
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		return 0, 0, fiber.NewError(fiber.StatusBadRequest, "offset must not be negative")
+	}
+	return limit, offset, nil
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"app/server/domain"
+	"app/server/services"
+
+	"library/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetUserLoans(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetLoans", mock.Anything, domain.LoanQuery{UserID: 7, State: "overdue", Limit: 5, Offset: 10}).
+		Return([]domain.Loan{{ID: 1, UserID: 7, BookID: 3, Status: "overdue"}}, nil)
+
+	app := fiber.New()
+	app.Get("/api/v1/users/:id/loans", GetUserLoans(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/v1/users/7/loans?status=overdue&limit=5&offset=10", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body := bodyFromResponse[domain.LoansResponse](t, resp)
+	assert.Len(t, body.Loans, 1)
+	assert.Equal(t, "overdue", body.Loans[0].Status)
+	assert.Equal(t, 5, body.Limit)
+	assert.Equal(t, 10, body.Offset)
+}
+
+func TestGetUserLoans_InvalidQuery(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+
+	app := fiber.New()
+	app.Get("/api/v1/users/:id/loans", GetUserLoans(mockService))
+
+	for _, url := range []string{
+		"/api/v1/users/abc/loans",
+		"/api/v1/users/7/loans?status=stolen",
+		"/api/v1/users/7/loans?limit=0",
+		"/api/v1/users/7/loans?offset=-1",
+	} {
+		resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+		assert.Nil(t, err)
+		assert.Equal(t, 400, resp.StatusCode, url)
+	}
+}
+
+func TestGetUserLoans_RequiresSelfOrAdmin(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetLoans", mock.Anything, domain.LoanQuery{UserID: 7, Limit: 20}).Return([]domain.Loan{}, nil)
+
+	app := fiber.New()
+	app.Get("/api/v1/users/:id/loans", middleware.RequireSelfOrRole("admin"), GetUserLoans(mockService))
+
+	req := httptest.NewRequest("GET", "/api/v1/users/7/loans", nil)
+	req.Header.Set(middleware.HeaderUserID, "8")
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	req = httptest.NewRequest("GET", "/api/v1/users/7/loans", nil)
+	req.Header.Set(middleware.HeaderUserID, "7")
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	req = httptest.NewRequest("GET", "/api/v1/users/7/loans", nil)
+	req.Header.Set(middleware.HeaderUserRole, "admin")
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestGetBookLoans_RequiresAdmin(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetLoans", mock.Anything, domain.LoanQuery{BookID: 3, Limit: 20}).Return([]domain.Loan{}, nil)
+
+	app := fiber.New()
+	app.Get("/api/v1/books/:id/loans", middleware.RequireRole("admin"), GetBookLoans(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/v1/books/3/loans", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	req := httptest.NewRequest("GET", "/api/v1/books/3/loans", nil)
+	req.Header.Set(middleware.HeaderUserRole, "admin")
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestGetBookLoans_ServiceFails(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetLoans", mock.Anything, mock.Anything).Return(nil, assert.AnError)
+
+	app := fiber.New()
+	app.Get("/api/v1/books/:id/loans", GetBookLoans(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/v1/books/3/loans", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+}
+
+func TestUpdateLoanStatus(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("UpdateLoanStatus", mock.Anything, 9, "lost").Return(domain.Loan{ID: 9, Status: "lost"}, nil)
+
+	app := fiber.New()
+	app.Put("/api/v1/loans/:id/status", UpdateLoanStatus(mockService))
+
+	req := postRequest("/api/v1/loans/9/status", `{"status":"lost"}`)
+	req.Method = "PUT"
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body := bodyFromResponse[domain.Loan](t, resp)
+	assert.Equal(t, "lost", body.Status)
+}
+
+func TestRenewLoan(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("RenewLoan", mock.Anything, 7, 9).Return(domain.Loan{ID: 9, UserID: 7, Status: "renewed", Renewals: 1}, nil)
+
+	app := fiber.New()
+	app.Post("/api/v1/users/:id/loans/:loan_id/renew", middleware.RequireSelfOrRole("admin"), RenewLoan(mockService))
+
+	req := httptest.NewRequest("POST", "/api/v1/users/7/loans/9/renew", nil)
+	req.Header.Set(middleware.HeaderUserID, "8")
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	req = httptest.NewRequest("POST", "/api/v1/users/7/loans/9/renew", nil)
+	req.Header.Set(middleware.HeaderUserID, "7")
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body := bodyFromResponse[domain.Loan](t, resp)
+	assert.Equal(t, 1, body.Renewals)
+}
+
+func TestRenewLoan_InvalidTransition(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("RenewLoan", mock.Anything, 7, 9).
+		Return(domain.Loan{}, fmt.Errorf("%w: loan cannot move from overdue to renewed", domain.ErrInvalidLoanTransition))
+
+	app := fiber.New()
+	app.Post("/api/v1/users/:id/loans/:loan_id/renew", RenewLoan(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/api/v1/users/7/loans/9/renew", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 409, resp.StatusCode)
+}
+
+func TestRenewLoan_LimitReached(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("RenewLoan", mock.Anything, 7, 9).
+		Return(domain.Loan{}, &domain.LoanRuleError{Rule: "max_renewals", Reason: "loan was already renewed 2 of 2 allowed times"})
+
+	app := fiber.New()
+	app.Post("/api/v1/users/:id/loans/:loan_id/renew", RenewLoan(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/api/v1/users/7/loans/9/renew", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 422, resp.StatusCode)
+
+	body := bodyFromResponse[domain.RuleViolationResponse](t, resp)
+	assert.Equal(t, "max_renewals", body.Rule)
+}
+
+func TestRenewLoan_NotFound(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("RenewLoan", mock.Anything, 7, 9).Return(domain.Loan{}, domain.ErrLoanNotFound)
+
+	app := fiber.New()
+	app.Post("/api/v1/users/:id/loans/:loan_id/renew", RenewLoan(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/api/v1/users/7/loans/9/renew", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"app/server/domain"
+
+	"library/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WithActor returns a middleware that passes the caller and the request id
+// on to the services, which attribute their writes to them in the audit log
+func WithActor() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := domain.WithActor(c.UserContext(), domain.Actor{ID: c.Get(middleware.HeaderUserID), Role: c.Get(middleware.HeaderUserRole)})
+		c.SetUserContext(domain.WithRequestID(ctx, c.Get(middleware.HeaderRequestID)))
+		return c.Next()
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"strconv"
+
+	"app/server/domain"
+	"app/server/services"
+
+	"library/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetNotificationPreferences returns a handler function that shows the loan
+// notifications the user in the path receives
+func GetNotificationPreferences(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid user id")
+		}
+
+		preferences, err := service.GetNotificationPreferences(c.UserContext(), userID)
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("GetNotificationPreferences failed", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+		return c.JSON(preferences)
+	}
+}
+
+// UpdateNotificationPreferences returns a handler function that replaces the
+// notification preferences of the user in the path
+func UpdateNotificationPreferences(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid user id")
+		}
+		var preferences domain.NotificationPreferences
+		if err := c.BodyParser(&preferences); err != nil {
+			logging.FromContext(c.UserContext()).Warn("UpdateNotificationPreferences request parsing failed", "error", err)
+			return sendError(c, fiber.StatusBadRequest, "invalid request")
+		}
+		preferences.UserID = userID
+		if err := domain.ValidateNotificationPreferences(preferences); err != nil {
+			return sendError(c, fiber.StatusBadRequest, err.Error())
+		}
+
+		updated, err := service.UpdateNotificationPreferences(c.UserContext(), preferences)
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("UpdateNotificationPreferences failed", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+		return c.JSON(updated)
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"app/server/domain"
+	"app/server/services"
+
+	"library/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetNotificationPreferences(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetNotificationPreferences", mock.Anything, 5).
+		Return(domain.NotificationPreferences{UserID: 5, DueSoon: true, Overdue: true}, nil)
+
+	app := fiber.New()
+	app.Get("/api/v1/users/:id/notification-preferences", middleware.RequireSelfOrRole("admin"), GetNotificationPreferences(mockService))
+
+	req := httptest.NewRequest("GET", "/api/v1/users/5/notification-preferences", nil)
+	req.Header.Set(middleware.HeaderUserID, "6")
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	req.Header.Set(middleware.HeaderUserID, "5")
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.True(t, bodyFromResponse[domain.NotificationPreferences](t, resp).DueSoon)
+
+	req.Header.Set(middleware.HeaderUserID, "6")
+	req.Header.Set(middleware.HeaderUserRole, "admin")
+	resp, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestUpdateNotificationPreferences(t *testing.T) {
+	preferences := domain.NotificationPreferences{UserID: 5, Email: "five@example.com", Overdue: true}
+	mockService := new(services.BooksServiceMock)
+	mockService.On("UpdateNotificationPreferences", mock.Anything, preferences).Return(preferences, nil)
+
+	app := fiber.New()
+	app.Put("/api/v1/users/:id/notification-preferences", UpdateNotificationPreferences(mockService))
+
+	for payload, status := range map[string]int{
+		`{"email":"five@example.com","due_soon":false,"overdue":true}`: 200,
+		`{"email":"Five <five@example.com>"}`:                          400,
+		`{"email":"not an address"}`:                                   400,
+	} {
+		req := httptest.NewRequest("PUT", "/api/v1/users/5/notification-preferences", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+		assert.Equal(t, status, resp.StatusCode, payload)
+	}
+	mockService.AssertNumberOfCalls(t, "UpdateNotificationPreferences", 1)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+
+	"app/server/domain"
+	"app/server/services"
+
+	"library/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CreateWebhook returns a handler function that subscribes a URL to events. The
+// response carries the signing secret, the only time it is returned.
+func CreateWebhook(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var subscription domain.WebhookSubscription
+		if err := c.BodyParser(&subscription); err != nil {
+			logging.FromContext(c.UserContext()).Warn("CreateWebhook request parsing failed", "error", err)
+			return sendError(c, fiber.StatusBadRequest, "invalid request")
+		}
+		if err := domain.ValidateWebhookSubscription(subscription); err != nil {
+			return sendError(c, fiber.StatusBadRequest, err.Error())
+		}
+
+		created, err := service.CreateWebhook(c.UserContext(), subscription)
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("CreateWebhook failed", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+		return c.Status(fiber.StatusCreated).JSON(created)
+	}
+}
+
+// ListWebhooks returns a handler function that lists the subscriptions without their secrets
+func ListWebhooks(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		webhooks, err := service.ListWebhooks(c.UserContext())
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("ListWebhooks failed", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+		return c.JSON(webhooks)
+	}
+}
+
+// DeleteWebhook returns a handler function that removes a subscription and its delivery log
+func DeleteWebhook(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid webhook id")
+		}
+
+		err = service.DeleteWebhook(c.UserContext(), id)
+		switch {
+		case errors.Is(err, domain.ErrWebhookNotFound):
+			return sendError(c, fiber.StatusNotFound, err.Error())
+		case err != nil:
+			logging.FromContext(c.UserContext()).Error("DeleteWebhook failed", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// deliveryStatuses are the values accepted by the status parameter
+var deliveryStatuses = []string{
+	domain.DeliveryStatusPending,
+	domain.DeliveryStatusDelivered,
+	domain.DeliveryStatusDead,
+}
+
+// GetWebhookDeliveries returns a handler function that lists the deliveries of a
+// subscription newest first, narrowed by the status parameter
+func GetWebhookDeliveries(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid webhook id")
+		}
+		limit, offset, err := parsePage(c)
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, err.Error())
+		}
+		status := c.Query("status")
+		if status != "" && !slices.Contains(deliveryStatuses, status) {
+			return sendError(c, fiber.StatusBadRequest, "unknown delivery status "+strconv.Quote(status))
+		}
+
+		deliveries, err := service.GetWebhookDeliveries(c.UserContext(), domain.WebhookDeliveryQuery{
+			SubscriptionID: id,
+			Status:         status,
+			Limit:          limit,
+			Offset:         offset,
+		})
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("GetWebhookDeliveries failed", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+
+		return c.JSON(domain.WebhookDeliveriesResponse{Deliveries: deliveries, Limit: limit, Offset: offset})
+	}
+}
+
+// RetryWebhookDelivery returns a handler function that queues a dead delivery again
+func RetryWebhookDelivery(service services.BooksService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid delivery id")
+		}
+
+		err = service.RetryWebhookDelivery(c.UserContext(), id)
+		switch {
+		case errors.Is(err, domain.ErrDeliveryNotFound):
+			return sendError(c, fiber.StatusNotFound, err.Error())
+		case errors.Is(err, domain.ErrDeliveryNotDead):
+			return sendError(c, fiber.StatusConflict, err.Error())
+		case err != nil:
+			logging.FromContext(c.UserContext()).Error("RetryWebhookDelivery failed", "error", err)
+			return sendError(c, fiber.StatusInternalServerError, "internal error")
+		}
+		return c.SendStatus(fiber.StatusAccepted)
+	}
+}
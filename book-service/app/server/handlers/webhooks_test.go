@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"app/server/domain"
+	"app/server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreateWebhook(t *testing.T) {
+	subscription := domain.WebhookSubscription{URL: "https://partner.example/hooks", EventTypes: []string{"book.borrowed"}}
+	mockService := new(services.BooksServiceMock)
+	mockService.On("CreateWebhook", mock.Anything, subscription).
+		Return(domain.WebhookSubscription{ID: 1, URL: subscription.URL, EventTypes: subscription.EventTypes, Secret: "s3cret"}, nil)
+
+	app := fiber.New()
+	app.Post("/api/v1/webhooks", CreateWebhook(mockService))
+
+	req := httptest.NewRequest("POST", "/api/v1/webhooks",
+		strings.NewReader(`{"url":"https://partner.example/hooks","event_types":["book.borrowed"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 201, resp.StatusCode)
+
+	body := bodyFromResponse[domain.WebhookSubscription](t, resp)
+	assert.Equal(t, 1, body.ID)
+	assert.Equal(t, "s3cret", body.Secret)
+	mockService.AssertExpectations(t)
+}
+
+func TestCreateWebhook_Invalid(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+
+	app := fiber.New()
+	app.Post("/api/v1/webhooks", CreateWebhook(mockService))
+
+	for _, payload := range []string{
+		`{"url":"partner.example/hooks"}`,
+		`{"url":"ftp://partner.example/hooks"}`,
+		`{"url":"https://partner.example/hooks","event_types":["book.shelved"]}`,
+	} {
+		req := httptest.NewRequest("POST", "/api/v1/webhooks", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+		assert.Equal(t, 400, resp.StatusCode, payload)
+	}
+	mockService.AssertNotCalled(t, "CreateWebhook", mock.Anything, mock.Anything)
+}
+
+func TestDeleteWebhook_NotFound(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("DeleteWebhook", mock.Anything, 4).Return(domain.ErrWebhookNotFound)
+
+	app := fiber.New()
+	app.Delete("/api/v1/webhooks/:id", DeleteWebhook(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("DELETE", "/api/v1/webhooks/4", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+func TestGetWebhookDeliveries(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("GetWebhookDeliveries", mock.Anything, domain.WebhookDeliveryQuery{SubscriptionID: 2, Status: "dead", Limit: 5}).
+		Return([]domain.WebhookDelivery{{ID: 9, SubscriptionID: 2, Status: "dead", Attempts: 8}}, nil)
+
+	app := fiber.New()
+	app.Get("/api/v1/webhooks/:id/deliveries", GetWebhookDeliveries(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/v1/webhooks/2/deliveries?status=dead&limit=5", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body := bodyFromResponse[domain.WebhookDeliveriesResponse](t, resp)
+	assert.Len(t, body.Deliveries, 1)
+	assert.Equal(t, 8, body.Deliveries[0].Attempts)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/api/v1/webhooks/2/deliveries?status=lost", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestRetryWebhookDelivery(t *testing.T) {
+	mockService := new(services.BooksServiceMock)
+	mockService.On("RetryWebhookDelivery", mock.Anything, int64(9)).Return(nil)
+	mockService.On("RetryWebhookDelivery", mock.Anything, int64(10)).Return(domain.ErrDeliveryNotDead)
+
+	app := fiber.New()
+	app.Post("/api/v1/webhooks/deliveries/:id/retry", RetryWebhookDelivery(mockService))
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/api/v1/webhooks/deliveries/9/retry", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("POST", "/api/v1/webhooks/deliveries/10/retry", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 409, resp.StatusCode)
+}
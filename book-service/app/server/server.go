@@ -2,27 +2,85 @@ package server
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"app/datasources"
 	"app/server/handlers"
 	"app/server/services"
 
+	"library/health"
+	"library/middleware"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-// NewServer creates a new Fiber app and sets up the routes
-func NewServer(ctx context.Context, dataSources *datasources.DataSources) *fiber.App {
-	app := fiber.New()
-	apiRoutes := app.Group("/api")
+// Config tunes the HTTP server, zero timeouts never expire
+type Config struct {
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// CORSOrigins are the origins browsers may call the API from, none disables CORS
+	CORSOrigins []string
+	// JWTKey verifies the bearer tokens callers authenticate with, without it the
+	// caller is taken from the headers set by the API gateway
+	JWTKey string
+	// Cache keeps the responses of the read routes
+	Cache middleware.CacheConfig
+}
+
+// NewServer creates a new Fiber app and sets up the routes, checker decides whether
+// the service is ready for traffic
+func NewServer(ctx context.Context, dataSources *datasources.DataSources, checker *health.Checker, config Config) *fiber.App {
+	app := fiber.New(fiber.Config{
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		IdleTimeout:  config.IdleTimeout,
+	})
+	app.Use(middleware.Trace(), middleware.Authenticate(config.JWTKey), middleware.RequestLogger(), middleware.RecordMetrics())
+	if len(config.CORSOrigins) > 0 {
+		app.Use(cors.New(cors.Config{AllowOrigins: strings.Join(config.CORSOrigins, ",")}))
+	}
+	app.Get("/metrics", middleware.Metrics(prometheus.DefaultGatherer))
+	app.Get("/health/live", health.Live())
+	app.Get("/health/ready", health.Ready(checker))
+	apiRoutes := app.Group("/api", handlers.WithActor())
 
 	apiRoutes.Get("/status", func(c *fiber.Ctx) error {
 		return c.SendString("ok")
 	})
-	apiRoutes.Get("/v1/books", handlers.GetBooks(services.NewBooksService(dataSources.DB)))
-	apiRoutes.Get("/v1/books:id", handlers.GetBook(services.NewBooksService(dataSources.DB)))
+	cached := middleware.Cache(config.Cache)
+	apiRoutes.Get("/v1/books", cached, handlers.GetBooks(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Get("/v1/books/export", handlers.ExportBooks(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Get("/v1/books/search", cached, handlers.SearchBooks(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Get("/v1/books/recommendations", cached, handlers.RecommendBooks(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Get("/v1/books/isbn/:isbn", cached, handlers.GetBookByISBN(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Get("/v1/books/:id", cached, handlers.GetBook(services.NewBooksService(dataSources.DB)))
 	apiRoutes.Post("/v1/books", handlers.AddBook(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Post("/v1/books/import", handlers.ImportBooks(services.NewBooksService(dataSources.DB)))
 	apiRoutes.Delete("/v1/books/:id", handlers.DeleteBook(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Post("/v1/books/:id/restore", middleware.RequireRole("admin"), handlers.RestoreBook(services.NewBooksService(dataSources.DB)))
 	apiRoutes.Put("/v1/books", handlers.UpdateBook(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Post("/v1/books/:id/borrow", handlers.BorrowBook(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Post("/v1/books/:id/reserve", handlers.ReserveBook(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Post("/v1/books/:id/return", handlers.ReturnBook(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Get("/v1/books/:id/loans", middleware.RequireRole("admin"), handlers.GetBookLoans(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Get("/v1/authors/:id/books", handlers.GetAuthorBooks(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Post("/v1/authors/:id/books/reassign", middleware.RequireRole("admin"), handlers.ReassignAuthorBooks(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Get("/v1/authors/:id/stats", handlers.GetAuthorStats(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Get("/v1/users/:id/loans", middleware.RequireSelfOrRole("admin"), handlers.GetUserLoans(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Get("/v1/users/:id/notification-preferences", middleware.RequireSelfOrRole("admin"), handlers.GetNotificationPreferences(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Put("/v1/users/:id/notification-preferences", middleware.RequireSelfOrRole("admin"), handlers.UpdateNotificationPreferences(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Post("/v1/users/:id/loans/:loan_id/renew", middleware.RequireSelfOrRole("admin"), handlers.RenewLoan(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Put("/v1/loans/:id/status", middleware.RequireRole("admin"), handlers.UpdateLoanStatus(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Get("/v1/audit", middleware.RequireRole("admin"), handlers.GetAuditLog(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Post("/v1/webhooks", middleware.RequireRole("admin"), handlers.CreateWebhook(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Get("/v1/webhooks", middleware.RequireRole("admin"), handlers.ListWebhooks(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Delete("/v1/webhooks/:id", middleware.RequireRole("admin"), handlers.DeleteWebhook(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Get("/v1/webhooks/:id/deliveries", middleware.RequireRole("admin"), handlers.GetWebhookDeliveries(services.NewBooksService(dataSources.DB)))
+	apiRoutes.Post("/v1/webhooks/deliveries/:id/retry", middleware.RequireRole("admin"), handlers.RetryWebhookDelivery(services.NewBooksService(dataSources.DB)))
 
 	return app
 }
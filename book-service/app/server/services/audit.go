@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"app/datasources/database"
+	"app/server/domain"
+)
+
+// record appends a write to the audit log, attributed to the actor and request in ctx.
+// before and after are the entity around the write, nil where it did not exist, and
+// only the fields that differ between them are kept.
+func (s *booksService) record(ctx context.Context, action, entity string, entityID int, before, after any) error {
+	changes, err := diffFields(before, after)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+
+	actor := domain.ActorFromContext(ctx)
+	err = s.db.AddAuditEntry(ctx, database.NewAuditEntry{
+		Actor:     actor.ID,
+		ActorRole: actor.Role,
+		Action:    action,
+		Entity:    entity,
+		EntityID:  entityID,
+		Changes:   encoded,
+		RequestID: domain.RequestIDFromContext(ctx),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+func (s *booksService) GetAuditLog(ctx context.Context, query domain.AuditQuery) ([]domain.AuditEntry, error) {
+	records, err := s.db.ListAuditEntries(ctx, database.AuditFilter{
+		Entity:   query.Entity,
+		EntityID: query.EntityID,
+		Actor:    query.Actor,
+	}, query.Limit, query.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load audit log: %w", err)
+	}
+
+	entries := make([]domain.AuditEntry, 0, len(records))
+	for _, record := range records {
+		entry := domain.AuditEntry{
+			ID:        record.ID,
+			Actor:     record.Actor,
+			ActorRole: record.ActorRole,
+			Action:    record.Action,
+			Entity:    record.Entity,
+			EntityID:  record.EntityID,
+			RequestID: record.RequestID,
+			CreatedAt: record.CreatedAt,
+		}
+		if err := json.Unmarshal(record.Changes, &entry.Changes); err != nil {
+			return nil, fmt.Errorf("failed to decode audit entry %d: %w", record.ID, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// diffFields compares the JSON fields of two values and returns the ones that differ
+func diffFields(before, after any) (map[string]domain.FieldChange, error) {
+	old, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]domain.FieldChange)
+	for field, value := range updated {
+		if previous, ok := old[field]; !ok || !reflect.DeepEqual(previous, value) {
+			changes[field] = domain.FieldChange{Before: previous, After: value}
+		}
+	}
+	for field, previous := range old {
+		if _, ok := updated[field]; !ok {
+			changes[field] = domain.FieldChange{Before: previous}
+		}
+	}
+	return changes, nil
+}
+
+// jsonFields decodes the JSON object a value encodes to, nil encodes to no fields
+func jsonFields(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"app/datasources/database"
+	"app/server/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	db, err := database.NewDatabase(context.Background(), "", database.PoolConfig{}, database.DefaultLoanPolicy())
+	require.NoError(t, err)
+	service := NewBooksService(db)
+
+	ctx := domain.WithActor(context.Background(), domain.Actor{ID: "42", Role: "admin"})
+	ctx = domain.WithRequestID(ctx, "req-1")
+	require.NoError(t, service.SaveBook(ctx, domain.Book{Title: "Atomic Habits", AuthorID: 1}))
+	require.NoError(t, service.BorrowBook(ctx, 0, domain.LoanRequest{UserID: 5}))
+	require.NoError(t, service.ReturnBook(domain.WithActor(context.Background(), domain.Actor{ID: "5", Role: "member"}), 0, domain.LoanRequest{UserID: 5}))
+	require.NoError(t, service.DeleteBook(domain.WithActor(context.Background(), domain.Actor{ID: "7", Role: "admin"}), 0))
+
+	entries, err := service.GetAuditLog(context.Background(), domain.AuditQuery{Entity: domain.AuditEntityBook, Actor: "42", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// newest first
+	borrow := entries[0]
+	assert.Equal(t, domain.AuditActionBorrow, borrow.Action)
+	assert.Equal(t, 0, borrow.EntityID)
+	assert.Equal(t, "admin", borrow.ActorRole)
+	assert.Equal(t, "req-1", borrow.RequestID)
+	assert.Equal(t, map[string]domain.FieldChange{"user_id": {After: 5.0}}, borrow.Changes)
+
+	create := entries[1]
+	assert.Equal(t, domain.AuditActionCreate, create.Action)
+	assert.Equal(t, domain.FieldChange{After: "Atomic Habits"}, create.Changes["title"])
+
+	entries, err = service.GetAuditLog(context.Background(), domain.AuditQuery{Actor: "7", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, domain.AuditActionDelete, entries[0].Action)
+	assert.Equal(t, domain.FieldChange{Before: "Atomic Habits"}, entries[0].Changes["title"])
+}
+
+func TestAuditLog_RecordFails(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("ReassignAuthorBooks", mock.Anything, 7, 9).Return(3, nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(assert.AnError)
+
+	service := NewBooksService(mockDB)
+	_, err := service.ReassignAuthorBooks(context.Background(), 7, 9)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.ErrorContains(t, err, "failed to record audit entry")
+}
+
+func TestDiffFields(t *testing.T) {
+	changes, err := diffFields(domain.Book{Title: "Dune", CategoryID: 1}, domain.Book{Title: "Dune", CategoryID: 2})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]domain.FieldChange{"category_id": {Before: 1.0, After: 2.0}}, changes)
+
+	changes, err = diffFields(domain.LoanRequest{UserID: 1}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]domain.FieldChange{"user_id": {Before: 1.0}}, changes)
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"app/server/domain"
+)
+
+// ReassignAuthorBooks moves every book of an author to another author, whose
+// existence is up to the caller as authors are kept by author-service
+func (s *booksService) ReassignAuthorBooks(ctx context.Context, fromAuthorID, toAuthorID int) (domain.ReassignResult, error) {
+	if toAuthorID < 1 || toAuthorID == fromAuthorID {
+		return domain.ReassignResult{}, domain.ErrInvalidReassign
+	}
+
+	result := domain.ReassignResult{FromAuthorID: fromAuthorID, ToAuthorID: toAuthorID}
+	err := s.db.WithinTx(ctx, func(ctx context.Context) error {
+		moved, err := s.db.ReassignAuthorBooks(ctx, fromAuthorID, toAuthorID)
+		if err != nil {
+			return fmt.Errorf("failed to reassign author books: %w", err)
+		}
+		result.Reassigned = moved
+		return s.record(ctx, domain.AuditActionReassignBooks, domain.AuditEntityAuthor, fromAuthorID, nil, result)
+	})
+	if err != nil {
+		return domain.ReassignResult{}, err
+	}
+	return result, nil
+}
+
+func (s *booksService) GetAuthorStats(ctx context.Context, authorID int) (domain.AuthorStats, error) {
+	stats, err := s.db.GetAuthorStats(ctx, authorID)
+	if err != nil {
+		return domain.AuthorStats{}, fmt.Errorf("failed to get author stats: %w", err)
+	}
+
+	return domain.AuthorStats{
+		AuthorID:        authorID,
+		Titles:          stats.Titles,
+		TotalCopies:     stats.TotalCopies,
+		AvailableCopies: stats.AvailableCopies,
+		ActiveLoans:     stats.ActiveLoans,
+	}, nil
+}
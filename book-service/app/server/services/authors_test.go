@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"app/datasources/database"
+	"app/server/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetAuthorStats(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthorStats", mock.Anything, 7).Return(database.AuthorStats{Titles: 3, TotalCopies: 12, AvailableCopies: 10, ActiveLoans: 2}, nil)
+
+	service := NewBooksService(mockDB)
+	stats, err := service.GetAuthorStats(context.Background(), 7)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.AuthorStats{AuthorID: 7, Titles: 3, TotalCopies: 12, AvailableCopies: 10, ActiveLoans: 2}, stats)
+}
+
+func TestGetAuthorStats_Fails(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetAuthorStats", mock.Anything, 7).Return(database.AuthorStats{}, assert.AnError)
+
+	service := NewBooksService(mockDB)
+	_, err := service.GetAuthorStats(context.Background(), 7)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestReassignAuthorBooks(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("ReassignAuthorBooks", mock.Anything, 7, 9).Return(3, nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
+
+	service := NewBooksService(mockDB)
+	result, err := service.ReassignAuthorBooks(context.Background(), 7, 9)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.ReassignResult{FromAuthorID: 7, ToAuthorID: 9, Reassigned: 3}, result)
+}
+
+func TestReassignAuthorBooks_Invalid(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	service := NewBooksService(mockDB)
+
+	_, err := service.ReassignAuthorBooks(context.Background(), 7, 7)
+	assert.ErrorIs(t, err, domain.ErrInvalidReassign)
+	_, err = service.ReassignAuthorBooks(context.Background(), 7, 0)
+	assert.ErrorIs(t, err, domain.ErrInvalidReassign)
+	mockDB.AssertNotCalled(t, "ReassignAuthorBooks", mock.Anything, mock.Anything, mock.Anything)
+}
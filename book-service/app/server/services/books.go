@@ -2,20 +2,54 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strconv"
+	"time"
 
 	"app/datasources/database"
 	"app/server/domain"
 )
 
 type BooksService interface {
-	GetBooks(ctx context.Context) ([]domain.Book, error)
+	GetBooks(ctx context.Context, query domain.BookQuery) (domain.BooksResponse, error)
+	ExportBooks(ctx context.Context, filter domain.BookFilter, sort []domain.SortField, format string, w io.Writer) error
 	GetBook(ctx context.Context, id int) (domain.Book, error)
+	GetBookByISBN(ctx context.Context, isbn string) (domain.Book, error)
+	SearchBooks(ctx context.Context, query string, limit, offset int) ([]domain.BookSearchHit, error)
+	RecommendBooks(ctx context.Context, query string, limit int) ([]domain.Recommendation, error)
 	SaveBook(ctx context.Context, newBook domain.Book) error
+	ImportBooks(ctx context.Context, format string, r io.Reader, dryRun bool) (domain.ImportReport, error)
 	DeleteBook(ctx context.Context, id int) error
+	RestoreBook(ctx context.Context, id int) (domain.Book, error)
+	PurgeBooks(ctx context.Context, before time.Time) (int, error)
 	UpdateBook(ctx context.Context, book domain.Book) error
+	BorrowBook(ctx context.Context, bookID int, request domain.LoanRequest) error
+	ReturnBook(ctx context.Context, bookID int, request domain.LoanRequest) error
+	ReserveBook(ctx context.Context, bookID int, request domain.LoanRequest) error
+	GetLoans(ctx context.Context, query domain.LoanQuery) ([]domain.Loan, error)
+	UpdateLoanStatus(ctx context.Context, loanID int, status string) (domain.Loan, error)
+	RenewLoan(ctx context.Context, userID, loanID int) (domain.Loan, error)
+	GetAuthorStats(ctx context.Context, authorID int) (domain.AuthorStats, error)
+	ReassignAuthorBooks(ctx context.Context, fromAuthorID, toAuthorID int) (domain.ReassignResult, error)
+	GetAuditLog(ctx context.Context, query domain.AuditQuery) ([]domain.AuditEntry, error)
+	CreateWebhook(ctx context.Context, subscription domain.WebhookSubscription) (domain.WebhookSubscription, error)
+	ListWebhooks(ctx context.Context) ([]domain.WebhookSubscription, error)
+	DeleteWebhook(ctx context.Context, id int) error
+	GetWebhookDeliveries(ctx context.Context, query domain.WebhookDeliveryQuery) ([]domain.WebhookDelivery, error)
+	RetryWebhookDelivery(ctx context.Context, id int64) error
+	GetNotificationPreferences(ctx context.Context, userID int) (domain.NotificationPreferences, error)
+	UpdateNotificationPreferences(ctx context.Context, preferences domain.NotificationPreferences) (domain.NotificationPreferences, error)
 }
 
+const (
+	// defaultStock is the number of copies a new book starts with
+	defaultStock = 12
+	// defaultPageLimit is the page size used when a query sets none
+	defaultPageLimit = 20
+)
+
 type booksService struct {
 	db database.Database
 }
@@ -25,46 +59,99 @@ func (s *booksService) GetBook(ctx context.Context, id int) (domain.Book, error)
 	if err != nil {
 		return domain.Book{}, err
 	}
-	book := domain.Book{
-		ID:          record.ID,
-		Title:       record.Title,
-		AuthorID:    record.AuthorID,
-		CategoryID:  record.CategoryID,
-		PublishDate: record.PublishedDate,
-		Description: record.Description,
-		ISBN:        record.ISBN,
-	}
-
-	return book, nil
+	return toDomainBook(record), nil
 }
 
 func NewBooksService(db database.Database) BooksService {
-	return &booksService{db: db}
+	return tracedBooksService{next: &booksService{db: db}}
 }
 
-func (s *booksService) GetBooks(ctx context.Context) ([]domain.Book, error) {
-	dbRecords, err := s.db.LoadAllBooks(ctx)
+// defaultBookSort lists books by title when a query sets no sort
+var defaultBookSort = []domain.SortField{{Field: "title"}}
+
+// ParseBookSort reads the sort parameter of a book listing or export, books are
+// sorted by title when it is empty
+func ParseBookSort(value string) ([]domain.SortField, error) {
+	fields, err := domain.ParseSort(value, database.BookSortable)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load books: %w", err)
+		return nil, err
 	}
+	if len(fields) == 0 {
+		return defaultBookSort, nil
+	}
+	return fields, nil
+}
 
-	books := make([]domain.Book, 0, len(dbRecords))
+// GetBooks returns a page of books in the requested sort order, ties are broken
+// by id. One extra row is read to tell whether another page follows.
+func (s *booksService) GetBooks(ctx context.Context, query domain.BookQuery) (domain.BooksResponse, error) {
+	sortFields, err := ParseBookSort(query.Sort)
+	if err != nil {
+		return domain.BooksResponse{}, err
+	}
+	sortKey := domain.FormatSort(sortFields)
+	after, err := decodeCursor(query.After, sortKey)
+	if err != nil {
+		return domain.BooksResponse{}, err
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultPageLimit
+	}
+
+	sort := toDatabaseSort(sortFields)
+	dbRecords, err := s.db.ListBooks(ctx, toDatabaseFilter(query.Filter), sort, after, query.Limit+1)
+	if err != nil {
+		return domain.BooksResponse{}, fmt.Errorf("failed to load books: %w", toDomainError(err))
+	}
+
+	response := domain.BooksResponse{Books: make([]domain.Book, 0, min(len(dbRecords), query.Limit))}
+	if len(dbRecords) > query.Limit {
+		dbRecords = dbRecords[:query.Limit]
+		response.NextCursor = encodeCursor(sortKey, database.BookCursor(dbRecords[len(dbRecords)-1], sort))
+	}
 	for _, record := range dbRecords {
-		books = append(books, domain.Book{
-			ID:          record.ID,
-			Title:       record.Title,
-			AuthorID:    record.AuthorID,
-			ISBN:        record.ISBN,
-			PublishDate: record.PublishedDate,
-			Description: record.Description,
-			CategoryID:  record.CategoryID,
+		response.Books = append(response.Books, toDomainBook(record))
+	}
+
+	return response, nil
+}
+
+func (s *booksService) SearchBooks(ctx context.Context, query string, limit, offset int) ([]domain.BookSearchHit, error) {
+	results, err := s.db.SearchBooks(ctx, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search books: %w", err)
+	}
+
+	hits := make([]domain.BookSearchHit, 0, len(results))
+	for _, result := range results {
+		hits = append(hits, domain.BookSearchHit{
+			Book:    toDomainBook(result.Book),
+			Score:   result.Rank,
+			Snippet: result.Snippet,
 		})
 	}
 
-	return books, nil
+	return hits, nil
+}
+
+func (s *booksService) GetBookByISBN(ctx context.Context, isbn string) (domain.Book, error) {
+	normalized, err := domain.NormalizeISBN(isbn)
+	if err != nil {
+		return domain.Book{}, err
+	}
+
+	record, err := s.db.GetBookByISBN(ctx, normalized)
+	if err != nil {
+		return domain.Book{}, fmt.Errorf("failed to get book: %w", toDomainError(err))
+	}
+	return toDomainBook(record), nil
 }
 
 func (s *booksService) SaveBook(ctx context.Context, book domain.Book) error {
+	if err := normalizeBookISBN(&book); err != nil {
+		return err
+	}
+
 	dbBook := database.NewBook{
 		Title:         book.Title,
 		AuthorID:      book.AuthorID,
@@ -72,39 +159,384 @@ func (s *booksService) SaveBook(ctx context.Context, book domain.Book) error {
 		Description:   book.Description,
 		CategoryID:    book.CategoryID,
 		PublishedDate: book.PublishDate,
-		Stock:         12,
+		Stock:         defaultStock,
+	}
+
+	return s.db.WithinTx(ctx, func(ctx context.Context) error {
+		id, err := s.db.CreateBook(ctx, dbBook)
+		if err != nil {
+			return fmt.Errorf("failed to save book: %w", toDomainError(err))
+		}
+
+		book.ID = id
+		book.ISBN10 = isbn10(book.ISBN)
+		return s.record(ctx, domain.AuditActionCreate, domain.AuditEntityBook, id, nil, book)
+	})
+}
+
+// DeleteBook soft deletes a book, it stays restorable until it is purged
+func (s *booksService) DeleteBook(ctx context.Context, id int) error {
+	return s.db.WithinTx(ctx, func(ctx context.Context) error {
+		before, err := s.db.GetBookByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete book: %w", toDomainError(err))
+		}
+
+		err = s.db.DeleteBook(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete book: %w", toDomainError(err))
+		}
+
+		return s.record(ctx, domain.AuditActionDelete, domain.AuditEntityBook, id, toDomainBook(before), nil)
+	})
+}
+
+func (s *booksService) RestoreBook(ctx context.Context, id int) (domain.Book, error) {
+	var book domain.Book
+	err := s.db.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.db.RestoreBook(ctx, id); err != nil {
+			return fmt.Errorf("failed to restore book: %w", toDomainError(err))
+		}
+		var err error
+		book, err = s.GetBook(ctx, id)
+		if err != nil {
+			return err
+		}
+		return s.record(ctx, domain.AuditActionRestore, domain.AuditEntityBook, id, nil, book)
+	})
+	if err != nil {
+		return domain.Book{}, err
 	}
+	return book, nil
+}
 
-	err := s.db.CreateBook(ctx, dbBook)
+// PurgeBooks permanently removes the books deleted before the given time. Books that
+// were ever lent out are never purged, so their loan history stays complete.
+func (s *booksService) PurgeBooks(ctx context.Context, before time.Time) (int, error) {
+	var purged int
+	err := s.db.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		purged, err = s.db.PurgeBooks(ctx, before)
+		if err != nil {
+			return fmt.Errorf("failed to purge books: %w", err)
+		}
+		if purged == 0 {
+			return nil
+		}
+		return s.record(ctx, domain.AuditActionPurge, domain.AuditEntityBook, 0, nil, map[string]any{
+			"purged":         purged,
+			"deleted_before": before,
+		})
+	})
 	if err != nil {
-		return fmt.Errorf("failed to save book: %w", err)
+		return 0, err
 	}
+	return purged, nil
+}
+
+func (s *booksService) UpdateBook(ctx context.Context, book domain.Book) error {
+	if err := normalizeBookISBN(&book); err != nil {
+		return err
+	}
+
+	return s.db.WithinTx(ctx, func(ctx context.Context) error {
+		before, err := s.db.GetBookByID(ctx, book.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update book: %w", toDomainError(err))
+		}
+
+		// the stock only changes with loans, a category or publish date left out keeps the current one
+		dbBook := database.Book{
+			ID:            book.ID,
+			Title:         book.Title,
+			AuthorID:      book.AuthorID,
+			ISBN:          book.ISBN,
+			Description:   book.Description,
+			CategoryID:    book.CategoryID,
+			Stock:         before.Stock,
+			PublishedDate: book.PublishDate,
+		}
+		if dbBook.CategoryID == 0 {
+			dbBook.CategoryID = before.CategoryID
+		}
+		if dbBook.PublishedDate.IsZero() {
+			dbBook.PublishedDate = before.PublishedDate
+		}
+
+		err = s.db.UpdateBook(ctx, dbBook)
+		if err != nil {
+			return fmt.Errorf("failed to update book: %w", toDomainError(err))
+		}
+
+		after, err := s.db.GetBookByID(ctx, book.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update book: %w", toDomainError(err))
+		}
+		return s.record(ctx, domain.AuditActionUpdate, domain.AuditEntityBook, book.ID, toDomainBook(before), toDomainBook(after))
+	})
+}
 
+func (s *booksService) BorrowBook(ctx context.Context, bookID int, request domain.LoanRequest) error {
+	userID, err := borrower(ctx, request)
+	if err != nil {
+		return fmt.Errorf("failed to borrow book: %w", err)
+	}
+	err = s.db.WithinRepeatableReadTx(ctx, func(ctx context.Context) error {
+		role, err := s.borrowerRole(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to borrow book: %w", err)
+		}
+		err = s.db.BorrowBook(ctx, database.NewBorrowingRecord{
+			BookID:     bookID,
+			UserID:     userID,
+			Role:       role,
+			BorrowedAt: time.Now(),
+			Status:     database.LoanStatusBorrowed,
+		})
+		if err != nil {
+			err = toDomainError(err)
+			countRejection(err)
+			return fmt.Errorf("failed to borrow book: %w", err)
+		}
+		return s.record(ctx, domain.AuditActionBorrow, domain.AuditEntityBook, bookID, nil, domain.LoanRequest{UserID: userID})
+	})
+	if err != nil {
+		return err
+	}
+	booksBorrowed.Inc()
 	return nil
 }
 
-func (s *booksService) DeleteBook(ctx context.Context, id int) error {
-	err := s.db.DeleteBook(ctx, id)
+func (s *booksService) ReserveBook(ctx context.Context, bookID int, request domain.LoanRequest) error {
+	userID, err := borrower(ctx, request)
 	if err != nil {
-		return fmt.Errorf("failed to delete book: %w", err)
+		return fmt.Errorf("failed to reserve book: %w", err)
 	}
+	err = s.db.WithinRepeatableReadTx(ctx, func(ctx context.Context) error {
+		role, err := s.borrowerRole(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to reserve book: %w", err)
+		}
+		err = s.db.BorrowBook(ctx, database.NewBorrowingRecord{
+			BookID:     bookID,
+			UserID:     userID,
+			Role:       role,
+			BorrowedAt: time.Now(),
+			Status:     database.LoanStatusReserved,
+		})
+		if err != nil {
+			err = toDomainError(err)
+			countRejection(err)
+			return fmt.Errorf("failed to reserve book: %w", err)
+		}
+		return s.record(ctx, domain.AuditActionReserve, domain.AuditEntityBook, bookID, nil, domain.LoanRequest{UserID: userID})
+	})
+	if err != nil {
+		return err
+	}
+	booksReserved.Inc()
+	return nil
+}
 
+func (s *booksService) ReturnBook(ctx context.Context, bookID int, request domain.LoanRequest) error {
+	userID, err := borrower(ctx, request)
+	if err != nil {
+		return fmt.Errorf("failed to return book: %w", err)
+	}
+	err = s.db.WithinTx(ctx, func(ctx context.Context) error {
+		err := s.db.ReturnBook(ctx, database.BorrowingRecord{
+			BookID: bookID,
+			UserID: userID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to return book: %w", toDomainError(err))
+		}
+		return s.record(ctx, domain.AuditActionReturn, domain.AuditEntityBook, bookID, nil, domain.LoanRequest{UserID: userID})
+	})
+	if err != nil {
+		return err
+	}
+	booksReturned.Inc()
 	return nil
 }
 
-func (s *booksService) UpdateBook(ctx context.Context, book domain.Book) error {
-	dbBook := database.Book{
-		Title:       book.Title,
-		AuthorID:    book.AuthorID,
-		ISBN:        book.ISBN,
-		Description: book.Description,
-		ID:          book.ID,
+// borrower returns the user a loan request is for, the caller unless an admin names
+// another user
+func borrower(ctx context.Context, request domain.LoanRequest) (int, error) {
+	actor := domain.ActorFromContext(ctx)
+	callerID, _ := strconv.Atoi(actor.ID)
+	switch {
+	case request.UserID == 0 && callerID == 0:
+		return 0, domain.ErrMissingUser
+	case request.UserID == 0 || request.UserID == callerID:
+		return callerID, nil
+	case actor.Role == "admin":
+		return request.UserID, nil
+	}
+	return 0, domain.ErrNotLoanOwner
+}
+
+// borrowerRole returns the role deciding the loan limit of userID. Users borrowing for
+// themselves are known by their caller role, for the users an admin lends to it is the
+// role they last acted with in the audit log, none if they never did, so that the
+// default limit applies to them and never the one of the admin.
+func (s *booksService) borrowerRole(ctx context.Context, userID int) (string, error) {
+	actor := domain.ActorFromContext(ctx)
+	if actor.ID == strconv.Itoa(userID) {
+		return actor.Role, nil
 	}
+	entries, err := s.db.ListAuditEntries(ctx, database.AuditFilter{Actor: strconv.Itoa(userID)}, 1, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up the role of user %d: %w", userID, err)
+	}
+	if len(entries) == 0 {
+		return "", nil
+	}
+	return entries[0].ActorRole, nil
+}
 
-	err := s.db.UpdateBook(ctx, dbBook)
+func (s *booksService) GetLoans(ctx context.Context, query domain.LoanQuery) ([]domain.Loan, error) {
+	records, err := s.db.ListLoans(ctx, database.LoanFilter{
+		UserID: query.UserID,
+		BookID: query.BookID,
+		State:  query.State,
+		Now:    time.Now(),
+	}, query.Limit, query.Offset)
 	if err != nil {
-		return fmt.Errorf("failed to update book: %w", err)
+		return nil, fmt.Errorf("failed to load loans: %w", err)
 	}
 
+	loans := make([]domain.Loan, 0, len(records))
+	for _, record := range records {
+		loans = append(loans, toDomainLoan(record))
+	}
+
+	return loans, nil
+}
+
+func (s *booksService) UpdateLoanStatus(ctx context.Context, loanID int, status string) (domain.Loan, error) {
+	var loan domain.Loan
+	err := s.db.WithinTx(ctx, func(ctx context.Context) error {
+		record, err := s.db.UpdateLoanStatus(ctx, loanID, status, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to update loan status: %w", toDomainError(err))
+		}
+
+		loan = toDomainLoan(record)
+		return s.record(ctx, domain.AuditActionUpdateStatus, domain.AuditEntityLoan, loanID, nil, loan)
+	})
+	if err != nil {
+		return domain.Loan{}, err
+	}
+	return loan, nil
+}
+
+func (s *booksService) RenewLoan(ctx context.Context, userID, loanID int) (domain.Loan, error) {
+	var loan domain.Loan
+	err := s.db.WithinTx(ctx, func(ctx context.Context) error {
+		record, err := s.db.RenewLoan(ctx, userID, loanID, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to renew loan: %w", toDomainError(err))
+		}
+
+		loan = toDomainLoan(record)
+		return s.record(ctx, domain.AuditActionUpdateStatus, domain.AuditEntityLoan, loanID, nil, loan)
+	})
+	if err != nil {
+		return domain.Loan{}, err
+	}
+	return loan, nil
+}
+
+func toDomainBook(record database.Book) domain.Book {
+	return domain.Book{
+		ID:          record.ID,
+		Title:       record.Title,
+		AuthorID:    record.AuthorID,
+		CategoryID:  record.CategoryID,
+		PublishDate: record.PublishedDate,
+		Description: record.Description,
+		ISBN:        record.ISBN,
+		ISBN10:      isbn10(record.ISBN),
+		DeletedAt:   record.DeletedAt,
+	}
+}
+
+func toDatabaseFilter(filter domain.BookFilter) database.BookFilter {
+	return database.BookFilter{
+		AuthorID:       filter.AuthorID,
+		CategoryID:     filter.CategoryID,
+		IncludeDeleted: filter.IncludeDeleted,
+	}
+}
+
+// normalizeBookISBN stores the ISBN of a book in its unhyphenated ISBN-13 form,
+// books without an ISBN are left alone
+func normalizeBookISBN(book *domain.Book) error {
+	if book.ISBN == "" {
+		return nil
+	}
+	normalized, err := domain.NormalizeISBN(book.ISBN)
+	if err != nil {
+		return err
+	}
+	book.ISBN = normalized
 	return nil
 }
+
+// isbn10 returns the ISBN-10 form of a stored ISBN or "" if it has none
+func isbn10(isbn string) string {
+	converted, err := domain.ISBN13To10(isbn)
+	if err != nil {
+		return ""
+	}
+	return converted
+}
+
+func toDomainLoan(record database.BorrowingRecord) domain.Loan {
+	return domain.Loan{
+		ID:         record.ID,
+		BookID:     record.BookID,
+		UserID:     record.UserID,
+		BorrowedAt: record.BorrowedAt,
+		DueDate:    record.DueDate,
+		ReturnedAt: record.ReturnedAt,
+		Status:     record.Status,
+		Renewals:   record.Renewals,
+	}
+}
+
+// toDomainError maps database errors the handlers need to tell apart onto domain errors
+func toDomainError(err error) error {
+	var (
+		ruleErr       *database.LoanRuleError
+		transitionErr *database.LoanTransitionError
+	)
+	switch {
+	case errors.As(err, &ruleErr):
+		return &domain.LoanRuleError{Rule: ruleErr.Rule, Reason: ruleErr.Reason}
+	case errors.As(err, &transitionErr):
+		return fmt.Errorf("%w: %s", domain.ErrInvalidLoanTransition, transitionErr.Error())
+	case errors.Is(err, database.ErrLoanNotFound):
+		return domain.ErrLoanNotFound
+	case errors.Is(err, database.ErrBookNotFound):
+		return domain.ErrBookNotFound
+	case errors.Is(err, database.ErrBookNotAvailable):
+		return domain.ErrBookNotAvailable
+	case errors.Is(err, database.ErrBookOnLoan):
+		return domain.ErrBookOnLoan
+	case errors.Is(err, database.ErrDuplicateISBN):
+		return domain.ErrDuplicateISBN
+	case errors.Is(err, database.ErrInvalidCursor):
+		return domain.ErrInvalidCursor
+	case errors.Is(err, database.ErrInvalidSort):
+		return domain.ErrInvalidSort
+	case errors.Is(err, database.ErrWebhookNotFound):
+		return domain.ErrWebhookNotFound
+	case errors.Is(err, database.ErrDeliveryNotFound):
+		return domain.ErrDeliveryNotFound
+	case errors.Is(err, database.ErrDeliveryNotDead):
+		return domain.ErrDeliveryNotDead
+	}
+	return err
+}
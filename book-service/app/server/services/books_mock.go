@@ -2,6 +2,8 @@ package services
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"app/server/domain"
 
@@ -12,12 +14,9 @@ type BooksServiceMock struct {
 	mock.Mock
 }
 
-func (m *BooksServiceMock) GetBooks(ctx context.Context) ([]domain.Book, error) {
-	args := m.Called(ctx)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).([]domain.Book), args.Error(1)
+func (m *BooksServiceMock) GetBooks(ctx context.Context, query domain.BookQuery) (domain.BooksResponse, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).(domain.BooksResponse), args.Error(1)
 }
 
 func (m *BooksServiceMock) SaveBook(ctx context.Context, newBook domain.Book) error {
@@ -29,3 +28,137 @@ func (m *BooksServiceMock) DeleteBook(ctx context.Context, id int) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
+
+func (m *BooksServiceMock) RestoreBook(ctx context.Context, id int) (domain.Book, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(domain.Book), args.Error(1)
+}
+
+func (m *BooksServiceMock) PurgeBooks(ctx context.Context, before time.Time) (int, error) {
+	args := m.Called(ctx, before)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *BooksServiceMock) GetBook(ctx context.Context, id int) (domain.Book, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(domain.Book), args.Error(1)
+}
+
+func (m *BooksServiceMock) UpdateBook(ctx context.Context, book domain.Book) error {
+	args := m.Called(ctx, book)
+	return args.Error(0)
+}
+
+func (m *BooksServiceMock) BorrowBook(ctx context.Context, bookID int, request domain.LoanRequest) error {
+	args := m.Called(ctx, bookID, request)
+	return args.Error(0)
+}
+
+func (m *BooksServiceMock) ReturnBook(ctx context.Context, bookID int, request domain.LoanRequest) error {
+	args := m.Called(ctx, bookID, request)
+	return args.Error(0)
+}
+
+func (m *BooksServiceMock) GetLoans(ctx context.Context, query domain.LoanQuery) ([]domain.Loan, error) {
+	args := m.Called(ctx, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Loan), args.Error(1)
+}
+
+func (m *BooksServiceMock) ReserveBook(ctx context.Context, bookID int, request domain.LoanRequest) error {
+	args := m.Called(ctx, bookID, request)
+	return args.Error(0)
+}
+
+func (m *BooksServiceMock) UpdateLoanStatus(ctx context.Context, loanID int, status string) (domain.Loan, error) {
+	args := m.Called(ctx, loanID, status)
+	return args.Get(0).(domain.Loan), args.Error(1)
+}
+
+func (m *BooksServiceMock) RenewLoan(ctx context.Context, userID, loanID int) (domain.Loan, error) {
+	args := m.Called(ctx, userID, loanID)
+	return args.Get(0).(domain.Loan), args.Error(1)
+}
+
+func (m *BooksServiceMock) SearchBooks(ctx context.Context, query string, limit, offset int) ([]domain.BookSearchHit, error) {
+	args := m.Called(ctx, query, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.BookSearchHit), args.Error(1)
+}
+
+func (m *BooksServiceMock) RecommendBooks(ctx context.Context, query string, limit int) ([]domain.Recommendation, error) {
+	args := m.Called(ctx, query, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Recommendation), args.Error(1)
+}
+
+func (m *BooksServiceMock) GetBookByISBN(ctx context.Context, isbn string) (domain.Book, error) {
+	args := m.Called(ctx, isbn)
+	return args.Get(0).(domain.Book), args.Error(1)
+}
+
+func (m *BooksServiceMock) ImportBooks(ctx context.Context, format string, r io.Reader, dryRun bool) (domain.ImportReport, error) {
+	args := m.Called(ctx, format, r, dryRun)
+	return args.Get(0).(domain.ImportReport), args.Error(1)
+}
+
+func (m *BooksServiceMock) ExportBooks(ctx context.Context, filter domain.BookFilter, sort []domain.SortField, format string, w io.Writer) error {
+	args := m.Called(ctx, filter, sort, format, w)
+	return args.Error(0)
+}
+
+func (m *BooksServiceMock) ReassignAuthorBooks(ctx context.Context, fromAuthorID, toAuthorID int) (domain.ReassignResult, error) {
+	args := m.Called(ctx, fromAuthorID, toAuthorID)
+	return args.Get(0).(domain.ReassignResult), args.Error(1)
+}
+
+func (m *BooksServiceMock) GetAuthorStats(ctx context.Context, authorID int) (domain.AuthorStats, error) {
+	args := m.Called(ctx, authorID)
+	return args.Get(0).(domain.AuthorStats), args.Error(1)
+}
+
+func (m *BooksServiceMock) GetAuditLog(ctx context.Context, query domain.AuditQuery) ([]domain.AuditEntry, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).([]domain.AuditEntry), args.Error(1)
+}
+
+func (m *BooksServiceMock) CreateWebhook(ctx context.Context, subscription domain.WebhookSubscription) (domain.WebhookSubscription, error) {
+	args := m.Called(ctx, subscription)
+	return args.Get(0).(domain.WebhookSubscription), args.Error(1)
+}
+
+func (m *BooksServiceMock) ListWebhooks(ctx context.Context) ([]domain.WebhookSubscription, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]domain.WebhookSubscription), args.Error(1)
+}
+
+func (m *BooksServiceMock) DeleteWebhook(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *BooksServiceMock) GetWebhookDeliveries(ctx context.Context, query domain.WebhookDeliveryQuery) ([]domain.WebhookDelivery, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).([]domain.WebhookDelivery), args.Error(1)
+}
+
+func (m *BooksServiceMock) RetryWebhookDelivery(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *BooksServiceMock) GetNotificationPreferences(ctx context.Context, userID int) (domain.NotificationPreferences, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(domain.NotificationPreferences), args.Error(1)
+}
+
+func (m *BooksServiceMock) UpdateNotificationPreferences(ctx context.Context, preferences domain.NotificationPreferences) (domain.NotificationPreferences, error) {
+	args := m.Called(ctx, preferences)
+	return args.Get(0).(domain.NotificationPreferences), args.Error(1)
+}
@@ -3,36 +3,81 @@ package services
 import (
 	"context"
 	"testing"
+	"time"
 
 	"app/datasources/database"
 	"app/server/domain"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
 func TestGetBooks(t *testing.T) {
 	mockDB := new(database.DatabaseMock)
-	mockDB.On("LoadAllBooks", mock.Anything).Return([]database.Book{{Title: "Title"}}, nil)
+	mockDB.On("ListBooks", mock.Anything, database.BookFilter{}, []database.SortField{{Field: "title"}}, (*database.Cursor)(nil), defaultPageLimit+1).
+		Return([]database.Book{{Title: "Title"}}, nil)
 
 	service := NewBooksService(mockDB)
-	books, err := service.GetBooks(context.Background())
+	response, err := service.GetBooks(context.Background(), domain.BookQuery{})
 	assert.Nil(t, err)
-	assert.Len(t, books, 1)
+	assert.Len(t, response.Books, 1)
+	assert.Empty(t, response.NextCursor)
+}
+
+func TestGetBooks_NextCursor(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	sort := []database.SortField{{Field: "stock", Desc: true}, {Field: "title"}}
+	mockDB.On("ListBooks", mock.Anything, database.BookFilter{CategoryID: 2}, sort, (*database.Cursor)(nil), 3).
+		Return([]database.Book{{ID: 4, Title: "A", Stock: 3}, {ID: 1, Title: "B", Stock: 2}, {ID: 2, Title: "C", Stock: 1}}, nil)
+	mockDB.On("ListBooks", mock.Anything, database.BookFilter{CategoryID: 2}, sort, &database.Cursor{Keys: []string{"2", "B"}, ID: 1}, 3).
+		Return([]database.Book{{ID: 2, Title: "C", Stock: 1}}, nil)
+
+	service := NewBooksService(mockDB)
+	query := domain.BookQuery{Filter: domain.BookFilter{CategoryID: 2}, Sort: "-stock, title", Limit: 2}
+	first, err := service.GetBooks(context.Background(), query)
+	assert.Nil(t, err)
+	assert.Len(t, first.Books, 2)
+	assert.NotEmpty(t, first.NextCursor)
+
+	query.After = first.NextCursor
+	second, err := service.GetBooks(context.Background(), query)
+	assert.Nil(t, err)
+	assert.Len(t, second.Books, 1)
+	assert.Empty(t, second.NextCursor)
+
+	// a cursor only continues the sort it was issued for
+	query.Sort = "title"
+	_, err = service.GetBooks(context.Background(), query)
+	assert.ErrorIs(t, err, domain.ErrInvalidCursor)
+}
+
+func TestGetBooks_InvalidSort(t *testing.T) {
+	service := NewBooksService(new(database.DatabaseMock))
+	_, err := service.GetBooks(context.Background(), domain.BookQuery{Sort: "-isbn"})
+	assert.ErrorIs(t, err, domain.ErrInvalidSort)
+}
+
+func TestGetBooks_InvalidCursor(t *testing.T) {
+	service := NewBooksService(new(database.DatabaseMock))
+	_, err := service.GetBooks(context.Background(), domain.BookQuery{After: "not a cursor"})
+	assert.ErrorIs(t, err, domain.ErrInvalidCursor)
 }
 
 func TestGetBooks_Fails(t *testing.T) {
 	mockDB := new(database.DatabaseMock)
-	mockDB.On("LoadAllBooks", mock.Anything).Return(nil, assert.AnError)
+	mockDB.On("ListBooks", mock.Anything, database.BookFilter{}, []database.SortField{{Field: "title"}}, (*database.Cursor)(nil), defaultPageLimit+1).
+		Return(nil, assert.AnError)
 
 	service := NewBooksService(mockDB)
-	_, err := service.GetBooks(context.Background())
+	_, err := service.GetBooks(context.Background(), domain.BookQuery{})
 	assert.NotNil(t, err)
 }
 
 func TestSaveBook(t *testing.T) {
 	mockDB := new(database.DatabaseMock)
-	mockDB.On("CreateBook", mock.Anything, database.NewBook{Title: "Title"}).Return(nil)
+	mockDB.On("CreateBook", mock.Anything, database.NewBook{Title: "Title", Stock: 12}).Return(3, nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
 
 	service := NewBooksService(mockDB)
 	err := service.SaveBook(context.Background(), domain.Book{Title: "Title"})
@@ -41,27 +86,280 @@ func TestSaveBook(t *testing.T) {
 
 func TestSaveBook_Fails(t *testing.T) {
 	mockDB := new(database.DatabaseMock)
-	mockDB.On("CreateBook", mock.Anything, database.NewBook{Title: "Title"}).Return(assert.AnError)
+	mockDB.On("CreateBook", mock.Anything, database.NewBook{Title: "Title", Stock: 12}).Return(0, assert.AnError)
 
 	service := NewBooksService(mockDB)
 	err := service.SaveBook(context.Background(), domain.Book{Title: "Title"})
 	assert.NotNil(t, err)
 }
 
+func TestSaveBook_NormalizesISBN(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("CreateBook", mock.Anything, database.NewBook{Title: "Title", ISBN: "9780735211292", Stock: 12}).Return(3, nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
+
+	service := NewBooksService(mockDB)
+	err := service.SaveBook(context.Background(), domain.Book{Title: "Title", ISBN: "0-7352-1129-9"})
+	assert.Nil(t, err)
+}
+
+func TestSaveBook_InvalidISBN(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+
+	service := NewBooksService(mockDB)
+	err := service.SaveBook(context.Background(), domain.Book{Title: "Title", ISBN: "978-0-7352-1129-3"})
+	assert.ErrorIs(t, err, domain.ErrInvalidISBN)
+	mockDB.AssertNotCalled(t, "CreateBook", mock.Anything, mock.Anything)
+}
+
+func TestSaveBook_DuplicateISBN(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("CreateBook", mock.Anything, mock.Anything).Return(0, database.ErrDuplicateISBN)
+
+	service := NewBooksService(mockDB)
+	err := service.SaveBook(context.Background(), domain.Book{Title: "Title", ISBN: "9780735211292"})
+	assert.ErrorIs(t, err, domain.ErrDuplicateISBN)
+}
+
+func TestGetBookByISBN(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetBookByISBN", mock.Anything, "9780735211292").
+		Return(database.Book{ID: 2, Title: "Atomic Habits", ISBN: "9780735211292"}, nil)
+
+	service := NewBooksService(mockDB)
+	book, err := service.GetBookByISBN(context.Background(), "0735211299")
+	assert.Nil(t, err)
+	assert.Equal(t, domain.Book{ID: 2, Title: "Atomic Habits", ISBN: "9780735211292", ISBN10: "0735211299"}, book)
+}
+
+func TestGetBookByISBN_NotFound(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetBookByISBN", mock.Anything, "9780735211292").Return(database.Book{}, database.ErrBookNotFound)
+
+	service := NewBooksService(mockDB)
+	_, err := service.GetBookByISBN(context.Background(), "978-0-7352-1129-2")
+	assert.ErrorIs(t, err, domain.ErrBookNotFound)
+}
+
 func TestDeleteBook(t *testing.T) {
 	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetBookByID", mock.Anything, 1).Return(database.Book{ID: 1, Title: "Title"}, nil)
 	mockDB.On("DeleteBook", mock.Anything, 1).Return(nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
 
 	service := NewBooksService(mockDB)
 	err := service.DeleteBook(context.Background(), 1)
 	assert.Nil(t, err)
 }
 
+func TestDeleteBook_NotFound(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetBookByID", mock.Anything, 1).Return(database.Book{}, database.ErrBookNotFound)
+
+	service := NewBooksService(mockDB)
+	err := service.DeleteBook(context.Background(), 1)
+	assert.ErrorIs(t, err, domain.ErrBookNotFound)
+	mockDB.AssertNotCalled(t, "DeleteBook", mock.Anything, mock.Anything)
+	mockDB.AssertNotCalled(t, "AddAuditEntry", mock.Anything, mock.Anything)
+}
+
+func TestRestoreBook(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("RestoreBook", mock.Anything, 1).Return(nil)
+	mockDB.On("GetBookByID", mock.Anything, 1).Return(database.Book{ID: 1, Title: "Title"}, nil)
+	mockDB.On("RestoreBook", mock.Anything, 2).Return(database.ErrBookNotFound)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
+
+	service := NewBooksService(mockDB)
+	book, err := service.RestoreBook(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "Title", book.Title)
+
+	_, err = service.RestoreBook(context.Background(), 2)
+	assert.ErrorIs(t, err, domain.ErrBookNotFound)
+}
+
 func TestUpdateBook(t *testing.T) {
 	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetBookByID", mock.Anything, 1).Return(database.Book{ID: 1, Title: "Old", AuthorID: 1}, nil).Once()
 	mockDB.On("UpdateBook", mock.Anything, database.Book{ID: 1, Title: "Title", AuthorID: 1, Description: "empty desc"}).Return(nil)
+	mockDB.On("GetBookByID", mock.Anything, 1).Return(database.Book{ID: 1, Title: "Title", AuthorID: 1, Description: "empty desc"}, nil).Once()
+	mockDB.On("AddAuditEntry", mock.Anything, mock.MatchedBy(func(e database.NewAuditEntry) bool {
+		return e.Action == "update" && e.Entity == "book" && e.EntityID == 1 &&
+			string(e.Changes) == `{"description":{"before":"","after":"empty desc"},"title":{"before":"Old","after":"Title"}}`
+	})).Return(nil)
 
 	service := NewBooksService(mockDB)
 	err := service.UpdateBook(context.Background(), domain.Book{ID: 1, Title: "Title", AuthorID: 1, Description: "empty desc"})
 	assert.Nil(t, err)
+	mockDB.AssertExpectations(t)
+}
+
+func TestUpdateBook_KeepsStockCategoryAndPublishDate(t *testing.T) {
+	published := time.Date(1965, 8, 1, 0, 0, 0, 0, time.UTC)
+	stored := database.Book{ID: 1, Title: "Dune", AuthorID: 1, CategoryID: 2, Stock: 3, PublishedDate: published}
+	updated := stored
+	updated.Title = "Dune Messiah"
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetBookByID", mock.Anything, 1).Return(stored, nil).Once()
+	mockDB.On("UpdateBook", mock.Anything, updated).Return(nil)
+	mockDB.On("GetBookByID", mock.Anything, 1).Return(updated, nil).Once()
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
+
+	service := NewBooksService(mockDB)
+	err := service.UpdateBook(context.Background(), domain.Book{ID: 1, Title: "Dune Messiah", AuthorID: 1})
+	assert.Nil(t, err)
+	mockDB.AssertExpectations(t)
+}
+
+func TestUpdateBook_NotFound(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetBookByID", mock.Anything, 1).Return(database.Book{}, database.ErrBookNotFound)
+
+	service := NewBooksService(mockDB)
+	err := service.UpdateBook(context.Background(), domain.Book{ID: 1, Title: "Title"})
+	assert.ErrorIs(t, err, domain.ErrBookNotFound)
+	mockDB.AssertNotCalled(t, "UpdateBook", mock.Anything, mock.Anything)
+}
+
+func TestBorrowBook(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("BorrowBook", mock.Anything, mock.MatchedBy(func(r database.NewBorrowingRecord) bool {
+		return r.BookID == 1 && r.UserID == 2 && r.Role == "member" && time.Since(r.BorrowedAt) < time.Minute
+	})).Return(nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
+
+	borrowed := testutil.ToFloat64(booksBorrowed)
+	service := NewBooksService(mockDB)
+	ctx := domain.WithActor(context.Background(), domain.Actor{ID: "2", Role: "member"})
+	err := service.BorrowBook(ctx, 1, domain.LoanRequest{UserID: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, borrowed+1, testutil.ToFloat64(booksBorrowed))
+	mockDB.AssertExpectations(t)
+}
+
+func TestBorrowBook_RuleViolation(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("BorrowBook", mock.Anything, mock.Anything).
+		Return(&database.LoanRuleError{Rule: database.RuleMaxLoans, Reason: "too many"})
+
+	rejected := testutil.ToFloat64(loanRejections.WithLabelValues(database.RuleMaxLoans))
+	service := NewBooksService(mockDB)
+	err := service.BorrowBook(domain.WithActor(context.Background(), domain.Actor{ID: "2", Role: "member"}), 1, domain.LoanRequest{})
+
+	var ruleErr *domain.LoanRuleError
+	assert.ErrorAs(t, err, &ruleErr)
+	assert.Equal(t, database.RuleMaxLoans, ruleErr.Rule)
+	assert.Equal(t, rejected+1, testutil.ToFloat64(loanRejections.WithLabelValues(database.RuleMaxLoans)))
+}
+
+func TestBorrowBook_NotAvailable(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("BorrowBook", mock.Anything, mock.Anything).Return(database.ErrBookNotAvailable)
+
+	rejected := testutil.ToFloat64(loanRejections.WithLabelValues("out_of_stock"))
+	service := NewBooksService(mockDB)
+	err := service.BorrowBook(domain.WithActor(context.Background(), domain.Actor{ID: "2", Role: "member"}), 1, domain.LoanRequest{})
+	assert.ErrorIs(t, err, domain.ErrBookNotAvailable)
+	assert.Equal(t, rejected+1, testutil.ToFloat64(loanRejections.WithLabelValues("out_of_stock")))
+}
+
+func TestBorrowBook_ForAnotherUser(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("ListAuditEntries", mock.Anything, database.AuditFilter{Actor: "5"}, 1, 0).
+		Return([]database.AuditEntry{{Actor: "5", ActorRole: "student"}}, nil)
+	mockDB.On("BorrowBook", mock.Anything, mock.MatchedBy(func(r database.NewBorrowingRecord) bool {
+		return r.UserID == 5 && r.Role == "student"
+	})).Return(nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
+
+	// the loan limit of the borrower applies, not the one of the admin
+	service := NewBooksService(mockDB)
+	ctx := domain.WithActor(context.Background(), domain.Actor{ID: "1", Role: "admin"})
+	assert.Nil(t, service.BorrowBook(ctx, 1, domain.LoanRequest{UserID: 5}))
+	mockDB.AssertExpectations(t)
+}
+
+func TestBorrowBook_NotOwner(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+
+	service := NewBooksService(mockDB)
+	ctx := domain.WithActor(context.Background(), domain.Actor{ID: "2", Role: "member"})
+	assert.ErrorIs(t, service.BorrowBook(ctx, 1, domain.LoanRequest{UserID: 5}), domain.ErrNotLoanOwner)
+	assert.ErrorIs(t, service.ReserveBook(ctx, 1, domain.LoanRequest{UserID: 5}), domain.ErrNotLoanOwner)
+	assert.ErrorIs(t, service.ReturnBook(ctx, 1, domain.LoanRequest{UserID: 5}), domain.ErrNotLoanOwner)
+	assert.ErrorIs(t, service.BorrowBook(context.Background(), 1, domain.LoanRequest{}), domain.ErrMissingUser)
+	mockDB.AssertNotCalled(t, "BorrowBook", mock.Anything, mock.Anything)
+	mockDB.AssertNotCalled(t, "ReturnBook", mock.Anything, mock.Anything)
+}
+
+func TestGetLoans(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("ListLoans", mock.Anything, mock.MatchedBy(func(f database.LoanFilter) bool {
+		return f.UserID == 7 && f.State == database.LoanStateCurrent && !f.Now.IsZero()
+	}), 10, 5).Return([]database.BorrowingRecord{{ID: 1, UserID: 7, BookID: 3, Status: database.LoanStatusBorrowed}}, nil)
+
+	service := NewBooksService(mockDB)
+	loans, err := service.GetLoans(context.Background(), domain.LoanQuery{UserID: 7, State: domain.LoanStateCurrent, Limit: 10, Offset: 5})
+	assert.Nil(t, err)
+	assert.Equal(t, []domain.Loan{{ID: 1, UserID: 7, BookID: 3, Status: "borrowed"}}, loans)
+}
+
+func TestGetLoans_Fails(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("ListLoans", mock.Anything, mock.Anything, 10, 0).Return(nil, assert.AnError)
+
+	service := NewBooksService(mockDB)
+	_, err := service.GetLoans(context.Background(), domain.LoanQuery{BookID: 3, Limit: 10})
+	assert.NotNil(t, err)
+}
+
+func TestUpdateLoanStatus(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("UpdateLoanStatus", mock.Anything, 9, database.LoanStatusLost, mock.Anything).
+		Return(database.BorrowingRecord{ID: 9, Status: database.LoanStatusLost}, nil)
+	mockDB.On("AddAuditEntry", mock.Anything, mock.Anything).Return(nil)
+
+	service := NewBooksService(mockDB)
+	loan, err := service.UpdateLoanStatus(context.Background(), 9, "lost")
+	assert.Nil(t, err)
+	assert.Equal(t, domain.Loan{ID: 9, Status: "lost"}, loan)
+}
+
+func TestUpdateLoanStatus_InvalidTransition(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("UpdateLoanStatus", mock.Anything, 9, database.LoanStatusRenewed, mock.Anything).
+		Return(database.BorrowingRecord{}, &database.LoanTransitionError{From: database.LoanStatusOverdue, To: database.LoanStatusRenewed})
+
+	service := NewBooksService(mockDB)
+	_, err := service.UpdateLoanStatus(context.Background(), 9, "renewed")
+	assert.ErrorIs(t, err, domain.ErrInvalidLoanTransition)
+	assert.ErrorContains(t, err, "loan cannot move from overdue to renewed")
+}
+
+func TestRenewLoan_LimitReached(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("RenewLoan", mock.Anything, 7, 9, mock.Anything).
+		Return(database.BorrowingRecord{}, &database.LoanRuleError{Rule: database.RuleMaxRenewals, Reason: "too many"})
+
+	service := NewBooksService(mockDB)
+	_, err := service.RenewLoan(context.Background(), 7, 9)
+
+	var ruleErr *domain.LoanRuleError
+	assert.ErrorAs(t, err, &ruleErr)
+	assert.Equal(t, database.RuleMaxRenewals, ruleErr.Rule)
+}
+
+func TestSearchBooks(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("SearchBooks", mock.Anything, "habits", 10, 0).Return([]database.BookSearchResult{
+		{Book: database.Book{ID: 2, Title: "Atomic Habits"}, Rank: 0.9, Snippet: "Atomic <mark>Habits</mark>"},
+	}, nil)
+
+	service := NewBooksService(mockDB)
+	hits, err := service.SearchBooks(context.Background(), "habits", 10, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []domain.BookSearchHit{
+		{Book: domain.Book{ID: 2, Title: "Atomic Habits"}, Score: 0.9, Snippet: "Atomic <mark>Habits</mark>"},
+	}, hits)
 }
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"app/datasources/database"
+	"app/server/domain"
+)
+
+// cursorPayload is the content of an opaque page cursor, it records the sort
+// it was issued for so it cannot be replayed against another one
+type cursorPayload struct {
+	Sort string   `json:"s"`
+	Keys []string `json:"k"`
+	ID   int      `json:"id"`
+}
+
+// encodeCursor returns the cursor of the page after the given keyset position
+func encodeCursor(sort string, cursor database.Cursor) string {
+	data, _ := json.Marshal(cursorPayload{Sort: sort, Keys: cursor.Keys, ID: cursor.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor from a previous response listed with the same sort,
+// an empty cursor selects the first page
+func decodeCursor(cursor, sort string) (*database.Cursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, domain.ErrInvalidCursor
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil || payload.Sort != sort {
+		return nil, domain.ErrInvalidCursor
+	}
+	return &database.Cursor{Keys: payload.Keys, ID: payload.ID}, nil
+}
+
+// toDatabaseSort converts a parsed sort for the database layer
+func toDatabaseSort(fields []domain.SortField) []database.SortField {
+	sort := make([]database.SortField, 0, len(fields))
+	for _, field := range fields {
+		sort = append(sort, database.SortField{Field: field.Field, Desc: field.Desc})
+	}
+	return sort
+}
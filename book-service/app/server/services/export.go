@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"app/datasources/database"
+	"app/server/domain"
+)
+
+// onixSender names this service in the header of ONIX exports
+const onixSender = "library-management book-service"
+
+// exportColumns are the CSV columns of an export, they are accepted back by ImportBooks
+var exportColumns = []string{"id", "title", "isbn", "author_id", "category_id", "publish_date", "description", "stock"}
+
+// exportRecord is a book as written to a JSON Lines export
+type exportRecord struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	ISBN        string `json:"isbn"`
+	AuthorID    int    `json:"author_id"`
+	CategoryID  int    `json:"category_id"`
+	PublishDate string `json:"publish_date"`
+	Description string `json:"description"`
+	Stock       int    `json:"stock"`
+}
+
+// ExportBooks writes the books matching filter to w in sort order one at a time as they
+// are read from the database. Nothing is written when the format is not supported.
+func (s *booksService) ExportBooks(ctx context.Context, filter domain.BookFilter, sort []domain.SortField, format string, w io.Writer) error {
+	var err error
+	switch format {
+	case domain.ExportFormatCSV:
+		err = s.exportCSV(ctx, filter, sort, w)
+	case domain.ExportFormatJSONL:
+		err = s.exportJSONL(ctx, filter, sort, w)
+	case domain.ExportFormatXML:
+		err = s.exportONIX(ctx, filter, sort, w)
+	default:
+		return domain.ErrUnsupportedExportFormat
+	}
+	if err != nil {
+		return fmt.Errorf("failed to export books: %w", err)
+	}
+	return nil
+}
+
+func (s *booksService) exportCSV(ctx context.Context, filter domain.BookFilter, sort []domain.SortField, w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportColumns); err != nil {
+		return err
+	}
+	err := s.db.StreamBooks(ctx, toDatabaseFilter(filter), toDatabaseSort(sort), func(book database.Book) error {
+		return writer.Write([]string{
+			strconv.Itoa(book.ID),
+			book.Title,
+			book.ISBN,
+			strconv.Itoa(book.AuthorID),
+			strconv.Itoa(book.CategoryID),
+			formatPublishDate(book.PublishedDate),
+			book.Description,
+			strconv.Itoa(book.Stock),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (s *booksService) exportJSONL(ctx context.Context, filter domain.BookFilter, sort []domain.SortField, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	return s.db.StreamBooks(ctx, toDatabaseFilter(filter), toDatabaseSort(sort), func(book database.Book) error {
+		return encoder.Encode(exportRecord{
+			ID:          book.ID,
+			Title:       book.Title,
+			ISBN:        book.ISBN,
+			AuthorID:    book.AuthorID,
+			CategoryID:  book.CategoryID,
+			PublishDate: formatPublishDate(book.PublishedDate),
+			Description: book.Description,
+			Stock:       book.Stock,
+		})
+	})
+}
+
+// onixHeader is the header of an ONIX for Books 3.0 message
+type onixHeader struct {
+	XMLName      xml.Name `xml:"Header"`
+	SenderName   string   `xml:"Sender>SenderName"`
+	SentDateTime string   `xml:"SentDateTime"`
+}
+
+type onixIdentifier struct {
+	ProductIDType string `xml:"ProductIDType"`
+	IDTypeName    string `xml:"IDTypeName,omitempty"`
+	IDValue       string `xml:"IDValue"`
+}
+
+// onixProduct is the subset of an ONIX product record the catalog can fill in
+type onixProduct struct {
+	XMLName           xml.Name         `xml:"Product"`
+	RecordReference   string           `xml:"RecordReference"`
+	NotificationType  string           `xml:"NotificationType"`
+	Identifiers       []onixIdentifier `xml:"ProductIdentifier"`
+	TitleType         string           `xml:"DescriptiveDetail>TitleDetail>TitleType"`
+	TitleLevel        string           `xml:"DescriptiveDetail>TitleDetail>TitleElement>TitleElementLevel"`
+	TitleText         string           `xml:"DescriptiveDetail>TitleDetail>TitleElement>TitleText"`
+	ContributorRole   string           `xml:"DescriptiveDetail>Contributor>ContributorRole"`
+	ContributorIDType string           `xml:"DescriptiveDetail>Contributor>NameIdentifier>NameIDType"`
+	ContributorIDName string           `xml:"DescriptiveDetail>Contributor>NameIdentifier>IDTypeName"`
+	ContributorID     int              `xml:"DescriptiveDetail>Contributor>NameIdentifier>IDValue"`
+	SubjectScheme     string           `xml:"DescriptiveDetail>Subject>SubjectSchemeIdentifier"`
+	SubjectName       string           `xml:"DescriptiveDetail>Subject>SubjectSchemeName"`
+	SubjectCode       int              `xml:"DescriptiveDetail>Subject>SubjectCode"`
+	TextType          string           `xml:"CollateralDetail>TextContent>TextType,omitempty"`
+	TextAudience      string           `xml:"CollateralDetail>TextContent>ContentAudience,omitempty"`
+	Text              string           `xml:"CollateralDetail>TextContent>Text,omitempty"`
+	DateRole          string           `xml:"PublishingDetail>PublishingDate>PublishingDateRole,omitempty"`
+	Date              string           `xml:"PublishingDetail>PublishingDate>Date,omitempty"`
+}
+
+// exportONIX writes an ONIX-style message, codes come from the ONIX code lists:
+// product identifier 15 is an ISBN-13, 01 a proprietary id, title type 01 the
+// distinctive title, contributor role A01 the author, text type 03 the description
+// and publishing date role 01 the publication date
+func (s *booksService) exportONIX(ctx context.Context, filter domain.BookFilter, sort []domain.SortField, w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	message := xml.StartElement{
+		Name: xml.Name{Local: "ONIXMessage"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "xmlns"}, Value: "http://ns.editeur.org/onix/3.0/reference"},
+			{Name: xml.Name{Local: "release"}, Value: "3.0"},
+		},
+	}
+	if err := encoder.EncodeToken(message); err != nil {
+		return err
+	}
+	header := onixHeader{SenderName: onixSender, SentDateTime: time.Now().UTC().Format("20060102T1504Z")}
+	if err := encoder.Encode(header); err != nil {
+		return err
+	}
+
+	err := s.db.StreamBooks(ctx, toDatabaseFilter(filter), toDatabaseSort(sort), func(book database.Book) error {
+		product := onixProduct{
+			RecordReference:  "book-" + strconv.Itoa(book.ID),
+			NotificationType: "03",
+			Identifiers: []onixIdentifier{
+				{ProductIDType: "01", IDTypeName: "book-id", IDValue: strconv.Itoa(book.ID)},
+			},
+			TitleType:         "01",
+			TitleLevel:        "01",
+			TitleText:         book.Title,
+			ContributorRole:   "A01",
+			ContributorIDType: "01",
+			ContributorIDName: "author-id",
+			ContributorID:     book.AuthorID,
+			SubjectScheme:     "24",
+			SubjectName:       "category-id",
+			SubjectCode:       book.CategoryID,
+		}
+		if book.ISBN != "" {
+			product.Identifiers = append(product.Identifiers, onixIdentifier{ProductIDType: "15", IDValue: book.ISBN})
+		}
+		if book.Description != "" {
+			product.TextType, product.TextAudience, product.Text = "03", "00", book.Description
+		}
+		if !book.PublishedDate.IsZero() {
+			product.DateRole, product.Date = "01", book.PublishedDate.Format("20060102")
+		}
+		return encoder.Encode(product)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := encoder.EncodeToken(message.End()); err != nil {
+		return err
+	}
+	return encoder.Flush()
+}
+
+func formatPublishDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+	return date.Format(time.DateOnly)
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"app/datasources/database"
+	"app/server/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newExportDB(t *testing.T) database.Database {
+	db, err := database.NewDatabase(context.Background(), "", database.PoolConfig{}, database.DefaultLoanPolicy())
+	require.NoError(t, err)
+	_, err = db.CreateBooks(context.Background(), []database.NewBook{
+		{Title: "Atomic Habits", ISBN: "9780735211292", AuthorID: 1, CategoryID: 1, Stock: 4,
+			PublishedDate: time.Date(2018, 10, 16, 0, 0, 0, 0, time.UTC), Description: "Tiny changes, remarkable results"},
+		{Title: "Deep Work", AuthorID: 2, CategoryID: 1, Stock: 2},
+	})
+	require.NoError(t, err)
+	return db
+}
+
+func TestExportBooks_CSV(t *testing.T) {
+	service := NewBooksService(newExportDB(t))
+
+	var out bytes.Buffer
+	err := service.ExportBooks(context.Background(), domain.BookFilter{}, nil, domain.ExportFormatCSV, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "id,title,isbn,author_id,category_id,publish_date,description,stock\n"+
+		"0,Atomic Habits,9780735211292,1,1,2018-10-16,\"Tiny changes, remarkable results\",4\n"+
+		"1,Deep Work,,2,1,,,2\n", out.String())
+}
+
+func TestExportBooks_JSONLFiltered(t *testing.T) {
+	service := NewBooksService(newExportDB(t))
+
+	var out bytes.Buffer
+	err := service.ExportBooks(context.Background(), domain.BookFilter{AuthorID: 2}, nil, domain.ExportFormatJSONL, &out)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":1,"title":"Deep Work","isbn":"","author_id":2,"category_id":1,"publish_date":"","description":"","stock":2}`+"\n", out.String())
+}
+
+func TestExportBooks_Sorted(t *testing.T) {
+	service := NewBooksService(newExportDB(t))
+
+	var out bytes.Buffer
+	err := service.ExportBooks(context.Background(), domain.BookFilter{}, []domain.SortField{{Field: "title", Desc: true}}, domain.ExportFormatCSV, &out)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[1], "1,Deep Work,"))
+	assert.True(t, strings.HasPrefix(lines[2], "0,Atomic Habits,"))
+}
+
+func TestExportBooks_XML(t *testing.T) {
+	service := NewBooksService(newExportDB(t))
+
+	var out bytes.Buffer
+	err := service.ExportBooks(context.Background(), domain.BookFilter{}, nil, domain.ExportFormatXML, &out)
+	require.NoError(t, err)
+
+	xml := out.String()
+	assert.True(t, strings.HasPrefix(xml, `<?xml version="1.0" encoding="UTF-8"?>`))
+	assert.Contains(t, xml, `<ONIXMessage xmlns="http://ns.editeur.org/onix/3.0/reference" release="3.0">`)
+	assert.Equal(t, 2, strings.Count(xml, "<Product>"))
+	assert.Contains(t, xml, "<ProductIDType>15</ProductIDType>\n      <IDValue>9780735211292</IDValue>")
+	assert.Contains(t, xml, "<Date>20181016</Date>")
+	assert.True(t, strings.HasSuffix(xml, "</ONIXMessage>"))
+}
+
+func TestExportBooks_ImportRoundTrip(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, NewBooksService(newExportDB(t)).ExportBooks(context.Background(), domain.BookFilter{}, nil, domain.ExportFormatCSV, &out))
+
+	db, err := database.NewDatabase(context.Background(), "", database.PoolConfig{}, database.DefaultLoanPolicy())
+	require.NoError(t, err)
+	report, err := NewBooksService(db).ImportBooks(context.Background(), domain.ImportFormatCSV, &out, true)
+	require.NoError(t, err)
+	// Deep Work was created without a publish date, which an import requires
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 1, report.Invalid)
+}
+
+func TestExportBooks_UnsupportedFormat(t *testing.T) {
+	service := NewBooksService(new(database.DatabaseMock))
+
+	var out bytes.Buffer
+	err := service.ExportBooks(context.Background(), domain.BookFilter{}, nil, "pdf", &out)
+	assert.ErrorIs(t, err, domain.ErrUnsupportedExportFormat)
+	assert.Zero(t, out.Len())
+}
+
+func TestExportBooks_StreamFails(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("StreamBooks", mock.Anything, database.BookFilter{CategoryID: 3}, []database.SortField{{Field: "title"}}, mock.Anything).
+		Return(assert.AnError)
+
+	service := NewBooksService(mockDB)
+	err := service.ExportBooks(context.Background(), domain.BookFilter{CategoryID: 3}, []domain.SortField{{Field: "title"}}, domain.ExportFormatJSONL, &bytes.Buffer{})
+	assert.ErrorContains(t, err, "failed to export books")
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"app/datasources/database"
+	"app/server/domain"
+)
+
+const (
+	// importBatchSize is how many books are checked and inserted together
+	importBatchSize = 500
+	// maxImportLine bounds a single JSON Lines record
+	maxImportLine = 1 << 20
+)
+
+// importRecord is one row of an import before validation
+type importRecord struct {
+	Title       string `json:"title"`
+	ISBN        string `json:"isbn"`
+	AuthorID    int    `json:"author_id"`
+	CategoryID  int    `json:"category_id"`
+	PublishDate string `json:"publish_date"`
+	Description string `json:"description"`
+	Stock       *int   `json:"stock"`
+}
+
+// parsedRow is a record read from an import with the line it starts on
+// and the error that made it unreadable, if any
+type parsedRow struct {
+	line   int
+	record importRecord
+	err    error
+}
+
+// importCandidate is a valid row waiting to be checked against the catalog
+type importCandidate struct {
+	row  int
+	book database.NewBook
+}
+
+// ImportBooks reads books as CSV with a header row or as JSON Lines, validates
+// every row like a single added book and inserts the valid ones in batches.
+// Rows whose ISBN is already in the catalog or earlier in the import are skipped.
+// A dry run stops before inserting. Batches already inserted stay when a later one fails.
+func (s *booksService) ImportBooks(ctx context.Context, format string, r io.Reader, dryRun bool) (domain.ImportReport, error) {
+	var (
+		parsed []parsedRow
+		err    error
+	)
+	switch format {
+	case domain.ImportFormatCSV:
+		parsed, err = readCSVImport(r)
+	case domain.ImportFormatJSONL:
+		parsed, err = readJSONLImport(r)
+	default:
+		return domain.ImportReport{}, domain.ErrUnsupportedImportFormat
+	}
+	if err != nil {
+		return domain.ImportReport{}, err
+	}
+
+	report := domain.ImportReport{DryRun: dryRun, Rows: make([]domain.ImportRow, len(parsed))}
+	seen := make(map[string]bool)
+	candidates := make([]importCandidate, 0, len(parsed))
+	now := time.Now()
+	for i, p := range parsed {
+		row := &report.Rows[i]
+		row.Line, row.Title, row.ISBN = p.line, p.record.Title, p.record.ISBN
+
+		newBook, err := database.NewBook{}, p.err
+		if err == nil {
+			newBook, err = p.record.validate(now)
+		}
+		switch {
+		case err != nil:
+			row.Status, row.Error = domain.ImportRowInvalid, err.Error()
+		case newBook.ISBN != "" && seen[newBook.ISBN]:
+			row.Status, row.Error = domain.ImportRowSkipped, "isbn appears earlier in the import"
+		default:
+			seen[newBook.ISBN] = newBook.ISBN != ""
+			row.ISBN = newBook.ISBN
+			candidates = append(candidates, importCandidate{row: i, book: newBook})
+		}
+	}
+
+	for start := 0; start < len(candidates); start += importBatchSize {
+		batch := candidates[start:min(start+importBatchSize, len(candidates))]
+		if err := s.importBatch(ctx, batch, report.Rows, dryRun); err != nil {
+			return report, err
+		}
+	}
+
+	for _, row := range report.Rows {
+		switch row.Status {
+		case domain.ImportRowCreated:
+			report.Created++
+		case domain.ImportRowSkipped:
+			report.Skipped++
+		case domain.ImportRowInvalid:
+			report.Invalid++
+		}
+	}
+	return report, nil
+}
+
+// importBatch skips the candidates already in the catalog and inserts the rest
+func (s *booksService) importBatch(ctx context.Context, batch []importCandidate, rows []domain.ImportRow, dryRun bool) error {
+	isbns := make([]string, 0, len(batch))
+	for _, c := range batch {
+		if c.book.ISBN != "" {
+			isbns = append(isbns, c.book.ISBN)
+		}
+	}
+	taken := make(map[string]bool)
+	if len(isbns) > 0 {
+		existing, err := s.db.ExistingISBNs(ctx, isbns)
+		if err != nil {
+			return fmt.Errorf("failed to check isbns: %w", err)
+		}
+		for _, isbn := range existing {
+			taken[isbn] = true
+		}
+	}
+
+	books := make([]database.NewBook, 0, len(batch))
+	for _, c := range batch {
+		if taken[c.book.ISBN] {
+			rows[c.row].Status, rows[c.row].Error = domain.ImportRowSkipped, domain.ErrDuplicateISBN.Error()
+			continue
+		}
+		rows[c.row].Status = domain.ImportRowCreated
+		books = append(books, c.book)
+	}
+	if dryRun || len(books) == 0 {
+		return nil
+	}
+
+	// COPY does not return the new ids, so a batch is recorded as one entry
+	titles := make([]string, 0, len(books))
+	for _, book := range books {
+		titles = append(titles, book.Title)
+	}
+	return s.db.WithinTx(ctx, func(ctx context.Context) error {
+		created, err := s.db.CreateBooks(ctx, books)
+		if err != nil {
+			return fmt.Errorf("failed to import books: %w", toDomainError(err))
+		}
+		return s.record(ctx, domain.AuditActionImport, domain.AuditEntityBook, 0, nil, map[string]any{
+			"created": created,
+			"titles":  titles,
+		})
+	})
+}
+
+// validate applies the AddBook rules to a record and normalizes its ISBN
+func (r importRecord) validate(now time.Time) (database.NewBook, error) {
+	book := domain.Book{
+		Title:       strings.TrimSpace(r.Title),
+		ISBN:        strings.TrimSpace(r.ISBN),
+		AuthorID:    r.AuthorID,
+		CategoryID:  r.CategoryID,
+		Description: r.Description,
+	}
+	if r.PublishDate != "" {
+		publishDate, err := parsePublishDate(r.PublishDate)
+		if err != nil {
+			return database.NewBook{}, err
+		}
+		book.PublishDate = publishDate
+	}
+	if err := domain.ValidateBook(book, now); err != nil {
+		return database.NewBook{}, err
+	}
+	if err := normalizeBookISBN(&book); err != nil {
+		return database.NewBook{}, err
+	}
+
+	stock := defaultStock
+	if r.Stock != nil {
+		if *r.Stock < 0 {
+			return database.NewBook{}, errors.New("stock must not be negative")
+		}
+		stock = *r.Stock
+	}
+	return database.NewBook{
+		Title:         book.Title,
+		ISBN:          book.ISBN,
+		AuthorID:      book.AuthorID,
+		CategoryID:    book.CategoryID,
+		Stock:         stock,
+		PublishedDate: book.PublishDate,
+		Description:   book.Description,
+	}, nil
+}
+
+// parsePublishDate accepts a plain date or an RFC 3339 timestamp
+func parsePublishDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("publish_date %q is not a date", value)
+	}
+	return t, nil
+}
+
+// readCSVImport reads records by header name, unknown columns are ignored.
+// Malformed rows are returned with their error so the rest can still be imported.
+func readCSVImport(r io.Reader) ([]parsedRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &domain.ImportError{Err: fmt.Errorf("failed to read csv header: %w", err)}
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, &domain.ImportError{Err: errors.New("csv header has no title column")}
+	}
+
+	// fields of a row with the wrong number of columns are still returned
+	reader.FieldsPerRecord = -1
+	var rows []parsedRow
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return nil, fmt.Errorf("failed to read csv: %w", err)
+		}
+		var line int
+		if parseErr != nil {
+			line = parseErr.StartLine
+		} else {
+			line, _ = reader.FieldPos(0)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(fields) {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+		record := importRecord{
+			Title:       field("title"),
+			ISBN:        field("isbn"),
+			PublishDate: field("publish_date"),
+			Description: field("description"),
+		}
+		if err == nil {
+			err = record.parseNumbers(field("author_id"), field("category_id"), field("stock"))
+		}
+		rows = append(rows, parsedRow{line: line, record: record, err: err})
+	}
+	return rows, nil
+}
+
+func (r *importRecord) parseNumbers(authorID, categoryID, stock string) error {
+	var err error
+	if authorID != "" {
+		if r.AuthorID, err = strconv.Atoi(authorID); err != nil {
+			return fmt.Errorf("author_id %q is not a number", authorID)
+		}
+	}
+	if categoryID != "" {
+		if r.CategoryID, err = strconv.Atoi(categoryID); err != nil {
+			return fmt.Errorf("category_id %q is not a number", categoryID)
+		}
+	}
+	if stock != "" {
+		n, err := strconv.Atoi(stock)
+		if err != nil {
+			return fmt.Errorf("stock %q is not a number", stock)
+		}
+		r.Stock = &n
+	}
+	return nil
+}
+
+// readJSONLImport reads one JSON object per line, blank lines are ignored
+func readJSONLImport(r io.Reader) ([]parsedRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLine)
+
+	var rows []parsedRow
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var record importRecord
+		err := json.Unmarshal([]byte(text), &record)
+		if err != nil {
+			err = fmt.Errorf("invalid json: %w", err)
+		}
+		rows = append(rows, parsedRow{line: line, record: record, err: err})
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, &domain.ImportError{Err: fmt.Errorf("jsonl lines must not exceed %d bytes", maxImportLine)}
+		}
+		return nil, fmt.Errorf("failed to read jsonl: %w", err)
+	}
+	return rows, nil
+}
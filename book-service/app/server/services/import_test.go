@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"app/datasources/database"
+	"app/server/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const importCSV = `title,isbn,author_id,category_id,publish_date,stock
+Atomic Habits,0-7352-1129-9,1,1,2018-10-16,4
+Deep Work,,3,2,2016-01-05,
+No Date,9780804429573,1,1,,
+Atomic Habits Again,978-0-7352-1129-2,1,1,2018-10-16,
+Bad Author,,x,1,2016-01-05,
+Existing,9780804429573,1,1,2016-01-05,
+`
+
+func newImportDB(t *testing.T) database.Database {
+	db, err := database.NewDatabase(context.Background(), "", database.PoolConfig{}, database.DefaultLoanPolicy())
+	require.NoError(t, err)
+	_, err = db.CreateBook(context.Background(), database.NewBook{Title: "Existing", ISBN: "9780804429573"})
+	require.NoError(t, err)
+	return db
+}
+
+func TestImportBooks_CSV(t *testing.T) {
+	db := newImportDB(t)
+	service := NewBooksService(db)
+
+	report, err := service.ImportBooks(context.Background(), domain.ImportFormatCSV, strings.NewReader(importCSV), false)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, 2, report.Skipped)
+	assert.Equal(t, 2, report.Invalid)
+	assert.Equal(t, []domain.ImportRow{
+		{Line: 2, Status: domain.ImportRowCreated, Title: "Atomic Habits", ISBN: "9780735211292"},
+		{Line: 3, Status: domain.ImportRowCreated, Title: "Deep Work"},
+		{Line: 4, Status: domain.ImportRowInvalid, Title: "No Date", ISBN: "9780804429573", Error: "published date is required"},
+		{Line: 5, Status: domain.ImportRowSkipped, Title: "Atomic Habits Again", ISBN: "978-0-7352-1129-2", Error: "isbn appears earlier in the import"},
+		{Line: 6, Status: domain.ImportRowInvalid, Title: "Bad Author", Error: `author_id "x" is not a number`},
+		{Line: 7, Status: domain.ImportRowSkipped, Title: "Existing", ISBN: "9780804429573", Error: domain.ErrDuplicateISBN.Error()},
+	}, report.Rows)
+
+	books, err := db.LoadAllBooks(context.Background(), database.BookFilter{})
+	require.NoError(t, err)
+	assert.Len(t, books, 3)
+	assert.Equal(t, 4, books[1].Stock)
+	assert.Equal(t, defaultStock, books[2].Stock)
+}
+
+func TestImportBooks_DryRun(t *testing.T) {
+	db := newImportDB(t)
+	service := NewBooksService(db)
+
+	report, err := service.ImportBooks(context.Background(), domain.ImportFormatCSV, strings.NewReader(importCSV), true)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 2, report.Created)
+
+	books, err := db.LoadAllBooks(context.Background(), database.BookFilter{})
+	require.NoError(t, err)
+	assert.Len(t, books, 1)
+}
+
+func TestImportBooks_JSONL(t *testing.T) {
+	service := NewBooksService(newImportDB(t))
+	input := `{"title":"Atomic Habits","isbn":"0735211299","publish_date":"2018-10-16T00:00:00Z"}
+
+{"title":"Broken"
+{"title":"Future","publish_date":"2999-01-01"}
+`
+
+	report, err := service.ImportBooks(context.Background(), domain.ImportFormatJSONL, strings.NewReader(input), false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 2, report.Invalid)
+	assert.Equal(t, 3, report.Rows[1].Line)
+	assert.Contains(t, report.Rows[1].Error, "invalid json")
+	assert.Equal(t, "published date cannot be in the future", report.Rows[2].Error)
+}
+
+func TestImportBooks_UnsupportedFormat(t *testing.T) {
+	service := NewBooksService(new(database.DatabaseMock))
+
+	_, err := service.ImportBooks(context.Background(), "xml", strings.NewReader(""), false)
+	assert.ErrorIs(t, err, domain.ErrUnsupportedImportFormat)
+}
+
+func TestImportBooks_UnreadableInput(t *testing.T) {
+	service := NewBooksService(new(database.DatabaseMock))
+
+	for _, tt := range []struct {
+		format string
+		input  string
+	}{
+		{domain.ImportFormatCSV, "isbn,author_id\n9780735211292,1\n"},
+		{domain.ImportFormatCSV, "\"title\n"},
+		{domain.ImportFormatJSONL, `{"title":"` + strings.Repeat("a", maxImportLine) + `"}`},
+	} {
+		_, err := service.ImportBooks(context.Background(), tt.format, strings.NewReader(tt.input), false)
+		var importErr *domain.ImportError
+		assert.ErrorAs(t, err, &importErr, tt.input[:min(len(tt.input), 20)])
+	}
+}
+
+func TestImportBooks_CreateFails(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("ExistingISBNs", mock.Anything, []string{"9780735211292"}).Return([]string{}, nil)
+	mockDB.On("CreateBooks", mock.Anything, mock.Anything).Return(0, assert.AnError)
+
+	service := NewBooksService(mockDB)
+	_, err := service.ImportBooks(context.Background(), domain.ImportFormatCSV,
+		strings.NewReader("title,isbn,publish_date\nAtomic Habits,9780735211292,2018-10-16\n"), false)
+	assert.ErrorContains(t, err, "failed to import books")
+}
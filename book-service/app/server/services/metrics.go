@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"app/datasources/database"
+	"app/server/domain"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	booksBorrowed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "library_books_borrowed_total", Help: "Books lent out",
+	})
+	booksReserved = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "library_books_reserved_total", Help: "Books reserved",
+	})
+	booksReturned = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "library_books_returned_total", Help: "Books given back",
+	})
+	loanRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "library_loan_rejections_total",
+		Help: "Borrows and reservations refused, by reason: out_of_stock or the loan rule broken",
+	}, []string{"reason"})
+)
+
+// overdueTimeout bounds the count of overdue loans made on every scrape
+const overdueTimeout = 5 * time.Second
+
+var loansOverdue = prometheus.NewDesc("library_loans_overdue", "Loans past their due date", nil, nil)
+
+// loanCollector counts the overdue loans in db on every scrape
+type loanCollector struct {
+	db database.Database
+}
+
+func (c loanCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- loansOverdue
+}
+
+func (c loanCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), overdueTimeout)
+	defer cancel()
+	count, err := c.db.CountOverdueLoans(ctx, time.Now())
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(loansOverdue, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(loansOverdue, prometheus.GaugeValue, float64(count))
+}
+
+// RegisterLoanMetrics exposes the number of overdue loans with registerer, counted in db on every scrape
+func RegisterLoanMetrics(registerer prometheus.Registerer, db database.Database) error {
+	return registerer.Register(loanCollector{db: db})
+}
+
+// countRejection counts a borrow or reservation refused with err, other failures are not counted
+func countRejection(err error) {
+	var ruleErr *domain.LoanRuleError
+	switch {
+	case errors.Is(err, domain.ErrBookNotAvailable):
+		loanRejections.WithLabelValues("out_of_stock").Inc()
+	case errors.As(err, &ruleErr):
+		loanRejections.WithLabelValues(ruleErr.Rule).Inc()
+	}
+}
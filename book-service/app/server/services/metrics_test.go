@@ -0,0 +1,33 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"app/datasources/database"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRegisterLoanMetrics(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("CountOverdueLoans", mock.Anything, mock.Anything).Return(3, nil).Once()
+	mockDB.On("CountOverdueLoans", mock.Anything, mock.Anything).Return(0, assert.AnError).Once()
+
+	registry := prometheus.NewPedanticRegistry()
+	assert.Nil(t, RegisterLoanMetrics(registry, mockDB))
+
+	assert.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP library_loans_overdue Loans past their due date
+# TYPE library_loans_overdue gauge
+library_loans_overdue 3
+`)))
+
+	// a failed count is reported to the scrape instead of a made up value
+	_, err := registry.Gather()
+	assert.ErrorIs(t, err, assert.AnError)
+	mockDB.AssertExpectations(t)
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+
+	"app/datasources/database"
+	"app/datasources/notifications"
+	"app/server/domain"
+
+	"library/logging"
+)
+
+func (s *booksService) GetNotificationPreferences(ctx context.Context, userID int) (domain.NotificationPreferences, error) {
+	preferences, err := s.db.GetNotificationPreferences(ctx, userID)
+	if err != nil {
+		return domain.NotificationPreferences{}, fmt.Errorf("failed to load notification preferences: %w", err)
+	}
+	return toDomainPreferences(preferences), nil
+}
+
+func (s *booksService) UpdateNotificationPreferences(ctx context.Context, preferences domain.NotificationPreferences) (domain.NotificationPreferences, error) {
+	before, err := s.GetNotificationPreferences(ctx, preferences.UserID)
+	if err != nil {
+		return domain.NotificationPreferences{}, err
+	}
+
+	var updated domain.NotificationPreferences
+	err = s.db.WithinTx(ctx, func(ctx context.Context) error {
+		stored, err := s.db.SetNotificationPreferences(ctx, database.NotificationPreferences{
+			UserID:  preferences.UserID,
+			Email:   preferences.Email,
+			DueSoon: preferences.DueSoon,
+			Overdue: preferences.Overdue,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to store notification preferences: %w", err)
+		}
+
+		updated = toDomainPreferences(stored)
+		// only the preferences themselves are audited, not when they were stored
+		after := updated
+		before.UpdatedAt, after.UpdatedAt = nil, nil
+		return s.record(ctx, domain.AuditActionUpdate, domain.AuditEntityNotificationPreferences, updated.UserID, before, after)
+	})
+	if err != nil {
+		return domain.NotificationPreferences{}, err
+	}
+	return updated, nil
+}
+
+func toDomainPreferences(preferences database.NotificationPreferences) domain.NotificationPreferences {
+	converted := domain.NotificationPreferences{
+		UserID:  preferences.UserID,
+		Email:   preferences.Email,
+		DueSoon: preferences.DueSoon,
+		Overdue: preferences.Overdue,
+	}
+	if !preferences.UpdatedAt.IsZero() {
+		converted.UpdatedAt = &preferences.UpdatedAt
+	}
+	return converted
+}
+
+const (
+	// reminderBatchSize is how many loans a reminder run reads at a time
+	reminderBatchSize = 100
+
+	// reminderRetryDelay is how long a notification the notifier failed to send waits
+	// before it is tried again, doubling with every failure up to reminderMaxRetryDelay
+	reminderRetryDelay    = 30 * time.Minute
+	reminderMaxRetryDelay = 24 * time.Hour
+)
+
+// reminderTemplates render the subject and body of every kind of loan notification
+var reminderTemplates = map[string]*template.Template{
+	database.NotificationDueSoon: template.Must(template.New(database.NotificationDueSoon).Parse(
+		`{{define "subject"}}"{{.BookTitle}}" is due {{if eq .Days 0}}today{{else if eq .Days 1}}tomorrow{{else}}in {{.Days}} days{{end}}{{end}}` +
+			`{{define "body"}}Hello,
+
+your loan of "{{.BookTitle}}" is due on {{.DueDate}}. Please return or renew it by then.
+{{end}}`)),
+	database.NotificationOverdue: template.Must(template.New(database.NotificationOverdue).Parse(
+		`{{define "subject"}}"{{.BookTitle}}" is overdue{{end}}` +
+			`{{define "body"}}Hello,
+
+your loan of "{{.BookTitle}}" was due on {{.DueDate}}. Please return it as soon as possible,
+overdue loans keep you from borrowing other books.
+{{end}}`)),
+}
+
+// reminderData is what the reminder templates are executed with
+type reminderData struct {
+	BookTitle string
+	DueDate   string
+	// Days is the number of whole days until the due date
+	Days int
+}
+
+// LoanReminders notifies borrowers of loans due soon and of overdue loans. Every
+// notification is sent once per due date, so renewing a loan brings new reminders.
+type LoanReminders struct {
+	db       database.Database
+	notifier notifications.Notifier
+	dueSoon  time.Duration
+	now      func() time.Time
+}
+
+// NewLoanReminders sends due soon reminders for loans due within dueSoon
+func NewLoanReminders(db database.Database, notifier notifications.Notifier, dueSoon time.Duration) *LoanReminders {
+	return &LoanReminders{db: db, notifier: notifier, dueSoon: dueSoon, now: time.Now}
+}
+
+// Send notifies every loan due a notification. A notification the notifier fails to
+// send is recorded and tried again after a delay growing with every failure, the other
+// loans are notified all the same.
+func (r *LoanReminders) Send(ctx context.Context) error {
+	now := r.now()
+	var errs []error
+	if r.dueSoon > 0 {
+		filter := database.NoticeFilter{Kind: database.NotificationDueSoon, DueAfter: now, DueBefore: now.Add(r.dueSoon), Now: now}
+		errs = append(errs, r.notify(ctx, filter, now))
+	}
+	errs = append(errs, r.notify(ctx, database.NoticeFilter{Kind: database.NotificationOverdue, DueBefore: now, Now: now}, now))
+	return errors.Join(errs...)
+}
+
+func (r *LoanReminders) notify(ctx context.Context, filter database.NoticeFilter, now time.Time) error {
+	var (
+		failed   int
+		firstErr error
+	)
+	for {
+		notices, err := r.db.LoansToNotify(ctx, filter, reminderBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, notice := range notices {
+			message, err := renderReminder(filter.Kind, notice, now)
+			if err != nil {
+				return err
+			}
+			err = r.notifier.Notify(ctx, message)
+			if errors.Is(err, notifications.ErrNoRecipient) {
+				// recorded all the same, or it would come up again on every run
+				logging.FromContext(ctx).Warn("skipping loan notification", "kind", filter.Kind, "user", notice.UserID, "error", err)
+			} else if err != nil {
+				err = fmt.Errorf("failed to notify user %d of loan %d: %w", notice.UserID, notice.LoanID, err)
+				if err := r.recordFailure(ctx, filter.Kind, notice, err, now); err != nil {
+					return err
+				}
+				failed++
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+
+			err = r.db.RecordNotification(ctx, database.SentNotification{
+				LoanID:  notice.LoanID,
+				UserID:  notice.UserID,
+				Kind:    filter.Kind,
+				DueDate: notice.DueDate,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if len(notices) < reminderBatchSize {
+			break
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d %s notifications failed, the first: %w", failed, filter.Kind, firstErr)
+	}
+	return nil
+}
+
+// recordFailure backs off a notification the notifier failed to send, so it leaves the
+// batches until its next attempt is due
+func (r *LoanReminders) recordFailure(ctx context.Context, kind string, notice database.LoanNotice, cause error, now time.Time) error {
+	attempts := notice.Attempts + 1
+	next := now.Add(reminderBackoff(attempts))
+	logging.FromContext(ctx).Warn("loan notification failed", "kind", kind, "user", notice.UserID, "loan", notice.LoanID,
+		"attempts", attempts, "next_attempt_at", next, "error", cause)
+	return r.db.RecordNotificationFailure(ctx, database.FailedNotification{
+		LoanID:        notice.LoanID,
+		Kind:          kind,
+		DueDate:       notice.DueDate,
+		Attempts:      attempts,
+		LastError:     cause.Error(),
+		NextAttemptAt: next,
+	})
+}
+
+// reminderBackoff returns the delay before the attempt following the given number of failed attempts
+func reminderBackoff(failed int) time.Duration {
+	delay := reminderRetryDelay
+	for i := 1; i < failed && delay < reminderMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, reminderMaxRetryDelay)
+}
+
+// renderReminder fills in the templates of a kind of notification for a loan
+func renderReminder(kind string, notice database.LoanNotice, now time.Time) (notifications.Message, error) {
+	tmpl, ok := reminderTemplates[kind]
+	if !ok {
+		return notifications.Message{}, fmt.Errorf("no template for %s notifications", kind)
+	}
+	data := reminderData{
+		BookTitle: notice.BookTitle,
+		DueDate:   notice.DueDate.Format("Monday, 2 January 2006"),
+		Days:      int(notice.DueDate.Sub(now) / (24 * time.Hour)),
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return notifications.Message{}, fmt.Errorf("failed to render %s notification: %w", kind, err)
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return notifications.Message{}, fmt.Errorf("failed to render %s notification: %w", kind, err)
+	}
+	return notifications.Message{
+		Kind:    kind,
+		UserID:  notice.UserID,
+		Email:   notice.Email,
+		LoanID:  notice.LoanID,
+		BookID:  notice.BookID,
+		Subject: subject.String(),
+		Body:    body.String(),
+	}, nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"app/datasources/database"
+	"app/datasources/notifications"
+	"app/server/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier keeps the messages it is asked to send, failing with err if set,
+// for the messages of failUser only if that is set
+type recordingNotifier struct {
+	messages []notifications.Message
+	err      error
+	failUser int
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, message notifications.Message) error {
+	if n.err != nil && (n.failUser == 0 || n.failUser == message.UserID) {
+		return n.err
+	}
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+func TestLoanReminders_Send(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.NewDatabase(ctx, "", database.PoolConfig{}, database.DefaultLoanPolicy())
+	require.NoError(t, err)
+	service := NewBooksService(db)
+	require.NoError(t, service.SaveBook(ctx, domain.Book{Title: "Dune", AuthorID: 1}))
+	admin := domain.WithActor(ctx, domain.Actor{ID: "1", Role: "admin"})
+	require.NoError(t, service.BorrowBook(admin, 0, domain.LoanRequest{UserID: 5}))
+	require.NoError(t, service.BorrowBook(admin, 0, domain.LoanRequest{UserID: 6}))
+	_, err = service.UpdateNotificationPreferences(ctx, domain.NotificationPreferences{UserID: 6, Email: "six@example.com", Overdue: true})
+	require.NoError(t, err)
+	loans, err := service.GetLoans(ctx, domain.LoanQuery{UserID: 5, Limit: 1})
+	require.NoError(t, err)
+	dueDate := loans[0].DueDate
+
+	notifier := &recordingNotifier{}
+	reminders := NewLoanReminders(db, notifier, 48*time.Hour)
+
+	// more than two days left
+	reminders.now = func() time.Time { return dueDate.Add(-72 * time.Hour) }
+	require.NoError(t, reminders.Send(ctx))
+	assert.Empty(t, notifier.messages)
+
+	reminders.now = func() time.Time { return dueDate.Add(-36 * time.Hour) }
+	require.NoError(t, reminders.Send(ctx))
+	require.NoError(t, reminders.Send(ctx))
+	require.Len(t, notifier.messages, 1, "user 6 opted out and reminders are sent once")
+	reminder := notifier.messages[0]
+	assert.Equal(t, database.NotificationDueSoon, reminder.Kind)
+	assert.Equal(t, 5, reminder.UserID)
+	assert.Equal(t, `"Dune" is due tomorrow`, reminder.Subject)
+	assert.Contains(t, reminder.Body, dueDate.Format("Monday, 2 January 2006"))
+
+	reminders.now = func() time.Time { return dueDate.Add(time.Hour) }
+	require.NoError(t, reminders.Send(ctx))
+	require.Len(t, notifier.messages, 3)
+	assert.Equal(t, database.NotificationOverdue, notifier.messages[1].Kind)
+	assert.Equal(t, `"Dune" is overdue`, notifier.messages[1].Subject)
+	assert.Equal(t, "six@example.com", notifier.messages[2].Email)
+}
+
+func TestLoanReminders_Send_NotifierFails(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.NewDatabase(ctx, "", database.PoolConfig{}, database.DefaultLoanPolicy())
+	require.NoError(t, err)
+	service := NewBooksService(db)
+	require.NoError(t, service.SaveBook(ctx, domain.Book{Title: "Dune", AuthorID: 1}))
+	admin := domain.WithActor(ctx, domain.Actor{ID: "1", Role: "admin"})
+	require.NoError(t, service.BorrowBook(admin, 0, domain.LoanRequest{UserID: 5}))
+	require.NoError(t, service.BorrowBook(admin, 0, domain.LoanRequest{UserID: 6}))
+
+	notifier := &recordingNotifier{err: assert.AnError, failUser: 5}
+	reminders := NewLoanReminders(db, notifier, 0)
+	now := time.Now().Add(30 * 24 * time.Hour)
+	reminders.now = func() time.Time { return now }
+
+	err = reminders.Send(ctx)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.ErrorContains(t, err, "failed to notify user 5")
+	require.Len(t, notifier.messages, 1, "the failing loan does not hold up the others")
+	assert.Equal(t, 6, notifier.messages[0].UserID)
+
+	// the failed notification waits for its next attempt
+	notifier.err = nil
+	require.NoError(t, reminders.Send(ctx))
+	assert.Len(t, notifier.messages, 1)
+
+	now = now.Add(reminderRetryDelay)
+	require.NoError(t, reminders.Send(ctx))
+	require.Len(t, notifier.messages, 2)
+	assert.Equal(t, 5, notifier.messages[1].UserID)
+}
+
+func TestReminderBackoff(t *testing.T) {
+	assert.Equal(t, reminderRetryDelay, reminderBackoff(1))
+	assert.Equal(t, 4*reminderRetryDelay, reminderBackoff(3))
+	assert.Equal(t, reminderMaxRetryDelay, reminderBackoff(20))
+}
+
+func TestUpdateNotificationPreferences(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.NewDatabase(ctx, "", database.PoolConfig{}, database.DefaultLoanPolicy())
+	require.NoError(t, err)
+	service := NewBooksService(db)
+
+	preferences, err := service.GetNotificationPreferences(ctx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, domain.NotificationPreferences{UserID: 5, DueSoon: true, Overdue: true}, preferences)
+
+	updated, err := service.UpdateNotificationPreferences(ctx, domain.NotificationPreferences{UserID: 5, Email: "five@example.com", DueSoon: true})
+	require.NoError(t, err)
+	assert.Equal(t, "five@example.com", updated.Email)
+	assert.False(t, updated.Overdue)
+	assert.NotNil(t, updated.UpdatedAt)
+
+	entries, err := service.GetAuditLog(ctx, domain.AuditQuery{Entity: domain.AuditEntityNotificationPreferences, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, map[string]domain.FieldChange{
+		"email":   {Before: "", After: "five@example.com"},
+		"overdue": {Before: true, After: false},
+	}, entries[0].Changes)
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"app/datasources/database"
+	"app/server/domain"
+)
+
+const (
+	// recommendationSeeds is how many search hits seed the recommendations
+	recommendationSeeds = 10
+	// affinityCandidates caps the books loaded for author and category affinity
+	affinityCandidates = 200
+
+	searchWeight   = 1.0
+	graphWeight    = 0.6
+	authorWeight   = 0.3
+	categoryWeight = 0.2
+)
+
+// RecommendBooks recommends books for a free-text query. Search hits seed the
+// result, then books linked to them in book_recommendation and books sharing
+// their author or category are added. Every score part is normalized to 0..1
+// and ties are broken by book ID so the order is deterministic.
+func (s *booksService) RecommendBooks(ctx context.Context, query string, limit int) ([]domain.Recommendation, error) {
+	hits, err := s.db.SearchBooks(ctx, query, recommendationSeeds, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search books: %w", err)
+	}
+	if len(hits) == 0 {
+		return []domain.Recommendation{}, nil
+	}
+
+	books := make(map[int]database.Book)
+	scores := make(map[int]*domain.ScoreBreakdown)
+	breakdown := func(id int) *domain.ScoreBreakdown {
+		if scores[id] == nil {
+			scores[id] = &domain.ScoreBreakdown{}
+		}
+		return scores[id]
+	}
+
+	// search relevance relative to the best hit
+	topRank := hits[0].Rank
+	seedWeight := make(map[int]float64, len(hits))
+	authorAffinity := make(map[int]float64)
+	categoryAffinity := make(map[int]float64)
+	for _, hit := range hits {
+		weight := 1.0
+		if topRank > 0 {
+			weight = hit.Rank / topRank
+		}
+		seedWeight[hit.Book.ID] = weight
+		books[hit.Book.ID] = hit.Book
+		breakdown(hit.Book.ID).Search = weight
+		authorAffinity[hit.Book.AuthorID] = max(authorAffinity[hit.Book.AuthorID], weight)
+		categoryAffinity[hit.Book.CategoryID] = max(categoryAffinity[hit.Book.CategoryID], weight)
+	}
+
+	// books the seeds point to in the recommendation graph
+	seedIDs := make([]int, 0, len(hits))
+	for _, hit := range hits {
+		seedIDs = append(seedIDs, hit.Book.ID)
+	}
+	recs, err := s.db.GetRecommendedBooks(ctx, seedIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recommended books: %w", err)
+	}
+	var missing []int
+	topGraph := 0.0
+	for _, rec := range recs {
+		b := breakdown(rec.RecommendedBookID)
+		b.Graph = max(b.Graph, seedWeight[rec.BookID]*float64(rec.Score))
+		topGraph = max(topGraph, b.Graph)
+		if _, ok := books[rec.RecommendedBookID]; !ok {
+			missing = append(missing, rec.RecommendedBookID)
+		}
+	}
+	if topGraph > 0 {
+		for _, b := range scores {
+			b.Graph /= topGraph
+		}
+	}
+	if len(missing) > 0 {
+		linked, err := s.db.LoadBooksByIDs(ctx, missing)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load recommended books: %w", err)
+		}
+		for _, book := range linked {
+			books[book.ID] = book
+		}
+	}
+
+	// books by the same authors or in the same categories as the seeds
+	related, err := s.db.LoadBooksByAuthorsOrCategories(ctx, sortedKeys(authorAffinity), sortedKeys(categoryAffinity), affinityCandidates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load related books: %w", err)
+	}
+	for _, book := range related {
+		books[book.ID] = book
+	}
+	for id, book := range books {
+		b := breakdown(id)
+		b.Author = authorAffinity[book.AuthorID]
+		b.Category = categoryAffinity[book.CategoryID]
+	}
+
+	recommendations := make([]domain.Recommendation, 0, len(books))
+	for id, book := range books {
+		b := scores[id]
+		b.Total = searchWeight*b.Search + graphWeight*b.Graph + authorWeight*b.Author + categoryWeight*b.Category
+		recommendations = append(recommendations, domain.Recommendation{
+			Book:      toDomainBook(book),
+			Score:     b.Total,
+			Breakdown: *b,
+		})
+	}
+
+	sort.Slice(recommendations, func(i, j int) bool {
+		if recommendations[i].Score != recommendations[j].Score {
+			return recommendations[i].Score > recommendations[j].Score
+		}
+		return recommendations[i].Book.ID < recommendations[j].Book.ID
+	})
+	if limit > 0 && limit < len(recommendations) {
+		recommendations = recommendations[:limit]
+	}
+
+	return recommendations, nil
+}
+
+func sortedKeys(m map[int]float64) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"app/datasources/database"
+	"app/server/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newRecommendationDB(t *testing.T) database.Database {
+	ctx := context.Background()
+	db, err := database.NewDatabase(ctx, "", database.PoolConfig{}, database.DefaultLoanPolicy())
+	require.NoError(t, err)
+
+	books := []database.NewBook{
+		{Title: "Atomic Habits", AuthorID: 1, CategoryID: 1},
+		{Title: "The Power of Habit", AuthorID: 2, CategoryID: 1},
+		{Title: "Deep Work", AuthorID: 3, CategoryID: 2},
+		{Title: "Make Time", AuthorID: 1, CategoryID: 3},
+		{Title: "Salt Fat Acid Heat", AuthorID: 4, CategoryID: 4},
+	}
+	for _, book := range books {
+		_, err := db.CreateBook(ctx, book)
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.AddRecommendedBook(ctx, database.NewBookRecommendation{BookID: 0, RecommendedBookID: 2, Score: 0.8}))
+	return db
+}
+
+func TestRecommendBooks(t *testing.T) {
+	service := NewBooksService(newRecommendationDB(t))
+
+	recommendations, err := service.RecommendBooks(context.Background(), "atomic habits", 10)
+	require.NoError(t, err)
+
+	ids := make([]int, 0, len(recommendations))
+	for _, r := range recommendations {
+		ids = append(ids, r.Book.ID)
+	}
+	// the unrelated cookbook is left out
+	assert.Equal(t, []int{0, 1, 2, 3}, ids)
+
+	assert.Equal(t, domain.ScoreBreakdown{Search: 1, Author: 1, Category: 1, Total: 1.5}, recommendations[0].Breakdown)
+	assert.Equal(t, domain.ScoreBreakdown{Graph: 1, Total: 0.6}, recommendations[2].Breakdown)
+	assert.Equal(t, domain.ScoreBreakdown{Author: 1, Total: 0.3}, recommendations[3].Breakdown)
+
+	again, err := service.RecommendBooks(context.Background(), "atomic habits", 10)
+	require.NoError(t, err)
+	assert.Equal(t, recommendations, again)
+}
+
+func TestRecommendBooks_Limit(t *testing.T) {
+	service := NewBooksService(newRecommendationDB(t))
+
+	recommendations, err := service.RecommendBooks(context.Background(), "atomic habits", 2)
+	require.NoError(t, err)
+	assert.Len(t, recommendations, 2)
+}
+
+func TestRecommendBooks_NoMatches(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("SearchBooks", mock.Anything, "nothing", recommendationSeeds, 0).Return([]database.BookSearchResult{}, nil)
+
+	service := NewBooksService(mockDB)
+	recommendations, err := service.RecommendBooks(context.Background(), "nothing", 10)
+	assert.Nil(t, err)
+	assert.Empty(t, recommendations)
+}
+
+func TestRecommendBooks_Fail(t *testing.T) {
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("SearchBooks", mock.Anything, "habits", recommendationSeeds, 0).Return([]database.BookSearchResult{
+		{Book: database.Book{ID: 1, Title: "Atomic Habits"}, Rank: 1},
+	}, nil)
+	mockDB.On("GetRecommendedBooks", mock.Anything, []int{1}).Return([]database.BookRecommendation{}, assert.AnError)
+
+	service := NewBooksService(mockDB)
+	_, err := service.RecommendBooks(context.Background(), "habits", 10)
+	assert.ErrorContains(t, err, "failed to load recommended books")
+}
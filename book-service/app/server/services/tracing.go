@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"app/server/domain"
+
+	"library/tracing"
+)
+
+// tracedBooksService runs every call of the service it wraps in a span named after the method
+type tracedBooksService struct {
+	next BooksService
+}
+
+// traced runs call in a span, failed calls mark the span failed
+func traced[T any](ctx context.Context, method string, call func(context.Context) (T, error)) (T, error) {
+	ctx, span := tracing.Start(ctx, method)
+	defer span.End()
+	result, err := call(ctx)
+	tracing.RecordError(span, err)
+	return result, err
+}
+
+func tracedCall(ctx context.Context, method string, call func(context.Context) error) error {
+	_, err := traced(ctx, method, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, call(ctx)
+	})
+	return err
+}
+
+func (s tracedBooksService) GetBooks(ctx context.Context, query domain.BookQuery) (domain.BooksResponse, error) {
+	return traced(ctx, "BooksService.GetBooks", func(ctx context.Context) (domain.BooksResponse, error) {
+		return s.next.GetBooks(ctx, query)
+	})
+}
+
+func (s tracedBooksService) ExportBooks(ctx context.Context, filter domain.BookFilter, sort []domain.SortField, format string, w io.Writer) error {
+	return tracedCall(ctx, "BooksService.ExportBooks", func(ctx context.Context) error {
+		return s.next.ExportBooks(ctx, filter, sort, format, w)
+	})
+}
+
+func (s tracedBooksService) GetBook(ctx context.Context, id int) (domain.Book, error) {
+	return traced(ctx, "BooksService.GetBook", func(ctx context.Context) (domain.Book, error) {
+		return s.next.GetBook(ctx, id)
+	})
+}
+
+func (s tracedBooksService) GetBookByISBN(ctx context.Context, isbn string) (domain.Book, error) {
+	return traced(ctx, "BooksService.GetBookByISBN", func(ctx context.Context) (domain.Book, error) {
+		return s.next.GetBookByISBN(ctx, isbn)
+	})
+}
+
+func (s tracedBooksService) SearchBooks(ctx context.Context, query string, limit, offset int) ([]domain.BookSearchHit, error) {
+	return traced(ctx, "BooksService.SearchBooks", func(ctx context.Context) ([]domain.BookSearchHit, error) {
+		return s.next.SearchBooks(ctx, query, limit, offset)
+	})
+}
+
+func (s tracedBooksService) RecommendBooks(ctx context.Context, query string, limit int) ([]domain.Recommendation, error) {
+	return traced(ctx, "BooksService.RecommendBooks", func(ctx context.Context) ([]domain.Recommendation, error) {
+		return s.next.RecommendBooks(ctx, query, limit)
+	})
+}
+
+func (s tracedBooksService) SaveBook(ctx context.Context, newBook domain.Book) error {
+	return tracedCall(ctx, "BooksService.SaveBook", func(ctx context.Context) error {
+		return s.next.SaveBook(ctx, newBook)
+	})
+}
+
+func (s tracedBooksService) ImportBooks(ctx context.Context, format string, r io.Reader, dryRun bool) (domain.ImportReport, error) {
+	return traced(ctx, "BooksService.ImportBooks", func(ctx context.Context) (domain.ImportReport, error) {
+		return s.next.ImportBooks(ctx, format, r, dryRun)
+	})
+}
+
+func (s tracedBooksService) DeleteBook(ctx context.Context, id int) error {
+	return tracedCall(ctx, "BooksService.DeleteBook", func(ctx context.Context) error {
+		return s.next.DeleteBook(ctx, id)
+	})
+}
+
+func (s tracedBooksService) RestoreBook(ctx context.Context, id int) (domain.Book, error) {
+	return traced(ctx, "BooksService.RestoreBook", func(ctx context.Context) (domain.Book, error) {
+		return s.next.RestoreBook(ctx, id)
+	})
+}
+
+func (s tracedBooksService) PurgeBooks(ctx context.Context, before time.Time) (int, error) {
+	return traced(ctx, "BooksService.PurgeBooks", func(ctx context.Context) (int, error) {
+		return s.next.PurgeBooks(ctx, before)
+	})
+}
+
+func (s tracedBooksService) UpdateBook(ctx context.Context, book domain.Book) error {
+	return tracedCall(ctx, "BooksService.UpdateBook", func(ctx context.Context) error {
+		return s.next.UpdateBook(ctx, book)
+	})
+}
+
+func (s tracedBooksService) BorrowBook(ctx context.Context, bookID int, request domain.LoanRequest) error {
+	return tracedCall(ctx, "BooksService.BorrowBook", func(ctx context.Context) error {
+		return s.next.BorrowBook(ctx, bookID, request)
+	})
+}
+
+func (s tracedBooksService) ReturnBook(ctx context.Context, bookID int, request domain.LoanRequest) error {
+	return tracedCall(ctx, "BooksService.ReturnBook", func(ctx context.Context) error {
+		return s.next.ReturnBook(ctx, bookID, request)
+	})
+}
+
+func (s tracedBooksService) ReserveBook(ctx context.Context, bookID int, request domain.LoanRequest) error {
+	return tracedCall(ctx, "BooksService.ReserveBook", func(ctx context.Context) error {
+		return s.next.ReserveBook(ctx, bookID, request)
+	})
+}
+
+func (s tracedBooksService) GetLoans(ctx context.Context, query domain.LoanQuery) ([]domain.Loan, error) {
+	return traced(ctx, "BooksService.GetLoans", func(ctx context.Context) ([]domain.Loan, error) {
+		return s.next.GetLoans(ctx, query)
+	})
+}
+
+func (s tracedBooksService) UpdateLoanStatus(ctx context.Context, loanID int, status string) (domain.Loan, error) {
+	return traced(ctx, "BooksService.UpdateLoanStatus", func(ctx context.Context) (domain.Loan, error) {
+		return s.next.UpdateLoanStatus(ctx, loanID, status)
+	})
+}
+
+func (s tracedBooksService) RenewLoan(ctx context.Context, userID, loanID int) (domain.Loan, error) {
+	return traced(ctx, "BooksService.RenewLoan", func(ctx context.Context) (domain.Loan, error) {
+		return s.next.RenewLoan(ctx, userID, loanID)
+	})
+}
+
+func (s tracedBooksService) GetAuthorStats(ctx context.Context, authorID int) (domain.AuthorStats, error) {
+	return traced(ctx, "BooksService.GetAuthorStats", func(ctx context.Context) (domain.AuthorStats, error) {
+		return s.next.GetAuthorStats(ctx, authorID)
+	})
+}
+
+func (s tracedBooksService) ReassignAuthorBooks(ctx context.Context, fromAuthorID, toAuthorID int) (domain.ReassignResult, error) {
+	return traced(ctx, "BooksService.ReassignAuthorBooks", func(ctx context.Context) (domain.ReassignResult, error) {
+		return s.next.ReassignAuthorBooks(ctx, fromAuthorID, toAuthorID)
+	})
+}
+
+func (s tracedBooksService) GetAuditLog(ctx context.Context, query domain.AuditQuery) ([]domain.AuditEntry, error) {
+	return traced(ctx, "BooksService.GetAuditLog", func(ctx context.Context) ([]domain.AuditEntry, error) {
+		return s.next.GetAuditLog(ctx, query)
+	})
+}
+
+func (s tracedBooksService) CreateWebhook(ctx context.Context, subscription domain.WebhookSubscription) (domain.WebhookSubscription, error) {
+	return traced(ctx, "BooksService.CreateWebhook", func(ctx context.Context) (domain.WebhookSubscription, error) {
+		return s.next.CreateWebhook(ctx, subscription)
+	})
+}
+
+func (s tracedBooksService) ListWebhooks(ctx context.Context) ([]domain.WebhookSubscription, error) {
+	return traced(ctx, "BooksService.ListWebhooks", func(ctx context.Context) ([]domain.WebhookSubscription, error) {
+		return s.next.ListWebhooks(ctx)
+	})
+}
+
+func (s tracedBooksService) DeleteWebhook(ctx context.Context, id int) error {
+	return tracedCall(ctx, "BooksService.DeleteWebhook", func(ctx context.Context) error {
+		return s.next.DeleteWebhook(ctx, id)
+	})
+}
+
+func (s tracedBooksService) GetWebhookDeliveries(ctx context.Context, query domain.WebhookDeliveryQuery) ([]domain.WebhookDelivery, error) {
+	return traced(ctx, "BooksService.GetWebhookDeliveries", func(ctx context.Context) ([]domain.WebhookDelivery, error) {
+		return s.next.GetWebhookDeliveries(ctx, query)
+	})
+}
+
+func (s tracedBooksService) RetryWebhookDelivery(ctx context.Context, id int64) error {
+	return tracedCall(ctx, "BooksService.RetryWebhookDelivery", func(ctx context.Context) error {
+		return s.next.RetryWebhookDelivery(ctx, id)
+	})
+}
+
+func (s tracedBooksService) GetNotificationPreferences(ctx context.Context, userID int) (domain.NotificationPreferences, error) {
+	return traced(ctx, "BooksService.GetNotificationPreferences", func(ctx context.Context) (domain.NotificationPreferences, error) {
+		return s.next.GetNotificationPreferences(ctx, userID)
+	})
+}
+
+func (s tracedBooksService) UpdateNotificationPreferences(ctx context.Context, preferences domain.NotificationPreferences) (domain.NotificationPreferences, error) {
+	return traced(ctx, "BooksService.UpdateNotificationPreferences", func(ctx context.Context) (domain.NotificationPreferences, error) {
+		return s.next.UpdateNotificationPreferences(ctx, preferences)
+	})
+}
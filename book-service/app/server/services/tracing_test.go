@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"app/datasources/database"
+
+	"library/tracing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTracedBooksService(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracing.SetDefault(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer tracing.SetDefault(noop.NewTracerProvider())
+
+	mockDB := new(database.DatabaseMock)
+	mockDB.On("GetBookByID", mock.MatchedBy(func(ctx context.Context) bool {
+		return trace.SpanContextFromContext(ctx).IsValid()
+	}), 3).Return(database.Book{}, database.ErrBookNotFound)
+
+	ctx, parent := tracing.Start(context.Background(), "GET /api/v1/books/:id")
+	_, err := NewBooksService(mockDB).GetBook(ctx, 3)
+	assert.NotNil(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "BooksService.GetBook", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, sdktrace.Status{Code: codes.Error, Description: err.Error()}, spans[0].Status())
+	mockDB.AssertExpectations(t)
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"app/datasources/database"
+	"app/datasources/webhooks"
+	"app/server/domain"
+
+	"library/events"
+	"library/logging"
+)
+
+// secretBytes is the size of the signing secrets generated for new subscriptions
+const secretBytes = 32
+
+// CreateWebhook adds a subscription and returns it with its signing secret, which
+// is generated when none is given. The secret is never returned again.
+func (s *booksService) CreateWebhook(ctx context.Context, subscription domain.WebhookSubscription) (domain.WebhookSubscription, error) {
+	if subscription.Secret == "" {
+		secret := make([]byte, secretBytes)
+		if _, err := rand.Read(secret); err != nil {
+			return domain.WebhookSubscription{}, fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+		subscription.Secret = hex.EncodeToString(secret)
+	}
+
+	var webhook domain.WebhookSubscription
+	err := s.db.WithinTx(ctx, func(ctx context.Context) error {
+		created, err := s.db.AddWebhookSubscription(ctx, database.NewWebhookSubscription{
+			URL:        subscription.URL,
+			Secret:     subscription.Secret,
+			EventTypes: subscription.EventTypes,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create webhook: %w", err)
+		}
+
+		webhook = toDomainWebhook(created)
+		return s.record(ctx, domain.AuditActionCreate, domain.AuditEntityWebhook, webhook.ID, nil, webhook)
+	})
+	if err != nil {
+		return domain.WebhookSubscription{}, err
+	}
+	webhook.Secret = subscription.Secret
+	return webhook, nil
+}
+
+// ListWebhooks returns every subscription without its secret
+func (s *booksService) ListWebhooks(ctx context.Context) ([]domain.WebhookSubscription, error) {
+	subscriptions, err := s.db.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhooks: %w", err)
+	}
+
+	webhooks := make([]domain.WebhookSubscription, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		webhooks = append(webhooks, toDomainWebhook(subscription))
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook removes a subscription along with its delivery log
+func (s *booksService) DeleteWebhook(ctx context.Context, id int) error {
+	return s.db.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.db.DeleteWebhookSubscription(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete webhook: %w", toDomainError(err))
+		}
+		return s.record(ctx, domain.AuditActionDelete, domain.AuditEntityWebhook, id, nil, nil)
+	})
+}
+
+func (s *booksService) GetWebhookDeliveries(ctx context.Context, query domain.WebhookDeliveryQuery) ([]domain.WebhookDelivery, error) {
+	records, err := s.db.ListWebhookDeliveries(ctx, database.WebhookDeliveryFilter{
+		SubscriptionID: query.SubscriptionID,
+		Status:         query.Status,
+	}, query.Limit, query.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhook deliveries: %w", err)
+	}
+
+	deliveries := make([]domain.WebhookDelivery, 0, len(records))
+	for _, record := range records {
+		deliveries = append(deliveries, domain.WebhookDelivery{
+			ID:             record.ID,
+			SubscriptionID: record.SubscriptionID,
+			EventID:        record.EventID,
+			EventType:      record.EventType,
+			Status:         record.Status,
+			Attempts:       record.Attempts,
+			ResponseStatus: record.ResponseStatus,
+			LastError:      record.LastError,
+			NextAttemptAt:  record.NextAttemptAt,
+			CreatedAt:      record.CreatedAt,
+			DeliveredAt:    record.DeliveredAt,
+		})
+	}
+	return deliveries, nil
+}
+
+// RetryWebhookDelivery sends a dead delivery again on the next delivery run,
+// with a fresh set of attempts
+func (s *booksService) RetryWebhookDelivery(ctx context.Context, id int64) error {
+	return s.db.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.db.RetryWebhookDelivery(ctx, id, time.Now()); err != nil {
+			return fmt.Errorf("failed to retry webhook delivery: %w", toDomainError(err))
+		}
+		return s.record(ctx, domain.AuditActionRetry, domain.AuditEntityWebhookDelivery, int(id), nil, nil)
+	})
+}
+
+func toDomainWebhook(subscription database.WebhookSubscription) domain.WebhookSubscription {
+	return domain.WebhookSubscription{
+		ID:         subscription.ID,
+		URL:        subscription.URL,
+		EventTypes: subscription.EventTypes,
+		CreatedAt:  subscription.CreatedAt,
+	}
+}
+
+const (
+	// webhookBatchSize is how many deliveries a run claims at a time
+	webhookBatchSize = 20
+	// webhookLease is how long a claimed delivery is hidden from other runs,
+	// it must outlast sending a whole batch
+	webhookLease = 5 * time.Minute
+)
+
+// WebhookRetryPolicy spaces out the attempts of a failing delivery. The delay after
+// the nth failed attempt is BaseDelay * 2^(n-1) capped at MaxDelay, and a delivery
+// is dead once MaxAttempts attempts failed.
+type WebhookRetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultWebhookRetryPolicy gives up after about four hours
+func DefaultWebhookRetryPolicy() WebhookRetryPolicy {
+	return WebhookRetryPolicy{
+		MaxAttempts: 8,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    time.Hour,
+	}
+}
+
+// Backoff returns the delay before the attempt following the given number of failed attempts
+func (p WebhookRetryPolicy) Backoff(failed int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < failed && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// WebhookDispatcher delivers domain events to the webhook subscriptions. As an
+// events.Sink it queues a delivery per interested subscription, Deliver sends them.
+type WebhookDispatcher struct {
+	db     database.Database
+	client *webhooks.Client
+	policy WebhookRetryPolicy
+	now    func() time.Time
+}
+
+func NewWebhookDispatcher(db database.Database, client *webhooks.Client, policy WebhookRetryPolicy) *WebhookDispatcher {
+	return &WebhookDispatcher{db: db, client: client, policy: policy, now: time.Now}
+}
+
+// Publish queues the event for every subscription wanting its type. Queuing the same
+// event twice is a no-op, so the relay may publish it again after a failure.
+func (d *WebhookDispatcher) Publish(ctx context.Context, event events.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	_, err = d.db.EnqueueWebhookDeliveries(ctx, database.NewWebhookDelivery{
+		EventID:   event.ID,
+		EventType: event.Type,
+		Payload:   body,
+	})
+	return err
+}
+
+func (d *WebhookDispatcher) Close() error {
+	return nil
+}
+
+// Deliver sends the deliveries that are due. Failed deliveries are rescheduled
+// following the retry policy, so a run ends once every due delivery was tried.
+func (d *WebhookDispatcher) Deliver(ctx context.Context) error {
+	for {
+		due, err := d.db.ClaimWebhookDeliveries(ctx, d.now(), webhookLease, webhookBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+
+		subscriptions, err := d.subscriptions(ctx)
+		if err != nil {
+			return err
+		}
+		for _, delivery := range due {
+			subscription, ok := subscriptions[delivery.SubscriptionID]
+			if !ok {
+				// deleted since it was claimed, its deliveries are gone too
+				continue
+			}
+			if err := d.db.RecordWebhookAttempt(ctx, delivery.ID, d.send(ctx, subscription, delivery)); err != nil &&
+				!errors.Is(err, database.ErrDeliveryNotFound) {
+				return err
+			}
+		}
+		if len(due) < webhookBatchSize {
+			return nil
+		}
+	}
+}
+
+func (d *WebhookDispatcher) subscriptions(ctx context.Context) (map[int]database.WebhookSubscription, error) {
+	list, err := d.db.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]database.WebhookSubscription, len(list))
+	for _, subscription := range list {
+		byID[subscription.ID] = subscription
+	}
+	return byID, nil
+}
+
+// send makes one attempt of a delivery and returns its outcome
+func (d *WebhookDispatcher) send(ctx context.Context, subscription database.WebhookSubscription, delivery database.WebhookDelivery) database.WebhookAttempt {
+	status, err := d.client.Send(ctx, webhooks.Request{
+		URL:        subscription.URL,
+		Secret:     subscription.Secret,
+		DeliveryID: delivery.ID,
+		EventID:    delivery.EventID,
+		EventType:  delivery.EventType,
+		Body:       delivery.Payload,
+	})
+	attempt := database.WebhookAttempt{ResponseStatus: status, At: d.now()}
+	attempted := delivery.Attempts + 1
+	switch {
+	case err == nil:
+		attempt.Status = database.DeliveryDelivered
+	case attempted >= d.policy.MaxAttempts:
+		attempt.Status = database.DeliveryDead
+		attempt.Error = err.Error()
+		logging.FromContext(ctx).Warn("webhook delivery failed for good", "delivery", delivery.ID, "url", subscription.URL, "error", err)
+	default:
+		attempt.Status = database.DeliveryPending
+		attempt.Error = err.Error()
+		attempt.NextAttemptAt = attempt.At.Add(d.policy.Backoff(attempted))
+	}
+	return attempt
+}
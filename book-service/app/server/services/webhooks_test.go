@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"app/datasources/database"
+	"app/datasources/webhooks"
+	"app/server/domain"
+
+	"library/events"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateWebhook(t *testing.T) {
+	db, err := database.NewDatabase(context.Background(), "", database.PoolConfig{}, database.DefaultLoanPolicy())
+	require.NoError(t, err)
+	service := NewBooksService(db)
+
+	created, err := service.CreateWebhook(context.Background(), domain.WebhookSubscription{URL: "https://partner.example/hooks"})
+	require.NoError(t, err)
+	assert.Len(t, created.Secret, 2*secretBytes)
+	assert.Empty(t, created.EventTypes)
+
+	listed, err := service.ListWebhooks(context.Background())
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Empty(t, listed[0].Secret)
+
+	entries, err := service.GetAuditLog(context.Background(), domain.AuditQuery{Entity: domain.AuditEntityWebhook, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.NotContains(t, entries[0].Changes, "secret")
+
+	require.NoError(t, service.DeleteWebhook(context.Background(), created.ID))
+	assert.ErrorIs(t, service.DeleteWebhook(context.Background(), created.ID), domain.ErrWebhookNotFound)
+}
+
+func TestWebhookRetryPolicy_Backoff(t *testing.T) {
+	policy := WebhookRetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	var delays []time.Duration
+	for failed := 1; failed <= 6; failed++ {
+		delays = append(delays, policy.Backoff(failed))
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		10 * time.Second, 10 * time.Second}, delays)
+}
+
+func TestWebhookDispatcher_Deliver(t *testing.T) {
+	var (
+		header http.Header
+		body   []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	db, err := database.NewDatabase(ctx, "", database.PoolConfig{}, database.DefaultLoanPolicy())
+	require.NoError(t, err)
+	service := NewBooksService(db)
+	webhook, err := service.CreateWebhook(ctx, domain.WebhookSubscription{URL: server.URL, EventTypes: []string{"book.created"}})
+	require.NoError(t, err)
+
+	dispatcher := NewWebhookDispatcher(db, webhooks.NewClient(), DefaultWebhookRetryPolicy())
+	event := events.Event{ID: 3, Type: "book.created", AggregateID: 1, Payload: json.RawMessage(`{"id":1}`)}
+	require.NoError(t, dispatcher.Publish(ctx, event))
+	// the relay may publish an event again, it is still delivered once
+	require.NoError(t, dispatcher.Publish(ctx, event))
+	require.NoError(t, dispatcher.Publish(ctx, events.Event{ID: 4, Type: "book.returned", Payload: json.RawMessage(`{}`)}))
+	require.NoError(t, dispatcher.Deliver(ctx))
+
+	var received events.Event
+	require.NoError(t, json.Unmarshal(body, &received))
+	assert.Equal(t, event, received)
+	assert.Equal(t, "book.created", header.Get(webhooks.HeaderEventType))
+	assert.NoError(t, webhooks.Verify(webhook.Secret, header.Get(webhooks.HeaderSignature), body, time.Minute, time.Now()))
+
+	deliveries, err := service.GetWebhookDeliveries(ctx, domain.WebhookDeliveryQuery{SubscriptionID: webhook.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, domain.DeliveryStatusDelivered, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.NotNil(t, deliveries[0].DeliveredAt)
+}
+
+func TestWebhookDispatcher_Deliver_RetriesThenDies(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	db, err := database.NewDatabase(ctx, "", database.PoolConfig{}, database.DefaultLoanPolicy())
+	require.NoError(t, err)
+	service := NewBooksService(db)
+	webhook, err := service.CreateWebhook(ctx, domain.WebhookSubscription{URL: server.URL})
+	require.NoError(t, err)
+
+	policy := WebhookRetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+	dispatcher := NewWebhookDispatcher(db, webhooks.NewClient(), policy)
+	require.NoError(t, dispatcher.Publish(ctx, events.Event{ID: 1, Type: "book.updated", Payload: json.RawMessage(`{}`)}))
+	now := time.Now()
+	dispatcher.now = func() time.Time { return now }
+
+	delivery := func() domain.WebhookDelivery {
+		t.Helper()
+		deliveries, err := service.GetWebhookDeliveries(ctx, domain.WebhookDeliveryQuery{SubscriptionID: webhook.ID, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		return deliveries[0]
+	}
+
+	require.NoError(t, dispatcher.Deliver(ctx))
+	failed := delivery()
+	assert.Equal(t, domain.DeliveryStatusPending, failed.Status)
+	assert.Equal(t, 503, failed.ResponseStatus)
+	assert.Equal(t, "webhook responded 503", failed.LastError)
+	assert.Equal(t, now.Add(time.Minute), *failed.NextAttemptAt)
+
+	// not due yet
+	require.NoError(t, dispatcher.Deliver(ctx))
+	assert.Equal(t, int32(1), calls.Load())
+
+	now = now.Add(time.Minute)
+	require.NoError(t, dispatcher.Deliver(ctx))
+	assert.Equal(t, now.Add(2*time.Minute), *delivery().NextAttemptAt)
+
+	now = now.Add(2 * time.Minute)
+	require.NoError(t, dispatcher.Deliver(ctx))
+	dead := delivery()
+	assert.Equal(t, domain.DeliveryStatusDead, dead.Status)
+	assert.Equal(t, 3, dead.Attempts)
+	assert.Nil(t, dead.NextAttemptAt)
+
+	now = now.Add(24 * time.Hour)
+	require.NoError(t, dispatcher.Deliver(ctx))
+	assert.Equal(t, int32(3), calls.Load())
+
+	// an admin retry brings it back with a fresh set of attempts
+	require.NoError(t, service.RetryWebhookDelivery(ctx, dead.ID))
+	assert.ErrorIs(t, service.RetryWebhookDelivery(ctx, dead.ID), domain.ErrDeliveryNotDead)
+	require.NoError(t, dispatcher.Deliver(ctx))
+	assert.Equal(t, int32(4), calls.Load())
+	assert.Equal(t, 1, delivery().Attempts)
+}
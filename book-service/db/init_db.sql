@@ -1,23 +1,65 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
 CREATE TABLE books (
    id SERIAL PRIMARY KEY,
-   title VARCHAR(255) NOT NULL,
-   isbn VARCHAR(20) UNIQUE,
+   title VARCHAR(255) COLLATE "en-US-x-icu" NOT NULL,
+   -- stored as an unhyphenated ISBN-13, ISBN-10s are converted on write; NULL when unknown
+   isbn VARCHAR(13) UNIQUE CHECK (isbn ~ '^97[89][0-9]{10}$'),
    author_id INT NOT NULL,
    category_id INT NOT NULL,
    stock INT NOT NULL DEFAULT 0,
    published_date DATE,
    description TEXT,
    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-   updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+   updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+   -- set by soft deletes, the purge job removes the row once the retention period has passed
+   deleted_at TIMESTAMP,
+   search_vector TSVECTOR GENERATED ALWAYS AS (
+       setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+       setweight(to_tsvector('english', COALESCE(description, '')), 'B')
+   ) STORED
 );
 
+CREATE INDEX idx_books_search_vector ON books USING GIN (search_vector);
+CREATE INDEX idx_books_title_trgm ON books USING GIN (title gin_trgm_ops);
+CREATE INDEX idx_books_title_id ON books (title, id);
+CREATE INDEX idx_books_deleted_at ON books (deleted_at) WHERE deleted_at IS NOT NULL;
+
 CREATE TABLE borrowing_records (
     id SERIAL PRIMARY KEY,
     user_id INT NOT NULL,
-    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    -- books with loans are never purged, so the loan history stays complete
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE RESTRICT,
     borrowed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     returned_at TIMESTAMP,
     due_date TIMESTAMP,
+    status VARCHAR(20) NOT NULL DEFAULT 'borrowed'
+        CHECK (status IN ('reserved', 'borrowed', 'renewed', 'overdue', 'returned', 'lost')),
+    -- how often the loan was renewed, capped by the loan policy
+    renewals INT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_borrowing_records_user_active ON borrowing_records (user_id)
+    WHERE status NOT IN ('returned', 'lost');
+CREATE INDEX idx_borrowing_records_book ON borrowing_records (book_id);
+
+CREATE TABLE fines (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    loan_id INT REFERENCES borrowing_records(id) ON DELETE SET NULL,
+    amount NUMERIC(10, 2) NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    paid_at TIMESTAMP
+);
+
+CREATE INDEX idx_fines_user_unpaid ON fines (user_id) WHERE paid_at IS NULL;
+
+-- borrowers has a row per user who borrowed, updated by every borrow so that two
+-- concurrent borrows of a user conflict instead of both passing the loan limit
+CREATE TABLE borrowers (
+    user_id INT PRIMARY KEY,
+    last_borrowed_at TIMESTAMP NOT NULL
 );
 
 CREATE TABLE book_recommendation (
@@ -27,4 +69,105 @@ CREATE TABLE book_recommendation (
     score FLOAT DEFAULT 1.0,
     FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
     FOREIGN KEY (recommended_book_id) REFERENCES books(id) ON DELETE CASCADE
-)
\ No newline at end of file
+);
+
+-- audit_log is append-only, the triggers reject any change to recorded entries
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL,
+    actor_role VARCHAR(50) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    entity VARCHAR(50) NOT NULL,
+    entity_id INT NOT NULL,
+    changes JSONB NOT NULL,
+    request_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_log_entity ON audit_log (entity, entity_id);
+CREATE INDEX idx_audit_log_actor ON audit_log (actor);
+
+CREATE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+-- outbox holds the domain events until the relay published them
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(100) NOT NULL,
+    aggregate_id INT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX idx_outbox_pending ON outbox (id) WHERE published_at IS NULL;
+
+-- webhook_subscriptions are the partner endpoints notified of domain events
+CREATE TABLE webhook_subscriptions (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    event_types TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- webhook_deliveries queues every event for every interested subscription and logs the attempts
+CREATE TABLE webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id INT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id BIGINT NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    response_status INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP,
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+-- notification_preferences holds the loan notifications each user wants, users without a row get all of them
+CREATE TABLE notification_preferences (
+    user_id INT PRIMARY KEY,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    due_soon BOOLEAN NOT NULL DEFAULT TRUE,
+    overdue BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- loan_notifications records every notification sent, once per loan, kind and due date
+CREATE TABLE loan_notifications (
+    loan_id INT NOT NULL REFERENCES borrowing_records(id) ON DELETE CASCADE,
+    user_id INT NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    due_date TIMESTAMP NOT NULL,
+    sent_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (loan_id, kind, due_date)
+);
+
+-- loan_notification_failures backs off the notifications the notifier failed to send
+CREATE TABLE loan_notification_failures (
+    loan_id INT NOT NULL REFERENCES borrowing_records(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    due_date TIMESTAMP NOT NULL,
+    attempts INT NOT NULL,
+    last_error TEXT NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (loan_id, kind, due_date)
+);
+
+CREATE INDEX idx_borrowing_records_due ON borrowing_records (due_date)
+    WHERE status IN ('borrowed', 'renewed', 'overdue');
@@ -0,0 +1,14 @@
+-- Fines charged to users, unpaid ones count against the loan policy.
+CREATE TABLE IF NOT EXISTS fines (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    amount NUMERIC(10, 2) NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    paid_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_fines_user_unpaid ON fines (user_id) WHERE paid_at IS NULL;
+
+-- the active loans of a user are counted on every borrow
+CREATE INDEX IF NOT EXISTS idx_borrowing_records_user_active ON borrowing_records (user_id) WHERE returned_at IS NULL;
@@ -0,0 +1,11 @@
+-- Loans keep their lifecycle status, the ones given back before it was stored are returned.
+ALTER TABLE borrowing_records ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'borrowed'
+    CHECK (status IN ('reserved', 'borrowed', 'renewed', 'overdue', 'returned', 'lost'));
+UPDATE borrowing_records SET status = 'returned' WHERE returned_at IS NOT NULL AND status = 'borrowed';
+
+DROP INDEX IF EXISTS idx_borrowing_records_user_active;
+CREATE INDEX idx_borrowing_records_user_active ON borrowing_records (user_id)
+    WHERE status NOT IN ('returned', 'lost');
+
+-- the loan a fine was charged for, like the replacement fee of a lost book
+ALTER TABLE fines ADD COLUMN IF NOT EXISTS loan_id INT REFERENCES borrowing_records(id) ON DELETE SET NULL;
@@ -0,0 +1,43 @@
+-- ISBNs are stored as unhyphenated ISBN-13s and a book without one has a NULL isbn, so
+-- any number of books can lack one. Existing values are normalized first: separators are
+-- stripped, ISBN-10s converted and empty values cleared. Values that are still no ISBN-13
+-- make the CHECK fail and have to be fixed by hand.
+ALTER TABLE books DROP CONSTRAINT IF EXISTS books_isbn_check;
+
+CREATE TEMPORARY TABLE normalized_isbns AS
+SELECT id, NULLIF(upper(regexp_replace(isbn, '[^0-9Xx]', '', 'g')), '') AS isbn FROM books;
+
+UPDATE normalized_isbns SET isbn = isbn10.body || (10 - (
+        SELECT sum(substr(isbn10.body, i, 1)::int * CASE WHEN i % 2 = 0 THEN 3 ELSE 1 END)
+        FROM generate_series(1, 12) AS i
+    ) % 10) % 10
+FROM (SELECT id, '978' || left(isbn, 9) AS body FROM normalized_isbns WHERE isbn ~ '^[0-9]{9}[0-9X]$') AS isbn10
+WHERE normalized_isbns.id = isbn10.id;
+
+-- books whose ISBNs only differ in their form, e.g. an ISBN-10 and its ISBN-13, would break
+-- the UNIQUE constraint half way through; they are listed so they can be merged by hand first
+DO $$
+DECLARE
+    conflicts TEXT;
+BEGIN
+    SELECT string_agg(isbn || ' (books ' || ids || ')', ', ' ORDER BY isbn) INTO conflicts
+    FROM (
+        SELECT isbn, string_agg(id::text, ', ' ORDER BY id) AS ids
+        FROM normalized_isbns
+        WHERE isbn IS NOT NULL
+        GROUP BY isbn
+        HAVING count(*) > 1
+    ) AS duplicates;
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'books share an ISBN once normalized: %', conflicts;
+    END IF;
+END $$;
+
+UPDATE books SET isbn = normalized_isbns.isbn
+FROM normalized_isbns
+WHERE books.id = normalized_isbns.id AND books.isbn IS DISTINCT FROM normalized_isbns.isbn;
+
+DROP TABLE normalized_isbns;
+
+ALTER TABLE books ALTER COLUMN isbn TYPE VARCHAR(13);
+ALTER TABLE books ADD CONSTRAINT books_isbn_check CHECK (isbn ~ '^97[89][0-9]{10}$');
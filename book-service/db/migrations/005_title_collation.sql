@@ -0,0 +1,12 @@
+-- Titles sort with the ICU en-US collation, the in-memory backend pages in the same order.
+-- search_vector is computed from the title, so it is dropped while the title changes.
+ALTER TABLE books DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE books ALTER COLUMN title TYPE VARCHAR(255) COLLATE "en-US-x-icu";
+ALTER TABLE books ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(description, '')), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_books_search_vector ON books USING GIN (search_vector);
+-- keyset pagination reads (title, id) in index order
+CREATE INDEX IF NOT EXISTS idx_books_title_id ON books (title, id);
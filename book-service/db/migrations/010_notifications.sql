@@ -0,0 +1,22 @@
+-- Which loan notifications each user wants, users without a row get all of them
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INT PRIMARY KEY,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    due_soon BOOLEAN NOT NULL DEFAULT TRUE,
+    overdue BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Notifications already sent, once per loan, kind and due date so a renewed loan is
+-- reminded again
+CREATE TABLE IF NOT EXISTS loan_notifications (
+    loan_id INT NOT NULL REFERENCES borrowing_records(id) ON DELETE CASCADE,
+    user_id INT NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    due_date TIMESTAMP NOT NULL,
+    sent_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (loan_id, kind, due_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_borrowing_records_due ON borrowing_records (due_date)
+    WHERE status IN ('borrowed', 'renewed', 'overdue');
@@ -0,0 +1,2 @@
+-- How often each loan was renewed, capped by the loan policy
+ALTER TABLE borrowing_records ADD COLUMN IF NOT EXISTS renewals INT NOT NULL DEFAULT 0;
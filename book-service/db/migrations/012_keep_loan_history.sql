@@ -0,0 +1,7 @@
+-- Purging a book no longer deletes its loans: books with loans are kept,
+-- and the foreign key refuses to drop loan history.
+ALTER TABLE borrowing_records
+    DROP CONSTRAINT IF EXISTS borrowing_records_book_id_fkey,
+    ADD CONSTRAINT borrowing_records_book_id_fkey FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS idx_borrowing_records_book ON borrowing_records (book_id);
@@ -0,0 +1,11 @@
+-- Notifications the notifier failed to send, backed off per loan so one failing
+-- notification does not hold up the others
+CREATE TABLE IF NOT EXISTS loan_notification_failures (
+    loan_id INT NOT NULL REFERENCES borrowing_records(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    due_date TIMESTAMP NOT NULL,
+    attempts INT NOT NULL,
+    last_error TEXT NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (loan_id, kind, due_date)
+);
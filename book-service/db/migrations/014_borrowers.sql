@@ -0,0 +1,6 @@
+-- A row per user who borrowed, updated by every borrow so that two concurrent borrows
+-- of a user conflict instead of both passing the loan limit
+CREATE TABLE IF NOT EXISTS borrowers (
+    user_id INT PRIMARY KEY,
+    last_borrowed_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,426 @@
+// Package config loads the settings of a service from, by increasing precedence, their
+// defaults, a YAML file, environment variables and command line flags.
+//
+// Every setting has a dotted key, e.g. database.max_conns, naming it in the file, where
+// the dots nest mappings, and as a flag (--database.max_conns=10), and an environment
+// variable of its own. A service asks the Loader for each of its settings with the
+// typed getters, then checks Err, which reports every invalid value at once along with
+// the file keys and flags that match no setting.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source tells where the value of a setting comes from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+const (
+	// FlagConfig names the YAML file to read, CONFIG_FILE does too when the flag is not given
+	FlagConfig = "config"
+	// FlagPrintConfig asks the service to print its settings and exit
+	FlagPrintConfig = "print-config"
+	envConfig       = "CONFIG_FILE"
+)
+
+// Loader resolves settings from the layers it was created with
+type Loader struct {
+	file        map[string]any
+	fileName    string
+	flags       map[string]string
+	printConfig bool
+	lookupEnv   func(string) (string, bool)
+
+	used     map[string]bool
+	settings []setting
+	errs     []error
+}
+
+// setting is a resolved setting as printed by Print
+type setting struct {
+	key    string
+	env    string
+	value  any
+	source Source
+	// redact replaces the printed value of secrets
+	redact func(value any) any
+	checks []func(value any) error
+}
+
+// NewLoader parses the command line flags in args, without the program name, and reads
+// the YAML file they or CONFIG_FILE name
+func NewLoader(args []string) (*Loader, error) {
+	return newLoader(args, os.LookupEnv)
+}
+
+func newLoader(args []string, lookupEnv func(string) (string, bool)) (*Loader, error) {
+	l := &Loader{
+		file:      map[string]any{},
+		flags:     map[string]string{},
+		lookupEnv: lookupEnv,
+		used:      map[string]bool{},
+	}
+	if err := l.parseFlags(args); err != nil {
+		return nil, err
+	}
+
+	if value, ok := l.flags[FlagPrintConfig]; ok {
+		printConfig, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("--%s: invalid boolean %q", FlagPrintConfig, value)
+		}
+		l.printConfig = printConfig
+		delete(l.flags, FlagPrintConfig)
+	}
+
+	path, ok := l.flags[FlagConfig]
+	delete(l.flags, FlagConfig)
+	if !ok {
+		path, _ = lookupEnv(envConfig)
+	}
+	if path != "" {
+		if err := l.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// parseFlags reads --key=value and --key value flags, a flag without a value is true
+func (l *Loader) parseFlags(args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || strings.Trim(arg, "-") == "" {
+			return fmt.Errorf("unexpected argument %q, settings are given as --key=value", arg)
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !hasValue {
+			value = "true"
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				value = args[i+1]
+				i++
+			}
+		}
+		l.flags[name] = value
+	}
+	return nil
+}
+
+func (l *Loader) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	l.fileName = path
+	flatten("", values, l.file)
+	return nil
+}
+
+// flatten stores the scalars and lists of nested mappings under their dotted keys
+func flatten(prefix string, values map[string]any, into map[string]any) {
+	for key, value := range values {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]any); ok {
+			flatten(key, nested, into)
+			continue
+		}
+		into[key] = value
+	}
+}
+
+// PrintConfig reports whether --print-config was given
+func (l *Loader) PrintConfig() bool {
+	return l.printConfig
+}
+
+// Err reports the invalid values of the settings read so far, and the file keys and
+// flags no setting was read from. It is meant to be called once every setting is read.
+func (l *Loader) Err() error {
+	errs := append([]error(nil), l.errs...)
+	for _, key := range sortedKeys(l.file) {
+		if !l.used[key] {
+			errs = append(errs, fmt.Errorf("%s in %s: unknown setting", key, l.fileName))
+		}
+	}
+	for _, name := range sortedKeys(l.flags) {
+		if !l.used[name] {
+			errs = append(errs, fmt.Errorf("--%s: unknown flag", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// raw is a value as found in a layer, a string for flags and the environment and any
+// YAML value for the file
+type raw struct {
+	value  any
+	source Source
+}
+
+// lookup returns the value of the highest layer setting key
+func (l *Loader) lookup(key, env string) (raw, bool) {
+	l.used[key] = true
+	if value, ok := l.flags[key]; ok {
+		return raw{value: value, source: SourceFlag}, true
+	}
+	if env != "" {
+		if value, ok := l.lookupEnv(env); ok {
+			return raw{value: value, source: SourceEnv}, true
+		}
+	}
+	if value, ok := l.file[key]; ok && value != nil {
+		return raw{value: value, source: SourceFile}, true
+	}
+	return raw{source: SourceDefault}, false
+}
+
+// origin names where a value was read, for errors
+func (l *Loader) origin(key, env string, source Source) string {
+	switch source {
+	case SourceFlag:
+		return "--" + key
+	case SourceEnv:
+		return env
+	case SourceFile:
+		return key + " in " + l.fileName
+	default:
+		return key
+	}
+}
+
+// resolve reads a setting with parse, keeping def when no layer sets it or its value
+// is invalid, and runs the checks of opts on the result
+func resolve[T any](l *Loader, key, env string, def T, parse func(any) (T, error), opts []Option) T {
+	s := setting{key: key, env: env, value: def, source: SourceDefault}
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	found, ok := l.lookup(key, env)
+	if ok {
+		value, err := parse(found.value)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Errorf("%s: %w", l.origin(key, env, found.source), err))
+			l.settings = append(l.settings, s)
+			return def
+		}
+		s.value = value
+		s.source = found.source
+	}
+	for _, check := range s.checks {
+		if err := check(s.value); err != nil {
+			l.errs = append(l.errs, fmt.Errorf("%s: %w", l.origin(key, env, s.source), err))
+			s.value = def
+			break
+		}
+	}
+	l.settings = append(l.settings, s)
+	return s.value.(T)
+}
+
+// scalar returns the text of a single value, YAML lists and mappings are rejected
+func scalar(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []any, map[string]any:
+		return "", errors.New("expected a single value")
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// String returns the setting key, read from the environment variable env
+func (l *Loader) String(key, env, def string, opts ...Option) string {
+	return resolve(l, key, env, def, scalar, opts)
+}
+
+func (l *Loader) Int(key, env string, def int, opts ...Option) int {
+	return resolve(l, key, env, def, func(value any) (int, error) {
+		text, err := scalar(value)
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil {
+			return 0, fmt.Errorf("invalid integer %q", text)
+		}
+		return n, nil
+	}, opts)
+}
+
+func (l *Loader) Float(key, env string, def float64, opts ...Option) float64 {
+	return resolve(l, key, env, def, func(value any) (float64, error) {
+		text, err := scalar(value)
+		if err != nil {
+			return 0, err
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", text)
+		}
+		return f, nil
+	}, opts)
+}
+
+func (l *Loader) Bool(key, env string, def bool, opts ...Option) bool {
+	return resolve(l, key, env, def, func(value any) (bool, error) {
+		text, err := scalar(value)
+		if err != nil {
+			return false, err
+		}
+		b, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			return false, fmt.Errorf("invalid boolean %q", text)
+		}
+		return b, nil
+	}, opts)
+}
+
+// Duration returns a setting given either as a Go duration, e.g. 90s, or as a whole
+// number of unit, which keeps environment variables like PURGE_INTERVAL_MINUTES=60 valid
+func (l *Loader) Duration(key, env string, def, unit time.Duration, opts ...Option) time.Duration {
+	return resolve(l, key, env, def, func(value any) (time.Duration, error) {
+		text, err := scalar(value)
+		if err != nil {
+			return 0, err
+		}
+		text = strings.TrimSpace(text)
+		if n, err := strconv.Atoi(text); err == nil {
+			return time.Duration(n) * unit, nil
+		}
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", text)
+		}
+		return d, nil
+	}, opts)
+}
+
+// Level returns a log level named debug, info, warn or error
+func (l *Loader) Level(key, env string, def slog.Level, opts ...Option) slog.Level {
+	return resolve(l, key, env, def, func(value any) (slog.Level, error) {
+		text, err := scalar(value)
+		if err != nil {
+			return 0, err
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(text))); err != nil {
+			return 0, fmt.Errorf("invalid log level %q", text)
+		}
+		return level, nil
+	}, opts)
+}
+
+// Strings returns a list, given as a YAML list in the file and comma separated
+// elsewhere. Empty elements are left out.
+func (l *Loader) Strings(key, env string, def []string, opts ...Option) []string {
+	return resolve(l, key, env, def, func(value any) ([]string, error) {
+		var items []string
+		if list, ok := value.([]any); ok {
+			for _, item := range list {
+				text, err := scalar(item)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, text)
+			}
+		} else {
+			text, err := scalar(value)
+			if err != nil {
+				return nil, err
+			}
+			items = strings.Split(text, ",")
+		}
+
+		var values []string
+		for _, item := range items {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+		return values, nil
+	}, opts)
+}
+
+// IntMap returns a mapping of names to integers, given as a YAML mapping in the file
+// and as name=value pairs separated by commas elsewhere, e.g. member=5,admin=10
+func (l *Loader) IntMap(key, env string, def map[string]int, opts ...Option) map[string]int {
+	// the file mapping was flattened to key.<name> entries
+	entries := map[string]any{}
+	for fileKey, value := range l.file {
+		if name, ok := strings.CutPrefix(fileKey, key+"."); ok {
+			entries[name] = value
+			l.used[fileKey] = true
+		}
+	}
+	if len(entries) > 0 {
+		l.file[key] = entries
+	}
+
+	return resolve(l, key, env, def, func(value any) (map[string]int, error) {
+		values := map[string]int{}
+		if entries, ok := value.(map[string]any); ok {
+			for name, v := range entries {
+				text, err := scalar(v)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+				n, err := strconv.Atoi(text)
+				if err != nil {
+					return nil, fmt.Errorf("invalid integer %q for %s", text, name)
+				}
+				values[name] = n
+			}
+			return values, nil
+		}
+
+		text, err := scalar(value)
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range strings.Split(text, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			name, limit, found := strings.Cut(pair, "=")
+			n, err := strconv.Atoi(strings.TrimSpace(limit))
+			if !found || err != nil {
+				return nil, fmt.Errorf("invalid entry %q, expected name=integer", pair)
+			}
+			values[strings.TrimSpace(name)] = n
+		}
+		return values, nil
+	}, opts)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// env returns a lookup of the environment variables in vars
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoader_Layers(t *testing.T) {
+	path := writeFile(t, `
+port: 4000
+database:
+  url: postgres://file
+  max_conns: 5
+log:
+  level: warn
+`)
+	l, err := newLoader([]string{"--config", path, "--port=5000"}, env(map[string]string{
+		"DATABASE_URL": "postgres://env",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, "5000", l.String("port", "PORT", "3000"))
+	assert.Equal(t, "postgres://env", l.String("database.url", "DATABASE_URL", ""))
+	assert.Equal(t, 5, l.Int("database.max_conns", "DATABASE_MAX_CONNS", 0))
+	assert.Equal(t, slog.LevelWarn, l.Level("log.level", "LOG_LEVEL", slog.LevelInfo))
+	assert.Equal(t, 2*time.Second, l.Duration("health.timeout", "HEALTH_CHECK_TIMEOUT_SECONDS", 2*time.Second, time.Second))
+	assert.NoError(t, l.Err())
+}
+
+func TestLoader_ConfigFileFromEnv(t *testing.T) {
+	path := writeFile(t, "port: 4000\n")
+	l, err := newLoader(nil, env(map[string]string{"CONFIG_FILE": path}))
+	require.NoError(t, err)
+
+	assert.Equal(t, "4000", l.String("port", "PORT", "3000"))
+}
+
+func TestLoader_Types(t *testing.T) {
+	path := writeFile(t, `
+cors:
+  origins: [https://a.example, https://b.example]
+loan:
+  max_per_role:
+    member: 2
+    staff: 8
+`)
+	l, err := newLoader([]string{"--config=" + path, "--loan.block_on_fines", "--purge.interval=90s"}, env(map[string]string{
+		"LOAN_MAX_UNPAID_FINES": "2.5",
+		"PURGE_RETENTION_DAYS":  "7",
+		"OTHER_ORIGINS":         " https://c.example, ,https://d.example",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"https://a.example", "https://b.example"}, l.Strings("cors.origins", "CORS_ALLOWED_ORIGINS", nil))
+	assert.Equal(t, []string{"https://c.example", "https://d.example"}, l.Strings("other.origins", "OTHER_ORIGINS", nil))
+	assert.Equal(t, map[string]int{"member": 2, "staff": 8}, l.IntMap("loan.max_per_role", "LOAN_MAX_PER_ROLE", nil))
+	assert.True(t, l.Bool("loan.block_on_fines", "LOAN_BLOCK_ON_FINES", false))
+	assert.Equal(t, 2.5, l.Float("loan.max_unpaid_fines", "LOAN_MAX_UNPAID_FINES", 0))
+	assert.Equal(t, 7*24*time.Hour, l.Duration("purge.retention", "PURGE_RETENTION_DAYS", 0, 24*time.Hour))
+	assert.Equal(t, 90*time.Second, l.Duration("purge.interval", "PURGE_INTERVAL_MINUTES", time.Hour, time.Minute))
+	assert.NoError(t, l.Err())
+}
+
+func TestLoader_IntMapFromEnv(t *testing.T) {
+	l, err := newLoader(nil, env(map[string]string{"LOAN_MAX_PER_ROLE": "member=5, admin=10"}))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int{"member": 5, "admin": 10}, l.IntMap("loan.max_per_role", "LOAN_MAX_PER_ROLE", nil))
+	assert.NoError(t, l.Err())
+}
+
+func TestLoader_Err(t *testing.T) {
+	path := writeFile(t, "port: 4000\ndatabse:\n  url: postgres://typo\n")
+	l, err := newLoader([]string{"--config", path, "--log.level=loud", "--unknown=1"}, env(map[string]string{
+		"DATABASE_MAX_CONNS": "many",
+		"LOAN_MAX_PER_ROLE":  "member=2,broken",
+		"DATABASE_MIN_CONNS": "-1",
+		"EVENT_SINK":         "kafka",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, l.Int("database.max_conns", "DATABASE_MAX_CONNS", 0))
+	assert.Equal(t, 0, l.Int("database.min_conns", "DATABASE_MIN_CONNS", 0, Min(0)))
+	assert.Equal(t, slog.LevelInfo, l.Level("log.level", "LOG_LEVEL", slog.LevelInfo))
+	assert.Nil(t, l.IntMap("loan.max_per_role", "LOAN_MAX_PER_ROLE", nil))
+	assert.Equal(t, "", l.String("events.sink", "EVENT_SINK", "", OneOf("", "nats", "webhook")))
+	l.String("port", "PORT", "3000")
+
+	assert.EqualError(t, l.Err(), `DATABASE_MAX_CONNS: invalid integer "many"
+DATABASE_MIN_CONNS: must be at least 0, got -1
+--log.level: invalid log level "loud"
+LOAN_MAX_PER_ROLE: invalid entry "broken", expected name=integer
+EVENT_SINK: must be one of "", "nats", "webhook", got "kafka"
+databse.url in `+path+`: unknown setting
+--unknown: unknown flag`)
+}
+
+func TestNewLoader_Errors(t *testing.T) {
+	_, err := newLoader([]string{"serve"}, env(nil))
+	assert.EqualError(t, err, `unexpected argument "serve", settings are given as --key=value`)
+
+	_, err = newLoader([]string{"--config", filepath.Join(t.TempDir(), "missing.yaml")}, env(nil))
+	assert.ErrorContains(t, err, "failed to read config file")
+
+	_, err = newLoader([]string{"--config", writeFile(t, "port: [")}, env(nil))
+	assert.ErrorContains(t, err, "failed to parse config file")
+
+	_, err = newLoader([]string{"--print-config=maybe"}, env(nil))
+	assert.EqualError(t, err, `--print-config: invalid boolean "maybe"`)
+}
+
+func TestLoader_Print(t *testing.T) {
+	l, err := newLoader([]string{"--print-config", "--port", "8080"}, env(map[string]string{
+		"DATABASE_URL":  "postgres://user:secret@db:5432/book",
+		"SMTP_PASSWORD": "hunter2",
+	}))
+	require.NoError(t, err)
+	assert.True(t, l.PrintConfig())
+
+	l.String("port", "PORT", "3000")
+	l.String("database.url", "DATABASE_URL", "", SecretURL())
+	l.Int("database.max_conns", "DATABASE_MAX_CONNS", 10)
+	l.Duration("purge.interval", "PURGE_INTERVAL_MINUTES", time.Hour, time.Minute)
+	l.String("smtp.password", "SMTP_PASSWORD", "", Secret())
+	l.String("smtp.username", "SMTP_USERNAME", "", Secret())
+	l.Level("log.level", "LOG_LEVEL", slog.LevelInfo)
+	l.Strings("cors.origins", "CORS_ALLOWED_ORIGINS", []string{"https://a.example"})
+
+	var out bytes.Buffer
+	require.NoError(t, l.Print(&out))
+	assert.Equal(t, `port: "8080" # flag
+database:
+  url: postgres://user:xxxxx@db:5432/book # env DATABASE_URL
+  max_conns: 10
+purge:
+  interval: 1h0m0s
+smtp:
+  password: <redacted> # env SMTP_PASSWORD
+  username: ""
+log:
+  level: info
+cors:
+  origins:
+    - https://a.example
+`, out.String())
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// redacted replaces the value of secrets in Print
+const redacted = "<redacted>"
+
+// Option validates a setting or changes how it is printed
+type Option func(*setting)
+
+// Secret keeps the value of a setting out of Print
+func Secret() Option {
+	return func(s *setting) {
+		s.redact = func(value any) any {
+			if value == "" {
+				return ""
+			}
+			return redacted
+		}
+	}
+}
+
+// SecretURL prints a URL setting with its password hidden, values that are not URLs
+// are hidden entirely. It suits connection strings, webhook URLs carry their secret in
+// the path or the query and take Secret instead.
+func SecretURL() Option {
+	return func(s *setting) {
+		s.redact = func(value any) any {
+			text, _ := value.(string)
+			u, err := url.Parse(text)
+			if text == "" {
+				return ""
+			}
+			if err != nil || u.Scheme == "" || u.Opaque != "" {
+				return redacted
+			}
+			return u.Redacted()
+		}
+	}
+}
+
+// Min rejects numbers and durations below min
+func Min[T int | float64 | time.Duration](min T) Option {
+	return func(s *setting) {
+		s.checks = append(s.checks, func(value any) error {
+			if v, ok := value.(T); ok && v < min {
+				return fmt.Errorf("must be at least %v, got %v", min, v)
+			}
+			return nil
+		})
+	}
+}
+
+// OneOf rejects strings other than values
+func OneOf(values ...string) Option {
+	return func(s *setting) {
+		s.checks = append(s.checks, func(value any) error {
+			if v, ok := value.(string); ok && !slices.Contains(values, v) {
+				return fmt.Errorf("must be one of %s, got %q", strings.Join(quoted(values), ", "), v)
+			}
+			return nil
+		})
+	}
+}
+
+func quoted(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = fmt.Sprintf("%q", v)
+	}
+	return out
+}
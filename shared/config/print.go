@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Print writes the settings read so far as a YAML file, in the order they were read,
+// with secrets redacted. Values not taken from their default are commented with where
+// they come from.
+func (l *Loader) Print(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, s := range l.settings {
+		value := s.value
+		if s.redact != nil {
+			value = s.redact(value)
+		}
+		node := &yaml.Node{}
+		if err := node.Encode(printable(value)); err != nil {
+			return fmt.Errorf("failed to encode %s: %w", s.key, err)
+		}
+		switch s.source {
+		case SourceFlag, SourceFile:
+			node.LineComment = string(s.source)
+		case SourceEnv:
+			node.LineComment = "env " + s.env
+		}
+		parent := root
+		parts := strings.Split(s.key, ".")
+		for _, part := range parts[:len(parts)-1] {
+			parent = child(parent, part)
+		}
+		parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: parts[len(parts)-1]}, node)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return fmt.Errorf("failed to write settings: %w", err)
+	}
+	return encoder.Close()
+}
+
+// child returns the mapping under key in parent, adding it when missing
+func child(parent *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == key {
+			return parent.Content[i+1]
+		}
+	}
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, node)
+	return node
+}
+
+// printable turns values into the form they are given in, durations as 1h30m
+// rather than nanoseconds
+func printable(value any) any {
+	switch v := value.(type) {
+	case time.Duration:
+		return v.String()
+	case slog.Level:
+		return strings.ToLower(v.String())
+	default:
+		return v
+	}
+}
@@ -0,0 +1,65 @@
+package events
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Broker is an in-memory Sink for tests and local runs, it keeps every event
+// published and hands them to its subscribers
+type Broker struct {
+	mu          sync.Mutex
+	events      []Event
+	subscribers []chan Event
+}
+
+func NewBroker() *Broker {
+	return &Broker{}
+}
+
+// Publish records the event and waits until every subscriber received it or ctx is done
+func (b *Broker) Publish(ctx context.Context, event Event) error {
+	b.mu.Lock()
+	b.events = append(b.events, event)
+	subscribers := slices.Clone(b.subscribers)
+	b.mu.Unlock()
+
+	for _, subscriber := range subscribers {
+		select {
+		case subscriber <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel receiving the events published from now on
+func (b *Broker) Subscribe(buffer int) <-chan Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscriber := make(chan Event, buffer)
+	b.subscribers = append(b.subscribers, subscriber)
+	return subscriber
+}
+
+// Events returns every event published so far, oldest first
+func (b *Broker) Events() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.events)
+}
+
+// Close closes the subscriber channels
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, subscriber := range b.subscribers {
+		close(subscriber)
+	}
+	b.subscribers = nil
+	return nil
+}
@@ -0,0 +1,95 @@
+// Package events delivers the domain events the services write to their outbox
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Sink kinds accepted by NewSink
+const (
+	SinkWebhook = "webhook"
+	SinkNATS    = "nats"
+	SinkMemory  = "memory"
+)
+
+// Event is a domain event as delivered to other services. IDs increase in the order
+// the events were written and are unique within the publishing service.
+type Event struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	AggregateID int             `json:"aggregate_id"`
+	Payload     json.RawMessage `json:"payload"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+}
+
+// Sink delivers events to their consumers
+type Sink interface {
+	Publish(ctx context.Context, event Event) error
+	Close() error
+}
+
+// Config selects the sink the relay delivers to
+type Config struct {
+	// Sink is one of the Sink constants, empty disables publishing
+	Sink string
+	// URL is the webhook endpoint or the NATS server, e.g. nats://nats:4222
+	URL string
+	// SubjectPrefix is prepended to the event type to form the NATS subject
+	SubjectPrefix string
+}
+
+// NewSink creates the sink described by config
+func NewSink(config Config) (Sink, error) {
+	switch config.Sink {
+	case SinkWebhook:
+		if config.URL == "" {
+			return nil, fmt.Errorf("the %s sink needs a URL", config.Sink)
+		}
+		return newWebhookSink(config.URL), nil
+	case SinkNATS:
+		if config.URL == "" {
+			return nil, fmt.Errorf("the %s sink needs a URL", config.Sink)
+		}
+		return newNATSSink(config.URL, config.SubjectPrefix)
+	case SinkMemory:
+		return NewBroker(), nil
+	default:
+		return nil, fmt.Errorf("unknown event sink %q", config.Sink)
+	}
+}
+
+// Outbox is where a service keeps the events written with each change, PendingEvents
+// returns the events not marked published yet in the order they were written
+type Outbox interface {
+	PendingEvents(ctx context.Context, limit int) ([]Event, error)
+	MarkEventPublished(ctx context.Context, id int64) error
+}
+
+// Relay returns a job delivering the pending outbox events to sink in the order they
+// were written. It stops at the first event the sink rejects and starts from it again
+// on the next run, so events are delivered at least once and consumers should skip
+// the ids they have already seen.
+func Relay(outbox Outbox, sink Sink, batchSize int) func(context.Context) error {
+	return func(ctx context.Context) error {
+		for {
+			pending, err := outbox.PendingEvents(ctx, batchSize)
+			if err != nil {
+				return err
+			}
+			for _, event := range pending {
+				if err := sink.Publish(ctx, event); err != nil {
+					return fmt.Errorf("failed to publish event %d: %w", event.ID, err)
+				}
+				if err := outbox.MarkEventPublished(ctx, event.ID); err != nil {
+					return err
+				}
+			}
+			if len(pending) < batchSize {
+				return nil
+			}
+		}
+	}
+}
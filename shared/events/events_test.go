@@ -0,0 +1,127 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOutbox keeps outbox events in memory like the databases do
+type fakeOutbox struct {
+	events    []Event
+	published map[int64]bool
+}
+
+func (o *fakeOutbox) PendingEvents(_ context.Context, limit int) ([]Event, error) {
+	pending := []Event{}
+	for _, event := range o.events {
+		if !o.published[event.ID] && len(pending) < limit {
+			pending = append(pending, event)
+		}
+	}
+	return pending, nil
+}
+
+func (o *fakeOutbox) MarkEventPublished(_ context.Context, id int64) error {
+	o.published[id] = true
+	return nil
+}
+
+func newFakeOutbox(count int) *fakeOutbox {
+	outbox := &fakeOutbox{published: map[int64]bool{}}
+	for id := int64(1); id <= int64(count); id++ {
+		outbox.events = append(outbox.events, Event{
+			ID: id, Type: "book.created", AggregateID: int(id), Payload: json.RawMessage(`{}`), OccurredAt: time.Now(),
+		})
+	}
+	return outbox
+}
+
+// rejectingSink fails every event with the given id and hands the others to a Broker
+type rejectingSink struct {
+	*Broker
+	reject int64
+}
+
+func (s rejectingSink) Publish(ctx context.Context, event Event) error {
+	if event.ID == s.reject {
+		return assert.AnError
+	}
+	return s.Broker.Publish(ctx, event)
+}
+
+func ids(events []Event) []int64 {
+	var ids []int64
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestRelay(t *testing.T) {
+	outbox := newFakeOutbox(5)
+	broker := NewBroker()
+	received := broker.Subscribe(10)
+
+	// batches smaller than the backlog are relayed until it is drained
+	require.NoError(t, Relay(outbox, broker, 2)(context.Background()))
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, ids(broker.Events()))
+	assert.Equal(t, int64(1), (<-received).ID)
+
+	pending, err := outbox.PendingEvents(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestRelay_StopsAtRejectedEvent(t *testing.T) {
+	outbox := newFakeOutbox(4)
+	sink := rejectingSink{Broker: NewBroker(), reject: 3}
+
+	err := Relay(outbox, sink, 10)(context.Background())
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.ErrorContains(t, err, "failed to publish event 3")
+	assert.Equal(t, []int64{1, 2}, ids(sink.Events()))
+
+	// the next run starts again at the rejected event, keeping the order
+	sink.reject = 0
+	require.NoError(t, Relay(outbox, sink, 10)(context.Background()))
+	assert.Equal(t, []int64{1, 2, 3, 4}, ids(sink.Events()))
+}
+
+func TestNewSink(t *testing.T) {
+	sink, err := NewSink(Config{Sink: SinkMemory})
+	require.NoError(t, err)
+	assert.IsType(t, &Broker{}, sink)
+
+	sink, err = NewSink(Config{Sink: SinkNATS, URL: "nats://localhost", SubjectPrefix: "library"})
+	require.NoError(t, err)
+	assert.Equal(t, "library.book.created", sink.(*natsSink).subject("book.created"))
+	assert.NoError(t, sink.Close())
+
+	for _, config := range []Config{
+		{Sink: "kafka"},
+		{Sink: SinkWebhook},
+		{Sink: SinkNATS, URL: "http://localhost:4222"},
+	} {
+		_, err := NewSink(config)
+		assert.Error(t, err, config)
+	}
+}
+
+func TestFanout(t *testing.T) {
+	first := NewBroker()
+	second := rejectingSink{Broker: NewBroker(), reject: 2}
+	sink := Fanout(first, second)
+
+	require.NoError(t, sink.Publish(context.Background(), Event{ID: 1}))
+	assert.ErrorIs(t, sink.Publish(context.Background(), Event{ID: 2}), assert.AnError)
+	assert.Equal(t, []int64{1, 2}, ids(first.Events()))
+	assert.Equal(t, []int64{1}, ids(second.Events()))
+	assert.NoError(t, sink.Close())
+
+	assert.Same(t, first, Fanout(first))
+}
@@ -0,0 +1,36 @@
+package events
+
+import (
+	"context"
+	"errors"
+)
+
+// fanout publishes every event to several sinks
+type fanout []Sink
+
+// Fanout returns a sink publishing to every sink in turn. It stops at the first
+// sink that fails, so when the relay publishes the event again the sinks before
+// it see it twice.
+func Fanout(sinks ...Sink) Sink {
+	if len(sinks) == 1 {
+		return sinks[0]
+	}
+	return fanout(sinks)
+}
+
+func (f fanout) Publish(ctx context.Context, event Event) error {
+	for _, sink := range f {
+		if err := sink.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f fanout) Close() error {
+	var errs []error
+	for _, sink := range f {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,88 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsTimeout bounds connecting to the server and a single publish
+const natsTimeout = 5 * time.Second
+
+// natsClientName identifies the relay in the server's connection list
+const natsClientName = "outbox-relay"
+
+// natsSink publishes events to a NATS server, every event goes to the subject
+// <prefix>.<event type>. Each publish is flushed so the server has accepted the
+// event once Publish returns.
+type natsSink struct {
+	conn   *nats.Conn
+	prefix string
+}
+
+// newNATSSink connects to the server at serverURL, reconnecting in the background
+// whenever the connection is lost. Events are not buffered while disconnected, their
+// publish fails and the relay retries them on its next run.
+func newNATSSink(serverURL, prefix string) (*natsSink, error) {
+	parsed, err := url.Parse(serverURL)
+	if err != nil || (parsed.Scheme != "nats" && parsed.Scheme != "tls") || parsed.Hostname() == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q", serverURL)
+	}
+	conn, err := nats.Connect(serverURL,
+		nats.Name(natsClientName),
+		nats.Timeout(natsTimeout),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectBufSize(-1),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			slog.Warn("NATS error", "error", err)
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	return &natsSink{conn: conn, prefix: prefix}, nil
+}
+
+func (s *natsSink) subject(eventType string) string {
+	if s.prefix == "" {
+		return eventType
+	}
+	return s.prefix + "." + eventType
+}
+
+// Publish sends the event and waits for the server to acknowledge it
+func (s *natsSink) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, natsTimeout)
+	defer cancel()
+
+	// the server reports a rejected publish before answering the flush,
+	// it shows up as a new last error of the connection
+	before := s.conn.LastError()
+	if err := s.conn.Publish(s.subject(event.Type), body); err != nil {
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+	if err := s.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+	if err := s.conn.LastError(); err != before && errors.Is(err, nats.ErrPermissionViolation) {
+		return fmt.Errorf("NATS rejected the event: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connection, every event published was already flushed
+func (s *natsSink) Close() error {
+	s.conn.Close()
+	return nil
+}
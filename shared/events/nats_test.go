@@ -0,0 +1,105 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNATS accepts one connection, answers every PUB with reply and sends
+// the subjects and payloads it received on the returned channel
+func fakeNATS(t *testing.T, reply string) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"max_payload\":1048576}\r\n")
+
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			var subject string
+			var size int
+			switch {
+			case strings.HasPrefix(line, "CONNECT "):
+				received <- strings.TrimSpace(line)
+			case strings.HasPrefix(line, "PUB "):
+				fmt.Sscanf(line, "PUB %s %d", &subject, &size)
+				payload := make([]byte, size+2)
+				if _, err := io.ReadFull(reader, payload); err != nil {
+					return
+				}
+				received <- subject + " " + strings.TrimSpace(string(payload))
+				fmt.Fprint(conn, reply)
+			case strings.HasPrefix(line, "PING"):
+				fmt.Fprint(conn, "PONG\r\n")
+			}
+		}
+	}()
+	return "nats://" + listener.Addr().String(), received
+}
+
+func TestNATSSink_Publish(t *testing.T) {
+	url, received := fakeNATS(t, "")
+	sink, err := newNATSSink(url, "library")
+	require.NoError(t, err)
+	defer sink.Close()
+
+	event := Event{ID: 4, Type: "book.borrowed", AggregateID: 2, Payload: json.RawMessage(`{"book_id":2}`)}
+	require.NoError(t, sink.Publish(context.Background(), event))
+
+	assert.Contains(t, <-received, `"name":"outbox-relay"`)
+	subject, body, _ := strings.Cut(<-received, " ")
+	assert.Equal(t, "library.book.borrowed", subject)
+	var published Event
+	require.NoError(t, json.Unmarshal([]byte(body), &published))
+	assert.Equal(t, event, published)
+}
+
+func TestNATSSink_Publish_Rejected(t *testing.T) {
+	url, _ := fakeNATS(t, "-ERR 'Permissions Violation for Publish to book.created'\r\n")
+	sink, err := newNATSSink(url, "")
+	require.NoError(t, err)
+
+	err = sink.Publish(context.Background(), Event{ID: 1, Type: "book.created", Payload: json.RawMessage(`{}`)})
+	assert.ErrorIs(t, err, nats.ErrPermissionViolation)
+	assert.ErrorContains(t, err, "NATS rejected the event")
+	assert.NoError(t, sink.Close())
+}
+
+func TestNATSSink_Publish_Disconnected(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	url := "nats://" + listener.Addr().String()
+	listener.Close()
+
+	// the sink is created while the server is down and keeps trying to connect
+	sink, err := newNATSSink(url, "")
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, sink.Publish(ctx, Event{ID: 1, Type: "book.created", Payload: json.RawMessage(`{}`)}))
+}
@@ -0,0 +1,42 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSink_Publish(t *testing.T) {
+	var received Event
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	event := Event{ID: 12, Type: "book.returned", AggregateID: 3, Payload: json.RawMessage(`{"book_id":3}`)}
+	err := newWebhookSink(server.URL).Publish(context.Background(), event)
+
+	require.NoError(t, err)
+	assert.Equal(t, event, received)
+	assert.Equal(t, "12", header.Get(HeaderEventID))
+	assert.Equal(t, "book.returned", header.Get(HeaderEventType))
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+}
+
+func TestWebhookSink_Publish_Rejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	err := newWebhookSink(server.URL).Publish(context.Background(), Event{ID: 1, Payload: json.RawMessage(`{}`)})
+	assert.ErrorContains(t, err, "webhook responded 503")
+}
@@ -0,0 +1,113 @@
+// Package health runs the checks behind the liveness and readiness endpoints of the services, serves
+// those endpoints and drains the service when it shuts down
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses of a report and of its checks
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDraining = "draining"
+)
+
+// Check probes a dependency and returns an error when the service cannot use it
+type Check func(ctx context.Context) error
+
+// Report is the outcome of the readiness checks
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Ready reports whether the service should be sent traffic
+func (r Report) Ready() bool {
+	return r.Status == StatusUp
+}
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker decides whether the service is ready from the checks of its dependencies.
+// A draining service is never ready, so it gets no new traffic while shutting down.
+type Checker struct {
+	timeout  time.Duration
+	mu       sync.Mutex
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+// NewChecker returns a checker failing the checks that take longer than timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add adds a check reported under name
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Drain marks the service as shutting down, it stays not ready from then on
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Ready runs every check at once and reports the service up when they all pass
+func (c *Checker) Ready(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := append([]namedCheck(nil), c.checks...)
+	c.mu.Unlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, check.check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]CheckResult, len(checks))}
+	for i, check := range checks {
+		report.Checks[check.name] = results[i]
+		if results[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	if c.draining.Load() {
+		report.Status = StatusDraining
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := CheckResult{Status: StatusUp, DurationMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
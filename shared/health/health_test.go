@@ -0,0 +1,51 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker_Ready(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.Add("database", func(context.Context) error { return nil })
+
+	report := checker.Ready(context.Background())
+	assert.True(t, report.Ready())
+	assert.Equal(t, StatusUp, report.Status)
+	assert.Equal(t, StatusUp, report.Checks["database"].Status)
+	assert.Empty(t, report.Checks["database"].Error)
+}
+
+func TestChecker_Ready_Down(t *testing.T) {
+	checker := NewChecker(10 * time.Millisecond)
+	checker.Add("database", func(context.Context) error { return errors.New("connection refused") })
+	checker.Add("cache", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	checker.Add("books", func(context.Context) error { return nil })
+
+	report := checker.Ready(context.Background())
+	assert.False(t, report.Ready())
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, CheckResult{Status: StatusDown, Error: "connection refused", DurationMS: report.Checks["database"].DurationMS},
+		report.Checks["database"])
+	assert.Equal(t, StatusDown, report.Checks["cache"].Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["cache"].Error)
+	assert.Equal(t, StatusUp, report.Checks["books"].Status)
+}
+
+func TestChecker_Drain(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.Add("database", func(context.Context) error { return nil })
+	checker.Drain()
+
+	report := checker.Ready(context.Background())
+	assert.False(t, report.Ready())
+	assert.Equal(t, StatusDraining, report.Status)
+	assert.Equal(t, StatusUp, report.Checks["database"].Status)
+}
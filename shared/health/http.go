@@ -0,0 +1,60 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Live returns a handler function reporting that the process is up. It checks
+// no dependency, a failing database must not get the service restarted.
+func Live() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(Report{Status: StatusUp})
+	}
+}
+
+// Ready returns a handler function reporting whether the service should get traffic,
+// with the outcome of every check. It responds 503 when a check fails or while draining.
+func Ready(checker *Checker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		report := checker.Ready(c.UserContext())
+		if !report.Ready() {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(report)
+		}
+		return c.JSON(report)
+	}
+}
+
+// Server is the part of the fiber app that Serve drives
+type Server interface {
+	Listen(addr string) error
+	ShutdownWithTimeout(timeout time.Duration) error
+}
+
+// Serve runs app on addr until ctx is done, then marks the service as draining, keeps
+// serving for drainDelay so load balancers see it and stop sending requests, and shuts
+// app down, giving the requests in flight up to timeout to finish
+func Serve(ctx context.Context, app Server, addr string, checker *Checker, drainDelay, timeout time.Duration) error {
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(addr)
+	}()
+
+	select {
+	case err := <-listenErr:
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down", "drain_delay", drainDelay, "timeout", timeout)
+	checker.Drain()
+	time.Sleep(drainDelay)
+	if err := app.ShutdownWithTimeout(timeout); err != nil {
+		return fmt.Errorf("failed to shut down the server: %w", err)
+	}
+	return <-listenErr
+}
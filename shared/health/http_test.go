@@ -0,0 +1,111 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLive(t *testing.T) {
+	app := fiber.New()
+	app.Get("/health/live", Live())
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/health/live", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var report Report
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, Report{Status: StatusUp}, report)
+}
+
+func TestReady(t *testing.T) {
+	var dbErr error
+	checker := NewChecker(time.Second)
+	checker.Add("database", func(context.Context) error { return dbErr })
+
+	app := fiber.New()
+	app.Get("/health/ready", Ready(checker))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/health/ready", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	dbErr = errors.New("connection refused")
+	resp, err = app.Test(httptest.NewRequest("GET", "/health/ready", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+
+	var report Report
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, "connection refused", report.Checks["database"].Error)
+
+	dbErr = nil
+	checker.Drain()
+	resp, err = app.Test(httptest.NewRequest("GET", "/health/ready", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+}
+
+// fakeServer serves until it is shut down, or fails to listen with listenErr
+type fakeServer struct {
+	listenErr       error
+	stopped         chan struct{}
+	shutdownTimeout time.Duration
+	shutdownAt      time.Time
+}
+
+func (s *fakeServer) Listen(string) error {
+	if s.listenErr != nil {
+		return s.listenErr
+	}
+	<-s.stopped
+	return nil
+}
+
+func (s *fakeServer) ShutdownWithTimeout(timeout time.Duration) error {
+	s.shutdownTimeout = timeout
+	s.shutdownAt = time.Now()
+	close(s.stopped)
+	return nil
+}
+
+func TestServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	app := &fakeServer{stopped: make(chan struct{})}
+	checker := NewChecker(time.Second)
+
+	done := make(chan error)
+	go func() {
+		done <- Serve(ctx, app, ":3000", checker, 50*time.Millisecond, 5*time.Second)
+	}()
+	assert.True(t, checker.Ready(context.Background()).Ready())
+	cancelledAt := time.Now()
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return once the context was done")
+	}
+	assert.Equal(t, 5*time.Second, app.shutdownTimeout)
+	assert.GreaterOrEqual(t, app.shutdownAt.Sub(cancelledAt), 50*time.Millisecond, "shut down before the drain delay")
+	assert.Equal(t, StatusDraining, checker.Ready(context.Background()).Status)
+}
+
+func TestServe_ListenError(t *testing.T) {
+	app := &fakeServer{listenErr: errors.New("address already in use"), stopped: make(chan struct{})}
+	checker := NewChecker(time.Second)
+
+	err := Serve(context.Background(), app, ":3000", checker, time.Second, time.Second)
+	assert.EqualError(t, err, "failed to listen on :3000: address already in use")
+	assert.True(t, checker.Ready(context.Background()).Ready())
+}
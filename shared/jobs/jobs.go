@@ -0,0 +1,71 @@
+// Package jobs runs the background work of the services on a schedule
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"library/logging"
+	"library/tracing"
+)
+
+// Run calls job every interval until ctx is done. Failures are logged and the job
+// runs again at the next tick. The job logs through the logger in its context, which
+// names the job, and every run is the root span of a trace.
+func Run(ctx context.Context, name string, interval time.Duration, job func(context.Context) error) {
+	logger := slog.Default().With("job", name)
+	ctx = logging.WithLogger(ctx, logger)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runCtx, span := tracing.Start(ctx, "job "+name)
+			err := job(runCtx)
+			tracing.RecordError(span, err)
+			span.End()
+			if err != nil {
+				logger.Error("job failed", "error", err)
+			}
+		}
+	}
+}
+
+// Purge returns a job removing the records soft deleted longer than retention ago
+func Purge(purge func(ctx context.Context, before time.Time) (int, error), retention time.Duration) func(context.Context) error {
+	return func(ctx context.Context) error {
+		purged, err := purge(ctx, time.Now().Add(-retention))
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			logging.FromContext(ctx).Info("purged deleted records", "count", purged)
+		}
+		return nil
+	}
+}
+
+// Group runs jobs in the background and lets the caller wait for them to stop
+type Group struct {
+	wg sync.WaitGroup
+}
+
+// Go starts Run in a goroutine, the job stops with ctx
+func (g *Group) Go(ctx context.Context, name string, interval time.Duration, job func(context.Context) error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		Run(ctx, name, interval, job)
+	}()
+}
+
+// Wait blocks until every job started with Go has stopped, a run in progress
+// finishes first
+func (g *Group) Wait() {
+	g.wg.Wait()
+}
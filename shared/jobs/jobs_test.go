@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := 0
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, "test", time.Millisecond, func(context.Context) error {
+			runs++
+			if runs == 3 {
+				cancel()
+			}
+			return assert.AnError
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not stop when the context was cancelled")
+	}
+	assert.Equal(t, 3, runs)
+}
+
+func TestPurge(t *testing.T) {
+	var before time.Time
+	job := Purge(func(_ context.Context, t time.Time) (int, error) {
+		before = t
+		return 2, nil
+	}, time.Hour)
+
+	assert.Nil(t, job(context.Background()))
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), before, time.Second)
+
+	job = Purge(func(context.Context, time.Time) (int, error) { return 0, assert.AnError }, time.Hour)
+	assert.ErrorIs(t, job(context.Background()), assert.AnError)
+}
+
+func TestGroup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var group Group
+	started := make(chan struct{})
+	group.Go(ctx, "test", time.Millisecond, func(ctx context.Context) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	group.Go(ctx, "other", time.Hour, func(context.Context) error { return nil })
+
+	<-started
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		group.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return once the jobs stopped")
+	}
+}
@@ -0,0 +1,28 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromContext(t *testing.T) {
+	assert.Same(t, slog.Default(), FromContext(context.Background()))
+
+	var out bytes.Buffer
+	logger := New(&out, slog.LevelInfo).With("request_id", "req-1")
+	ctx := WithLogger(context.Background(), logger)
+	FromContext(ctx).Debug("hidden")
+	FromContext(ctx).Info("served", "status", 200)
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, "served", line["msg"])
+	assert.Equal(t, "req-1", line["request_id"])
+	assert.Equal(t, 200.0, line["status"])
+}
@@ -0,0 +1,56 @@
+// Package metrics holds the Prometheus collectors the services share
+package metrics
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector exposes the statistics of a connection pool, read on every scrape
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+var (
+	poolAcquired = prometheus.NewDesc("db_pool_acquired_connections", "Connections in use", nil, nil)
+	poolIdle     = prometheus.NewDesc("db_pool_idle_connections", "Connections waiting to be used", nil, nil)
+	poolTotal    = prometheus.NewDesc("db_pool_total_connections",
+		"Open connections, including the ones being opened", nil, nil)
+	poolMax      = prometheus.NewDesc("db_pool_max_connections", "Most connections the pool opens", nil, nil)
+	poolAcquires = prometheus.NewDesc("db_pool_acquires_total", "Connections handed out", nil, nil)
+	poolEmpty    = prometheus.NewDesc("db_pool_empty_acquires_total",
+		"Connections handed out after waiting for one to be free", nil, nil)
+	poolWait = prometheus.NewDesc("db_pool_acquire_wait_seconds_total",
+		"Time spent waiting for a free connection", nil, nil)
+)
+
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{poolAcquired, poolIdle, poolTotal, poolMax, poolAcquires, poolEmpty, poolWait} {
+		ch <- desc
+	}
+}
+
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquired, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdle, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotal, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMax, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquires, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmpty, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolWait, prometheus.CounterValue, s.EmptyAcquireWaitTime().Seconds())
+}
+
+// RegisterPool exposes the statistics of pool with registerer, replacing the pool registered before
+func RegisterPool(registerer prometheus.Registerer, pool *pgxpool.Pool) error {
+	collector := poolCollector{pool: pool}
+	err := registerer.Register(collector)
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		registerer.Unregister(registered.ExistingCollector)
+		err = registerer.Register(collector)
+	}
+	return err
+}
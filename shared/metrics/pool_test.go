@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterPool(t *testing.T) {
+	// the pool connects lazily, so its statistics can be read without a server
+	pool, err := pgxpool.New(context.Background(), "postgres://user@localhost:1/db?pool_max_conns=4")
+	require.NoError(t, err)
+	defer pool.Close()
+
+	registry := prometheus.NewPedanticRegistry()
+	assert.Nil(t, RegisterPool(registry, pool))
+	// registering a new pool replaces the previous one
+	assert.Nil(t, RegisterPool(registry, pool))
+
+	assert.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP db_pool_max_connections Most connections the pool opens
+# TYPE db_pool_max_connections gauge
+db_pool_max_connections 4
+# HELP db_pool_acquires_total Connections handed out
+# TYPE db_pool_acquires_total counter
+db_pool_acquires_total 0
+`), "db_pool_max_connections", "db_pool_acquires_total"))
+	assert.Equal(t, 7, testutil.CollectAndCount(poolCollector{pool: pool}))
+}
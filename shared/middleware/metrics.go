@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Requests served, by method, route template and status",
+	}, []string{"method", "route", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to serve requests, by method and route template",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// RecordMetrics returns a middleware that counts every request and its latency
+// by route template, so /api/v1/items/1 and /api/v1/items/2 add up under /api/v1/items/:id
+func RecordMetrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+		route := c.Route().Path
+		httpRequests.WithLabelValues(c.Method(), route, strconv.Itoa(responseStatus(c, err))).Inc()
+		httpDuration.WithLabelValues(c.Method(), route).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// Metrics returns a handler function that serves the metrics of gatherer in the Prometheus text format.
+// Metrics failing to be read are logged and left out rather than failing the scrape.
+func Metrics(gatherer prometheus.Gatherer) fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+		ErrorLog:      slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		ErrorHandling: promhttp.ContinueOnError,
+	}))
+}
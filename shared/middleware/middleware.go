@@ -0,0 +1,239 @@
+// Package middleware holds the fiber middleware the services put in front of their routes
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"library/logging"
+	"library/tracing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cache"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers set by the API gateway
+const (
+	// HeaderUserRole carries the role of the authenticated caller
+	HeaderUserRole = "X-User-Role"
+	// HeaderUserID carries the id of the authenticated caller
+	HeaderUserID = "X-User-ID"
+	// HeaderRequestID carries the id the gateway gave the request
+	HeaderRequestID = "X-Request-ID"
+)
+
+// maxRequestIDLength bounds the request ids taken from callers, longer ones are replaced
+const maxRequestIDLength = 128
+
+// RequireRole returns a middleware that rejects callers without the given role
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Get(HeaderUserRole) != role {
+			return sendError(c, fiber.StatusForbidden, "forbidden")
+		}
+		return c.Next()
+	}
+}
+
+// RequireSelfOrRole returns a middleware that only lets through the user named by
+// the id path parameter and callers with the given role
+func RequireSelfOrRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Get(HeaderUserID) != c.Params("id") && c.Get(HeaderUserRole) != role {
+			return sendError(c, fiber.StatusForbidden, "forbidden")
+		}
+		return c.Next()
+	}
+}
+
+// userClaims are the claims of a bearer token, the subject is the user id
+type userClaims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// Authenticate returns a middleware that takes the caller from the bearer token of the
+// request instead of the X-User-ID and X-User-Role headers, which are replaced with the
+// sub and role claims of the token. Tokens must be signed with key using HS256 and expire,
+// requests with an invalid token are rejected and requests without one are anonymous.
+// Without a key the headers set by the API gateway are trusted.
+func Authenticate(key string) fiber.Handler {
+	if key == "" {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	keyFunc := func(*jwt.Token) (any, error) {
+		return []byte(key), nil
+	}
+	return func(c *fiber.Ctx) error {
+		header := &c.Request().Header
+		header.Del(HeaderUserID)
+		header.Del(HeaderUserRole)
+
+		token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok {
+			return c.Next()
+		}
+		var claims userClaims
+		if _, err := parser.ParseWithClaims(token, &claims, keyFunc); err != nil {
+			slog.Warn("rejected bearer token", "path", c.Path(), "error", err)
+			return sendError(c, fiber.StatusUnauthorized, "invalid bearer token")
+		}
+		header.Set(HeaderUserID, claims.Subject)
+		header.Set(HeaderUserRole, claims.Role)
+		return c.Next()
+	}
+}
+
+// CacheConfig keeps the responses of read routes in memory, a zero Expiration disables it
+type CacheConfig struct {
+	// Expiration is how long a response is served from the cache, in whole seconds
+	Expiration time.Duration
+	// MaxBytes bounds the size of the cached bodies, the entries expiring first are
+	// dropped to make room. Zero is unbounded.
+	MaxBytes int
+}
+
+// Cache returns a middleware serving GET requests from a cache. A response is kept per
+// caller, as what callers see depends on their role, and only successful ones are kept.
+func Cache(config CacheConfig) fiber.Handler {
+	if config.Expiration <= 0 {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+	return cache.New(cache.Config{
+		// asked again once the request is served, which keeps failed responses out
+		Next: func(c *fiber.Ctx) bool {
+			return c.Response().StatusCode() != fiber.StatusOK
+		},
+		Expiration: config.Expiration,
+		MaxBytes:   uint(config.MaxBytes),
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return strings.Join([]string{c.Get(HeaderUserID), c.Get(HeaderUserRole), c.OriginalURL()}, "|")
+		},
+	})
+}
+
+// RequestLogger returns a middleware that gives every request an id, the X-Request-ID
+// header of the caller or a generated one, which is echoed in the response. The user
+// context carries a logger with the request and user id for the other layers to log
+// with, and every request is logged once served.
+func RequestLogger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		requestID := c.Get(HeaderRequestID)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = utils.UUIDv4()
+			c.Request().Header.Set(HeaderRequestID, requestID)
+		}
+		c.Set(HeaderRequestID, requestID)
+
+		logger := slog.Default().With("request_id", requestID)
+		if sc := trace.SpanContextFromContext(c.UserContext()); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		if userID := c.Get(HeaderUserID); userID != "" {
+			logger = logger.With("user_id", userID)
+		}
+		c.SetUserContext(logging.WithLogger(c.UserContext(), logger))
+
+		err := c.Next()
+		status := responseStatus(c, err)
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(c.UserContext(), level, "request",
+			slog.String("method", c.Method()),
+			slog.String("route", c.Route().Path),
+			slog.String("path", c.Path()),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		)
+		return err
+	}
+}
+
+// Trace returns a middleware that serves every request in a server span, joining the
+// trace of the caller when the request has a traceparent header. The span is named
+// after the route template once the request is served.
+func Trace() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := tracing.Extract(c.UserContext(), headerCarrier{&c.Request().Header})
+		ctx, span := tracing.Start(ctx, c.Method(), trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Method()),
+				attribute.String("url.path", c.Path()),
+			))
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		status := responseStatus(c, err)
+		span.SetName(c.Method() + " " + c.Route().Path)
+		span.SetAttributes(
+			attribute.String("http.route", c.Route().Path),
+			attribute.Int("http.response.status_code", status),
+		)
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		return err
+	}
+}
+
+// headerCarrier reads and writes the trace headers of a request for the propagator
+type headerCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+func (h headerCarrier) Get(key string) string {
+	return string(h.header.Peek(key))
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h.header.Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, h.header.Len())
+	h.header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// responseStatus returns the status of the response to a request served with err
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	// the error handler has not written the response yet
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// errorResponse is the body of the responses the middleware rejects requests with
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// sendError responds with code and message
+func sendError(c *fiber.Ctx, code int, message string) error {
+	return c.Status(code).JSON(errorResponse{Error: message})
+}
@@ -0,0 +1,253 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"library/logging"
+	"library/tracing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// signToken returns an HS256 token for the user with the given role
+func signToken(t *testing.T, key, userID, role string, expires time.Time) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, userClaims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	}).SignedString([]byte(key))
+	require.NoError(t, err)
+	return token
+}
+
+func TestAuthenticate(t *testing.T) {
+	app := fiber.New()
+	app.Use(Authenticate("s3cret"))
+	app.Get("/whoami", func(c *fiber.Ctx) error {
+		return c.SendString(c.Get(HeaderUserID) + "/" + c.Get(HeaderUserRole))
+	})
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		body   string
+	}{
+		{"valid token", signToken(t, "s3cret", "42", "admin", time.Now().Add(time.Hour)), 200, "42/admin"},
+		{"anonymous", "", 200, "/"},
+		{"wrong key", signToken(t, "other", "42", "admin", time.Now().Add(time.Hour)), 401, ""},
+		{"expired", signToken(t, "s3cret", "42", "admin", time.Now().Add(-time.Hour)), 401, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/whoami", nil)
+			// the headers are never taken from the caller once tokens are checked
+			req.Header.Set(HeaderUserID, "7")
+			req.Header.Set(HeaderUserRole, "admin")
+			if tt.token != "" {
+				req.Header.Set(fiber.HeaderAuthorization, "Bearer "+tt.token)
+			}
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			if tt.status == 200 {
+				assert.Equal(t, tt.body, readBody(t, resp))
+			}
+		})
+	}
+}
+
+func TestAuthenticate_NoKey(t *testing.T) {
+	app := fiber.New()
+	app.Use(Authenticate(""))
+	app.Get("/whoami", func(c *fiber.Ctx) error {
+		return c.SendString(c.Get(HeaderUserID) + "/" + c.Get(HeaderUserRole))
+	})
+
+	req := httptest.NewRequest("GET", "/whoami", nil)
+	req.Header.Set(HeaderUserID, "7")
+	req.Header.Set(HeaderUserRole, "member")
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "7/member", readBody(t, resp))
+}
+
+func TestRequireSelfOrRole(t *testing.T) {
+	app := fiber.New()
+	app.Get("/users/:id", RequireSelfOrRole("admin"), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		userID string
+		role   string
+		status int
+	}{
+		{"self", "7", "member", 204},
+		{"other user", "8", "member", 403},
+		{"admin", "8", "admin", 204},
+		{"anonymous", "", "", 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/users/7", nil)
+			req.Header.Set(HeaderUserID, tt.userID)
+			req.Header.Set(HeaderUserRole, tt.role)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	calls := 0
+	app := fiber.New()
+	app.Get("/items/:id", Cache(CacheConfig{Expiration: time.Minute}), func(c *fiber.Ctx) error {
+		calls++
+		if c.Params("id") == "missing" {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		return c.SendString(c.Get(HeaderUserRole))
+	})
+
+	get := func(path, role string) string {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(HeaderUserRole, role)
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+		return readBody(t, resp)
+	}
+	assert.Equal(t, "member", get("/items/1", "member"))
+	assert.Equal(t, "member", get("/items/1", "member"))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "admin", get("/items/1", "admin"), "responses are cached per caller")
+	assert.Equal(t, 2, calls)
+
+	get("/items/missing", "member")
+	get("/items/missing", "member")
+	assert.Equal(t, 4, calls, "failed responses are not cached")
+}
+
+func TestRequestLogger(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logging.New(&logs, slog.LevelInfo))
+
+	app := fiber.New()
+	app.Use(RequestLogger())
+	app.Get("/api/v1/items/:id", func(c *fiber.Ctx) error {
+		logging.FromContext(c.UserContext()).Info("handled")
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	req := httptest.NewRequest("GET", "/api/v1/items/3", nil)
+	req.Header.Set(HeaderRequestID, "req-1")
+	req.Header.Set(HeaderUserID, "42")
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "req-1", resp.Header.Get(HeaderRequestID))
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	assert.Len(t, lines, 2)
+	var handled, request map[string]any
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &handled))
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &request))
+	assert.Equal(t, "req-1", handled["request_id"])
+	assert.Equal(t, "42", handled["user_id"])
+	assert.Equal(t, "request", request["msg"])
+	assert.Equal(t, "req-1", request["request_id"])
+	assert.Equal(t, "GET", request["method"])
+	assert.Equal(t, "/api/v1/items/:id", request["route"])
+	assert.Equal(t, "/api/v1/items/3", request["path"])
+	assert.Equal(t, float64(204), request["status"])
+}
+
+func TestRequestLogger_GeneratesID(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logging.New(&logs, slog.LevelInfo))
+
+	app := fiber.New()
+	app.Use(RequestLogger())
+	app.Get("/api/v1/items/:id", func(c *fiber.Ctx) error {
+		return fiber.ErrNotFound
+	})
+
+	req := httptest.NewRequest("GET", "/api/v1/items/3", nil)
+	req.Header.Set(HeaderRequestID, strings.Repeat("x", 200))
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	requestID := resp.Header.Get(HeaderRequestID)
+	assert.Len(t, requestID, 36)
+
+	var request map[string]any
+	assert.Nil(t, json.Unmarshal(logs.Bytes(), &request))
+	assert.Equal(t, requestID, request["request_id"])
+	assert.Equal(t, float64(404), request["status"])
+	assert.Equal(t, "INFO", request["level"])
+}
+
+func TestTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracing.SetDefault(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer tracing.SetDefault(noop.NewTracerProvider())
+
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logging.New(&logs, slog.LevelInfo))
+
+	app := fiber.New()
+	app.Use(Trace(), RequestLogger())
+	app.Get("/api/v1/items/:id", func(c *fiber.Ctx) error {
+		return fiber.ErrBadGateway
+	})
+
+	req := httptest.NewRequest("GET", "/api/v1/items/3", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 502, resp.StatusCode)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "GET /api/v1/items/:id", spans[0].Name())
+	assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.Contains(t, spans[0].Attributes(), attribute.Int("http.response.status_code", 502))
+	assert.Equal(t, sdktrace.Status{Code: codes.Error, Description: "Bad Gateway"}, spans[0].Status())
+
+	var request map[string]any
+	assert.Nil(t, json.Unmarshal(logs.Bytes(), &request))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", request["trace_id"])
+}
+
+// readBody returns the body of resp as a string
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
@@ -0,0 +1,114 @@
+// Package tracing sets up OpenTelemetry for the services and starts their spans
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporter kinds accepted by New
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterMemory = "memory"
+)
+
+// scope names the instrumentation the spans of the service are recorded with
+const scope = "app"
+
+// Config selects where the spans of a service are exported
+type Config struct {
+	// Exporter is one of the Exporter constants, empty disables tracing
+	Exporter string
+	// Endpoint is the base URL of the OTLP/HTTP collector, e.g. http://otel-collector:4318
+	Endpoint string
+	// Service names the service in the exported spans
+	Service string
+}
+
+// propagator passes the span context across services in the W3C traceparent header
+var propagator = propagation.TraceContext{}
+
+// New creates the tracer provider described by config, which exports the spans in batches
+// until it is shut down. It is nil when tracing is disabled.
+func New(ctx context.Context, config Config) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	switch config.Exporter {
+	case "":
+		return nil, nil
+	case ExporterOTLP:
+		if config.Endpoint == "" {
+			return nil, fmt.Errorf("the %s exporter needs an endpoint", config.Exporter)
+		}
+		// the endpoint is the base URL of the collector, as OTEL_EXPORTER_OTLP_ENDPOINT is
+		url := strings.TrimSuffix(config.Endpoint, "/") + "/v1/traces"
+		otlp, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(url))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the %s exporter: %w", config.Exporter, err)
+		}
+		exporter = otlp
+	case ExporterStdout:
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the %s exporter: %w", config.Exporter, err)
+		}
+		exporter = stdout
+	case ExporterMemory:
+		exporter = tracetest.NewInMemoryExporter()
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", config.Exporter)
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", config.Service))),
+	), nil
+}
+
+// SetDefault makes provider the one spans are started with and the span context
+// propagated in the traceparent header
+func SetDefault(provider trace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+}
+
+// Start starts a span, the child of the span in ctx, with the default tracer provider
+// and returns a copy of ctx carrying it. The span does nothing with tracing disabled.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(scope).Start(ctx, name, opts...)
+}
+
+// RecordError marks span failed with err, a nil err is ignored
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Extract returns a copy of ctx carrying the span context received from a caller in
+// carrier, the spans started from it join the trace of the caller
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return propagator.Extract(ctx, carrier)
+}
+
+// NewTransport returns a transport making every request through base in a client span
+// and passing the trace on in the traceparent header. A nil base is http.DefaultTransport.
+func NewTransport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base, otelhttp.WithPropagators(propagator))
+}
@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestNew(t *testing.T) {
+	provider, err := New(context.Background(), Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, provider)
+
+	provider, err = New(context.Background(), Config{Exporter: ExporterMemory, Service: "book-service"})
+	assert.Nil(t, err)
+	assert.NotNil(t, provider)
+	assert.Nil(t, provider.Shutdown(context.Background()))
+
+	_, err = New(context.Background(), Config{Exporter: ExporterOTLP})
+	assert.EqualError(t, err, "the otlp exporter needs an endpoint")
+
+	_, err = New(context.Background(), Config{Exporter: "jaeger"})
+	assert.EqualError(t, err, `unknown trace exporter "jaeger"`)
+}
+
+func TestStart(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	SetDefault(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer SetDefault(noop.NewTracerProvider())
+
+	ctx := Extract(context.Background(), propagation.MapCarrier{"traceparent": traceparent})
+	_, span := Start(ctx, "BooksService.GetBook")
+	RecordError(span, errors.New("book not found"))
+	span.End()
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.Equal(t, sdktrace.Status{Code: codes.Error, Description: "book not found"}, spans[0].Status())
+}
+
+func TestNewTransport(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	SetDefault(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer SetDefault(noop.NewTracerProvider())
+
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	ctx, parent := Start(context.Background(), "job relay events")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, nil)
+	resp, err := (&http.Client{Transport: NewTransport(nil)}).Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	parent.End()
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	client := spans[0]
+	assert.Equal(t, trace.SpanKindClient, client.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), client.Parent().SpanID())
+	// the server joins the trace as a child of the client span
+	sc := trace.SpanContextFromContext(Extract(context.Background(), propagation.MapCarrier{"traceparent": received}))
+	assert.Equal(t, client.SpanContext().TraceID(), sc.TraceID())
+	assert.Equal(t, client.SpanContext().SpanID(), sc.SpanID())
+}